@@ -21,6 +21,7 @@
 package starx
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -42,6 +43,8 @@ type acceptor struct {
 	sessionMap map[int64]*session.Session // backend sessions
 	f2bMap     map[int64]int64            // frontend session id -> backend session id map
 	b2fMap     map[int64]int64            // backend session id -> frontend session id map
+	tasks      chan func()                // tasks which will be executed on logic goroutine
+	die        chan bool                  // closed when acceptor closed
 	lastTime   int64                      // last heartbeat unix time stamp
 }
 
@@ -54,6 +57,8 @@ func newAcceptor(id int64, conn net.Conn) *acceptor {
 		sessionMap: make(map[int64]*session.Session),
 		f2bMap:     make(map[int64]int64),
 		b2fMap:     make(map[int64]int64),
+		tasks:      make(chan func(), packetBufferSize),
+		die:        make(chan bool),
 		lastTime:   time.Now().Unix(),
 	}
 }
@@ -78,13 +83,19 @@ func (a *acceptor) Session(sid int64) *session.Session {
 	a.sessionMap[s.ID] = s
 	a.f2bMap[sid] = s.ID
 	a.b2fMap[s.ID] = sid
+	events.emit(&EventArgs{Event: SessionCreated, Session: s})
 	return s
 }
 
 func (a *acceptor) Close() {
+	if a.status == statusClosed {
+		return
+	}
 	a.status = statusClosed
+	close(a.die)
+	// sessions are closed since the connection from frontend lost
 	for _, s := range a.sessionMap {
-		transporter.closeSession(s)
+		transporter.closeSession(s, session.CloseReadError)
 	}
 	transporter.removeAcceptor(a)
 	a.socket.Close()
@@ -99,6 +110,20 @@ func (a *acceptor) Send(data []byte) error {
 	return err
 }
 
+// Invoke push the task to the logic goroutine of the acceptor
+func (a *acceptor) Invoke(fn func()) error {
+	if a.status == statusClosed {
+		return ErrSessionClosed
+	}
+
+	select {
+	case a.tasks <- fn:
+		return nil
+	case <-a.die:
+		return ErrSessionClosed
+	}
+}
+
 func (a *acceptor) Push(session *session.Session, route string, v interface{}) error {
 	data, err := serializeOrRaw(v)
 	if err != nil {
@@ -109,7 +134,7 @@ func (a *acceptor) Push(session *session.Session, route string, v interface{}) e
 
 	rs, err := transporter.acceptor(session.Entity.ID())
 	if err != nil {
-		log.Errorf(err.Error())
+		log.Error(err.Error())
 		return err
 	}
 
@@ -120,10 +145,11 @@ func (a *acceptor) Push(session *session.Session, route string, v interface{}) e
 	}
 
 	resp := &rpc.Response{
-		Route: route,
-		Kind:  rpc.HandlerPush,
-		Data:  data,
-		Sid:   sid,
+		Route:   route,
+		Kind:    rpc.HandlerPush,
+		Data:    data,
+		Sid:     sid,
+		TraceID: session.TraceID,
 	}
 	return rpc.WriteResponse(a.socket, resp)
 }
@@ -139,7 +165,7 @@ func (a *acceptor) Response(session *session.Session, v interface{}) error {
 
 	rs, err := transporter.acceptor(session.Entity.ID())
 	if err != nil {
-		log.Errorf(err.Error())
+		log.Error(err.Error())
 		return err
 	}
 
@@ -149,14 +175,15 @@ func (a *acceptor) Response(session *session.Session, v interface{}) error {
 		return ErrSidNotExists
 	}
 	resp := &rpc.Response{
-		Kind: rpc.HandlerResponse,
-		Data: data,
-		Sid:  sid,
+		Kind:    rpc.HandlerResponse,
+		Data:    data,
+		Sid:     sid,
+		TraceID: session.TraceID,
 	}
 	return rpc.WriteResponse(a.socket, resp)
 }
 
-func (a *acceptor) Call(session *session.Session, route string, reply interface{}, args ...interface{}) error {
+func (a *acceptor) Call(ctx context.Context, session *session.Session, route string, reply interface{}, args ...interface{}) error {
 	r, err := routelib.Decode(route)
 	if err != nil {
 		return err
@@ -166,12 +193,16 @@ func (a *acceptor) Call(session *session.Session, route string, reply interface{
 		return ErrRPCLocal
 	}
 
+	if env.single {
+		return ErrSingleProcess
+	}
+
 	data, err := gobEncode(args...)
 	if err != nil {
 		return err
 	}
 
-	ret, err := cluster.Call(rpc.User, r, session, data)
+	ret, err := cluster.Call(ctx, rpc.User, r, session, data)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,347 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+const adminExecRoute = "__Admin.Exec"
+
+// default host of admin server, admin server should not be exposed to
+// the network which clients connect from
+const defaultAdminHost = "127.0.0.1"
+
+var kickPacket, _ = packet.Pack(&packet.Packet{Type: packet.Kick})
+
+// adminRoute is requested over the rpc mesh to execute admin commands on peers
+var adminRoute = &route.Route{Service: "__Admin", Method: "Exec"}
+
+// adminSession represents a connected session in admin console
+type adminSession struct {
+	ID       int64  `json:"id"`
+	Uid      int64  `json:"uid"`
+	Remote   string `json:"remote"`
+	LastTime int64  `json:"last_time"`
+}
+
+// adminCommand represents an endpoint of admin server, which can be executed
+// on peers over the rpc mesh
+type adminCommand struct {
+	method string
+	fn     func(form url.Values) (interface{}, error)
+}
+
+// adminRequest represents an admin command sent to peers
+type adminRequest struct {
+	Path string     `json:"path"`
+	Form url.Values `json:"form"`
+}
+
+var adminCommands = map[string]*adminCommand{
+	"/sessions": {"GET", func(url.Values) (interface{}, error) {
+		return adminSessions(), nil
+	}},
+	"/services": {"GET", func(url.Values) (interface{}, error) {
+		return adminServices(), nil
+	}},
+	"/stats": {"GET", func(url.Values) (interface{}, error) {
+		return Stats(), nil
+	}},
+	"/cluster": {"GET", func(url.Values) (interface{}, error) {
+		return Cluster(), nil
+	}},
+	"/kick": {"POST", func(form url.Values) (interface{}, error) {
+		uid, err := strconv.ParseInt(form.Get("uid"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if uid < 1 {
+			return nil, session.ErrIllegalUID
+		}
+		return map[string]int{"kicked": adminKick(uid)}, nil
+	}},
+	"/loglevel": {"POST", func(form url.Values) (interface{}, error) {
+		level := form.Get("level")
+		if err := log.SetLevelByName(level); err != nil {
+			return nil, err
+		}
+		log.Infof("log level changed to %s by admin console", level)
+		return map[string]string{"level": level}, nil
+	}},
+}
+
+// Admin console for operators, every node which has an admin port in
+// servers config serve a group of http endpoints on the admin host, which
+// is loopback by default:
+//
+//	GET  /sessions           all connected sessions of current node
+//	GET  /services           registered handler and remote routes
+//	GET  /cluster            cluster topology, with the live state of peers
+//	GET  /stats              traffic statistics of current node
+//	GET  /ready              readiness probe, 503 until current server is
+//	                         serving, with the rpc connection state of peers
+//	POST /kick?uid=1         kick all sessions bound to the uid
+//	POST /loglevel?level=... adjust log level at runtime
+//
+// endpoints that prefixed with `/cluster/` execute the command on all nodes
+// in cluster over the rpc mesh, e.g. /cluster/sessions, results are grouped
+// by server id, frontend servers are reachable only if rpc port set.
+// All endpoints except /ready require the token set by SetAdminToken in
+// the header `Authorization: Bearer <token>`, and are forbidden if no token
+// set.
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	for path, cmd := range adminCommands {
+		mux.HandleFunc(path, adminOnly(cmd))
+	}
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		ready := checkReady()
+		w.Header().Set("Content-Type", "application/json")
+		if !ready.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(ready)
+	})
+	mux.HandleFunc("/cluster/", func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(w, r) {
+			return
+		}
+		path := r.URL.Path[len("/cluster"):]
+		cmd, ok := adminCommands[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if !adminMethodAllowed(w, r, cmd) {
+			return
+		}
+		r.ParseForm()
+		writeAdminResult(w, adminBroadcast(&adminRequest{Path: path, Form: r.Form}), nil)
+	})
+	return mux
+}
+
+func adminOnly(cmd *adminCommand) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(w, r) || !adminMethodAllowed(w, r, cmd) {
+			return
+		}
+		r.ParseForm()
+		v, err := cmd.fn(r.Form)
+		writeAdminResult(w, v, err)
+	}
+}
+
+func adminMethodAllowed(w http.ResponseWriter, r *http.Request, cmd *adminCommand) bool {
+	if r.Method != cmd.method {
+		w.Header().Set("Allow", cmd.method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// adminAuthorized check the token carried by request, and respond error if
+// the token mismatched
+func adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	token := env.adminToken
+	if token == "" {
+		http.Error(w, "admin token not set", http.StatusForbidden)
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func writeAdminResult(w http.ResponseWriter, v interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		v = map[string]string{"error": err.Error()}
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func adminSessions() []adminSession {
+	sessions := make([]adminSession, 0, transporter.count())
+	transporter.rangeAgents(func(a *agent) bool {
+		sessions = append(sessions, adminSession{
+			ID:       a.session.ID,
+			Uid:      a.session.Uid,
+			Remote:   a.socket.RemoteAddr().String(),
+			LastTime: a.lastTime,
+		})
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+func adminServices() map[string][]string {
+	routes := map[string][]string{
+		"handler": {},
+		"remote":  {},
+	}
+	handler.RLock()
+	for sname, s := range handler.serviceMap {
+		for mname := range s.HandlerMethods {
+			routes["handler"] = append(routes["handler"], sname+"."+mname)
+		}
+	}
+	handler.RUnlock()
+
+	remote.RLock()
+	defer remote.RUnlock()
+	for sname, s := range remote.serviceMap {
+		for mname := range s.HandlerMethods {
+			routes["handler"] = append(routes["handler"], sname+"."+mname)
+		}
+		for mname := range s.RemoteMethods {
+			routes["remote"] = append(routes["remote"], sname+"."+mname)
+		}
+	}
+	for _, r := range routes {
+		sort.Strings(r)
+	}
+	return routes
+}
+
+// adminKick disconnect all sessions bound to the uid, and returns
+// the number of sessions that have been kicked
+func adminKick(uid int64) int {
+	var agents []*agent
+	transporter.rangeAgents(func(a *agent) bool {
+		if a.session.Uid == uid {
+			agents = append(agents, a)
+		}
+		return true
+	})
+
+	for _, a := range agents {
+		a := a
+		a.Invoke(func() {
+			kick := a.controlPacket(packet.Kick, kickPacket)
+			a.sniffOutbound(kick)
+			a.socket.Write(kick)
+			a.close(false, session.CloseKicked)
+		})
+	}
+	return len(agents)
+}
+
+// adminBroadcast execute the command on all nodes, current node executes it
+// locally, and peers are requested over the rpc mesh
+func adminBroadcast(req *adminRequest) map[string]interface{} {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]interface{})
+	)
+	for _, svr := range cluster.Servers() {
+		wg.Add(1)
+		go func(svr *cluster.ServerConfig) {
+			defer wg.Done()
+			var (
+				v   interface{}
+				err error
+			)
+			if app.config != nil && svr.Id == app.config.Id {
+				v, err = adminExec(data)
+			} else {
+				v, err = cluster.CallServer(context.Background(), svr.Id, adminRoute, data)
+			}
+			if err != nil {
+				v = map[string]string{"error": err.Error()}
+			} else if raw, ok := v.([]byte); ok {
+				v = json.RawMessage(raw)
+			}
+			mu.Lock()
+			results[svr.Id] = v
+			mu.Unlock()
+		}(svr)
+	}
+	wg.Wait()
+	return results
+}
+
+// adminExec execute the admin command requested by peer, and returns the
+// result encoded in json
+func adminExec(data []byte) ([]byte, error) {
+	req := &adminRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	cmd, ok := adminCommands[req.Path]
+	if !ok {
+		return nil, fmt.Errorf("unknown admin command %s", req.Path)
+	}
+	v, err := cmd.fn(req.Form)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func serveAdmin() {
+	host := app.config.AdminHost
+	if host == "" {
+		host = defaultAdminHost
+	}
+	addr := fmt.Sprintf("%s:%d", host, app.config.AdminPort)
+	if env.adminToken == "" {
+		log.Warnf("admin token not set, only readiness probe served by admin server")
+	}
+	listener, err := upgrader.listenTCP(addr)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	log.Infof("admin server listen at %s", addr)
+	if err := http.Serve(listener, adminHandler()); err != nil && !upgrader.isUpgrading() {
+		log.Error(err.Error())
+	}
+}
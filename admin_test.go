@@ -0,0 +1,192 @@
+package starx
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
+)
+
+const testAdminToken = "admin-token"
+
+// newAdminRequest returns a request carrying the admin token
+func newAdminRequest(method, target string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return r
+}
+
+func TestAdminAuth(t *testing.T) {
+	w := httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("GET", "/sessions", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("admin should be forbidden without token set, got: %d", w.Code)
+	}
+
+	SetAdminToken(testAdminToken)
+	defer SetAdminToken("")
+
+	w = httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, httptest.NewRequest("POST", "/kick?uid=1", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("request without token should be rejected, got: %d", w.Code)
+	}
+
+	r := httptest.NewRequest("POST", "/cluster/kick?uid=1", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("request with wrong token should be rejected, got: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("GET", "/sessions", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	SetAdminToken(testAdminToken)
+	defer SetAdminToken("")
+
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	defer a.Close()
+	a.session.Bind(100)
+
+	w := httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("GET", "/sessions", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var sessions []adminSession
+	if err := json.NewDecoder(w.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sessions {
+		if s.ID == a.session.ID && s.Uid == 100 {
+			return
+		}
+	}
+	t.Fatalf("session %d not found in %v", a.session.ID, sessions)
+}
+
+func TestAdminKick(t *testing.T) {
+	SetAdminToken(testAdminToken)
+	defer SetAdminToken("")
+
+	c, peer := net.Pipe()
+	a := transporter.createAgent(c)
+	a.session.Bind(200)
+
+	w := httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("POST", "/kick?uid=200", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	go (<-a.tasks)()
+	buf := make([]byte, len(kickPacket))
+	if _, err := peer.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf[0] != packet.Kick {
+		t.Fatalf("expect kick packet, got: %v", buf)
+	}
+
+	w = httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("POST", "/kick?uid=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("illegal uid should be rejected, got: %d", w.Code)
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	SetAdminToken(testAdminToken)
+	defer SetAdminToken("")
+	defer log.SetLevel(log.LevelInfo)
+
+	w := httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("GET", "/loglevel?level=debug", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("POST", "/loglevel?level=unknown", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("POST", "/loglevel?level=debug", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+func TestAdminCluster(t *testing.T) {
+	SetAdminToken(testAdminToken)
+	defer SetAdminToken("")
+	cluster.SetAppConfig(app.config)
+
+	// the peer serves rpc in current process
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serve(l, remote.handle, acceptRPCConn)
+
+	cluster.Register(&cluster.ServerConfig{Type: "admin-gate", Id: "admin-gate-1", Host: "127.0.0.1", Port: 1, IsFrontend: true, RpcPort: l.Addr().(*net.TCPAddr).Port})
+	cluster.Register(&cluster.ServerConfig{Type: "admin-gate", Id: "admin-gate-2", Host: "127.0.0.1", Port: 2, IsFrontend: true})
+	defer cluster.RemoveServer("admin-gate-1")
+	defer cluster.RemoveServer("admin-gate-2")
+
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	defer a.Close()
+	a.session.Bind(300)
+
+	w := httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("GET", "/cluster/sessions", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var results map[string]json.RawMessage
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	var sessions []adminSession
+	if err := json.Unmarshal(results["admin-gate-1"], &sessions); err != nil {
+		t.Fatalf("sessions of peer should be queried over rpc, got: %s", results["admin-gate-1"])
+	}
+	found := false
+	for _, s := range sessions {
+		found = found || s.ID == a.session.ID
+	}
+	if !found {
+		t.Fatalf("session %d not found in %v", a.session.ID, sessions)
+	}
+
+	var failure map[string]string
+	if err := json.Unmarshal(results["admin-gate-2"], &failure); err != nil || failure["error"] == "" {
+		t.Fatalf("frontend without rpc port should report error, got: %s", results["admin-gate-2"])
+	}
+
+	w = httptest.NewRecorder()
+	adminHandler().ServeHTTP(w, newAdminRequest("GET", "/cluster/kick?uid=300", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("method of command should be checked, got: %d", w.Code)
+	}
+}
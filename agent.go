@@ -21,15 +21,20 @@
 package starx
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/lonnng/starx/cluster"
 	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/encrypt"
 	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/metrics"
 	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/ratelimit"
 	routelib "github.com/lonnng/starx/route"
 	"github.com/lonnng/starx/session"
 )
@@ -38,19 +43,39 @@ var (
 	ErrRPCLocal          = errors.New("RPC object must location in different server type")
 	ErrSidNotExists      = errors.New("sid not exists")
 	ErrSendChannelClosed = errors.New("agent send channel closed")
+	ErrRPCTimeout        = rpc.ErrTimeout
+	ErrSessionClosed     = errors.New("session closed")
 )
 
+// maxBatchSize is the maximum bytes of packets coalesced in one write
+const maxBatchSize = 64 * 1024
+
 // Agent corresponding a user, used for store raw socket information
 // only used in package internal, can not accessible by other package
 type agent struct {
-	id         int64
-	socket     net.Conn
-	status     networkStatus
-	session    *session.Session
-	sendBuffer chan []byte
-	recvBuffer chan *packet.Packet
-	die        chan bool
-	lastTime   int64 // last heartbeat unix time stamp
+	stats         agentStats // keep 64-bit aligned for atomic operations
+	id            int64
+	socket        net.Conn
+	status        networkStatus
+	session       *session.Session
+	sendBuffer    chan []byte // outbound packets of normal priority
+	highBuffer    chan []byte // outbound packets of high priority
+	lowBuffer     chan []byte // outbound packets of low priority
+	recvBuffer    chan *packet.Packet
+	tasks         chan func() // tasks which will be executed on logic goroutine
+	die           chan bool
+	lastTime      int64                        // last heartbeat unix time stamp
+	compress      bool                         // message data compression negotiated in handshake
+	limiters      map[string]*ratelimit.Bucket // rate limiters of routes
+	limitsVersion int                          // version of rate limits which limiters built from
+	cipher        *encrypt.Cipher              // encrypt packet data, key exchanged in handshake
+	token         string                       // resume token issued in handshake
+	codec         packet.Codec                 // packet codec of listener, nil means default codec
+	batch         *batcher                     // aggregate pushes, nil if batch not negotiated
+	egress        *ratelimit.Bucket            // egress limit of outbound bytes, created by writer
+	throttled     int32                        // 1 when writer waiting for egress limit, updated with atomics
+	controls      int32                        // control packets queued in receive buffer, updated with atomics
+	waiting       bool                         // remote call of last message in flight, only accessed in logic goroutine
 }
 
 // Create new agent instance
@@ -60,10 +85,14 @@ func newAgent(conn net.Conn) *agent {
 		status:     statusStart,
 		lastTime:   time.Now().Unix(),
 		sendBuffer: make(chan []byte, packetBufferSize),
+		highBuffer: make(chan []byte, packetBufferSize),
+		lowBuffer:  make(chan []byte, packetBufferSize),
 		recvBuffer: make(chan *packet.Packet, packetBufferSize),
+		tasks:      make(chan func(), packetBufferSize),
 		die:        make(chan bool, 1),
 	}
 	s := session.New(a)
+	s.Remote = conn.RemoteAddr().String()
 	a.session = s
 	a.id = s.ID
 
@@ -79,16 +108,27 @@ func (a *agent) String() string {
 }
 
 func (a *agent) heartbeat() {
-	a.lastTime = time.Now().Unix()
+	atomic.StoreInt64(&a.lastTime, time.Now().Unix())
 }
 
 func (a *agent) Close() {
+	a.close(false, session.CloseServer)
+}
+
+// disconnect close the agent when connection lost, the session will be
+// suspended for resuming if resume enabled
+func (a *agent) disconnect(reason session.CloseReason) {
+	a.close(true, reason)
+}
+
+func (a *agent) close(resumable bool, reason session.CloseReason) {
 	if a.status == statusClosed {
 		return
 	}
 
+	working := a.status == statusWorking
 	a.status = statusClosed
-	log.Debugf("Session closed, Id=%d, IP=%s", a.session.ID, a.socket.RemoteAddr())
+	sessionLogger(a.session).Debugf("session closed, remote=%s", a.socket.RemoteAddr())
 
 	a.die <- true
 
@@ -96,8 +136,15 @@ func (a *agent) Close() {
 	close(a.die)
 	close(a.recvBuffer)
 	close(a.sendBuffer)
+	close(a.highBuffer)
+	close(a.lowBuffer)
 
-	transporter.closeSession(a.session)
+	// the reason is kept for the suspended session, which will be closed
+	// when grace period expired
+	a.session.CloseReason = reason
+	if !(resumable && working && resumes.suspend(a)) {
+		transporter.closeSession(a.session, reason)
+	}
 	a.socket.Close()
 }
 
@@ -123,6 +170,88 @@ func (a *agent) Send(data []byte) (err error) {
 	return
 }
 
+// write drain the send buffer, packets pending in the buffer will be coalesced
+// into one write to reduce syscalls, when flush interval was set, writer will
+// wait for the interval to gather more packets before flush
+func (a *agent) write() {
+	var (
+		buf   []byte
+		count int
+		flush <-chan time.Time
+	)
+
+	for {
+		data, ok, flushed := a.next(flush)
+		if !ok {
+			return
+		}
+		if !flushed {
+			a.sniffOutbound(data)
+			buf = append(buf, data...)
+			count++
+			if len(buf) < maxBatchSize {
+				// more packets pending, coalesce them
+				if a.queued() > 0 {
+					continue
+				}
+				if env.flushInterval > 0 {
+					if flush == nil {
+						flush = time.After(env.flushInterval)
+					}
+					continue
+				}
+			}
+		}
+
+		if err := a.throttle(len(buf)); err != nil {
+			sessionLogger(a.session).Warnf("%s, session will be closed", err.Error())
+			a.discard()
+			return
+		}
+
+		if d := writeTimeout(); d > 0 {
+			a.socket.SetWriteDeadline(time.Now().Add(d))
+		}
+		n, err := a.socket.Write(buf)
+		metrics.PacketsSent.Add(int64(count))
+		metrics.BytesSent.Add(int64(n))
+		atomic.AddInt64(&a.stats.packetsOut, int64(count))
+		atomic.AddInt64(&a.stats.bytesOut, int64(n))
+		if err != nil {
+			sessionLogger(a.session).Errorf("write message error: %s, session will be closed", err.Error())
+			a.discard()
+			return
+		}
+
+		buf, count, flush = buf[:0], 0, nil
+	}
+}
+
+// discard close the socket, read loop will close the agent when socket
+// closed, drain the buffer until then to make sure that senders never blocked
+func (a *agent) discard() {
+	a.socket.Close()
+	for {
+		if _, ok, _ := a.next(nil); !ok {
+			return
+		}
+	}
+}
+
+// Invoke push the task to the logic goroutine of the agent
+func (a *agent) Invoke(fn func()) error {
+	if a.status == statusClosed {
+		return ErrSessionClosed
+	}
+
+	select {
+	case a.tasks <- fn:
+		return nil
+	case <-a.die:
+		return ErrSessionClosed
+	}
+}
+
 func (a *agent) Push(session *session.Session, route string, v interface{}) error {
 	data, err := serializeOrRaw(v)
 	if err != nil {
@@ -146,7 +275,13 @@ func (a *agent) Response(session *session.Session, v interface{}) error {
 	return transporter.response(session, data)
 }
 
-func (a *agent) Call(session *session.Session, route string, reply interface{}, args ...interface{}) error {
+func (a *agent) Call(ctx context.Context, session *session.Session, route string, reply interface{}, args ...interface{}) error {
+	return userCall(ctx, session, route, reply, args...)
+}
+
+// userCall call the remote method of route with the session, which is not
+// served by current server
+func userCall(ctx context.Context, session *session.Session, route string, reply interface{}, args ...interface{}) error {
 	r, err := routelib.Decode(route)
 	if err != nil {
 		return err
@@ -156,12 +291,16 @@ func (a *agent) Call(session *session.Session, route string, reply interface{},
 		return ErrRPCLocal
 	}
 
+	if env.single {
+		return ErrSingleProcess
+	}
+
 	data, err := gobEncode(args...)
 	if err != nil {
 		return err
 	}
 
-	ret, err := cluster.Call(rpc.User, r, session, data)
+	ret, err := cluster.Call(ctx, rpc.User, r, session, data)
 	if err != nil {
 		return err
 	}
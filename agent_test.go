@@ -0,0 +1,50 @@
+package starx
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAgentWriteCoalesce(t *testing.T) {
+	c, peer := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+
+	a.Send([]byte("hello"))
+	a.Send([]byte("world"))
+	go a.write()
+
+	buf := make([]byte, 64)
+	n, err := peer.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], []byte("helloworld")) {
+		t.Fatalf("pending packets should be written at once, got: %s", buf[:n])
+	}
+}
+
+func TestAgentWriteFlushInterval(t *testing.T) {
+	SetFlushInterval(20 * time.Millisecond)
+	defer SetFlushInterval(0)
+
+	c, peer := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+	go a.write()
+
+	a.Send([]byte("hello"))
+	time.Sleep(5 * time.Millisecond)
+	a.Send([]byte("world"))
+
+	buf := make([]byte, 64)
+	n, err := peer.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], []byte("helloworld")) {
+		t.Fatalf("packets in flush interval should be written at once, got: %s", buf[:n])
+	}
+}
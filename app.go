@@ -26,10 +26,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
+	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/lonnng/starx/cluster"
 	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/metrics"
 )
 
 func welcomeMsg() {
@@ -38,6 +41,38 @@ func welcomeMsg() {
 
 func startup() {
 	startupComps()
+	crons.start()
+	events.watchPeers()
+	if env.single {
+		warnSingle()
+	} else {
+		discovery.watch()
+	}
+	watchReload()
+	watchUpgrade()
+	watchTopology()
+	events.emit(&EventArgs{Event: ServerStarted, Server: app.config})
+
+	if env.metricsAddr != "" {
+		go serveMetrics(env.metricsAddr)
+	}
+
+	if app.config.AdminPort > 0 {
+		go serveAdmin()
+	}
+
+	if app.config.IsFrontend && app.config.RpcPort > 0 {
+		go listenAndServeRPC()
+	}
+
+	if env.consolePath != "" {
+		if l, err := listenConsole(env.consolePath); err != nil {
+			log.Errorf("debug console error: %s", err.Error())
+		} else {
+			defer closeConsole(l)
+			go serveConsole(l)
+		}
+	}
 
 	go func() {
 		if app.config.IsWebsocket {
@@ -47,6 +82,16 @@ func startup() {
 		}
 	}()
 
+	if app.config.IsFrontend {
+		for _, lc := range app.config.Listeners {
+			go func(lc *cluster.ListenerConfig) {
+				if err := serveListener(lc); err != nil {
+					log.Errorf("listener(port: %d) error: %s", lc.Port, err.Error())
+				}
+			}(lc)
+		}
+	}
+
 	sg := make(chan os.Signal)
 	signal.Notify(sg, syscall.SIGINT)
 
@@ -58,56 +103,114 @@ func startup() {
 		log.Infof("got signal: %v", s)
 	}
 
-	log.Infof("server: " + app.config.Id + " is stopping...")
+	log.Info("server: " + app.config.Id + " is stopping...")
 
 	// shutdown all components registered by application, that
-	// call by reverse order against register
+	// call by the same order against register
+	crons.stop()
 	shutdownComps()
+	closeRecorder()
+	closeCapture()
 }
 
 // Enable current server accept connection
 func listenAndServe() {
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", app.config.Host, app.config.Port))
+	listener, err := listen(fmt.Sprintf("%s:%d", app.config.Host, app.config.Port))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 	log.Infof("listen at %s:%d(%s)", app.config.Host, app.config.Port, app.config.String())
+	atomic.StoreInt32(&serving, 1)
+
+	if app.config.IsFrontend {
+		serve(listener, handler.handle, acceptConn)
+	} else {
+		serve(listener, remote.handle, acceptRPCConn)
+	}
+}
+
+// listenAndServeRPC serve rpc on the rpc port of frontend server, so peers
+// can reach it over the rpc mesh
+func listenAndServeRPC() {
+	addr := fmt.Sprintf("%s:%d", app.config.Host, app.config.RpcPort)
+	listener, err := listenTransport("tcp", addr)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	log.Infof("rpc listen at %s", addr)
+	serve(listener, remote.handle, acceptRPCConn)
+}
 
+// serve accept connections on the listener, and handle each connection in
+// a new goroutine, connections are refused if accept returns false
+func serve(listener net.Listener, handle func(net.Conn), accept func(net.Addr) bool) {
 	defer listener.Close()
+	var delay time.Duration // how long to sleep on accept failure
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Errorf(err.Error())
-			continue
+			// backoff on temporary error, e.g. too many open files,
+			// avoid spinning the accept loop
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else {
+					delay *= 2
+				}
+				if max := 1 * time.Second; delay > max {
+					delay = max
+				}
+				log.Errorf("accept error: %s, retrying in %v", err.Error(), delay)
+				time.Sleep(delay)
+				continue
+			}
+			log.Error(err.Error())
+			return
 		}
-		if app.config.IsFrontend {
-			go handler.handle(conn)
-		} else {
-			go remote.handle(conn)
+		delay = 0
+		if !accept(conn.RemoteAddr()) {
+			log.Debugf("connection from %s refused by filter", conn.RemoteAddr())
+			conn.Close()
+			continue
 		}
+		go handle(conn)
 	}
 }
 
-func listenAndServeWS() {
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin:     env.checkOrigin,
-	}
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Error(err)
-			return
+func serveMetrics(addr string) {
+	metrics.RegisterGaugeFunc("recv_queue_depth", "Packets waiting to be processed of all sessions.", func() float64 {
+		depth := 0
+		for _, n := range RecvQueueDepths() {
+			depth += n
 		}
-
-		handler.HandleWS(conn)
+		return float64(depth)
 	})
 
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	listener, err := upgrader.listenTCP(addr)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	log.Infof("metrics server listen at %s", addr)
+	if err := http.Serve(listener, mux); err != nil && !upgrader.isUpgrading() {
+		log.Error(err.Error())
+	}
+}
+
+func listenAndServeWS() {
+	http.HandleFunc("/", wsHandler(nil))
+
 	addr := fmt.Sprintf("%s:%d", app.config.Host, app.config.Port)
+	listener, err := upgrader.listenTCP(addr)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 	log.Infof("listen at %s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	atomic.StoreInt32(&serving, 1)
+	if err := http.Serve(listener, nil); err != nil && !upgrader.isUpgrading() {
 		log.Fatal(err.Error())
 	}
 }
@@ -0,0 +1,114 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	ErrAuthDisabled    = errors.New("authentication not enabled")
+	ErrUnauthenticated = errors.New("session not authenticated")
+)
+
+// Authenticator verify the token(e.g. JWT or opaque token) sent by client,
+// and returns the uid the token belongs to
+type Authenticator func(token string) (int64, error)
+
+type auth struct {
+	verify    Authenticator   // nil if sessions only bound by handlers
+	whitelist map[string]bool // routes available before authenticated
+	timeout   time.Duration   // unauthenticated session will be closed after timeout
+}
+
+// HTTPAuthenticator verify the token via http endpoint, the token will be
+// posted as form value `token`, and the endpoint should respond status 200
+// with json body like {"uid": 10000} when the token is valid
+func HTTPAuthenticator(endpoint string) Authenticator {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func(token string) (int64, error) {
+		resp, err := client.PostForm(endpoint, url.Values{"token": {token}})
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("auth endpoint respond status: %d", resp.StatusCode)
+		}
+		res := struct {
+			Uid int64 `json:"uid"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			return 0, err
+		}
+		return res.Uid, nil
+	}
+}
+
+// authenticate verify the token and bind the session to the resolved uid
+func authenticate(s *session.Session, token string) error {
+	if env.auth == nil || env.auth.verify == nil {
+		return ErrAuthDisabled
+	}
+	uid, err := env.auth.verify(token)
+	if err != nil {
+		return err
+	}
+	return s.Bind(uid)
+}
+
+// authorized check whether the session can access the route, unauthenticated
+// session can only access the routes in whitelist
+func (a *agent) authorized(route string) bool {
+	return env.auth == nil || a.session.Uid > 0 || env.auth.whitelist[route]
+}
+
+// routeSet returns the set of routes
+func routeSet(routes []string) map[string]bool {
+	set := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		set[r] = true
+	}
+	return set
+}
+
+// waitAuth close the session if it is not authenticated before timeout
+func (a *agent) waitAuth() {
+	if env.auth == nil || env.auth.timeout <= 0 || a.session.Uid > 0 {
+		return
+	}
+	time.AfterFunc(env.auth.timeout, func() {
+		a.Invoke(func() {
+			if a.session.Uid == 0 {
+				sessionLogger(a.session).Warnf("session not authenticated in %v, will be closed", env.auth.timeout)
+				a.Close()
+			}
+		})
+	})
+}
@@ -0,0 +1,126 @@
+package starx
+
+import (
+	encjson "encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestAuthHandshake(t *testing.T) {
+	EnableAuth(func(token string) (int64, error) {
+		if token != "valid" {
+			return 0, errors.New("invalid token")
+		}
+		return 5000, nil
+	}, []string{"Login.Login"}, 0)
+	defer func() { env.auth = nil }()
+
+	handshake := func(token string) (*agent, net.Conn) {
+		req, _ := encjson.Marshal(map[string]interface{}{
+			"user": map[string]interface{}{"token": token},
+		})
+		c, peer := net.Pipe()
+		a := newAgent(c)
+		go handler.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: req})
+		return a, peer
+	}
+
+	a, peer := handshake("invalid")
+	if resp := readHandshakeResponse(t, peer); resp["code"] != float64(handshakeRejected) {
+		t.Fatalf("unexpected handshake response: %v", resp)
+	}
+
+	a, _ = handshake("valid")
+	defer a.Close()
+	<-a.sendBuffer
+	if a.session.Uid != 5000 {
+		t.Fatalf("session should be bound to uid, got: %d", a.session.Uid)
+	}
+	if !a.authorized("Game.Move") {
+		t.Fatal("authenticated session should access all routes")
+	}
+
+	a, _ = handshake("")
+	defer a.Close()
+	<-a.sendBuffer
+	if a.authorized("Game.Move") || !a.authorized("Login.Login") {
+		t.Fatal("unauthenticated session should only access whitelist")
+	}
+}
+
+func TestAuthTimeout(t *testing.T) {
+	EnableAuth(func(token string) (int64, error) { return 0, nil }, nil, 10*time.Millisecond)
+	defer func() { env.auth = nil }()
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	a.status = statusWorking
+	a.waitAuth()
+
+	select {
+	case fn := <-a.tasks:
+		fn()
+	case <-time.After(time.Second):
+		t.Fatal("timeout task should be invoked")
+	}
+	if a.status != statusClosed {
+		t.Fatal("unauthenticated session should be closed after timeout")
+	}
+}
+
+func TestHTTPAuthenticator(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("token") != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"uid": 6000}`))
+	}))
+	defer ts.Close()
+
+	verify := HTTPAuthenticator(ts.URL)
+	if uid, err := verify("valid"); err != nil || uid != 6000 {
+		t.Fatalf("unexpected result, uid=%d, err=%v", uid, err)
+	}
+	if _, err := verify("invalid"); err == nil {
+		t.Fatal("invalid token should be refused")
+	}
+}
+
+func TestPreAuthRoutes(t *testing.T) {
+	SetPreAuthRoutes("Auth.Login")
+	defer func() { env.auth = nil }()
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+
+	if a.authorized("Game.Move") || !a.authorized("Auth.Login") {
+		t.Fatal("unbound session should only access pre-auth routes")
+	}
+	if err := Authenticate(a.session, "token"); err != ErrAuthDisabled {
+		t.Fatalf("expect ErrAuthDisabled without authenticator, got: %v", err)
+	}
+
+	a.session.Bind(6000)
+	if !a.authorized("Game.Move") {
+		t.Fatal("bound session should access all routes")
+	}
+}
+
+func TestDataBeforeHandshake(t *testing.T) {
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+
+	handler.processPacket(a, &packet.Packet{Type: packet.Data, Data: []byte("hello")})
+	if a.status != statusClosed {
+		t.Fatal("session should be closed when data received before handshake")
+	}
+}
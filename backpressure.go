@@ -0,0 +1,141 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync/atomic"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
+)
+
+// BackpressurePolicy represents the strategy that applied when the receive
+// buffer of a connection is full, which means the logic goroutine can not
+// consume packets as fast as the client send them
+type BackpressurePolicy byte
+
+const (
+	BackpressureBlock      BackpressurePolicy = iota // block the read loop until buffer available
+	BackpressureDropOldest                           // discard the oldest packet in buffer
+	BackpressureDropNewest                           // discard the packet just received
+	BackpressureDisconnect                           // close the slow connection
+)
+
+var backpressurePolicyNames = []string{
+	BackpressureBlock:      "Block",
+	BackpressureDropOldest: "DropOldest",
+	BackpressureDropNewest: "DropNewest",
+	BackpressureDisconnect: "Disconnect",
+}
+
+func (p BackpressurePolicy) String() string {
+	if int(p) < len(backpressurePolicyNames) {
+		return backpressurePolicyNames[p]
+	}
+	return "Unknown"
+}
+
+// backpressurePolicy returns the policy of current server type, the default
+// policy is applied if the server type has no policy set
+func backpressurePolicy() BackpressurePolicy {
+	if app.config != nil {
+		if p, ok := env.serverBackpressure[app.config.Type]; ok {
+			return p
+		}
+	}
+	return env.backpressure
+}
+
+// enqueue put the packet to receive buffer, apply the backpressure policy
+// when buffer is full, return false if the connection should be closed.
+// Control packets, e.g. handshake, are never dropped, they wait for the room
+// of buffer, and are never evicted by the following data packets
+func (a *agent) enqueue(p *packet.Packet) bool {
+	if p.Type != packet.Data {
+		atomic.AddInt32(&a.controls, 1)
+		a.recvBuffer <- p
+		return true
+	}
+
+	policy := backpressurePolicy()
+	switch policy {
+	case BackpressureBlock:
+		a.recvBuffer <- p
+		return true
+	default:
+		select {
+		case a.recvBuffer <- p:
+			return true
+		default:
+		}
+	}
+
+	log.Warnf("Receive buffer full, Id=%d, Remote=%s, Policy=%s", a.id, a.socket.RemoteAddr(), policy)
+
+	switch policy {
+	case BackpressureDropOldest:
+		// the oldest packet may be a control packet, which can't be put back
+		// to the head of buffer, the packet just received is dropped then
+		if atomic.LoadInt32(&a.controls) > 0 {
+			packet.Free(p)
+			break
+		}
+		select {
+		case dropped := <-a.recvBuffer:
+			packet.Free(dropped)
+		default:
+		}
+		select {
+		case a.recvBuffer <- p:
+		default:
+			packet.Free(p)
+		}
+	case BackpressureDropNewest:
+		packet.Free(p)
+	case BackpressureDisconnect:
+		packet.Free(p)
+		return false
+	}
+	return true
+}
+
+// dequeued marks the packet taken from receive buffer by logic goroutine
+func (a *agent) dequeued(p *packet.Packet) {
+	if p.Type != packet.Data {
+		atomic.AddInt32(&a.controls, -1)
+	}
+}
+
+// pending return the number of packets waiting to be processed
+func (a *agent) pending() int {
+	return len(a.recvBuffer)
+}
+
+// RecvQueueDepths return a snapshot of receive buffer depth of all connected
+// sessions, key is session id, which helps to find out slow consumers
+func RecvQueueDepths() map[int64]int {
+	depths := make(map[int64]int, transporter.count())
+	transporter.rangeAgents(func(a *agent) bool {
+		depths[a.session.ID] = a.pending()
+		return true
+	})
+	return depths
+}
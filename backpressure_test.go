@@ -0,0 +1,107 @@
+package starx
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestAgent_Enqueue(t *testing.T) {
+	defer SetBackpressurePolicy(BackpressureBlock)
+
+	c, _ := net.Pipe()
+
+	SetBackpressurePolicy(BackpressureDropNewest)
+	a := newAgent(c)
+	for i := 0; i < packetBufferSize+10; i++ {
+		if !a.enqueue(&packet.Packet{Type: packet.Data, Length: i}) {
+			t.Fatal("drop newest policy should not close connection")
+		}
+	}
+	if p := <-a.recvBuffer; p.Length != 0 {
+		t.Fatalf("expect oldest packet remained, got: %d", p.Length)
+	}
+
+	SetBackpressurePolicy(BackpressureDropOldest)
+	a = newAgent(c)
+	for i := 0; i < packetBufferSize+10; i++ {
+		a.enqueue(&packet.Packet{Type: packet.Data, Length: i})
+	}
+	if a.pending() != packetBufferSize {
+		t.Fatalf("expect full buffer, got: %d", a.pending())
+	}
+	if p := <-a.recvBuffer; p.Length != 10 {
+		t.Fatalf("expect oldest packets dropped, got: %d", p.Length)
+	}
+
+	SetBackpressurePolicy(BackpressureDisconnect)
+	a = newAgent(c)
+	for i := 0; i < packetBufferSize; i++ {
+		a.enqueue(&packet.Packet{Type: packet.Data})
+	}
+	if a.enqueue(&packet.Packet{Type: packet.Data}) {
+		t.Fatal("disconnect policy should close connection")
+	}
+}
+
+func TestServerBackpressurePolicy(t *testing.T) {
+	defer func() { env.serverBackpressure = nil }()
+
+	SetServerBackpressurePolicy("other", BackpressureDisconnect)
+	if p := backpressurePolicy(); p != BackpressureBlock {
+		t.Fatalf("expect default policy, got: %s", p)
+	}
+
+	SetServerBackpressurePolicy(app.config.Type, BackpressureDisconnect)
+	if p := backpressurePolicy(); p != BackpressureDisconnect {
+		t.Fatalf("expect policy of server type, got: %s", p)
+	}
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	for i := 0; i < packetBufferSize; i++ {
+		a.enqueue(&packet.Packet{Type: packet.Data})
+	}
+	if a.enqueue(&packet.Packet{Type: packet.Data}) {
+		t.Fatal("policy of server type should be applied")
+	}
+}
+
+func TestEnqueueDropped(t *testing.T) {
+	defer SetBackpressurePolicy(BackpressureBlock)
+
+	c, _ := net.Pipe()
+
+	// dropped packets are freed
+	SetBackpressurePolicy(BackpressureDropNewest)
+	a := newAgent(c)
+	for i := 0; i < packetBufferSize; i++ {
+		a.enqueue(&packet.Packet{Type: packet.Data})
+	}
+	p := &packet.Packet{Type: packet.Data, Data: []byte("dropped")}
+	a.enqueue(p)
+	if p.Data != nil {
+		t.Fatal("dropped packet should be freed")
+	}
+
+	// control packets are never evicted
+	SetBackpressurePolicy(BackpressureDropOldest)
+	a = newAgent(c)
+	a.enqueue(&packet.Packet{Type: packet.Handshake})
+	for i := 0; i < packetBufferSize+10; i++ {
+		a.enqueue(&packet.Packet{Type: packet.Data, Length: i})
+	}
+	p = <-a.recvBuffer
+	if p.Type != packet.Handshake {
+		t.Fatalf("handshake should not be evicted, got: %v", p.Type)
+	}
+	a.dequeued(p)
+
+	// data packets are evicted once the control packet consumed
+	a.enqueue(&packet.Packet{Type: packet.Data, Length: -1})
+	a.enqueue(&packet.Packet{Type: packet.Data, Length: -2})
+	if p := <-a.recvBuffer; p.Length != 1 {
+		t.Fatalf("expect oldest packet dropped, got: %d", p.Length)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/message"
+)
+
+// batcher aggregates the pushes of normal priority within the batch window,
+// and sends them in one data packet, only used by the agents which have
+// negotiated batch in handshake
+type batcher struct {
+	sync.Mutex // keep batches in order
+	agent      *agent
+	msgs       [][]byte // encoded messages waiting to be sent
+	size       int
+	timer      *time.Timer
+}
+
+func newBatcher(a *agent) *batcher {
+	return &batcher{agent: a}
+}
+
+// add the encoded message to current batch, the batch will be sent when the
+// window elapsed or the size exceeds maxBatchSize
+func (b *batcher) add(em []byte) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.msgs = append(b.msgs, em)
+	b.size += len(em)
+	if b.size >= maxBatchSize {
+		return b.send()
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(env.batchWindow, func() { b.flush() })
+	}
+	return nil
+}
+
+// flush send the pending messages immediately, called before sending other
+// messages to keep the order
+func (b *batcher) flush() error {
+	b.Lock()
+	defer b.Unlock()
+	return b.send()
+}
+
+func (b *batcher) send() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	msgs := b.msgs
+	b.msgs, b.size = nil, 0
+
+	var (
+		body []byte
+		err  error
+	)
+	switch len(msgs) {
+	case 0:
+		return nil
+	case 1:
+		body = msgs[0]
+	default:
+		if body, err = message.EncodeBatch(msgs); err != nil {
+			return err
+		}
+	}
+
+	data, err := transporter.packData(b.agent.session, body)
+	if err != nil {
+		return err
+	}
+	return b.agent.sendPriority(data, PriorityNormal)
+}
@@ -0,0 +1,92 @@
+package starx
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+)
+
+func TestBatchHandshake(t *testing.T) {
+	EnableBatch(10 * time.Millisecond)
+	defer EnableBatch(0)
+
+	handshake := func(batch bool) (*agent, map[string]interface{}) {
+		req, _ := json.Marshal(map[string]interface{}{
+			"sys": map[string]interface{}{"batch": batch},
+		})
+		c, _ := net.Pipe()
+		a := newAgent(c)
+		handler.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: req})
+
+		p, _, _ := packet.Unpack(<-a.sendBuffer)
+		resp := map[string]interface{}{}
+		json.Unmarshal(p.Data, &resp)
+		return a, resp["sys"].(map[string]interface{})
+	}
+
+	a, sys := handshake(true)
+	defer a.Close()
+	if a.batch == nil || sys["batch"] == nil {
+		t.Fatalf("batch should be negotiated: %v", sys)
+	}
+
+	a, sys = handshake(false)
+	defer a.Close()
+	if a.batch != nil || sys["batch"] != nil {
+		t.Fatalf("batch should not be negotiated: %v", sys)
+	}
+}
+
+func TestBatchPush(t *testing.T) {
+	EnableBatch(10 * time.Millisecond)
+	defer EnableBatch(0)
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+	a.batch = newBatcher(a)
+
+	for _, data := range []string{"1", "2", "3"} {
+		if err := a.session.Push("onMove", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var p *packet.Packet
+	select {
+	case data := <-a.sendBuffer:
+		p, _, _ = packet.Unpack(data)
+	case <-time.After(time.Second):
+		t.Fatal("batch should be sent after window")
+	}
+
+	msgs, err := message.SplitBatch(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expect 3 messages in batch, got %d", len(msgs))
+	}
+	m, _ := message.Decode(msgs[2])
+	if m.Route != "onMove" || string(m.Data) != "3" {
+		t.Fatalf("unexpected message: %s", m.String())
+	}
+
+	// pending pushes are flushed before response
+	a.session.LastID = 1
+	a.session.Push("onMove", []byte("4"))
+	a.session.Response([]byte("ok"))
+
+	p, _, _ = packet.Unpack(<-a.sendBuffer)
+	if m, err := message.Decode(p.Data); err != nil || m.Type != message.Push || string(m.Data) != "4" {
+		t.Fatalf("single pushed message should be sent without batch: %+v, %v", m, err)
+	}
+	p, _, _ = packet.Unpack(<-a.sendBuffer)
+	if m, err := message.Decode(p.Data); err != nil || m.Type != message.Response {
+		t.Fatalf("response should be sent after pushes: %+v, %v", m, err)
+	}
+}
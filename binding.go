@@ -0,0 +1,285 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+const pushUIDsRoute = "__Session.PushUIDs"
+
+var ErrUidNotFound = errors.New("uid not bound to any session")
+
+// peerPushRoute is requested over the rpc mesh to push messages to the uids
+// bound in peer frontend servers
+var peerPushRoute = &route.Route{Service: "__Session", Method: "PushUIDs"}
+
+// uidPush is the message pushed to the uids bound in peer
+type uidPush struct {
+	Uids  []int64 `json:"uids"`
+	Route string  `json:"route"`
+	Data  []byte  `json:"data"`
+}
+
+// bindings registry the sessions bound to uid, frontend sessions registered
+// when bound, and backend sessions registered when receiving request from
+// bound frontend session, the peer frontend servers which the other uids
+// bound in are learned from the replies of pushes
+var bindings = newBindingService()
+
+type bindingService struct {
+	sync.RWMutex
+	sessions map[int64]*session.Session // uid -> session
+	owners   map[int64]string           // uid -> id of peer frontend server which the uid bound in
+}
+
+func newBindingService() *bindingService {
+	b := &bindingService{
+		sessions: make(map[int64]*session.Session),
+		owners:   make(map[int64]string),
+	}
+	events.on(SessionBound, func(args *EventArgs) { b.bind(args.Session) })
+	events.on(SessionClosed, func(args *EventArgs) { b.unbind(args.Session) })
+	return b
+}
+
+func (b *bindingService) bind(s *session.Session) {
+	if s.Uid < 1 {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.sessions[s.Uid] = s
+	delete(b.owners, s.Uid)
+}
+
+func (b *bindingService) unbind(s *session.Session) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.sessions[s.Uid] == s {
+		delete(b.sessions, s.Uid)
+	}
+}
+
+func (b *bindingService) session(uid int64) (*session.Session, bool) {
+	b.RLock()
+	defer b.RUnlock()
+
+	s, ok := b.sessions[uid]
+	return s, ok
+}
+
+// ownersOf group the uids by the peer frontend servers which they bound in,
+// and returns the uids of unknown owner, owners that left are forgotten
+func (b *bindingService) ownersOf(uids []int64) (map[string][]int64, []int64) {
+	b.Lock()
+	defer b.Unlock()
+
+	var (
+		owners  = make(map[string][]int64)
+		unknown []int64
+	)
+	for _, uid := range uids {
+		id, ok := b.owners[uid]
+		if ok {
+			if _, err := cluster.Server(id); err != nil {
+				delete(b.owners, uid)
+				ok = false
+			}
+		}
+		if !ok {
+			unknown = append(unknown, uid)
+			continue
+		}
+		owners[id] = append(owners[id], uid)
+	}
+	return owners, unknown
+}
+
+func (b *bindingService) setOwner(uids []int64, svrId string) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, uid := range uids {
+		b.owners[uid] = svrId
+	}
+}
+
+// forgetOwner forget the owner of uids, which are not bound in it any more
+func (b *bindingService) forgetOwner(uids []int64, svrId string) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, uid := range uids {
+		if b.owners[uid] == svrId {
+			delete(b.owners, uid)
+		}
+	}
+}
+
+// localSessions returns the sessions bound to uids in current server, and
+// the uids not bound in current server
+func localSessions(uids []int64) ([]*session.Session, []int64) {
+	var (
+		sessions = make([]*session.Session, 0, len(uids))
+		missing  []int64
+	)
+	for _, uid := range uids {
+		if s, ok := bindings.session(uid); ok {
+			sessions = append(sessions, s)
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+	return sessions, missing
+}
+
+// pushToUIDs push the message to sessions of uids, the messages to frontend
+// sessions of the same frontend server will be batched in one rpc response,
+// uids not bound in current server are pushed by peer frontend servers,
+// returns the number of sessions pushed
+func pushToUIDs(uids []int64, route string, data []byte) (int, error) {
+	sessions, missing := localSessions(uids)
+	err := pushToSessions(sessions, route, data)
+	if len(missing) == 0 {
+		return len(sessions), err
+	}
+
+	n, e := pushToPeers(missing, route, data)
+	if e != nil {
+		err = e
+	}
+	return len(sessions) + n, err
+}
+
+// pushToPeers send the message to the peer frontend servers which the uids
+// bound in, one request per server. Owners of uids are learned from the
+// replies of previous pushes, the uids of unknown owner, or not bound in the
+// known owner any more, are sent to all frontend servers serving rpc, which
+// push the message to the uids bound in them. Frontend servers without rpc
+// port are unreachable
+func pushToPeers(uids []int64, route string, data []byte) (int, error) {
+	owners, unknown := bindings.ownersOf(uids)
+	pushed, missed := pushToServers(owners, route, data)
+	for id, uids := range missed {
+		bindings.forgetOwner(uids, id)
+		unknown = append(unknown, uids...)
+	}
+	if len(unknown) == 0 {
+		return pushed, nil
+	}
+
+	targets := make(map[string][]int64)
+	for _, svr := range cluster.Servers() {
+		if !svr.IsFrontend || svr.RpcPort == 0 || (app.config != nil && svr.Id == app.config.Id) {
+			continue
+		}
+		targets[svr.Id] = unknown
+	}
+	n, _ := pushToServers(targets, route, data)
+	return pushed + n, nil
+}
+
+// pushToServers send the message to the uids of each server concurrently,
+// returns the number of sessions pushed, and the uids not pushed by each
+// server, the servers which pushed uids are remembered as their owners
+func pushToServers(targets map[string][]int64, route string, data []byte) (int, map[string][]int64) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		pushed int
+		missed = make(map[string][]int64)
+	)
+	for id, uids := range targets {
+		req, err := json.Marshal(&uidPush{Uids: uids, Route: route, Data: data})
+		if err != nil {
+			log.Errorf("push to uids of server %s error: %s", id, err.Error())
+			continue
+		}
+		wg.Add(1)
+		go func(id string, uids []int64) {
+			defer wg.Done()
+			var done []int64
+			resp, err := cluster.CallServer(context.Background(), id, peerPushRoute, req)
+			if err == nil {
+				err = json.Unmarshal(resp, &done)
+			}
+			if err != nil {
+				log.Errorf("push to uids of server %s error: %s", id, err.Error())
+			}
+			bindings.setOwner(done, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			pushed += len(done)
+			if len(done) < len(uids) {
+				missed[id] = subtract(uids, done)
+			}
+		}(id, uids)
+	}
+	wg.Wait()
+	return pushed, missed
+}
+
+// subtract returns the uids not contained in excluded
+func subtract(uids, excluded []int64) []int64 {
+	set := make(map[int64]bool, len(excluded))
+	for _, uid := range excluded {
+		set[uid] = true
+	}
+	var rest []int64
+	for _, uid := range uids {
+		if !set[uid] {
+			rest = append(rest, uid)
+		}
+	}
+	return rest
+}
+
+// pushFromPeer push the message sent by peer to the uids bound in current
+// server, and returns the uids pushed, so the peer learns the owner of them.
+// It's a peer route, which is never served to the requests routed by clients
+func pushFromPeer(data []byte) ([]byte, error) {
+	req := &uidPush{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	sessions, _ := localSessions(req.Uids)
+	if err := pushToSessions(sessions, req.Route, req.Data); err != nil {
+		return nil, err
+	}
+	uids := make([]int64, 0, len(sessions))
+	for _, s := range sessions {
+		uids = append(uids, s.Uid)
+	}
+	return json.Marshal(uids)
+}
@@ -0,0 +1,110 @@
+package starx
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/packet"
+)
+
+func TestPushToUID(t *testing.T) {
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	a.session.Bind(7000)
+
+	if err := PushToUID(7000, "onPush", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if p, _, err := packet.Unpack(<-a.sendBuffer); err != nil || p.Type != packet.Data {
+		t.Fatalf("message should be pushed to session, err=%v", err)
+	}
+
+	a.Close()
+	if err := PushToUID(7000, "onPush", []byte("hello")); err != ErrUidNotFound {
+		t.Fatalf("expect ErrUidNotFound, got: %v", err)
+	}
+}
+
+func TestPushToUIDsBatch(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	for i, uid := range []int64{8001, 8002} {
+		s := ac.Session(int64(100 + i))
+		restoreSessionContext(s, &rpc.Request{Uid: uid})
+	}
+
+	go PushToUIDs([]int64{8001, 8002, 8003}, "onBatch", []byte("hello"))
+
+	buf := make([]byte, 1024)
+	n, err := peer.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &rpc.Response{}
+	if _, err := resp.UnmarshalMsg(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Kind != rpc.HandlerMulticast || resp.Route != "onBatch" || string(resp.Data) != "hello" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if !reflect.DeepEqual(resp.Sids, []int64{100, 101}) {
+		t.Fatalf("pushes should be batched, got sids: %v", resp.Sids)
+	}
+}
+
+func TestPushToPeers(t *testing.T) {
+	cluster.SetAppConfig(app.config)
+
+	// the peer serves rpc in current process
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serve(l, remote.handle, acceptRPCConn)
+
+	cluster.Register(&cluster.ServerConfig{Type: "push-gate", Id: "push-gate-1", Host: "127.0.0.1", Port: 1, IsFrontend: true, RpcPort: l.Addr().(*net.TCPAddr).Port})
+	cluster.Register(&cluster.ServerConfig{Type: "push-gate", Id: "push-gate-2", Host: "127.0.0.1", Port: 2, IsFrontend: true})
+	defer cluster.RemoveServer("push-gate-1")
+	defer cluster.RemoveServer("push-gate-2")
+
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	defer a.Close()
+	a.session.Bind(7100)
+
+	n, err := pushToPeers([]int64{7100, 7101}, "onPeerPush", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expect 1 session pushed by peer, got: %d", n)
+	}
+	if p, _, err := packet.Unpack(<-a.sendBuffer); err != nil || p.Type != packet.Data {
+		t.Fatalf("message should be pushed to session, err=%v", err)
+	}
+
+	// the owner is learned, and the message is sent to it only
+	owners, unknown := bindings.ownersOf([]int64{7100, 7101})
+	if len(owners["push-gate-1"]) != 1 || owners["push-gate-1"][0] != 7100 || len(unknown) != 1 {
+		t.Fatalf("owner of uid should be learned, got %v %v", owners, unknown)
+	}
+	if n, _ := pushToPeers([]int64{7100}, "onPeerPush", []byte("hello")); n != 1 {
+		t.Fatalf("expect 1 session pushed by owner, got: %d", n)
+	}
+	<-a.sendBuffer
+
+	// the owner is forgotten once the uid is not bound in it
+	bindings.unbind(a.session)
+	if n, _ := pushToPeers([]int64{7100}, "onPeerPush", []byte("hello")); n != 0 {
+		t.Fatalf("expect no session pushed, got: %d", n)
+	}
+	if _, unknown := bindings.ownersOf([]int64{7100}); len(unknown) != 1 {
+		t.Fatal("owner should be forgotten")
+	}
+}
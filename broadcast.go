@@ -0,0 +1,94 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// pushToSessions push the message to sessions, the messages to backend
+// sessions owned by the same frontend server will be batched in one rpc
+// response, rather than one rpc response per session
+func pushToSessions(sessions []*session.Session, route string, data []byte) error {
+	var err error
+	batches := make(map[*acceptor][]int64)
+	for _, s := range sessions {
+		a, ok := s.Entity.(*acceptor)
+		if !ok {
+			if e := s.Push(route, data); e != nil {
+				log.Error(e.Error())
+				err = e
+			}
+			continue
+		}
+		if sid, ok := a.b2fMap[s.ID]; ok {
+			batches[a] = append(batches[a], sid)
+		}
+	}
+
+	for a, sids := range batches {
+		resp := &rpc.Response{
+			Kind:  rpc.HandlerMulticast,
+			Route: route,
+			Data:  data,
+			Sids:  sids,
+		}
+		if e := rpc.WriteResponse(a.socket, resp); e != nil {
+			log.Error(e.Error())
+			err = e
+		}
+	}
+	return err
+}
+
+// broadcastAll push the message to all sessions of current server when
+// current server is frontend server, otherwise push the message to all
+// sessions of frontend servers connected to current server, one rpc
+// response per frontend server
+func broadcastAll(route string, data []byte) error {
+	if app.config.IsFrontend {
+		transporter.broadcast(route, data)
+		return nil
+	}
+
+	transporter.RLock()
+	acceptors := make([]*acceptor, 0, len(transporter.acceptors))
+	for _, a := range transporter.acceptors {
+		acceptors = append(acceptors, a)
+	}
+	transporter.RUnlock()
+
+	var err error
+	for _, a := range acceptors {
+		resp := &rpc.Response{
+			Kind:  rpc.HandlerBroadcast,
+			Route: route,
+			Data:  data,
+		}
+		if e := rpc.WriteResponse(a.socket, resp); e != nil {
+			log.Error(e.Error())
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package starx
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func readResponse(t *testing.T, conn net.Conn) *rpc.Response {
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &rpc.Response{}
+	if _, err := resp.UnmarshalMsg(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestChannelBroadcastBatch(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	c := newChannel("batch")
+	for i, uid := range []int64{8101, 8102, 8103} {
+		s := ac.Session(int64(200 + i))
+		s.Uid = uid
+		c.Add(s)
+	}
+
+	go c.Broadcast("onChannel", []byte("hello"))
+
+	resp := readResponse(t, peer)
+	if resp.Kind != rpc.HandlerMulticast || resp.Route != "onChannel" || string(resp.Data) != "hello" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	sort.Slice(resp.Sids, func(i, j int) bool { return resp.Sids[i] < resp.Sids[j] })
+	if !reflect.DeepEqual(resp.Sids, []int64{200, 201, 202}) {
+		t.Fatalf("pushes should be batched, got sids: %v", resp.Sids)
+	}
+}
+
+func TestBroadcastAll(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer ac.Close()
+
+	go BroadcastAll("onAll", []byte("hello"))
+
+	resp := readResponse(t, peer)
+	if resp.Kind != rpc.HandlerBroadcast || resp.Route != "onAll" || string(resp.Data) != "hello" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
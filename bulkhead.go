@@ -0,0 +1,95 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrBusy responded to the request refused by the concurrency limit of route
+var ErrBusy = errors.New("server busy")
+
+// bulkhead limits the in-flight handler calls of a route or service across
+// all sessions, calls exceeding the limit wait for a slot in a bounded queue,
+// and are refused when the queue is full
+type bulkhead struct {
+	slots   chan struct{} // tokens of in-flight calls
+	queue   int32         // maximum calls waiting for a slot
+	waiting int32         // calls waiting for a slot, updated with atomics
+}
+
+func newBulkhead(n, queue int) *bulkhead {
+	if n < 1 {
+		n = 1
+	}
+	if queue < 0 {
+		queue = 0
+	}
+	return &bulkhead{slots: make(chan struct{}, n), queue: int32(queue)}
+}
+
+// acquire a slot, blocks if the queue is not full, returns false if the call
+// refused, done closed, e.g. the session closed while waiting, or the
+// application is shutting down
+func (b *bulkhead) acquire(done <-chan struct{}) bool {
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt32(&b.waiting, 1) > b.queue {
+		atomic.AddInt32(&b.waiting, -1)
+		return false
+	}
+	defer atomic.AddInt32(&b.waiting, -1)
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	case <-env.die:
+		return false
+	}
+}
+
+func (b *bulkhead) release() {
+	<-b.slots
+}
+
+// queued returns the number of calls waiting for a slot
+func (b *bulkhead) queued() int {
+	return int(atomic.LoadInt32(&b.waiting))
+}
+
+// bulkheadOf returns the concurrency limit of route, limit of route takes
+// precedence over the limit of service
+func bulkheadOf(service, method string) *bulkhead {
+	if len(env.bulkheads) == 0 {
+		return nil
+	}
+	if b, ok := env.bulkheads[service+"."+method]; ok {
+		return b
+	}
+	return env.bulkheads[service]
+}
@@ -0,0 +1,123 @@
+package starx
+
+import (
+	encjson "encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
+)
+
+func TestBulkhead(t *testing.T) {
+	b := newBulkhead(1, 1)
+	if !b.acquire(nil) {
+		t.Fatal("first call should acquire the slot")
+	}
+
+	acquired := make(chan bool)
+	go func() { acquired <- b.acquire(nil) }()
+	waitFor(t, func() bool { return b.queued() == 1 })
+
+	// the queue is full
+	if b.acquire(nil) {
+		t.Fatal("call should be refused when the queue is full")
+	}
+
+	b.release()
+	select {
+	case ok := <-acquired:
+		if !ok {
+			t.Fatal("queued call should acquire the released slot")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued call should acquire the released slot")
+	}
+	b.release()
+
+	// the queued call gives up once its session closed
+	b.acquire(nil)
+	done := make(chan struct{})
+	go func() { acquired <- b.acquire(done) }()
+	waitFor(t, func() bool { return b.queued() == 1 })
+	close(done)
+	if ok := <-acquired; ok || b.queued() != 0 {
+		t.Fatal("queued call should give up after done")
+	}
+	b.release()
+}
+
+type BulkheadComp struct {
+	component.Base
+	calls chan []byte
+}
+
+func (c *BulkheadComp) Search(s *session.Session, data []byte) error {
+	c.calls <- data
+	return nil
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	c := &BulkheadComp{calls: make(chan []byte, 1)}
+	handler.register(c)
+	defer handler.unregister("BulkheadComp")
+
+	SetConcurrencyLimit("BulkheadComp", 1, 0)
+	defer func() { env.bulkheads = nil }()
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	// an in-flight call of other session holds the only slot
+	b := bulkheadOf("BulkheadComp", "Search")
+	if b == nil || !b.acquire(nil) {
+		t.Fatal("limit of service should apply to its routes")
+	}
+	handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 3, Route: "BulkheadComp.Search", Data: []byte("busy")})
+	p, _, _ := packet.Unpack(<-a.sendBuffer)
+	m, err := message.Decode(p.Data)
+	if err != nil || !m.Error || m.ID != 3 {
+		t.Fatalf("expect error response, got %v, %v", m, err)
+	}
+	e := &Error{}
+	if err := encjson.Unmarshal(m.Data, e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != CodeBusy || e.Msg != ErrBusy.Error() {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	b.release()
+	handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 4, Route: "BulkheadComp.Search", Data: []byte("idle")})
+	if data := <-c.calls; string(data) != "idle" {
+		t.Fatalf("unexpected call: %s", data)
+	}
+	if len(b.slots) != 0 {
+		t.Fatal("slot should be released after handler returned")
+	}
+}
+
+func TestConcurrencyLimitDropped(t *testing.T) {
+	c := &BulkheadComp{calls: make(chan []byte, 1)}
+	handler.register(c)
+	defer handler.unregister("BulkheadComp")
+
+	SetConcurrencyLimit("BulkheadComp", 1, 0)
+	defer func() { env.bulkheads = nil }()
+	SetDispatchPolicy("BulkheadComp", Pool(1))
+	defer func() { env.dispatchPolicies = nil }()
+
+	// the call of closed session is dropped by the worker pool
+	conn, _ := net.Pipe()
+	a := transporter.createAgent(conn)
+	transporter.closeSession(a.session, session.CloseClient)
+	handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 1, Route: "BulkheadComp.Search", Data: []byte("closed")})
+
+	// the call may also be run by the pool, which releases the slot soon
+	b := bulkheadOf("BulkheadComp", "Search")
+	waitFor(t, func() bool { return len(b.slots) == 0 })
+}
@@ -0,0 +1,191 @@
+// Package capture writes and reads the dumps of packets on the wire in a
+// pcap-like binary format, a file header followed by packet records, so the
+// traffic of custom clients can be inspected without tcpdump and framing by
+// hand.
+//
+// File header is 8 bytes, the magic "STXC", and version in 2 bytes big endian,
+// followed by 2 reserved bytes. Every packet record has a 22 bytes header:
+//
+//	time      8 bytes, unix time in nanoseconds
+//	sid       8 bytes, session id
+//	direction 1 byte, 0 inbound, 1 outbound
+//	type      1 byte, packet type
+//	length    4 bytes, length of raw bytes
+//
+// all integers are big endian, then the raw bytes of packet follows.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/packet"
+)
+
+const (
+	headerLength = 8
+	recordLength = 22
+	version      = 1
+)
+
+var magic = []byte("STXC")
+
+var (
+	ErrWrongMagic   = errors.New("not a packet capture file")
+	ErrWrongVersion = errors.New("unsupported packet capture version")
+)
+
+// Direction represents whether the packet was received or sent by server
+type Direction byte
+
+const (
+	Inbound  Direction = iota // packet received from client
+	Outbound                  // packet sent to client
+)
+
+func (d Direction) String() string {
+	if d == Inbound {
+		return "inbound"
+	}
+	return "outbound"
+}
+
+// Packet represents a packet captured on the wire
+type Packet struct {
+	Time      int64 // unix time in nanoseconds when captured
+	Sid       int64 // session id
+	Direction Direction
+	Type      packet.PacketType
+	Raw       []byte // raw bytes of packet, including the framing of codec
+}
+
+// At returns the time when the packet captured
+func (p *Packet) At() time.Time {
+	return time.Unix(0, p.Time)
+}
+
+// Writer writes packets, it's safe to call Write in multiple goroutines
+type Writer struct {
+	sync.Mutex // protect following
+	w          *bufio.Writer
+	closer     io.Closer
+}
+
+// NewWriter returns a writer writing packets to w, file header is written
+// immediately
+func NewWriter(w io.Writer) (*Writer, error) {
+	cw := &Writer{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		cw.closer = c
+	}
+
+	header := make([]byte, headerLength)
+	copy(header, magic)
+	binary.BigEndian.PutUint16(header[len(magic):], version)
+	if _, err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, cw.w.Flush()
+}
+
+// Create returns a writer writing packets to the file, the file will be
+// truncated if it exists
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write the packet, header and raw bytes are flushed in one write
+func (w *Writer) Write(p *Packet) error {
+	header := make([]byte, recordLength)
+	binary.BigEndian.PutUint64(header[0:], uint64(p.Time))
+	binary.BigEndian.PutUint64(header[8:], uint64(p.Sid))
+	header[16] = byte(p.Direction)
+	header[17] = byte(p.Type)
+	binary.BigEndian.PutUint32(header[18:], uint32(len(p.Raw)))
+
+	w.Lock()
+	defer w.Unlock()
+
+	if _, err := w.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(p.Raw); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// Close the underlying writer if it's an io.Closer
+func (w *Writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
+
+// Reader reads the packets written by Writer in order
+type Reader struct {
+	r      *bufio.Reader
+	header bool // whether file header has been read
+}
+
+// NewReader returns a reader reading packets from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next packet, io.EOF returned at the end of packets
+func (r *Reader) Next() (*Packet, error) {
+	if !r.header {
+		header := make([]byte, headerLength)
+		if _, err := io.ReadFull(r.r, header); err != nil {
+			if err == io.EOF {
+				return nil, ErrWrongMagic
+			}
+			return nil, err
+		}
+		if string(header[:len(magic)]) != string(magic) {
+			return nil, ErrWrongMagic
+		}
+		if binary.BigEndian.Uint16(header[len(magic):]) != version {
+			return nil, ErrWrongVersion
+		}
+		r.header = true
+	}
+
+	header := make([]byte, recordLength)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		return nil, err
+	}
+	p := &Packet{
+		Time:      int64(binary.BigEndian.Uint64(header[0:])),
+		Sid:       int64(binary.BigEndian.Uint64(header[8:])),
+		Direction: Direction(header[16]),
+		Type:      packet.PacketType(header[17]),
+		Raw:       make([]byte, binary.BigEndian.Uint32(header[18:])),
+	}
+	if _, err := io.ReadFull(r.r, p.Raw); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,56 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestCapture(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := []*Packet{
+		{Time: 1, Sid: 1, Direction: Inbound, Type: packet.Handshake, Raw: []byte{0x01, 0x00, 0x00, 0x02, '{', '}'}},
+		{Time: 2, Sid: 1, Direction: Outbound, Type: packet.Heartbeat, Raw: []byte{0x03, 0x00, 0x00, 0x00}},
+		{Time: 3, Sid: 2, Direction: Outbound, Type: packet.Data, Raw: []byte{}},
+	}
+	for _, p := range packets {
+		if err := w.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(buf)
+	for i, expect := range packets {
+		p, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Time != expect.Time || p.Sid != expect.Sid || p.Direction != expect.Direction ||
+			p.Type != expect.Type || !bytes.Equal(p.Raw, expect.Raw) {
+			t.Fatalf("packet %d mismatch: %+v", i, p)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+}
+
+func TestReaderWrongMagic(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("{\"time\":1}\n"))).Next(); err != ErrWrongMagic {
+		t.Fatalf("expect ErrWrongMagic, got %v", err)
+	}
+
+	data := append([]byte("STXC"), 0x00, 0x09, 0x00, 0x00)
+	if _, err := NewReader(bytes.NewReader(data)).Next(); err != ErrWrongVersion {
+		t.Fatalf("expect ErrWrongVersion, got %v", err)
+	}
+}
@@ -14,10 +14,44 @@ type Channel struct {
 	members []int64                    // all user ids
 }
 
+// channels contains all channels, which used to find out the channels that
+// a session subscribed when migrating session
+var channels = struct {
+	sync.RWMutex
+	m map[string]*Channel
+}{m: make(map[string]*Channel)}
+
 func newChannel(n string) *Channel {
-	return &Channel{
+	c := &Channel{
 		name:   n,
 		uidMap: make(map[int64]*session.Session)}
+
+	channels.Lock()
+	channels.m[n] = c
+	channels.Unlock()
+	return c
+}
+
+// channelsOf return names of all channels that contain the uid
+func channelsOf(uid int64) []string {
+	channels.RLock()
+	defer channels.RUnlock()
+
+	var names []string
+	for n, c := range channels.m {
+		if c.IsContain(uid) {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func channelByName(n string) (*Channel, bool) {
+	channels.RLock()
+	defer channels.RUnlock()
+
+	c, ok := channels.m[n]
+	return c, ok
 }
 
 func (c *Channel) Member(uid int64) *session.Session {
@@ -44,22 +78,20 @@ func (c *Channel) Multicast(route string, v interface{}, filter SessionFilter) e
 	log.Debugf("Type=Multicast Route=%s, Data=%+v", route, v)
 
 	c.RLock()
-	defer c.RUnlock()
-
+	sessions := make([]*session.Session, 0, len(c.uidMap))
 	for _, s := range c.uidMap {
-		if !filter(s) {
-			continue
-		}
-		err = transporter.push(s, route, data)
-		if err != nil {
-			log.Error(err.Error())
+		if filter(s) {
+			sessions = append(sessions, s)
 		}
 	}
+	c.RUnlock()
 
+	pushToSessions(sessions, route, data)
 	return nil
 }
 
-// Push message to all client
+// Push message to all client, messages to members on the same frontend server
+// are batched in one rpc when current server is backend server
 func (c *Channel) Broadcast(route string, v interface{}) error {
 	data, err := serializeOrRaw(v)
 	if err != nil {
@@ -69,16 +101,13 @@ func (c *Channel) Broadcast(route string, v interface{}) error {
 	log.Debugf("Type=Broadcast Route=%s, Data=%+v", route, v)
 
 	c.RLock()
-	defer c.RUnlock()
-
+	sessions := make([]*session.Session, 0, len(c.uidMap))
 	for _, s := range c.uidMap {
-		err = transporter.push(s, route, data)
-		if err != nil {
-			log.Error(err.Error())
-		}
+		sessions = append(sessions, s)
 	}
+	c.RUnlock()
 
-	return err
+	return pushToSessions(sessions, route, data)
 }
 
 func (c *Channel) IsContain(uid int64) bool {
@@ -136,4 +165,10 @@ func (c *Channel) Count() int {
 
 func (c *Channel) Destroy() {
 	c.LeaveAll()
+
+	channels.Lock()
+	if channels.m[c.name] == c {
+		delete(channels.m, c.name)
+	}
+	channels.Unlock()
 }
@@ -0,0 +1,552 @@
+// Package client implements the client side of starx wire protocol, which
+// includes handshake, heartbeat, request/notify and push subscription, it's
+// used to write integration tests and load-testing bots in Go against a
+// running server.
+//
+//	c, err := client.Dial("127.0.0.1:3250")
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	c.On("onMessage", func(data []byte) {
+//		// handle push message
+//	})
+//
+//	reply := &JoinResponse{}
+//	if err := c.Request("chat.Room.Join", &JoinRequest{Name: "bot"}, reply); err != nil {
+//		return err
+//	}
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/compress"
+	"github.com/lonnng/starx/encrypt"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/serialize"
+	jsonserializer "github.com/lonnng/starx/serialize/json"
+)
+
+// handshakeOK is the code of handshake response when handshake succeed
+const handshakeOK = 200
+
+var (
+	ErrClosed          = errors.New("client: connection closed")
+	ErrKicked          = errors.New("client: kicked by server")
+	ErrHandshakeTwice  = errors.New("client: handshake has been done")
+	ErrNotHandshake    = errors.New("client: handshake has not been done")
+	ErrInvalidResponse = errors.New("client: invalid handshake response")
+)
+
+// HandshakeError represents the handshake refused by server
+type HandshakeError struct {
+	Code int    // handshake response code, e.g. 403, 503
+	Msg  string // reason of refusal
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("client: handshake refused(code: %d): %s", e.Code, e.Msg)
+}
+
+// Error represents the error response of request, which is responded when
+// the request failed in routing, decoding or handler execution
+type Error struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: error response(code: %d): %s", e.Code, e.Msg)
+}
+
+// handshakeRequest represents the data of handshake packet
+type handshakeRequest struct {
+	Sys struct {
+		Compress []string `json:"compress,omitempty"`
+		Encrypt  struct {
+			Key []byte `json:"key"`
+		} `json:"encrypt"`
+		Resume struct {
+			Token string `json:"token,omitempty"`
+		} `json:"resume"`
+		Batch bool `json:"batch"`
+	} `json:"sys"`
+	User interface{} `json:"user,omitempty"`
+}
+
+// handshakeResponse represents the data of handshake response
+type handshakeResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Sys  struct {
+		Heartbeat float64           `json:"heartbeat"` // heartbeat interval in seconds
+		Dict      map[string]uint16 `json:"dict"`
+		Compress  *struct {
+			Algorithm string `json:"algorithm"`
+		} `json:"compress"`
+		Encrypt *struct {
+			Key []byte `json:"key"`
+		} `json:"encrypt"`
+		Resume *struct {
+			Token string `json:"token"`
+		} `json:"resume"`
+	} `json:"sys"`
+	User json.RawMessage `json:"user"`
+}
+
+// Client represents a connection to frontend server, all methods are safe
+// for concurrent use, except the setters which should be called before
+// handshake
+type Client struct {
+	conn       net.Conn
+	codec      packet.Codec
+	serializer serialize.Serializer
+	compressor compress.Compressor
+	cipher     *encrypt.Cipher
+
+	dict      map[string]uint16 // route -> code received in handshake
+	codes     map[uint16]string // code -> route received in handshake
+	heartbeat time.Duration     // heartbeat interval received in handshake
+	token     string            // resume token
+	user      json.RawMessage   // user data of handshake response
+
+	writeMu sync.Mutex // protect writing to conn
+
+	mu         sync.Mutex // protect following
+	handshaked bool
+	nextID     uint
+	pending    map[uint]chan *message.Message // message id -> response
+	handlers   map[string]func([]byte)        // route -> push handler
+	err        error                          // reason of closed
+	die        chan struct{}                  // closed when connection closed
+}
+
+// NewClient returns a client of the connection, Handshake should be called
+// before sending messages
+func NewClient(conn net.Conn) *Client {
+	return &Client{
+		conn:       conn,
+		codec:      packet.DefaultCodec,
+		serializer: jsonserializer.NewSerializer(),
+		pending:    make(map[uint]chan *message.Message),
+		handlers:   make(map[string]func([]byte)),
+		die:        make(chan struct{}),
+	}
+}
+
+// Dial connects to the frontend server at the address and handshakes with
+// default settings
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(conn)
+	if err := c.Handshake(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetSerializer set the serializer of messages, json by default, which
+// should be the same as server
+func (c *Client) SetSerializer(s serialize.Serializer) {
+	c.serializer = s
+}
+
+// SetCompressor declare the compression algorithm in handshake, messages
+// compressed by server will be decompressed by the compressor
+func (c *Client) SetCompressor(cp compress.Compressor) {
+	c.compressor = cp
+}
+
+// SetPacketCodec set the codec of packets, which should be the same as server
+func (c *Client) SetPacketCodec(codec packet.Codec) {
+	c.codec = codec
+}
+
+// SetResumeToken set the resume token of a lost session, which is sent in
+// handshake to resume the session
+func (c *Client) SetResumeToken(token string) {
+	c.token = token
+}
+
+// ResumeToken returns the resume token issued by server in handshake
+func (c *Client) ResumeToken() string {
+	return c.token
+}
+
+// UserData returns the user data of handshake response
+func (c *Client) UserData() json.RawMessage {
+	return c.user
+}
+
+// Handshake send handshake packet with the user data, e.g. authentication
+// token `{"token": "..."}`, and wait for the response, then heartbeat and
+// message receiving are started. Encryption key is always sent, which is used
+// only when server requires encryption.
+func (c *Client) Handshake(user interface{}) error {
+	c.mu.Lock()
+	handshaked := c.handshaked
+	c.mu.Unlock()
+	if handshaked {
+		return ErrHandshakeTwice
+	}
+
+	key, err := encrypt.GenerateKey()
+	if err != nil {
+		return err
+	}
+	req := &handshakeRequest{User: user}
+	req.Sys.Encrypt.Key = key.Public()
+	req.Sys.Resume.Token = c.token
+	req.Sys.Batch = true
+	if c.compressor != nil {
+		req.Sys.Compress = []string{c.compressor.Name()}
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := c.writePacket(packet.Handshake, data); err != nil {
+		return err
+	}
+
+	decoder := c.codec.NewDecoder(c.conn)
+	p, err := decoder.Decode()
+	if err != nil {
+		return err
+	}
+	if p.Type != packet.Handshake {
+		return ErrInvalidResponse
+	}
+	res := &handshakeResponse{}
+	if err := json.Unmarshal(p.Data, res); err != nil {
+		return ErrInvalidResponse
+	}
+	if res.Code != handshakeOK {
+		return &HandshakeError{Code: res.Code, Msg: res.Msg}
+	}
+
+	c.dict = res.Sys.Dict
+	c.codes = make(map[uint16]string, len(res.Sys.Dict))
+	for route, code := range res.Sys.Dict {
+		c.codes[code] = route
+	}
+	c.heartbeat = time.Duration(res.Sys.Heartbeat * float64(time.Second))
+	c.user = res.User
+	if res.Sys.Resume != nil {
+		c.token = res.Sys.Resume.Token
+	}
+	if res.Sys.Compress == nil {
+		c.compressor = nil
+	}
+	if res.Sys.Encrypt != nil {
+		if c.cipher, err = key.Cipher(res.Sys.Encrypt.Key); err != nil {
+			return err
+		}
+	}
+
+	if err := c.writePacket(packet.HandshakeAck, nil); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.handshaked = true
+	c.mu.Unlock()
+
+	go c.read(decoder)
+	if c.heartbeat > 0 {
+		go c.keepalive()
+	}
+	return nil
+}
+
+// On register the handler of push messages of the route, handlers are called
+// in the order of messages received, and should not block
+func (c *Client) On(route string, fn func(data []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers[route] = fn
+}
+
+// Request send a request message and wait for the response, which will be
+// deserialized to reply, reply can be *[]byte to receive the raw data. *Error
+// is returned if server responded an error.
+func (c *Client) Request(route string, v interface{}, reply interface{}) error {
+	return c.RequestContext(context.Background(), route, v, reply)
+}
+
+// RequestContext send a request message and wait for the response or the
+// context to be done, whichever happens first
+func (c *Client) RequestContext(ctx context.Context, route string, v interface{}, reply interface{}) error {
+	data, err := c.serialize(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if err := c.ready(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *message.Message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	m := &message.Message{Type: message.Request, ID: id, Route: route, Data: data}
+	if err := c.writeMessage(m); err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case m := <-ch:
+		if m.Error {
+			e := &Error{}
+			if err := json.Unmarshal(m.Data, e); err != nil {
+				return err
+			}
+			return e
+		}
+		if raw, ok := reply.(*[]byte); ok {
+			*raw = m.Data
+			return nil
+		}
+		return c.serializer.Deserialize(m.Data, reply)
+	case <-c.die:
+		return c.closeErr()
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	}
+}
+
+// Notify send a notify message, which has no response
+func (c *Client) Notify(route string, v interface{}) error {
+	data, err := c.serialize(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	err = c.ready()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return c.writeMessage(&message.Message{Type: message.Notify, Route: route, Data: data})
+}
+
+// Done returns a channel which is closed when the connection closed
+func (c *Client) Done() <-chan struct{} {
+	return c.die
+}
+
+// Err returns the reason of connection closed, ErrKicked if kicked by server
+func (c *Client) Err() error {
+	select {
+	case <-c.die:
+		return c.closeErr()
+	default:
+		return nil
+	}
+}
+
+// Close the connection, pending requests return ErrClosed
+func (c *Client) Close() error {
+	c.close(ErrClosed)
+	return c.conn.Close()
+}
+
+func (c *Client) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.die:
+		return
+	default:
+	}
+	c.err = err
+	close(c.die)
+}
+
+// ready returns an error if messages can not be sent, c.mu must be held
+func (c *Client) ready() error {
+	if !c.handshaked {
+		return ErrNotHandshake
+	}
+	select {
+	case <-c.die:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *Client) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *Client) forget(id uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, id)
+}
+
+func (c *Client) serialize(v interface{}) ([]byte, error) {
+	if data, ok := v.([]byte); ok {
+		return data, nil
+	}
+	return c.serializer.Serialize(v)
+}
+
+func (c *Client) writeMessage(m *message.Message) error {
+	data, err := message.EncodeWithDict(m, c.dict)
+	if err != nil {
+		return err
+	}
+	if c.cipher != nil {
+		if data, err = c.cipher.Encrypt(data); err != nil {
+			return err
+		}
+	}
+	return c.writePacket(packet.Data, data)
+}
+
+func (c *Client) writePacket(typ packet.PacketType, data []byte) error {
+	p, err := c.codec.Encode(&packet.Packet{Type: typ, Length: len(data), Data: data})
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if _, err := c.conn.Write(p); err != nil {
+		c.close(err)
+		return err
+	}
+	return nil
+}
+
+// keepalive send heartbeat packets periodically until the connection closed
+func (c *Client) keepalive() {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.writePacket(packet.Heartbeat, nil); err != nil {
+				return
+			}
+		case <-c.die:
+			return
+		}
+	}
+}
+
+// read receive packets until the connection closed
+func (c *Client) read(decoder packet.Decoder) {
+	for {
+		p, err := decoder.Decode()
+		if err != nil {
+			c.close(err)
+			return
+		}
+
+		switch p.Type {
+		case packet.Data:
+			if err := c.processData(p.Data); err != nil {
+				c.close(err)
+				c.conn.Close()
+				return
+			}
+			// messages dispatched refer to the data only, not the packet
+			packet.Free(p)
+		case packet.Kick:
+			c.close(ErrKicked)
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// processData decrypt the data of data packet, and dispatch the messages,
+// which may be batched
+func (c *Client) processData(data []byte) error {
+	var err error
+	if c.cipher != nil {
+		if data, err = c.cipher.Decrypt(data); err != nil {
+			return err
+		}
+	}
+
+	msgs := [][]byte{data}
+	if message.IsBatch(data) {
+		if msgs, err = message.SplitBatch(data); err != nil {
+			return err
+		}
+	}
+
+	for _, em := range msgs {
+		m, err := message.DecodeWithDict(em, c.codes)
+		if err != nil {
+			return err
+		}
+		if m.DataCompressed {
+			if c.compressor == nil {
+				return fmt.Errorf("client: compressed message received without negotiation")
+			}
+			if m.Data, err = c.compressor.Decompress(m.Data); err != nil {
+				return err
+			}
+			m.DataCompressed = false
+		}
+		c.dispatch(m)
+	}
+	return nil
+}
+
+func (c *Client) dispatch(m *message.Message) {
+	c.mu.Lock()
+	var (
+		ch chan *message.Message
+		fn func([]byte)
+	)
+	switch m.Type {
+	case message.Response:
+		ch = c.pending[m.ID]
+		delete(c.pending, m.ID)
+	case message.Push:
+		fn = c.handlers[m.Route]
+	}
+	c.mu.Unlock()
+
+	if ch != nil {
+		ch <- m
+	}
+	if fn != nil {
+		fn(m.Data)
+	}
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+)
+
+// fakeServer handshakes with the client, and echo the data of requests
+type fakeServer struct {
+	t       *testing.T
+	conn    net.Conn
+	decoder packet.Decoder
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *Client) {
+	sc, cc := net.Pipe()
+	return &fakeServer{t: t, conn: sc, decoder: packet.NewDecoder(sc)}, NewClient(cc)
+}
+
+func (s *fakeServer) write(typ packet.PacketType, data []byte) {
+	p, err := packet.Pack(&packet.Packet{Type: typ, Data: data})
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	if _, err := s.conn.Write(p); err != nil {
+		s.t.Error(err)
+	}
+}
+
+func (s *fakeServer) read() *packet.Packet {
+	p, err := s.decoder.Decode()
+	if err != nil {
+		s.t.Error(err)
+		return &packet.Packet{}
+	}
+	return p
+}
+
+// readData returns the next data packet, heartbeat packets are skipped
+func (s *fakeServer) readData() *packet.Packet {
+	for {
+		if p := s.read(); p.Type != packet.Heartbeat {
+			return p
+		}
+	}
+}
+
+func (s *fakeServer) handshake(res map[string]interface{}) map[string]interface{} {
+	req := map[string]interface{}{}
+	if err := json.Unmarshal(s.read().Data, &req); err != nil {
+		s.t.Error(err)
+	}
+	data, _ := json.Marshal(res)
+	s.write(packet.Handshake, data)
+	return req
+}
+
+func TestClient(t *testing.T) {
+	s, c := newFakeServer(t)
+	defer c.Close()
+
+	dict := map[string]uint16{"Room.Join": 1, "onMessage": 2}
+	go func() {
+		req := s.handshake(map[string]interface{}{
+			"code": 200,
+			"sys":  map[string]interface{}{"heartbeat": 0.05, "dict": dict, "resume": map[string]string{"token": "t1"}},
+			"user": map[string]string{"motd": "hello"},
+		})
+		if req["user"].(map[string]interface{})["token"] != "secret" {
+			t.Errorf("unexpected handshake request: %v", req)
+		}
+		if p := s.read(); p.Type != packet.HandshakeAck {
+			t.Errorf("expect handshake ack, got %d", p.Type)
+		}
+
+		// request with compressed route
+		p := s.readData()
+		m, err := message.DecodeWithDict(p.Data, map[uint16]string{1: "Room.Join"})
+		if err != nil || m.Route != "Room.Join" || m.ID != 1 {
+			t.Errorf("unexpected request: %v, %v", m, err)
+		}
+		resp, _ := message.Encode(&message.Message{Type: message.Response, ID: m.ID, Data: m.Data})
+		s.write(packet.Data, resp)
+
+		// error response
+		m, err = message.Decode(s.readData().Data)
+		if err != nil {
+			t.Error(err)
+		}
+		resp, _ = message.Encode(&message.Message{Type: message.Response, ID: m.ID, Data: []byte(`{"code":404,"msg":"not found"}`), Error: true})
+		s.write(packet.Data, resp)
+
+		// pushes batched in one packet
+		p1, _ := message.EncodeWithDict(&message.Message{Type: message.Push, Route: "onMessage", Data: []byte(`"a"`)}, dict)
+		p2, _ := message.Encode(&message.Message{Type: message.Push, Route: "onMessage", Data: []byte(`"b"`)})
+		batch, _ := message.EncodeBatch([][]byte{p1, p2})
+		s.write(packet.Data, batch)
+
+		if p := s.read(); p.Type != packet.Heartbeat {
+			t.Errorf("expect heartbeat, got %d", p.Type)
+		}
+		s.write(packet.Kick, nil)
+	}()
+
+	if err := c.Handshake(map[string]string{"token": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.ResumeToken() != "t1" || string(c.UserData()) != `{"motd":"hello"}` {
+		t.Fatalf("unexpected handshake response: %s, %s", c.ResumeToken(), c.UserData())
+	}
+
+	pushes := make(chan string, 2)
+	c.On("onMessage", func(data []byte) {
+		var s string
+		json.Unmarshal(data, &s)
+		pushes <- s
+	})
+
+	reply := map[string]string{}
+	if err := c.Request("Room.Join", map[string]string{"name": "bot"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply["name"] != "bot" {
+		t.Fatalf("unexpected reply: %v", reply)
+	}
+
+	err := c.Request("Room.Missing", nil, &reply)
+	if e, ok := err.(*Error); !ok || e.Code != 404 || e.Msg != "not found" {
+		t.Fatalf("expect error response, got %v", err)
+	}
+
+	for _, want := range []string{"a", "b"} {
+		select {
+		case got := <-pushes:
+			if got != want {
+				t.Fatalf("expect push %s, got %s", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("push timeout")
+		}
+	}
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("client should be kicked")
+	}
+	if c.Err() != ErrKicked {
+		t.Fatalf("expect ErrKicked, got %v", c.Err())
+	}
+	if err := c.Request("Room.Join", nil, nil); err != ErrKicked {
+		t.Fatalf("expect ErrKicked, got %v", err)
+	}
+}
+
+func TestClientHandshakeRefused(t *testing.T) {
+	s, c := newFakeServer(t)
+	defer c.Close()
+
+	go s.handshake(map[string]interface{}{"code": 503, "msg": "server is full"})
+
+	err := c.Handshake(nil)
+	if he, ok := err.(*HandshakeError); !ok || he.Code != 503 {
+		t.Fatalf("expect HandshakeError, got %v", err)
+	}
+	if err := c.Notify("Room.Join", nil); err != ErrNotHandshake {
+		t.Fatalf("expect ErrNotHandshake, got %v", err)
+	}
+}
+
+func TestClientRequestContext(t *testing.T) {
+	s, c := newFakeServer(t)
+	defer c.Close()
+
+	go func() {
+		s.handshake(map[string]interface{}{"code": 200})
+		s.read() // ack
+		s.read() // request without response
+	}()
+	if err := c.Handshake(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.RequestContext(ctx, "Room.Join", []byte("raw"), nil); err != context.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+	if len(c.pending) != 0 {
+		t.Fatalf("pending request should be removed, got %d", len(c.pending))
+	}
+}
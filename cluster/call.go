@@ -1,10 +1,14 @@
 package cluster
 
 import (
-	"errors"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"time"
 
 	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/metrics"
 	"github.com/lonnng/starx/route"
 	"github.com/lonnng/starx/session"
 )
@@ -14,22 +18,129 @@ var (
 	sessionSyncRoute   = &route.Route{Service: "__Session", Method: "Sync"}
 )
 
+// default timeout of rpc call, which will be applied when the context
+// passed to Call does not carry a deadline, zero means never time out
+var callTimeout = 5 * time.Second
+
+// SetCallTimeout set the default timeout of rpc call
+func SetCallTimeout(d time.Duration) {
+	callTimeout = d
+}
+
+// CallTimeout returns the default timeout of rpc call
+func CallTimeout() time.Duration {
+	return callTimeout
+}
+
 // Client send request
 // First argument is namespace, can be set `user` or `sys`
-func Call(rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte) ([]byte, error) {
+func Call(ctx context.Context, rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte) ([]byte, error) {
 	client, err := ClientByType(route.ServerType, session)
 	if err != nil {
-		log.Infof(err.Error())
+		log.Info(err.Error())
 		return nil, err
 	}
+	return call(ctx, client, rpcKind, route, session, args)
+}
+
+// CallRetry is the same as Call, the request will be retried on another
+// server of the same type at most retries times, when the selected server
+// failed to handle it, e.g. connection lost or timeout. Errors returned by
+// the remote handler are never retried, so it should be used for idempotent
+// requests only. The servers are selected by router, except the failed ones.
+func CallRetry(ctx context.Context, rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte, retries int) ([]byte, error) {
+	var failed map[string]bool
+	for i := 0; ; i++ {
+		client, id, err := clientByType(route.ServerType, session, failed)
+		if err == nil {
+			var reply []byte
+			if reply, err = call(ctx, client, rpcKind, route, session, args); err == nil {
+				return reply, nil
+			}
+		}
+		if i >= retries || !retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		log.Warnf("call %s on server %s failed: %s, retry on another server", route.String(), id, err.Error())
+		metrics.RPCRetries.Inc()
+		if failed == nil {
+			failed = make(map[string]bool)
+		}
+		failed[id] = true
+	}
+}
+
+// retryable reports whether the request failed by the server instead of the
+// remote handler, so it can be retried on another server
+func retryable(err error) bool {
+	switch err.(type) {
+	case rpc.ServerError, *rpc.CodeError:
+		return false
+	}
+	return err != ErrClientNotFound
+}
+
+func call(ctx context.Context, client *rpc.Client, rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok && callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, callTimeout)
+		defer cancel()
+	}
+
+	// the full route is forwarded for namespaces, e.g. tenant.game.Room.Join
+	service := route.Service
+	if route.Namespace != "" {
+		service = route.Namespace + "." + route.ServerType + "." + route.Service
+	}
+
+	ctx = rpc.WithSessionContext(ctx, sessionContext(session))
 	reply := new([]byte)
-	err = client.Call(rpcKind, route.Service, route.Method, session.Entity.ID(), reply, args)
+	err := client.CallContext(ctx, rpcKind, service, route.Method, session.Entity.ID(), reply, args)
 	if err != nil {
-		return nil, errors.New(err.Error())
+		metrics.RPCErrors.Inc()
+		return nil, err
 	}
 	return *reply, nil
 }
 
+// CallServer send a request of the internal route to the server, which
+// carries no session, e.g. heartbeats and admin commands between peers
+func CallServer(ctx context.Context, svrId string, route *route.Route, args []byte) ([]byte, error) {
+	client, err := Client(svrId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok && callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, callTimeout)
+		defer cancel()
+	}
+
+	reply := new([]byte)
+	if err := client.CallContext(ctx, rpc.Peer, route.Service, route.Method, 0, reply, args); err != nil {
+		metrics.RPCErrors.Inc()
+		return nil, err
+	}
+	return *reply, nil
+}
+
+// sessionContext returns the context of session which will be forwarded to
+// remote server, session data should be gob encodable, or it will be ignored
+func sessionContext(s *session.Session) *rpc.SessionContext {
+	sc := &rpc.SessionContext{Uid: s.Uid, Remote: s.Remote, TraceID: s.TraceID, SpanID: s.SpanID}
+	if state := s.State(); len(state) > 0 {
+		buf := bytes.NewBuffer([]byte(nil))
+		if err := gob.NewEncoder(buf).Encode(state); err != nil {
+			log.Errorf("encode session state error: %s", err.Error())
+		} else {
+			sc.State = buf.Bytes()
+		}
+	}
+	return sc
+}
+
 func SessionClosed(session *session.Session) {
 	for _, t := range svrTypes {
 		client, err := ClientByType(t, session)
@@ -37,6 +148,6 @@ func SessionClosed(session *session.Session) {
 			continue
 		}
 
-		client.Call(rpc.Sys, sessionClosedRoute.Service, sessionClosedRoute.Method, session.Entity.ID(), nil, nil)
+		client.Call(rpc.Sys, sessionClosedRoute.Service, sessionClosedRoute.Method, session.Entity.ID(), nil, []byte{byte(session.CloseReason)})
 	}
 }
@@ -22,14 +22,19 @@ var (
 	appConfig    *ServerConfig          // current app config
 
 	sessionManager SessionManager //get session instance
+
+	serverAddedCb   func(*ServerConfig) // callback on new server registered
+	serverRemovedCb func(*ServerConfig) // callback on server removed
 )
 
 var (
 	ErrServerNotFound = errors.New("server config not found")
+	ErrClientNotFound = errors.New("not found rpc client")
 )
 
 type SessionManager interface {
 	Session(sid int64) (*session.Session, error)
+	Broadcast(route string, data []byte) // push to all sessions
 }
 
 func init() {
@@ -63,13 +68,19 @@ func DumpServers() {
 }
 
 func Register(server *ServerConfig) {
+	if register(server) && serverAddedCb != nil {
+		serverAddedCb(server)
+	}
+}
+
+func register(server *ServerConfig) bool {
 	svrLock.Lock()
 	defer svrLock.Unlock()
 
 	// server exists
 	if _, ok := svrIdMaps[server.Id]; ok {
 		log.Infof("serverId: %s already existed(%s)", server.Id, server.String())
-		return
+		return false
 	}
 
 	svr := server
@@ -91,16 +102,23 @@ func Register(server *ServerConfig) {
 
 	svrIdMaps[svr.Id] = svr
 	svrTypeMaps[svr.Type] = append(svrTypeMaps[svr.Type], svr.Id)
+	return true
 }
 
 func RemoveServer(svrId string) {
+	if svr := removeServer(svrId); svr != nil && serverRemovedCb != nil {
+		serverRemovedCb(svr)
+	}
+}
+
+func removeServer(svrId string) *ServerConfig {
 	svrLock.Lock()
 	defer svrLock.Unlock()
 
 	svr, ok := svrIdMaps[svrId]
 	if !ok || svr == nil {
 		log.Infof("serverId: %s not found", svrId)
-		return
+		return nil
 	}
 
 	// remove from ServerIdMaps map
@@ -109,7 +127,7 @@ func RemoveServer(svrId string) {
 
 	if !ok || len(svrs) == 0 {
 		log.Infof("server type: %s has not instance", typ)
-		return
+		return nil
 	}
 
 	if len(svrs) == 1 { // array only one element, remove it directly
@@ -129,6 +147,8 @@ func RemoveServer(svrId string) {
 	// remove from ServerIdMaps
 	delete(svrIdMaps, svrId)
 	CloseClient(svrId)
+	removePeer(svrId)
+	return svr
 }
 
 func Server(id string) (*ServerConfig, error) {
@@ -143,13 +163,29 @@ func Server(id string) (*ServerConfig, error) {
 	return svr, nil
 }
 
+// Servers returns all registered servers, ordered by server type
+func Servers() []*ServerConfig {
+	svrLock.RLock()
+	defer svrLock.RUnlock()
+
+	var svrs []*ServerConfig
+	for _, t := range svrTypes {
+		for _, id := range svrTypeMaps[t] {
+			if svr, ok := svrIdMaps[id]; ok {
+				svrs = append(svrs, svr)
+			}
+		}
+	}
+	return svrs
+}
+
 func UpdateServer(newSvr *ServerConfig) {
 	svrLock.Lock()
 	defer svrLock.Unlock()
 
 	svr, ok := svrIdMaps[newSvr.Id]
 	if !ok || svr == nil {
-		log.Errorf(newSvr.Id + " not exists")
+		log.Error(newSvr.Id + " not exists")
 		return
 	}
 
@@ -158,15 +194,15 @@ func UpdateServer(newSvr *ServerConfig) {
 
 func CloseClient(svrId string) {
 	mutex.Lock()
-	defer mutex.Unlock()
-
 	client, ok := clientIdMaps[svrId]
 	if !ok {
+		mutex.Unlock()
 		log.Infof("%s not found in rpc client list", svrId)
 		return
 	}
 
 	delete(clientIdMaps, svrId)
+	mutex.Unlock()
 	client.Close()
 
 	log.Infof("%s rpc client has been removed.", svrId)
@@ -174,33 +210,60 @@ func CloseClient(svrId string) {
 }
 
 func ClientByType(svrType string, session *session.Session) (*rpc.Client, error) {
+	client, _, err := clientByType(svrType, session, nil)
+	return client, err
+}
+
+// clientByType select a server of the type except the excluded servers,
+// returns the client and id of the selected server
+func clientByType(svrType string, session *session.Session, exclude map[string]bool) (*rpc.Client, string, error) {
 	if svrType == appConfig.Type {
-		return nil, errors.New(fmt.Sprintf("current server has the same type(Type: %s)", svrType))
+		return nil, "", errors.New(fmt.Sprintf("current server has the same type(Type: %s)", svrType))
 	}
 
-	// fast mode
-	if id := session.ServerID(svrType); id != "" {
-		return Client(id)
+	sticky := !nonSticky[svrType]
+
+	// fast mode, the server cached in session is invalidated if it has left
+	// or been excluded
+	if id := session.ServerID(svrType); sticky && id != "" {
+		if _, err := Server(id); err == nil && !exclude[id] {
+			client, err := Client(id)
+			return client, id, err
+		}
+		session.SetServerID(svrType, "")
 	}
 
 	// slow mode
-	svrIds := svrTypeMaps[svrType]
+	svrLock.RLock()
+	var svrIds []string
+	for _, id := range svrTypeMaps[svrType] {
+		if !exclude[id] {
+			svrIds = append(svrIds, id)
+		}
+	}
+	svrLock.RUnlock()
 	if n := len(svrIds); n > 0 {
 		var id string
-		if fn := router[svrType]; fn != nil {
+		fn := router[svrType]
+		if fn != nil {
 			// try to get user-define router function
 			id = fn(session)
-		} else {
-			// select a random server when could not found user-define router
+		}
+		if fn == nil || exclude[id] {
+			// select a random server when could not found user-define router,
+			// or the server selected by router has been excluded
 			r := rand.Intn(n)
 			id = svrIds[r]
 		}
 
-		session.SetServerID(svrType, id)
-		return Client(id)
+		if sticky {
+			session.SetServerID(svrType, id)
+		}
+		client, err := Client(id)
+		return client, id, err
 	}
 
-	return nil, errors.New("not found rpc client")
+	return nil, "", ErrClientNotFound
 }
 
 // Get RPC client by server id(`connector-server-1`), and return the client if
@@ -227,12 +290,16 @@ func Client(svrId string) (*rpc.Client, error) {
 		return nil, errors.New(svr.Id + " is current server")
 	}
 
-	// frontend server
+	// frontend server serves rpc on a separate port
+	port := svr.Port
 	if svr.IsFrontend {
-		return nil, errors.New(svr.Id + " is frontend server, can handle rpc request")
+		if svr.RpcPort == 0 {
+			return nil, errors.New(svr.Id + " is frontend server without rpc port, can't handle rpc request")
+		}
+		port = svr.RpcPort
 	}
 
-	client, err := rpc.Dial("tcp4", fmt.Sprintf("%s:%d", svr.Host, svr.Port))
+	client, err := rpc.Dial("tcp4", fmt.Sprintf("%s:%d", svr.Host, port))
 	if err != nil {
 		return nil, err
 	}
@@ -250,9 +317,22 @@ func Client(svrId string) (*rpc.Client, error) {
 	// handle sys rpc push/response
 	go func() {
 		for resp := range client.ResponseChan {
+			if resp.Kind == rpc.HandlerMulticast {
+				for _, sid := range resp.Sids {
+					if s, err := sessionManager.Session(sid); err == nil {
+						s.Push(resp.Route, resp.Data)
+					}
+				}
+				continue
+			}
+			if resp.Kind == rpc.HandlerBroadcast {
+				sessionManager.Broadcast(resp.Route, resp.Data)
+				continue
+			}
+
 			s, err := sessionManager.Session(resp.Sid)
 			if err != nil {
-				log.Errorf(err.Error())
+				log.WithFields(log.Fields{"sid": resp.Sid, "trace": resp.TraceID}).Errorf("dispatch response error: %s", err.Error())
 				continue
 			}
 
@@ -270,6 +350,15 @@ func Client(svrId string) (*rpc.Client, error) {
 	return client, nil
 }
 
+// Connected reports whether the rpc client of the server has established,
+// the server is never dialed here
+func Connected(svrId string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return clientIdMaps[svrId] != nil
+}
+
 // Dump all clients that has established netword connection with remote server
 func DumpClientIdMaps() {
 	mutex.RLock()
@@ -302,3 +391,13 @@ func SetSessionManager(s SessionManager) {
 	}
 	sessionManager = s
 }
+
+// OnServerAdded set the callback which will be called after new server registered
+func OnServerAdded(fn func(*ServerConfig)) {
+	serverAddedCb = fn
+}
+
+// OnServerRemoved set the callback which will be called after server removed
+func OnServerRemoved(fn func(*ServerConfig)) {
+	serverRemovedCb = fn
+}
@@ -2,23 +2,52 @@ package cluster
 
 import "fmt"
 
-type ServerConfig struct {
-	Type        string `json:"type"`
-	Id          string `json:"id"`
-	Host        string `json:"host"`
+// ListenerConfig represents an additional listener of frontend server, all
+// listeners feed the same handler service
+type ListenerConfig struct {
+	Host        string `json:"host"` // default to the host of server
 	Port        int    `json:"port"`
-	IsFrontend  bool   `json:"is_frontend"`
-	IsMaster    bool   `json:"is_master"`
 	IsWebsocket bool   `json:"is_websocket"`
+	Transport   string `json:"transport"` // transport of non-websocket listener, e.g. kcp, default tcp
+	Codec       string `json:"codec"`     // name of packet codec registered by starx.RegisterPacketCodec, default codec if empty
+	TLSCert     string `json:"tls_cert"`  // certificate file, TLS enabled when both certificate and key set
+	TLSKey      string `json:"tls_key"`   // private key file
+}
+
+type ServerConfig struct {
+	Type           string            `json:"type"`
+	Id             string            `json:"id"`
+	Host           string            `json:"host"`
+	Port           int               `json:"port"`
+	IsFrontend     bool              `json:"is_frontend"`
+	IsMaster       bool              `json:"is_master"`
+	IsWebsocket    bool              `json:"is_websocket"`
+	AdminHost      string            `json:"admin_host"`      // admin server host, default 127.0.0.1
+	AdminPort      int               `json:"admin_port"`      // admin server port, disabled if zero
+	RpcPort        int               `json:"rpc_port"`        // rpc port of frontend server, peers can't reach it over rpc if zero
+	MaxConnections int               `json:"max_connections"` // maximum client connections of frontend server, unlimited if zero
+	Encrypt        bool              `json:"encrypt"`         // encrypt data packets with the key exchanged in handshake
+	Transport      string            `json:"transport"`       // transport of client connections, e.g. kcp, default tcp
+	Listeners      []*ListenerConfig `json:"listeners"`       // additional listeners of frontend server
+	Allow          []string          `json:"allow"`           // CIDRs allowed to connect, all allowed if empty
+	Deny           []string          `json:"deny"`            // CIDRs denied to connect, take precedence over allow
+	RpcAllow       []string          `json:"rpc_allow"`       // CIDRs allowed to connect to the rpc port, all allowed if empty
+	RpcDeny        []string          `json:"rpc_deny"`        // CIDRs denied to connect to the rpc port, take precedence over rpc allow
 }
 
 func (c *ServerConfig) String() string {
-	return fmt.Sprintf("Type: %s, Id: %s, Host: %s, Port: %d, IsFrontend: %t, IsMaster: %t, IsWebsocket: %t",
+	return fmt.Sprintf("Type: %s, Id: %s, Host: %s, Port: %d, IsFrontend: %t, IsMaster: %t, IsWebsocket: %t, AdminPort: %d, RpcPort: %d, MaxConnections: %d, Encrypt: %t, Transport: %s, Listeners: %d",
 		c.Type,
 		c.Id,
 		c.Host,
 		c.Port,
 		c.IsFrontend,
 		c.IsMaster,
-		c.IsWebsocket)
+		c.IsWebsocket,
+		c.AdminPort,
+		c.RpcPort,
+		c.MaxConnections,
+		c.Encrypt,
+		c.Transport,
+		len(c.Listeners))
 }
@@ -0,0 +1,52 @@
+// Package dns discover servers from DNS SRV records, e.g. headless services
+// in kubernetes, every pod behind the service is a server of the type
+package dns
+
+import (
+	"net"
+	"strings"
+
+	"github.com/lonnng/starx/cluster"
+)
+
+// lookupSRV replaced in tests
+var lookupSRV = net.LookupSRV
+
+// Service maps a DNS name to servers of a type
+type Service struct {
+	Type       string // server type
+	Name       string // DNS name to lookup SRV records, e.g. game.default.svc.cluster.local
+	IsFrontend bool
+}
+
+// Provider resolve SRV records of services, server id is the first label of
+// target, which is the pod hostname in kubernetes
+type Provider struct {
+	services []Service
+}
+
+// NewProvider returns a provider which discover servers of the services
+func NewProvider(services ...Service) *Provider {
+	return &Provider{services: services}
+}
+
+func (p *Provider) Servers() ([]*cluster.ServerConfig, error) {
+	var svrs []*cluster.ServerConfig
+	for _, s := range p.services {
+		_, addrs, err := lookupSRV("", "", s.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			host := strings.TrimSuffix(addr.Target, ".")
+			svrs = append(svrs, &cluster.ServerConfig{
+				Type:       s.Type,
+				Id:         strings.SplitN(host, ".", 2)[0],
+				Host:       host,
+				Port:       int(addr.Port),
+				IsFrontend: s.IsFrontend,
+			})
+		}
+	}
+	return svrs, nil
+}
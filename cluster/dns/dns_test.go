@@ -0,0 +1,37 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestProvider_Servers(t *testing.T) {
+	defer func(fn func(string, string, string) (string, []*net.SRV, error)) { lookupSRV = fn }(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name != "game.default.svc.cluster.local" {
+			return "", nil, errors.New("no such host")
+		}
+		return "", []*net.SRV{
+			{Target: "game-0.game.default.svc.cluster.local.", Port: 3250},
+			{Target: "game-1.game.default.svc.cluster.local.", Port: 3250},
+		}, nil
+	}
+
+	p := NewProvider(Service{Type: "game", Name: "game.default.svc.cluster.local"})
+	svrs, err := p.Servers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svrs) != 2 {
+		t.Fatalf("expect 2 servers, got %d", len(svrs))
+	}
+	if s := svrs[1]; s.Type != "game" || s.Id != "game-1" || s.Host != "game-1.game.default.svc.cluster.local" || s.Port != 3250 {
+		t.Fatalf("unexpected server: %s", s.String())
+	}
+
+	p = NewProvider(Service{Type: "chat", Name: "chat.default.svc.cluster.local"})
+	if _, err := p.Servers(); err == nil {
+		t.Fatal("expect lookup error")
+	}
+}
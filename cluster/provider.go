@@ -0,0 +1,9 @@
+package cluster
+
+// Provider discover the servers of cluster, e.g. from DNS records of
+// headless services in kubernetes or a service registry, so servers can
+// join cluster without listing every node in servers config
+type Provider interface {
+	// Servers returns all servers currently alive in cluster
+	Servers() ([]*ServerConfig, error)
+}
@@ -6,10 +6,23 @@ import (
 	"github.com/lonnng/starx/session"
 )
 
-var router map[string]func(*session.Session) string
+var router = make(map[string]func(*session.Session) string)
+
+// server types of which sessions are not sticky, see Sticky
+var nonSticky = make(map[string]bool)
 
 func Router(svrType string, fn func(*session.Session) string) {
 	if t := strings.TrimSpace(svrType); t != "" {
 		router[svrType] = fn
 	}
 }
+
+// Sticky set whether the sessions keep routing to the server selected for
+// the first message of the server type, sessions are sticky by default. The
+// server cached in session is invalidated when the server left the cluster,
+// and a new server will be selected by router for the next message.
+func Sticky(svrType string, sticky bool) {
+	if t := strings.TrimSpace(svrType); t != "" {
+		nonSticky[svrType] = !sticky
+	}
+}
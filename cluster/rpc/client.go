@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -18,11 +19,23 @@ func (e ServerError) Error() string {
 	return string(e)
 }
 
+// CodeError represents an error with code that has been returned from the
+// remote side, the code is sent to client in the error response
+type CodeError struct {
+	Code int
+	Msg  string
+}
+
+func (e *CodeError) Error() string {
+	return e.Msg
+}
+
 var (
 	ErrShutdown        = errors.New("connection is shut down")
 	ErrRequestOverFlow = errors.New("request too long")
 	ErrEmptyBuffer     = errors.New("empty buffer")
 	ErrTruncedBuffer   = errors.New("buffer length less than response length")
+	ErrTimeout         = errors.New("rpc call timeout")
 )
 
 var debugLog = false
@@ -36,6 +49,26 @@ type Call struct {
 	Reply         *[]byte    // The reply from the function.
 	Error         error      // After completion, the error status.
 	Done          chan *Call // Strobes when call is complete.
+	seq           uint64     // sequence number, valid only when Reply is not nil
+	session       *SessionContext
+}
+
+// SessionContext represents the context of frontend session, which will be
+// forwarded to remote server along with the request
+type SessionContext struct {
+	Uid     int64  // uid bound to frontend session
+	Remote  string // remote address of client
+	State   []byte // gob encoded session data
+	TraceID string // trace id of client message
+	SpanID  string // span id of caller
+}
+
+type sessionContextKey struct{}
+
+// WithSessionContext returns a copy of ctx which carries the session context,
+// pass it to CallContext to forward the session context
+func WithSessionContext(ctx context.Context, sc *SessionContext) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sc)
 }
 
 // Client represents an RPC Client.
@@ -53,6 +86,7 @@ type Client struct {
 	pending          map[uint64]*Call
 	closing          bool           // user has called Close
 	shutdown         bool           // server has told us to stop
+	accept           string         // compression algorithm accepted by server
 	shutdownCallback func()         // callback on client shutdown
 	ResponseChan     chan *Response // rpc response handler
 }
@@ -77,7 +111,11 @@ func (codec *clientCodec) close() error {
 func (client *Client) writeRequest() error {
 	data, err := client.request.MarshalMsg(emptyBytes)
 	if err != nil {
-		log.Errorf(err.Error())
+		log.WithFields(log.Fields{
+			"method": client.request.ServiceMethod,
+			"seq":    client.request.Seq,
+			"sid":    client.request.Sid,
+		}).Errorf("rpc: marshal request error: %s", err.Error())
 		return err
 	}
 	_, err = client.codec.rw.Write(data)
@@ -88,6 +126,16 @@ func (client *Client) send(rpcKind RpcKind, call *Call) {
 	client.reqMutex.Lock()
 	defer client.reqMutex.Unlock()
 
+	var state []byte
+	if call.session != nil {
+		state = call.session.State
+	}
+	if err := checkPayload(call.ServiceMethod, len(call.Args)+len(state)); err != nil {
+		call.Error = err
+		call.done()
+		return
+	}
+
 	// Register this call.
 	client.mutex.Lock()
 	if client.shutdown || client.closing {
@@ -96,22 +144,46 @@ func (client *Client) send(rpcKind RpcKind, call *Call) {
 		call.done()
 		return
 	}
+	accept := client.accept
 	seq := client.seq
 	if call.Reply != nil {
 		client.seq++
 		client.pending[seq] = call
+		call.seq = seq
 	}
 	client.mutex.Unlock()
 
 	// Encode and send the request.
 	client.request.Seq = seq
 	client.request.ServiceMethod = call.ServiceMethod
-	client.request.Data = call.Args
 	client.request.Kind = rpcKind
 	client.request.Sid = call.Sid
+	if sc := call.session; sc != nil {
+		client.request.Uid = sc.Uid
+		client.request.Remote = sc.Remote
+		client.request.State = sc.State
+		client.request.TraceID = sc.TraceID
+		client.request.SpanID = sc.SpanID
+	} else {
+		client.request.Uid = 0
+		client.request.Remote = ""
+		client.request.State = nil
+		client.request.TraceID = ""
+		client.request.SpanID = ""
+	}
+	client.request.Accept = accepted()
 
-	if err := client.writeRequest(); err != nil {
-		log.Errorf(err.Error())
+	data, algorithm, err := compressPayload(call.Args, accept)
+	if err == nil {
+		client.request.Data, client.request.Compression = data, algorithm
+		err = client.writeRequest()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"method": call.ServiceMethod,
+			"seq":    seq,
+			"sid":    call.Sid,
+		}).Errorf("rpc: write request error: %s", err.Error())
 		client.mutex.Lock()
 		call = client.pending[seq]
 		delete(client.pending, seq)
@@ -136,12 +208,26 @@ func (client *Client) input() {
 		client.codec.buf = append(client.codec.buf, tmp[:n]...)
 		for {
 			response = &Response{}
-			client.codec.buf, err = response.UnmarshalMsg(client.codec.buf)
+			// keep the truncated data until the rest arrives
+			rest, err := response.UnmarshalMsg(client.codec.buf)
 			if err != nil {
 				//log.Error(err.Error())
 				break
 			}
-			if response.Kind == HandlerPush || response.Kind == HandlerResponse {
+			client.codec.buf = rest
+			if response.Accept != "" {
+				client.mutex.Lock()
+				client.accept = response.Accept
+				client.mutex.Unlock()
+			}
+			// error of payload will be reported to the pending call
+			perr := response.decodePayload()
+			if response.Kind == HandlerPush || response.Kind == HandlerResponse || response.Kind == HandlerMulticast ||
+				response.Kind == HandlerBroadcast {
+				if perr != nil {
+					log.Errorf("rpc: decode %s payload error: %s", response.Kind, perr.Error())
+					continue
+				}
 				client.ResponseChan <- response
 				continue
 			}
@@ -159,11 +245,18 @@ func (client *Client) input() {
 				// error reading request body. We should still attempt
 				// to read error body, but there's no one to give it to.
 				// err = errors.New("reading error body")
+			case perr != nil:
+				call.Error = perr
+				call.done()
 			case response.Error != "":
 				// We've got an error response. Give this to the request;
 				// any subsequent requests will get the ReadResponseBody
 				// error if there is one.
-				call.Error = ServerError(response.Error)
+				if response.ErrorCode != 0 {
+					call.Error = &CodeError{Code: response.ErrorCode, Msg: response.Error}
+				} else {
+					call.Error = ServerError(response.Error)
+				}
 				if err != nil {
 					err = errors.New("reading error body: " + err.Error())
 				}
@@ -196,7 +289,7 @@ func (client *Client) input() {
 	client.mutex.Unlock()
 	client.reqMutex.Unlock()
 	if debugLog && err != io.EOF && !closing {
-		log.Errorf("rpc: client protocol error:", err)
+		log.Errorf("rpc: client protocol error: %v", err)
 	}
 	if client.shutdownCallback != nil {
 		client.shutdownCallback()
@@ -263,7 +356,12 @@ func (client *Client) Close() error {
 // the same Call object.  If done is nil, Go will allocate a new channel.
 // If non-nil, done must be buffered or Go will deliberately crash.
 func (client *Client) Go(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, done chan *Call, args []byte) *Call {
+	return client.goCall(rpcKind, service, method, sid, reply, done, args, nil)
+}
+
+func (client *Client) goCall(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, done chan *Call, args []byte, sc *SessionContext) *Call {
 	call := new(Call)
+	call.session = sc
 	call.ServiceMethod = service + "." + method
 	call.Args = args
 	call.Reply = reply
@@ -289,3 +387,27 @@ func (client *Client) Call(rpcKind RpcKind, service string, method string, sid i
 	call := <-client.Go(rpcKind, service, method, sid, reply, make(chan *Call, 1), args).Done
 	return call.Error
 }
+
+// CallContext invokes the named function and waits for it to complete or the
+// context to be done, whichever happens first. When the context is done before
+// the response arrives, the pending call is discarded, so a late response will
+// be dropped, and ErrTimeout is returned if the deadline exceeded, otherwise the
+// context error is returned. Session context carried by ctx will be forwarded.
+func (client *Client) CallContext(ctx context.Context, rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, args []byte) error {
+	sc, _ := ctx.Value(sessionContextKey{}).(*SessionContext)
+	call := client.goCall(rpcKind, service, method, sid, reply, make(chan *Call, 1), args, sc)
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		if call.Reply != nil {
+			client.mutex.Lock()
+			delete(client.pending, call.seq)
+			client.mutex.Unlock()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrTimeout
+		}
+		return ctx.Err()
+	}
+}
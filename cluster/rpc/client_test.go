@@ -0,0 +1,127 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_CallContextTimeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	// drain requests without any response
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			if _, err := s.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	reply := new([]byte)
+	err := client.CallContext(ctx, Sys, "Test", "Timeout", 1, reply, []byte("hello"))
+	if err != ErrTimeout {
+		t.Fatalf("expect ErrTimeout, got: %v", err)
+	}
+
+	client.mutex.Lock()
+	n := len(client.pending)
+	client.mutex.Unlock()
+	if n != 0 {
+		t.Fatalf("pending call should be removed, remains: %d", n)
+	}
+}
+
+func TestClient_CallContextCancel(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			if _, err := s.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	reply := new([]byte)
+	err := client.CallContext(ctx, Sys, "Test", "Cancel", 1, reply, []byte("hello"))
+	if err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got: %v", err)
+	}
+}
+
+func TestClient_CallContextSession(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	requests := make(chan *Request, 1)
+	go func() {
+		buf := make([]byte, 512)
+		n, err := s.Read(buf)
+		if err != nil {
+			return
+		}
+		r := &Request{}
+		if _, err := r.UnmarshalMsg(buf[:n]); err == nil {
+			requests <- r
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	ctx := WithSessionContext(context.Background(), &SessionContext{Uid: 1000, Remote: "127.0.0.1:10000", State: []byte("state"), TraceID: "trace", SpanID: "span"})
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	client.CallContext(ctx, Sys, "Test", "Session", 1, new([]byte), []byte("hello"))
+
+	r := <-requests
+	if r.Uid != 1000 || r.Remote != "127.0.0.1:10000" || string(r.State) != "state" || r.TraceID != "trace" || r.SpanID != "span" {
+		t.Fatalf("session context should be forwarded, got: %+v", r)
+	}
+}
+
+func TestClient_CallErrorCode(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	go func() {
+		buf := make([]byte, 512)
+		n, err := s.Read(buf)
+		if err != nil {
+			return
+		}
+		r := &Request{}
+		if _, err := r.UnmarshalMsg(buf[:n]); err != nil {
+			return
+		}
+		resp := &Response{Kind: RemoteResponse, Seq: r.Seq, Error: "not found", ErrorCode: 404}
+		data, _ := resp.MarshalMsg(nil)
+		s.Write(data)
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	err := client.Call(Sys, "Test", "Missing", 1, new([]byte), []byte("hello"))
+	if ce, ok := err.(*CodeError); !ok || ce.Code != 404 || ce.Msg != "not found" {
+		t.Fatalf("expect CodeError, got: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lonnng/starx/compress"
+)
+
+var ErrUnknownCompression = errors.New("rpc: unknown compression algorithm")
+
+// PayloadTooLargeError is returned when the payload of a request or response
+// exceeds the limit set by SetMaxPayload, the size of compressed payload is
+// checked after decompressed, Size is limit+1 if decompressing was stopped
+// at the limit
+type PayloadTooLargeError struct {
+	ServiceMethod string
+	Size          int
+	Limit         int
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("rpc: payload of %s too large(%d > %d)", e.ServiceMethod, e.Size, e.Limit)
+}
+
+// payload options shared by all clients and servers in process
+var payload struct {
+	sync.RWMutex
+	compressor compress.Compressor
+	threshold  int
+	limit      int
+}
+
+// SetCompressor enable payload compression, the data longer than threshold
+// will be compressed when the peer accepts the algorithm. The algorithm is
+// negotiated per rpc, the caller declares the accepted algorithm in request,
+// and the server declares it in response, so the peers without compressor
+// or with different algorithms keep exchanging uncompressed data
+func SetCompressor(c compress.Compressor, threshold int) {
+	payload.Lock()
+	defer payload.Unlock()
+
+	payload.compressor = c
+	payload.threshold = threshold
+}
+
+// SetMaxPayload set the maximum length of data and session state of request,
+// and data of response, unlimited if zero
+func SetMaxPayload(n int) {
+	payload.Lock()
+	defer payload.Unlock()
+
+	payload.limit = n
+}
+
+// accepted returns the name of the algorithm accepted, empty if no compressor
+func accepted() string {
+	payload.RLock()
+	defer payload.RUnlock()
+
+	if payload.compressor == nil {
+		return ""
+	}
+	return payload.compressor.Name()
+}
+
+func checkPayload(method string, size int) error {
+	payload.RLock()
+	limit := payload.limit
+	payload.RUnlock()
+
+	if limit > 0 && size > limit {
+		return &PayloadTooLargeError{ServiceMethod: method, Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// compressPayload compress the data if the peer accepts the algorithm,
+// returns the data and the algorithm, empty algorithm if not compressed
+func compressPayload(data []byte, accept string) ([]byte, string, error) {
+	payload.RLock()
+	c, threshold := payload.compressor, payload.threshold
+	payload.RUnlock()
+
+	if c == nil || accept != c.Name() || len(data) <= threshold {
+		return data, "", nil
+	}
+	compressed, err := c.Compress(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return compressed, c.Name(), nil
+}
+
+// decompressPayload decompress the data, inflating stops once the data
+// exceeds the payload limit, so oversized payloads never reach memory
+func decompressPayload(method string, data []byte, algorithm string) ([]byte, error) {
+	if algorithm == "" {
+		return data, nil
+	}
+
+	payload.RLock()
+	c, limit := payload.compressor, payload.limit
+	payload.RUnlock()
+
+	if c == nil || c.Name() != algorithm {
+		return nil, ErrUnknownCompression
+	}
+	if limit <= 0 {
+		return c.Decompress(data)
+	}
+	data, err := compress.Decompress(c, data, limit)
+	if err == compress.ErrTooLarge {
+		return nil, &PayloadTooLargeError{ServiceMethod: method, Size: limit + 1, Limit: limit}
+	}
+	return data, err
+}
+
+// DecodePayload decompress the data of request and check the size of payload,
+// server should call it before processing the request
+func (r *Request) DecodePayload() error {
+	if err := checkPayload(r.ServiceMethod, len(r.Data)+len(r.State)); err != nil {
+		return err
+	}
+	data, err := decompressPayload(r.ServiceMethod, r.Data, r.Compression)
+	if err != nil {
+		return err
+	}
+	r.Data, r.Compression = data, ""
+	return checkPayload(r.ServiceMethod, len(r.Data)+len(r.State))
+}
+
+// EncodePayload check the size of response data and compress it if accepted
+// by the caller of request, the data will be dropped when too large, server
+// should call it before writing the response
+func (resp *Response) EncodePayload(accept string) error {
+	resp.Accept = accepted()
+	if err := checkPayload(resp.ServiceMethod, len(resp.Data)); err != nil {
+		resp.Data = nil
+		return err
+	}
+	data, algorithm, err := compressPayload(resp.Data, accept)
+	if err != nil {
+		resp.Data = nil
+		return err
+	}
+	resp.Data, resp.Compression = data, algorithm
+	return nil
+}
+
+// decodePayload decompress the data of response and check the size
+func (resp *Response) decodePayload() error {
+	data, err := decompressPayload(resp.ServiceMethod, resp.Data, resp.Compression)
+	if err != nil {
+		return err
+	}
+	resp.Data, resp.Compression = data, ""
+	return checkPayload(resp.ServiceMethod, len(resp.Data))
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/compress/gzip"
+)
+
+// echoServer responds the data of requests, the compression of requests
+// received will be sent to the channel
+func echoServer(conn net.Conn, compression chan<- string) {
+	var tmp []byte
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		tmp = append(tmp, buf[:n]...)
+		for {
+			req := &Request{}
+			rest, err := req.UnmarshalMsg(tmp)
+			if err != nil {
+				break
+			}
+			tmp = rest
+			compression <- req.Compression
+			resp := &Response{Kind: RemoteResponse, ServiceMethod: req.ServiceMethod, Seq: req.Seq}
+			if err := req.DecodePayload(); err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Data = req.Data
+			}
+			if err := resp.EncodePayload(req.Accept); err != nil {
+				resp.Error = err.Error()
+			}
+			WriteResponse(conn, resp)
+		}
+	}
+}
+
+func TestClient_Compression(t *testing.T) {
+	SetCompressor(gzip.NewCompressor(), 16)
+	defer SetCompressor(nil, 0)
+
+	c, s := net.Pipe()
+	defer s.Close()
+	compression := make(chan string, 10)
+	go echoServer(s, compression)
+
+	client := NewClient(c)
+	defer client.Close()
+
+	args := bytes.Repeat([]byte("starx"), 100)
+	for i, expect := range []string{"", "gzip"} {
+		reply := new([]byte)
+		if err := client.Call(User, "Test", "Echo", 1, reply, args); err != nil {
+			t.Fatal(err)
+		}
+		// the first request is not compressed before server accepted
+		if got := <-compression; got != expect {
+			t.Fatalf("call %d: expect compression %q, got %q", i, expect, got)
+		}
+		if !bytes.Equal(*reply, args) {
+			t.Fatalf("call %d: reply mismatch", i)
+		}
+	}
+
+	// short data is not compressed
+	reply := new([]byte)
+	if err := client.Call(User, "Test", "Echo", 1, reply, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-compression; got != "" {
+		t.Fatalf("short data should not be compressed, got %q", got)
+	}
+}
+
+func TestClient_MaxPayload(t *testing.T) {
+	SetMaxPayload(10)
+	defer SetMaxPayload(0)
+
+	c, s := net.Pipe()
+	defer s.Close()
+	compression := make(chan string, 10)
+	go echoServer(s, compression)
+
+	client := NewClient(c)
+	defer client.Close()
+
+	reply := new([]byte)
+	err := client.Call(User, "Test", "Echo", 1, reply, make([]byte, 11))
+	if e, ok := err.(*PayloadTooLargeError); !ok || e.Size != 11 || e.Limit != 10 {
+		t.Fatalf("expect PayloadTooLargeError, got: %v", err)
+	}
+	select {
+	case <-compression:
+		t.Fatal("request too large should not be sent")
+	default:
+	}
+
+	if err := client.Call(User, "Test", "Echo", 1, reply, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequest_DecodePayload(t *testing.T) {
+	SetCompressor(gzip.NewCompressor(), 0)
+	defer SetCompressor(nil, 0)
+	SetMaxPayload(100)
+	defer SetMaxPayload(0)
+
+	// payload exceeds the limit after decompressed
+	data, algorithm, err := compressPayload(make([]byte, 1000), "gzip")
+	if err != nil || algorithm != "gzip" || len(data) > 100 {
+		t.Fatalf("compress error: %v, %q, %d", err, algorithm, len(data))
+	}
+	req := &Request{ServiceMethod: "Test.Echo", Data: data, Compression: algorithm}
+	if e, ok := req.DecodePayload().(*PayloadTooLargeError); !ok || e.Size != 101 {
+		t.Fatalf("decompressing should stop at the limit, got: %v", e)
+	}
+
+	req = &Request{ServiceMethod: "Test.Echo", Data: data, Compression: "zlib"}
+	if err := req.DecodePayload(); err != ErrUnknownCompression {
+		t.Fatalf("expect ErrUnknownCompression, got: %v", err)
+	}
+
+	resp := &Response{ServiceMethod: "Test.Echo", Data: make([]byte, 101)}
+	if _, ok := resp.EncodePayload("gzip").(*PayloadTooLargeError); !ok || resp.Data != nil {
+		t.Fatal("data of response too large should be dropped")
+	}
+}
@@ -4,10 +4,12 @@ package rpc
 type ResponseKind byte
 
 const (
-	HandlerResponse ResponseKind = 0x1 // handler session response
-	HandlerPush                  = 0x2 // handler session push
-	RemoteResponse               = 0x3 // remote request normal response, represent whether rpc call successfully
-	RemotePush                   = 0x4 // using remote server push message to current server
+	HandlerResponse  ResponseKind = 0x1 // handler session response
+	HandlerPush                   = 0x2 // handler session push
+	RemoteResponse                = 0x3 // remote request normal response, represent whether rpc call successfully
+	RemotePush                    = 0x4 // using remote server push message to current server
+	HandlerMulticast              = 0x5 // handler push to multiple sessions
+	HandlerBroadcast              = 0x6 // handler push to all sessions of frontend server
 )
 
 type RpcKind byte
@@ -16,6 +18,7 @@ const (
 	_    RpcKind = iota
 	Sys          // sys namespace rpc
 	User         // user namespace rpc
+	Peer         // internal rpc between servers, which carries no session
 )
 
 // Request is a header written before every RPC call.  It is used internally
@@ -27,6 +30,13 @@ type Request struct {
 	Sid           int64   // frontend session id
 	Data          []byte  // for args
 	Kind          RpcKind // namespace
+	Uid           int64   // uid bound to frontend session
+	Remote        string  // remote address of client
+	State         []byte  // gob encoded frontend session data
+	TraceID       string  // trace id of client message
+	SpanID        string  // span id of caller, parent of the span in remote server
+	Compression   string  // algorithm which Data compressed with, empty if not compressed
+	Accept        string  // algorithm of compression accepted by caller in response
 }
 
 // Response is a header written before every RPC return.  It is used internally
@@ -40,4 +50,9 @@ type Response struct {
 	Data          []byte       // save response value
 	Error         string       // error, if any.
 	Route         string       // exists when ResponseType equal RPC_HANDLER_PUSH
+	Sids          []int64      // frontend session ids, exists when ResponseType equal HandlerMulticast
+	TraceID       string       // echoes that of the request
+	ErrorCode     int          // code of error response to client, exists when Error is not empty
+	Compression   string       // algorithm which Data compressed with, empty if not compressed
+	Accept        string       // algorithm of compression accepted by server in later requests
 }
@@ -53,6 +53,41 @@ func (z *Request) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "Uid":
+			z.Uid, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "Remote":
+			z.Remote, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "State":
+			z.State, err = dc.ReadBytes(z.State)
+			if err != nil {
+				return
+			}
+		case "TraceID":
+			z.TraceID, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "SpanID":
+			z.SpanID, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Compression":
+			z.Compression, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Accept":
+			z.Accept, err = dc.ReadString()
+			if err != nil {
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -65,9 +100,9 @@ func (z *Request) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Request) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 5
+	// map header, size 12
 	// write "ServiceMethod"
-	err = en.Append(0x85, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
+	err = en.Append(0x8c, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
 	if err != nil {
 		return err
 	}
@@ -111,15 +146,78 @@ func (z *Request) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "Uid"
+	err = en.Append(0xa3, 0x55, 0x69, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.Uid)
+	if err != nil {
+		return
+	}
+	// write "Remote"
+	err = en.Append(0xa6, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Remote)
+	if err != nil {
+		return
+	}
+	// write "State"
+	err = en.Append(0xa5, 0x53, 0x74, 0x61, 0x74, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBytes(z.State)
+	if err != nil {
+		return
+	}
+	// write "TraceID"
+	err = en.Append(0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.TraceID)
+	if err != nil {
+		return
+	}
+	// write "SpanID"
+	err = en.Append(0xa6, 0x53, 0x70, 0x61, 0x6e, 0x49, 0x44)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.SpanID)
+	if err != nil {
+		return
+	}
+	// write "Compression"
+	err = en.Append(0xab, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Compression)
+	if err != nil {
+		return
+	}
+	// write "Accept"
+	err = en.Append(0xa6, 0x41, 0x63, 0x63, 0x65, 0x70, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Accept)
+	if err != nil {
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Request) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 5
+	// map header, size 12
 	// string "ServiceMethod"
-	o = append(o, 0x85, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
+	o = append(o, 0x8c, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
 	o = msgp.AppendString(o, z.ServiceMethod)
 	// string "Seq"
 	o = append(o, 0xa3, 0x53, 0x65, 0x71)
@@ -133,6 +231,27 @@ func (z *Request) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "Kind"
 	o = append(o, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
 	o = msgp.AppendByte(o, byte(z.Kind))
+	// string "Uid"
+	o = append(o, 0xa3, 0x55, 0x69, 0x64)
+	o = msgp.AppendInt64(o, z.Uid)
+	// string "Remote"
+	o = append(o, 0xa6, 0x52, 0x65, 0x6d, 0x6f, 0x74, 0x65)
+	o = msgp.AppendString(o, z.Remote)
+	// string "State"
+	o = append(o, 0xa5, 0x53, 0x74, 0x61, 0x74, 0x65)
+	o = msgp.AppendBytes(o, z.State)
+	// string "TraceID"
+	o = append(o, 0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	o = msgp.AppendString(o, z.TraceID)
+	// string "SpanID"
+	o = append(o, 0xa6, 0x53, 0x70, 0x61, 0x6e, 0x49, 0x44)
+	o = msgp.AppendString(o, z.SpanID)
+	// string "Compression"
+	o = append(o, 0xab, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendString(o, z.Compression)
+	// string "Accept"
+	o = append(o, 0xa6, 0x41, 0x63, 0x63, 0x65, 0x70, 0x74)
+	o = msgp.AppendString(o, z.Accept)
 	return
 }
 
@@ -181,6 +300,41 @@ func (z *Request) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			if err != nil {
 				return
 			}
+		case "Uid":
+			z.Uid, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "Remote":
+			z.Remote, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "State":
+			z.State, bts, err = msgp.ReadBytesBytes(bts, z.State)
+			if err != nil {
+				return
+			}
+		case "TraceID":
+			z.TraceID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "SpanID":
+			z.SpanID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Compression":
+			z.Compression, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Accept":
+			z.Accept, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -193,7 +347,7 @@ func (z *Request) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 func (z *Request) Msgsize() (s int) {
-	s = 1 + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 5 + msgp.ByteSize
+	s = 1 + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 5 + msgp.ByteSize + 4 + msgp.Int64Size + 7 + msgp.StringPrefixSize + len(z.Remote) + 6 + msgp.BytesPrefixSize + len(z.State) + 8 + msgp.StringPrefixSize + len(z.TraceID) + 7 + msgp.StringPrefixSize + len(z.SpanID) + 12 + msgp.StringPrefixSize + len(z.Compression) + 7 + msgp.StringPrefixSize + len(z.Accept)
 	return
 }
 
@@ -252,6 +406,43 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "Sids":
+			var zsid uint32
+			zsid, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Sids) >= int(zsid) {
+				z.Sids = (z.Sids)[:zsid]
+			} else {
+				z.Sids = make([]int64, zsid)
+			}
+			for zsix := range z.Sids {
+				z.Sids[zsix], err = dc.ReadInt64()
+				if err != nil {
+					return
+				}
+			}
+		case "TraceID":
+			z.TraceID, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "ErrorCode":
+			z.ErrorCode, err = dc.ReadInt()
+			if err != nil {
+				return
+			}
+		case "Compression":
+			z.Compression, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Accept":
+			z.Accept, err = dc.ReadString()
+			if err != nil {
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -264,9 +455,9 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Response) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 7
+	// map header, size 12
 	// write "Kind"
-	err = en.Append(0x87, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
+	err = en.Append(0x8c, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
 	if err != nil {
 		return err
 	}
@@ -328,15 +519,66 @@ func (z *Response) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "Sids"
+	err = en.Append(0xa4, 0x53, 0x69, 0x64, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Sids)))
+	if err != nil {
+		return
+	}
+	for zsix := range z.Sids {
+		err = en.WriteInt64(z.Sids[zsix])
+		if err != nil {
+			return
+		}
+	}
+	// write "TraceID"
+	err = en.Append(0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.TraceID)
+	if err != nil {
+		return
+	}
+	// write "ErrorCode"
+	err = en.Append(0xa9, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt(z.ErrorCode)
+	if err != nil {
+		return
+	}
+	// write "Compression"
+	err = en.Append(0xab, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Compression)
+	if err != nil {
+		return
+	}
+	// write "Accept"
+	err = en.Append(0xa6, 0x41, 0x63, 0x63, 0x65, 0x70, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Accept)
+	if err != nil {
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 7
+	// map header, size 12
 	// string "Kind"
-	o = append(o, 0x87, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
+	o = append(o, 0x8c, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
 	o = msgp.AppendByte(o, byte(z.Kind))
 	// string "ServiceMethod"
 	o = append(o, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
@@ -356,6 +598,24 @@ func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "Route"
 	o = append(o, 0xa5, 0x52, 0x6f, 0x75, 0x74, 0x65)
 	o = msgp.AppendString(o, z.Route)
+	// string "Sids"
+	o = append(o, 0xa4, 0x53, 0x69, 0x64, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Sids)))
+	for zsix := range z.Sids {
+		o = msgp.AppendInt64(o, z.Sids[zsix])
+	}
+	// string "TraceID"
+	o = append(o, 0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	o = msgp.AppendString(o, z.TraceID)
+	// string "ErrorCode"
+	o = append(o, 0xa9, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65)
+	o = msgp.AppendInt(o, z.ErrorCode)
+	// string "Compression"
+	o = append(o, 0xab, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendString(o, z.Compression)
+	// string "Accept"
+	o = append(o, 0xa6, 0x41, 0x63, 0x63, 0x65, 0x70, 0x74)
+	o = msgp.AppendString(o, z.Accept)
 	return
 }
 
@@ -414,6 +674,43 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			if err != nil {
 				return
 			}
+		case "Sids":
+			var zsid uint32
+			zsid, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Sids) >= int(zsid) {
+				z.Sids = (z.Sids)[:zsid]
+			} else {
+				z.Sids = make([]int64, zsid)
+			}
+			for zsix := range z.Sids {
+				z.Sids[zsix], bts, err = msgp.ReadInt64Bytes(bts)
+				if err != nil {
+					return
+				}
+			}
+		case "TraceID":
+			z.TraceID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "ErrorCode":
+			z.ErrorCode, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Compression":
+			z.Compression, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Accept":
+			z.Accept, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -426,7 +723,7 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 func (z *Response) Msgsize() (s int) {
-	s = 1 + 5 + msgp.ByteSize + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 6 + msgp.StringPrefixSize + len(z.Error) + 6 + msgp.StringPrefixSize + len(z.Route)
+	s = 1 + 5 + msgp.ByteSize + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 6 + msgp.StringPrefixSize + len(z.Error) + 6 + msgp.StringPrefixSize + len(z.Route) + 5 + msgp.ArrayHeaderSize + (len(z.Sids) * (msgp.Int64Size)) + 8 + msgp.StringPrefixSize + len(z.TraceID) + 10 + msgp.IntSize + 12 + msgp.StringPrefixSize + len(z.Compression) + 7 + msgp.StringPrefixSize + len(z.Accept)
 	return
 }
 
@@ -37,9 +37,12 @@ func isExported(name string) bool {
 }
 
 var rpcResponseKindNames = []string{
-	HandlerResponse: "HandlerResponse",
-	HandlerPush:     "HandlerPush",
-	RemoteResponse:  "RemoteResponse",
+	HandlerResponse:  "HandlerResponse",
+	HandlerPush:      "HandlerPush",
+	RemoteResponse:   "RemoteResponse",
+	RemotePush:       "RemotePush",
+	HandlerMulticast: "HandlerMulticast",
+	HandlerBroadcast: "HandlerBroadcast",
 }
 
 func (k ResponseKind) String() string {
@@ -52,6 +55,7 @@ func (k ResponseKind) String() string {
 var rpcKindNames = []string{
 	Sys:  "SysRpc",  // system rpc
 	User: "UserRpc", // user rpc
+	Peer: "PeerRpc", // internal rpc between servers
 }
 
 func (k RpcKind) String() string {
@@ -64,7 +68,11 @@ func (k RpcKind) String() string {
 func WriteResponse(w io.Writer, resp *Response) error {
 	data, err := resp.MarshalMsg(emptyBytes)
 	if err != nil {
-		log.Errorf(err.Error())
+		log.WithFields(log.Fields{
+			"method": resp.ServiceMethod,
+			"seq":    resp.Seq,
+			"sid":    resp.Sid,
+		}).Errorf("rpc: marshal response error: %s", err.Error())
 		return err
 	}
 	// TODO: n
@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/route"
+)
+
+// heartbeatRoute is requested over the rpc mesh to measure latency and collect
+// the state reported by peers
+var heartbeatRoute = &route.Route{Service: "__Cluster", Method: "Heartbeat"}
+
+// PeerStatus represents whether the server responded the last heartbeat
+type PeerStatus int
+
+const (
+	PeerUnknown PeerStatus = iota // not probed yet, or frontend server without rpc port
+	PeerUp                        // responded the last heartbeat
+	PeerDown                      // failed to respond the last heartbeat
+)
+
+var peerStatusNames = [...]string{
+	PeerUnknown: "Unknown",
+	PeerUp:      "Up",
+	PeerDown:    "Down",
+}
+
+func (s PeerStatus) String() string {
+	if s < 0 || int(s) >= len(peerStatusNames) {
+		return "Unknown"
+	}
+	return peerStatusNames[s]
+}
+
+// Report represents the state of a server carried by heartbeat response
+type Report struct {
+	Connections int `json:"connections"` // client connections of the server
+}
+
+// Peer represents the live state of a server in cluster
+type Peer struct {
+	ID          string        `json:"id"`
+	Type        string        `json:"type"`
+	Host        string        `json:"host"`
+	Port        int           `json:"port"`
+	IsFrontend  bool          `json:"is_frontend"`
+	Status      PeerStatus    `json:"status"`
+	Latency     time.Duration `json:"latency"`     // round trip time of the last heartbeat
+	Connections int           `json:"connections"` // client connections reported in the last heartbeat
+	LastSeen    time.Time     `json:"last_seen"`   // when the last heartbeat responded
+}
+
+var (
+	peersLock sync.RWMutex
+	peers     = make(map[string]*Peer) // server id -> state of the last heartbeat
+)
+
+// Heartbeat send a heartbeat to the server over rpc, returns the state
+// reported by the server and the round trip time
+func Heartbeat(svrId string) (*Report, time.Duration, error) {
+	start := time.Now()
+	reply, err := CallServer(context.Background(), svrId, heartbeatRoute, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	rtt := time.Since(start)
+
+	r := &Report{}
+	if err := json.Unmarshal(reply, r); err != nil {
+		return nil, 0, err
+	}
+	return r, rtt, nil
+}
+
+// Probe send heartbeats to all servers except current server and frontend
+// servers without rpc port concurrently, and returns the peers whose status
+// changed
+func Probe() []*Peer {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		changed []*Peer
+	)
+	for _, svr := range Servers() {
+		if (svr.IsFrontend && svr.RpcPort == 0) || (appConfig != nil && svr.Id == appConfig.Id) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(svr *ServerConfig) {
+			defer wg.Done()
+			r, rtt, err := Heartbeat(svr.Id)
+			if p := updatePeer(svr, r, rtt, err); p != nil {
+				mu.Lock()
+				changed = append(changed, p)
+				mu.Unlock()
+			}
+		}(svr)
+	}
+	wg.Wait()
+	return changed
+}
+
+// updatePeer save the result of heartbeat, returns a copy of the peer if its
+// status changed
+func updatePeer(svr *ServerConfig, r *Report, rtt time.Duration, err error) *Peer {
+	peersLock.Lock()
+	defer peersLock.Unlock()
+
+	p, ok := peers[svr.Id]
+	if !ok {
+		p = &Peer{}
+		peers[svr.Id] = p
+	}
+	last := p.Status
+	if err != nil {
+		p.Status = PeerDown
+	} else {
+		p.Status = PeerUp
+		p.Latency = rtt
+		p.Connections = r.Connections
+		p.LastSeen = time.Now()
+	}
+	if p.Status == last {
+		return nil
+	}
+	c := peerOf(svr)
+	return &c
+}
+
+// peerOf returns the state of the server, peersLock should be held
+func peerOf(svr *ServerConfig) Peer {
+	p := Peer{}
+	if s, ok := peers[svr.Id]; ok {
+		p = *s
+	}
+	p.ID, p.Type, p.Host, p.Port, p.IsFrontend = svr.Id, svr.Type, svr.Host, svr.Port, svr.IsFrontend
+	return p
+}
+
+func removePeer(svrId string) {
+	peersLock.Lock()
+	defer peersLock.Unlock()
+
+	delete(peers, svrId)
+}
+
+// Topology returns the live view of all servers in cluster ordered by server
+// type, the state of peers is updated by Probe
+func Topology() []*Peer {
+	svrs := Servers()
+
+	peersLock.RLock()
+	defer peersLock.RUnlock()
+
+	topology := make([]*Peer, 0, len(svrs))
+	for _, svr := range svrs {
+		p := peerOf(svr)
+		topology = append(topology, &p)
+	}
+	return topology
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/client"
+)
+
+var ErrEmptyMix = errors.New("mix should contain at least one route")
+
+// config represents the settings of benchmark
+type config struct {
+	addr     string        // address of frontend server
+	admin    string        // address of admin server
+	clients  int           // number of concurrent clients
+	duration time.Duration // duration of benchmark
+	timeout  time.Duration // timeout of each request
+	rate     float64       // messages per second of each client, unlimited if zero
+	rampUp   time.Duration // duration to connect all clients evenly
+	mix      []*routeMix   // routes to send
+	payload  string        // payload of messages
+}
+
+// routeMix represents a route in the mix of messages
+type routeMix struct {
+	route  string
+	notify bool // send notify instead of request
+	weight int
+}
+
+// parseMix parse the mix of routes, which is a comma separated list of
+// `[notify:]route[=weight]`, weight defaults to 1
+func parseMix(s string) ([]*routeMix, error) {
+	var mix []*routeMix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		m := &routeMix{weight: 1}
+		if strings.HasPrefix(item, "notify:") {
+			m.notify = true
+			item = strings.TrimPrefix(item, "notify:")
+		}
+		if i := strings.LastIndex(item, "="); i >= 0 {
+			w, err := strconv.Atoi(item[i+1:])
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("invalid weight of route %s: %q", item[:i], item[i+1:])
+			}
+			m.weight = w
+			item = item[:i]
+		}
+		if item == "" {
+			return nil, fmt.Errorf("empty route in mix %q", s)
+		}
+		m.route = item
+		mix = append(mix, m)
+	}
+	if len(mix) == 0 {
+		return nil, ErrEmptyMix
+	}
+	return mix, nil
+}
+
+// pick returns the route of n, which should be in [0, total weight)
+func pick(mix []*routeMix, n int) *routeMix {
+	for _, m := range mix {
+		if n < m.weight {
+			return m
+		}
+		n -= m.weight
+	}
+	return mix[len(mix)-1]
+}
+
+func totalWeight(mix []*routeMix) int {
+	total := 0
+	for _, m := range mix {
+		total += m.weight
+	}
+	return total
+}
+
+// serverStats represents the statistics queried from admin server, which is
+// the subset of starx.Statistics
+type serverStats struct {
+	PacketsIn      int64
+	PacketsOut     int64
+	PacketsDropped int64
+}
+
+func queryStats(admin string) (*serverStats, error) {
+	resp, err := http.Get("http://" + admin + "/stats")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query server statistics: %s", resp.Status)
+	}
+	s := &serverStats{}
+	if err := json.NewDecoder(resp.Body).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// run the benchmark, and returns the report when all clients finished
+func run(cfg *config) (*report, error) {
+	var before *serverStats
+	if cfg.admin != "" {
+		var err error
+		if before, err = queryStats(cfg.admin); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		wg        sync.WaitGroup
+		recorders = make([]*recorder, cfg.clients)
+		start     = time.Now()
+		deadline  = start.Add(cfg.duration)
+		payload   = []byte(cfg.payload)
+	)
+	for i := range recorders {
+		recorders[i] = newRecorder()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if cfg.rampUp > 0 {
+				time.Sleep(cfg.rampUp * time.Duration(i) / time.Duration(cfg.clients))
+			}
+			simulate(cfg, payload, deadline, recorders[i], int64(i))
+		}(i)
+	}
+	wg.Wait()
+
+	r := newReport(cfg.mix, recorders, time.Since(start))
+	if before != nil {
+		after, err := queryStats(cfg.admin)
+		if err != nil {
+			return nil, err
+		}
+		r.server = &serverStats{
+			PacketsIn:      after.PacketsIn - before.PacketsIn,
+			PacketsOut:     after.PacketsOut - before.PacketsOut,
+			PacketsDropped: after.PacketsDropped - before.PacketsDropped,
+		}
+	}
+	return r, nil
+}
+
+// simulate a client which sends messages until the deadline
+func simulate(cfg *config, payload []byte, deadline time.Time, rec *recorder, seed int64) {
+	c, err := client.Dial(cfg.addr)
+	if err != nil {
+		rec.connectErrors++
+		return
+	}
+	defer c.Close()
+
+	var (
+		rnd      = rand.New(rand.NewSource(seed))
+		total    = totalWeight(cfg.mix)
+		interval time.Duration
+		next     = time.Now()
+	)
+	if cfg.rate > 0 {
+		interval = time.Duration(float64(time.Second) / cfg.rate)
+	}
+
+	for time.Now().Before(deadline) {
+		if interval > 0 {
+			next = next.Add(interval)
+			if d := time.Until(next); d > 0 {
+				time.Sleep(d)
+			}
+		}
+
+		m := pick(cfg.mix, rnd.Intn(total))
+		if m.notify {
+			rec.notified(m.route, c.Notify(m.route, payload))
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+			var reply []byte
+			begin := time.Now()
+			err := c.RequestContext(ctx, m.route, payload, &reply)
+			cancel()
+			rec.record(m.route, time.Since(begin), err)
+		}
+
+		if c.Err() != nil {
+			rec.disconnects++
+			return
+		}
+	}
+}
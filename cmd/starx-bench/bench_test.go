@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := parseMix("Room.Join, notify:Room.Message=9,chat.Room.Leave=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*routeMix{
+		{route: "Room.Join", weight: 1},
+		{route: "Room.Message", notify: true, weight: 9},
+		{route: "chat.Room.Leave", weight: 2},
+	}
+	if !reflect.DeepEqual(mix, want) {
+		t.Fatalf("unexpected mix: %+v", mix)
+	}
+
+	for _, s := range []string{"", " , ", "Room.Join=0", "Room.Join=x", "=1"} {
+		if _, err := parseMix(s); err == nil {
+			t.Fatalf("mix %q should be invalid", s)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	mix := []*routeMix{{route: "a", weight: 1}, {route: "b", weight: 3}}
+	got := ""
+	for n := 0; n < totalWeight(mix); n++ {
+		got += pick(mix, n).route
+	}
+	if got != "abbb" {
+		t.Fatalf("unexpected picks: %s", got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	mix := []*routeMix{{route: "Room.Join", weight: 1}, {route: "Room.Message", notify: true, weight: 1}}
+	r1, r2 := newRecorder(), newRecorder()
+	for i := 100; i > 0; i-- {
+		r1.record("Room.Join", time.Duration(i)*time.Millisecond, nil)
+	}
+	r2.record("Room.Join", 0, context.DeadlineExceeded)
+	r2.record("Room.Join", 0, errors.New("closed"))
+	r2.notified("Room.Message", nil)
+	r2.connectErrors++
+
+	r := newReport(mix, []*recorder{r1, r2}, time.Second)
+	s := r.routes["Room.Join"]
+	if s.sent != 100 || s.timeouts != 1 || s.errors != 1 || r.routes["Room.Message"].sent != 1 || r.connectErrors != 1 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := percentile(s.latencies, p); got != want {
+			t.Fatalf("p%v should be %v, got %v", p, want, got)
+		}
+	}
+	if percentile(nil, 50) != 0 {
+		t.Fatal("percentile of empty latencies should be zero")
+	}
+}
@@ -0,0 +1,54 @@
+// Command starx-bench spins up concurrent simulated clients against a running
+// frontend server, sends a configurable mix of requests and notifies, and
+// reports the latency percentiles of each route and the packets dropped by
+// server, so performance regressions in the packet and dispatch layers are
+// measurable.
+//
+//	starx-bench -addr 127.0.0.1:3250 -admin 127.0.0.1:3251 -clients 500 \
+//		-duration 30s -mix "Room.Join=1,notify:Room.Message=9" \
+//		-payload '{"name":"bot","content":"hello"}'
+//
+// Each item of mix is `[notify:]route[=weight]`, messages of a route are sent
+// in proportion to its weight, requests wait for the response before the next
+// message is sent by the same client, notifies do not. Server side statistics
+// are queried from the admin server before and after the benchmark when the
+// admin address is set.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	var (
+		cfg = &config{}
+		mix string
+	)
+	flag.StringVar(&cfg.addr, "addr", "127.0.0.1:3250", "address of frontend server")
+	flag.StringVar(&cfg.admin, "admin", "", "address of admin server, server statistics are reported if set")
+	flag.IntVar(&cfg.clients, "clients", 100, "number of concurrent clients")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "duration of benchmark")
+	flag.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "timeout of each request")
+	flag.Float64Var(&cfg.rate, "rate", 0, "messages per second of each client, unlimited if zero")
+	flag.DurationVar(&cfg.rampUp, "ramp-up", 0, "duration to connect all clients evenly")
+	flag.StringVar(&mix, "mix", "", "routes to send, e.g. \"Room.Join=1,notify:Room.Message=9\"")
+	flag.StringVar(&cfg.payload, "payload", "{}", "payload of messages, which is sent as it is")
+	flag.Parse()
+
+	var err error
+	if cfg.mix, err = parseMix(mix); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	r, err := run(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r.print(os.Stdout)
+}
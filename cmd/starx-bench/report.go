@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// stat represents the result of a route
+type stat struct {
+	sent      int             // messages sent successfully
+	errors    int             // messages failed to send or responded with error
+	timeouts  int             // requests without response in timeout, which may be dropped by server
+	latencies []time.Duration // latencies of requests
+}
+
+// recorder records the results of a client, which is not safe for
+// concurrent use, each client has its own recorder
+type recorder struct {
+	routes        map[string]*stat
+	connectErrors int
+	disconnects   int
+}
+
+func newRecorder() *recorder {
+	return &recorder{routes: make(map[string]*stat)}
+}
+
+func (r *recorder) stat(route string) *stat {
+	s, ok := r.routes[route]
+	if !ok {
+		s = &stat{}
+		r.routes[route] = s
+	}
+	return s
+}
+
+// record the result of a request
+func (r *recorder) record(route string, latency time.Duration, err error) {
+	s := r.stat(route)
+	switch err {
+	case nil:
+		s.sent++
+		s.latencies = append(s.latencies, latency)
+	case context.DeadlineExceeded:
+		s.timeouts++
+	default:
+		s.errors++
+	}
+}
+
+// notified record the result of a notify
+func (r *recorder) notified(route string, err error) {
+	s := r.stat(route)
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.sent++
+}
+
+// report represents the result of benchmark
+type report struct {
+	elapsed       time.Duration
+	clients       int
+	connectErrors int
+	disconnects   int
+	mix           []*routeMix
+	routes        map[string]*stat
+	server        *serverStats // statistics delta of server, nil if admin address not set
+}
+
+// newReport merge the results of all clients, latencies are sorted
+func newReport(mix []*routeMix, recorders []*recorder, elapsed time.Duration) *report {
+	r := &report{
+		elapsed: elapsed,
+		clients: len(recorders),
+		mix:     mix,
+		routes:  make(map[string]*stat),
+	}
+	for _, m := range mix {
+		r.routes[m.route] = &stat{}
+	}
+	for _, rec := range recorders {
+		r.connectErrors += rec.connectErrors
+		r.disconnects += rec.disconnects
+		for route, s := range rec.routes {
+			merged := r.routes[route]
+			merged.sent += s.sent
+			merged.errors += s.errors
+			merged.timeouts += s.timeouts
+			merged.latencies = append(merged.latencies, s.latencies...)
+		}
+	}
+	for _, s := range r.routes {
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	}
+	return r
+}
+
+// percentile returns the latency of the percentile p in (0, 100] from the
+// sorted latencies, zero if no latency
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "clients: %d, elapsed: %v, connect errors: %d, disconnects: %d\n\n",
+		r.clients, r.elapsed.Round(time.Millisecond), r.connectErrors, r.disconnects)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "route\ttype\tsent\tper sec\terrors\ttimeouts\tp50\tp90\tp99\tmax\t")
+	total := 0
+	for _, m := range r.mix {
+		s := r.routes[m.route]
+		total += s.sent
+		typ, latencies := "request", make([]interface{}, 0, 4)
+		for _, p := range []float64{50, 90, 99, 100} {
+			latencies = append(latencies, percentile(s.latencies, p))
+		}
+		if m.notify {
+			// notifies have no response
+			typ, latencies = "notify", []interface{}{"-", "-", "-", "-"}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\t%d\t%d\t%v\t%v\t%v\t%v\t\n",
+			append([]interface{}{m.route, typ, s.sent, float64(s.sent) / r.elapsed.Seconds(), s.errors, s.timeouts},
+				latencies...)...)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\ntotal: %d messages, %.1f per sec\n", total, float64(total)/r.elapsed.Seconds())
+
+	if r.server != nil {
+		fmt.Fprintf(w, "server: %d packets in, %d packets out, %d packets dropped\n",
+			r.server.PacketsIn, r.server.PacketsOut, r.server.PacketsDropped)
+	}
+}
@@ -1,8 +1,39 @@
 package component
 
+// Component is the unit of application logic, exported methods of a component
+// will be registered as handlers or remote methods. Lifecycle hooks of all
+// components are called in registration order at the following points:
+//   - Init: server startup, before any connection has been accepted, it's the
+//     right place to open database pools etc.
+//   - AfterInit: all components have been initialized
+//   - BeforeShutdown: server is stopping, connections are still alive, it's
+//     the right place to flush state
+//   - Shutdown: all components have been notified that server is stopping
+//
+// Components registered at runtime are initialized immediately, and will be
+// shut down when unregistered.
 type Component interface {
 	Init()
 	AfterInit()
 	BeforeShutdown()
 	Shutdown()
 }
+
+// Exposer can be implemented by components to declare the server types which
+// expose the handler methods to clients, e.g. only gate handles Login, and
+// only game handles Battle. The handler methods of the component registered
+// in other server types can not be called by clients, remote methods are not
+// affected.
+type Exposer interface {
+	ExposedBy() []string
+}
+
+// Idempotent can be implemented by components to declare the handler methods
+// which are safe to be handled more than once, e.g. queries. The requests of
+// these methods forwarded by frontend server will be retried on another
+// server of the same type when the selected server failed. Components of
+// backend servers are not registered in frontend server, declare their routes
+// by starx.SetIdempotent in frontend server instead.
+type Idempotent interface {
+	IdempotentMethods() []string
+}
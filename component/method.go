@@ -1,6 +1,7 @@
 package component
 
 import (
+	"context"
 	"reflect"
 	"unicode"
 	"unicode/utf8"
@@ -12,6 +13,7 @@ var (
 	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
 	typeOfBytes   = reflect.TypeOf(([]byte)(nil))
 	typeOfSession = reflect.TypeOf(session.New(nil))
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
 
 func isExported(name string) bool {
@@ -37,8 +39,13 @@ func isHandlerMethod(method reflect.Method) bool {
 		return false
 	}
 
-	// Method needs three ins: receiver, *Session, []byte or pointer.
-	if mt.NumIn() != 3 {
+	// Method needs three ins: receiver, *Session, []byte or pointer, or four
+	// ins with context.Context ahead of *Session.
+	n := mt.NumIn()
+	if n == 4 && mt.In(1) != typeOfContext {
+		return false
+	}
+	if n != 3 && n != 4 {
 		return false
 	}
 
@@ -47,11 +54,11 @@ func isHandlerMethod(method reflect.Method) bool {
 		return false
 	}
 
-	if t1 := mt.In(1); t1.Kind() != reflect.Ptr || t1 != typeOfSession {
+	if t1 := mt.In(n - 2); t1.Kind() != reflect.Ptr || t1 != typeOfSession {
 		return false
 	}
 
-	if (mt.In(2).Kind() != reflect.Ptr && mt.In(2) != typeOfBytes) || mt.Out(0) != typeOfError {
+	if (mt.In(n-1).Kind() != reflect.Ptr && mt.In(n-1) != typeOfBytes) || mt.Out(0) != typeOfError {
 		return false
 	}
 	return true
@@ -88,11 +95,12 @@ func suitableHandlerMethods(typ reflect.Type, reportErr bool) map[string]*Handle
 		mt := method.Type
 		mn := method.Name
 		if isHandlerMethod(method) {
+			n := mt.NumIn()
 			raw := false
-			if mt.In(2) == typeOfBytes {
+			if mt.In(n-1) == typeOfBytes {
 				raw = true
 			}
-			methods[mn] = &HandlerMethod{Method: method, Type: mt.In(2), Raw: raw}
+			methods[mn] = &HandlerMethod{Method: method, Type: mt.In(n - 1), Raw: raw, Context: n == 4}
 		}
 	}
 	return methods
@@ -1,17 +1,31 @@
 package component
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"sync"
+
+	"github.com/lonnng/starx/session"
 )
 
 type HandlerMethod struct {
 	sync.Mutex
-	Method   reflect.Method
-	Type     reflect.Type
-	Raw      bool //Whether the data need to serialize
-	numCalls uint
+	Method     reflect.Method
+	Type       reflect.Type
+	Raw        bool //Whether the data need to serialize
+	Idempotent bool // safe to be retried on another server, see Idempotent
+	Context    bool // context.Context is the first argument
+	numCalls   uint
+}
+
+// Args returns the arguments to call the handler method, ctx is passed only if
+// the method accepts it
+func (m *HandlerMethod) Args(rcvr reflect.Value, ctx context.Context, s *session.Session, data interface{}) []reflect.Value {
+	if m.Context {
+		return []reflect.Value{rcvr, reflect.ValueOf(ctx), reflect.ValueOf(s), reflect.ValueOf(data)}
+	}
+	return []reflect.Value{rcvr, reflect.ValueOf(s), reflect.ValueOf(data)}
 }
 
 type RemoteMethod struct {
@@ -27,6 +41,7 @@ type Service struct {
 	Type           reflect.Type              // type of the receiver
 	HandlerMethods map[string]*HandlerMethod // registered methods
 	RemoteMethods  map[string]*RemoteMethod  // registered methods
+	Hidden         bool                      // handler methods not exposed to clients by current server type
 }
 
 // Register publishes in the service the set of methods of the
@@ -35,6 +50,7 @@ type Service struct {
 // - two arguments, both of exported type
 // - the first argument is *session.Session
 // - the second argument is []byte or a pointer
+// - optionally context.Context ahead of all arguments
 func (s *Service) ScanHandler() error {
 	if s.Name == "" {
 		return errors.New("handler.Register: no service name for type " + s.Type.String())
@@ -45,6 +61,13 @@ func (s *Service) ScanHandler() error {
 
 	// Install the methods
 	s.HandlerMethods = suitableHandlerMethods(s.Type, true)
+	if c, ok := s.Rcvr.Interface().(Idempotent); ok {
+		for _, name := range c.IdempotentMethods() {
+			if m, ok := s.HandlerMethods[name]; ok {
+				m.Idempotent = true
+			}
+		}
+	}
 
 	if len(s.HandlerMethods) == 0 {
 		str := ""
@@ -90,6 +113,12 @@ func (s *Service) ScanRemote() error {
 	return nil
 }
 
+func (m *HandlerMethod) IncCalls() {
+	m.Lock()
+	m.numCalls++
+	m.Unlock()
+}
+
 func (m *HandlerMethod) NumCalls() (n uint) {
 	m.Lock()
 	n = m.numCalls
@@ -97,6 +126,12 @@ func (m *HandlerMethod) NumCalls() (n uint) {
 	return n
 }
 
+func (m *RemoteMethod) IncCalls() {
+	m.Lock()
+	m.numCalls++
+	m.Unlock()
+}
+
 func (m *RemoteMethod) NumCalls() (n uint) {
 	m.Lock()
 	n = m.numCalls
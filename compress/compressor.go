@@ -0,0 +1,54 @@
+package compress
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// MaxSize is the default maximum length of decompressed data, which is the
+// maximum length of message carried by a packet
+const MaxSize = 1<<24 - 1
+
+var ErrTooLarge = errors.New("compress: decompressed data too large")
+
+type Compressor interface {
+	Name() string
+	Compress([]byte) ([]byte, error)
+	Decompress([]byte) ([]byte, error)
+}
+
+// LimitDecompressor is implemented by the compressors which can stop
+// inflating data once it exceeds the limit
+type LimitDecompressor interface {
+	DecompressLimit(data []byte, limit int) ([]byte, error)
+}
+
+// Decompress decompress the data, returns ErrTooLarge if the decompressed
+// data is longer than limit
+func Decompress(c Compressor, data []byte, limit int) ([]byte, error) {
+	if l, ok := c.(LimitDecompressor); ok {
+		return l.DecompressLimit(data, limit)
+	}
+	data, err := c.Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// ReadAll read from r until EOF, at most limit+1 bytes will be read, returns
+// ErrTooLarge if r is longer than limit
+func ReadAll(r io.Reader, limit int) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
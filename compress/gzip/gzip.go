@@ -0,0 +1,58 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	"github.com/lonnng/starx/compress"
+)
+
+type Compressor struct {
+	level int
+}
+
+func NewCompressor() *Compressor {
+	return &Compressor{level: gzip.DefaultCompression}
+}
+
+// NewCompressorLevel return a compressor with the special compression level,
+// which should be in range gzip.HuffmanOnly ~ gzip.BestCompression
+func NewCompressorLevel(level int) *Compressor {
+	return &Compressor{level: level}
+}
+
+func (c *Compressor) Name() string {
+	return "gzip"
+}
+
+func (c *Compressor) Compress(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	w, err := gzip.NewWriterLevel(buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress decompress the data, which should not be longer than
+// compress.MaxSize after decompressed
+func (c *Compressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressLimit(data, compress.MaxSize)
+}
+
+// DecompressLimit decompress the data, returns compress.ErrTooLarge once the
+// decompressed data is longer than limit
+func (c *Compressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return compress.ReadAll(r, limit)
+}
@@ -0,0 +1,59 @@
+package gzip
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lonnng/starx/compress"
+)
+
+func TestCompressor_Compress(t *testing.T) {
+	data := bytes.Repeat([]byte("hello world"), 100)
+	c := NewCompressor()
+
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(compressed) >= len(data) {
+		t.Fatalf("compressed data should be shorter, origin: %d, compressed: %d", len(data), len(compressed))
+	}
+
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, decompressed) {
+		t.Fail()
+	}
+}
+
+func BenchmarkCompressor_Compress(b *testing.B) {
+	data := bytes.Repeat([]byte("hello world"), 100)
+	c := NewCompressor()
+
+	for i := 0; i < b.N; i++ {
+		c.Compress(data)
+	}
+
+	b.ReportAllocs()
+}
+
+func TestCompressor_DecompressLimit(t *testing.T) {
+	data := bytes.Repeat([]byte{0}, 1<<20)
+	c := NewCompressor()
+
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.DecompressLimit(compressed, len(data)-1); err != compress.ErrTooLarge {
+		t.Fatalf("expect ErrTooLarge, got %v", err)
+	}
+	if decompressed, err := c.DecompressLimit(compressed, len(data)); err != nil || !bytes.Equal(data, decompressed) {
+		t.Fatalf("data no longer than limit should be decompressed, err: %v", err)
+	}
+}
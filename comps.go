@@ -21,38 +21,214 @@
 package starx
 
 import (
+	"errors"
+	"reflect"
+	"sync"
+
 	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/log"
+)
+
+var (
+	ErrServiceNotFound = errors.New("service not found")
+	ErrServiceExists   = errors.New("service already defined")
 )
 
 var (
-	comps = make([]component.Component, 0)
+	compsLock    sync.Mutex // protect comps and compsStarted
+	comps        = make([]component.Component, 0)
+	compsStarted bool // whether components have been started
 )
 
+// services is the service registry of the current server, handler service
+// for frontend and remote service for backend
+type services interface {
+	newService(c component.Component) (*component.Service, error)
+	put(ns string, s *component.Service, replace bool) (*component.Service, error)
+	serviceIn(ns, name string) (*component.Service, bool)
+}
+
+func localServices() services {
+	if app.config != nil && app.config.IsFrontend {
+		return handler
+	}
+	return remote
+}
+
+// registerComp append the component to components list, and the component
+// serve immediately if server has started already, the component is checked
+// before initializing, so a refused component is never initialized
+func registerComp(c component.Component) error {
+	compsLock.Lock()
+	if !compsStarted {
+		comps = append(comps, c)
+		compsLock.Unlock()
+		return nil
+	}
+	compsLock.Unlock()
+
+	svcs := localServices()
+	ns := namespaceOf(c)
+	s, err := svcs.newService(c)
+	if err != nil {
+		return err
+	}
+	if _, ok := svcs.serviceIn(ns, s.Name); ok {
+		return ErrServiceExists
+	}
+
+	c.Init()
+	c.AfterInit()
+	if _, err := svcs.put(ns, s, false); err != nil {
+		c.BeforeShutdown()
+		c.Shutdown()
+		return err
+	}
+
+	compsLock.Lock()
+	comps = append(comps, c)
+	compsLock.Unlock()
+	return nil
+}
+
+// replaceComp swap in the component for the service of the same name, the
+// old component keeps serving until the new one is initialized, and it is
+// shutdown after the swap, so the routes never miss a service
+func replaceComp(c component.Component) error {
+	compsLock.Lock()
+	if !compsStarted {
+		defer compsLock.Unlock()
+		for i, comp := range comps {
+			if compName(comp) == compName(c) && namespaceOf(comp) == namespaceOf(c) {
+				comps[i] = c
+				if comp != c {
+					removeComponentNamespace(comp)
+				}
+				return nil
+			}
+		}
+		return ErrServiceNotFound
+	}
+	compsLock.Unlock()
+
+	svcs := localServices()
+	ns := namespaceOf(c)
+	s, err := svcs.newService(c)
+	if err != nil {
+		return err
+	}
+	if _, ok := svcs.serviceIn(ns, s.Name); !ok {
+		return ErrServiceNotFound
+	}
+
+	c.Init()
+	c.AfterInit()
+	old, err := svcs.put(ns, s, true)
+	if err != nil {
+		c.BeforeShutdown()
+		c.Shutdown()
+		return err
+	}
+
+	oc := old.Rcvr.Interface().(component.Component)
+	if oc == c {
+		return nil
+	}
+	removeComponentNamespace(oc)
+	compsLock.Lock()
+	for i, comp := range comps {
+		if comp == oc {
+			comps[i] = c
+			break
+		}
+	}
+	compsLock.Unlock()
+
+	oc.BeforeShutdown()
+	oc.Shutdown()
+	return nil
+}
+
+func compName(c component.Component) string {
+	return reflect.Indirect(reflect.ValueOf(c)).Type().Name()
+}
+
+// unregisterComp stop serving the service and shutdown the component
+func unregisterComp(name string) error {
+	var (
+		s   *component.Service
+		err error
+	)
+	if app.config != nil && app.config.IsFrontend {
+		s, err = handler.unregister(name)
+	} else {
+		s, err = remote.unregister(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	c := s.Rcvr.Interface().(component.Component)
+	removeComponentNamespace(c)
+	compsLock.Lock()
+	for i, comp := range comps {
+		if comp == c {
+			comps = append(comps[:i], comps[i+1:]...)
+			break
+		}
+	}
+	compsLock.Unlock()
+
+	c.BeforeShutdown()
+	c.Shutdown()
+	return nil
+}
+
+func serveComp(c component.Component) error {
+	ns := namespaceOf(c)
+	if app.config.IsFrontend {
+		return handler.registerIn(ns, c)
+	}
+	return remote.registerIn(ns, c)
+}
+
 func startupComps() {
-	for _, c := range comps {
+	compsLock.Lock()
+	compsStarted = true
+	list := append([]component.Component(nil), comps...)
+	compsLock.Unlock()
+
+	for _, c := range list {
 		c.Init()
 	}
-	for _, c := range comps {
+	for _, c := range list {
 		c.AfterInit()
 	}
 
-	for _, c := range comps {
-		if app.config.IsFrontend {
-			handler.register(c)
-		} else {
-			remote.register(c)
+	for _, c := range list {
+		if err := serveComp(c); err != nil {
+			log.Error(err.Error())
 		}
 	}
 
+	if app.config.IsFrontend {
+		handler.buildDict()
+		handler.buildProtos()
+	}
+
 	handler.dumpServiceMap()
 	remote.dumpServiceMap()
 }
 
 func shutdownComps() {
-	for _, c := range comps {
+	compsLock.Lock()
+	list := append([]component.Component(nil), comps...)
+	compsLock.Unlock()
+
+	for _, c := range list {
 		c.BeforeShutdown()
 	}
-	for _, c := range comps {
+	for _, c := range list {
 		c.Shutdown()
 	}
 }
@@ -0,0 +1,54 @@
+package starx
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lonnng/starx/session"
+)
+
+var lifecycle []string
+
+type (
+	LifecycleA struct{}
+	LifecycleB struct{}
+)
+
+func (c *LifecycleA) Init()           { lifecycle = append(lifecycle, "A.Init") }
+func (c *LifecycleA) AfterInit()      { lifecycle = append(lifecycle, "A.AfterInit") }
+func (c *LifecycleA) BeforeShutdown() { lifecycle = append(lifecycle, "A.BeforeShutdown") }
+func (c *LifecycleA) Shutdown()       { lifecycle = append(lifecycle, "A.Shutdown") }
+
+func (c *LifecycleA) Handle(s *session.Session, data []byte) error { return nil }
+
+func (c *LifecycleB) Init()           { lifecycle = append(lifecycle, "B.Init") }
+func (c *LifecycleB) AfterInit()      { lifecycle = append(lifecycle, "B.AfterInit") }
+func (c *LifecycleB) BeforeShutdown() { lifecycle = append(lifecycle, "B.BeforeShutdown") }
+func (c *LifecycleB) Shutdown()       { lifecycle = append(lifecycle, "B.Shutdown") }
+
+func (c *LifecycleB) Handle(s *session.Session, data []byte) error { return nil }
+
+func TestComponentLifecycle(t *testing.T) {
+	defer func() {
+		compsStarted = false
+		comps = comps[:0]
+		Unregister("LifecycleA")
+		Unregister("LifecycleB")
+	}()
+
+	lifecycle = nil
+	Register(&LifecycleA{})
+	Register(&LifecycleB{})
+	startupComps()
+	shutdownComps()
+
+	expect := []string{
+		"A.Init", "B.Init",
+		"A.AfterInit", "B.AfterInit",
+		"A.BeforeShutdown", "B.BeforeShutdown",
+		"A.Shutdown", "B.Shutdown",
+	}
+	if !reflect.DeepEqual(lifecycle, expect) {
+		t.Fatalf("expect %v, got %v", expect, lifecycle)
+	}
+}
@@ -21,8 +21,6 @@
 package starx
 
 import (
-	"encoding/json"
-	"io"
 	"net/http"
 	"os"
 	"path"
@@ -30,8 +28,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lonnng/starx/capture"
 	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/compress"
 	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/record"
+	"github.com/lonnng/starx/session"
 	"github.com/lonnng/starx/timer"
 )
 
@@ -50,13 +53,64 @@ var (
 	// env represents the environment of the current process, includes
 	// work path and config path etc.
 	env = &struct {
-		wd                string                      // working path
-		serversConfigPath string                      // servers config path(default: $appPath/configs/servers.json)
-		masterServerId    string                      // master server id
-		serverId          string                      // current process server id
-		settings          map[string][]ServerInitFunc // all settings
-		heartbeatInternal time.Duration               // heartbeat internal
-		die               chan bool                   // wait for end application
+		wd                 string                         // working path
+		serversConfigPath  string                         // servers config path(default: $appPath/configs/servers.json)
+		configPath         string                         // reload config path(default: $appPath/configs/starx.json)
+		masterServerId     string                         // master server id
+		serverId           string                         // current process server id
+		settings           map[string][]ServerInitFunc    // all settings
+		heartbeatInternal  time.Duration                  // heartbeat internal
+		maxPacketSize      int                            // maximum length of packets sent by client, unlimited if zero
+		reloadCallbacks    []func(*ReloadConfig)          // callbacks on config reloaded
+		drainTimeout       time.Duration                  // duration to drain sessions before exit on graceful restart, disabled if zero
+		batchWindow        time.Duration                  // window to aggregate pushes into one packet, disabled if zero
+		single             bool                           // run in single process mode, all routes are served locally
+		errorCodes         ErrorCodes                     // codes of error responses
+		hideErrorDetails   bool                           // respond generic messages instead of error details
+		backpressure       BackpressurePolicy             // policy when receive buffer is full
+		serverBackpressure map[string]BackpressurePolicy  // server type -> backpressure policy, overrides the default policy
+		compressor         compress.Compressor            // compress message data when negotiated in handshake
+		compressThreshold  int                            // data length threshold to trigger compression
+		metricsAddr        string                         // address of metrics http server, disabled if empty
+		rateLimits         map[string]rateLimit           // route -> rate limit of each session, empty route means all messages
+		serverRateLimits   map[string]rateLimit           // server type -> rate limit of each session, messages routed to the server type
+		rateLimitedCb      func(*session.Session, string) // callback on message rate exceeded
+		handshakeValidator func([]byte) error             // validate handshake data, handshake will be rejected if error returned
+		handshakeData      interface{}                    // user-define data sent in handshake response
+		flushInterval      time.Duration                  // interval to gather outbound packets before flush
+		packetCodec        packet.Codec                   // wire protocol of packets
+		packetCodecs       map[string]packet.Codec        // name -> packet codec available for listeners
+		pushPriorities     map[string]Priority            // route -> priority of pushed messages
+		auth               *auth                          // token authentication, disabled if nil
+		dispatchPolicies   map[string]DispatchPolicy      // route or service -> dispatch policy of handler calls
+		inbound            pipeline                       // process raw bytes of inbound messages before decode
+		outbound           pipeline                       // process raw bytes of outbound messages after encode
+		outboundHooks      map[string]OutboundHook        // client type -> hook transforming data of outbound messages
+		serverProtos       map[string]interface{}         // route -> schema of messages pushed by server
+		clientProtos       map[string]interface{}         // route -> schema of messages sent by client
+		resumeGrace        time.Duration                  // how long a disconnected session kept for resuming, disabled if zero
+		replaySize         int                            // maximum messages buffered for suspended session
+		handshakeTimeout   time.Duration                  // connections not handshaked in timeout will be closed, disabled if zero
+		idleTimeout        time.Duration                  // connections idle longer than timeout will be closed, twice of heartbeat if zero
+		writeTimeout       time.Duration                  // deadline of writing packets to connection, disabled if zero
+		ipFilter           *ipFilter                      // allow and deny lists of server config, nil if both empty
+		acceptFilter       AcceptFilter                   // decide whether the connection will be accepted
+		rpcIPFilter        *ipFilter                      // rpc allow and deny lists of server config, nil if both empty
+		rpcAcceptFilter    AcceptFilter                   // decide whether the rpc connection will be accepted
+		exposedRoutes      map[string]map[string]bool     // server type -> services exposed to clients, all exposed if empty
+		recorder           *record.Recorder               // record inbound messages, disabled if nil
+		slowThreshold      time.Duration                  // handler calls running longer are logged with stack, disabled if zero
+		validators         map[string][]Validator         // route -> validators of deserialized messages
+		retries            int                            // times to retry idempotent requests on other servers, disabled if zero
+		idempotentRoutes   map[string]bool                // routes declared by SetIdempotent, e.g. game.Room.Query
+		bulkheads          map[string]*bulkhead           // route or service -> concurrency limit of handler calls
+		topologyInterval   time.Duration                  // interval of heartbeats sent to peers, disabled if zero
+		egress             *egressLimit                   // egress limit of outbound bytes of each session, disabled if nil
+		consolePath        string                         // unix socket path of debug console, disabled if empty
+		adminToken         string                         // token required by admin server, only readiness probe served if empty
+		sniffer            PacketSniffer                  // receive packets on the wire of client connections, disabled if nil
+		capture            *capture.Writer                // dump packets on the wire of client connections, disabled if nil
+		die                chan bool                      // wait for end application
 
 		checkOrigin func(*http.Request) bool // check origin when websocket enabled
 	}{}
@@ -77,50 +131,44 @@ func init() {
 	// environment initialize
 	env.settings = make(map[string][]ServerInitFunc)
 	env.die = make(chan bool)
+	env.packetCodec = packet.DefaultCodec
+	env.handshakeTimeout = defaultHandshakeTimeout
+	env.writeTimeout = defaultWriteTimeout
+	env.topologyInterval = defaultTopologyInterval
+	env.errorCodes = ErrorCodes{BadRequest: CodeBadRequest, Unauthorized: CodeUnauthorized, Forbidden: CodeForbidden, NotFound: CodeNotFound, TooManyRequests: CodeTooManyRequests, Internal: CodeInternal, Busy: CodeBusy}
 
 	if wd, err := os.Getwd(); err != nil {
 		panic(err)
 	} else {
 		env.wd, _ = filepath.Abs(wd)
 
-		// config file path
-		serversConfigPath := filepath.Join(wd, "configs", "servers.json")
-
-		if fileExists(serversConfigPath) {
-			env.serversConfigPath = serversConfigPath
-		}
 	}
 }
 
 func loadServers() {
+	if env.serversConfigPath == "" {
+		env.serversConfigPath = findServersConfig()
+	}
+
 	// initialize servers config
 	if !fileExists(env.serversConfigPath) {
-		log.Fatalf("%s not found", env.serversConfigPath)
+		log.Fatalf("servers config %q not found", env.serversConfigPath)
 		return
 	}
 
-	// read config file
-	f, _ := os.Open(env.serversConfigPath)
-	defer f.Close()
-
-	// load config from file
-	reader := json.NewDecoder(f)
-	var servers map[string][]*cluster.ServerConfig
-	for {
-		if err := reader.Decode(&servers); err == io.EOF {
-			break
-		} else if err != nil {
-			log.Errorf(err.Error())
-		}
+	servers, err := readServers(env.serversConfigPath)
+	if err != nil {
+		log.Fatal(err.Error())
+		return
 	}
 
 	// register server to cluster
-	for typ, svrs := range servers {
+	for _, svrs := range servers {
 		for _, svr := range svrs {
-			svr.Type = typ
 			cluster.Register(svr)
 		}
 	}
+	deriveServer()
 	cluster.DumpServers()
 }
 
@@ -141,7 +189,7 @@ func initSetting() {
 		// if server running in cluster mode, master server config require
 		// initialize master server config
 		if env.masterServerId == "" {
-			log.Fatalf("master server id must be set in cluster mode", env.masterServerId)
+			log.Fatal("master server id must be set in cluster mode")
 		}
 
 		if server, err := cluster.Server(env.masterServerId); err != nil {
@@ -163,6 +211,26 @@ func initSetting() {
 		}
 	}
 
+	if err := overrideServer(app.config, os.LookupEnv); err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := validateServer(app.config); err != nil {
+		log.Fatal(err.Error())
+	}
+	if env.single && !app.config.IsFrontend {
+		log.Fatal("server running in single process mode must be frontend")
+	}
+	if f, err := newIPFilter(app.config.Allow, app.config.Deny); err != nil {
+		log.Fatal(err.Error())
+	} else {
+		env.ipFilter = f
+	}
+	if f, err := newIPFilter(app.config.RpcAllow, app.config.RpcDeny); err != nil {
+		log.Fatal(err.Error())
+	} else {
+		env.rpcIPFilter = f
+	}
+
 	// dependencies initialization
 	cluster.SetAppConfig(app.config)
 }
@@ -180,8 +248,10 @@ func initServer() {
 
 	// register heartbeat service
 	if app.config.IsFrontend {
-		timer.Register(env.heartbeatInternal, func() {
+		reloadLock.Lock()
+		heartbeatTimer = timer.Register(env.heartbeatInternal, func() {
 			transporter.heartbeat()
 		})
+		reloadLock.Unlock()
 	}
 }
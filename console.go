@@ -0,0 +1,357 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/metrics"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	ErrConsoleCommand = errors.New("unknown command, type help for usage")
+	ErrConsoleUsage   = errors.New("wrong arguments of command")
+)
+
+// consoleCommand represents a command of debug console, the argument is the
+// text after command name
+type consoleCommand struct {
+	usage string
+	help  string
+	fn    func(c *consoleConn, arg string) (interface{}, error)
+}
+
+// consoleCommands all commands supported by debug console
+var consoleCommands map[string]consoleCommand
+
+func init() {
+	consoleCommands = map[string]consoleCommand{
+		"help":     {"help", "list all commands", consoleHelp},
+		"sessions": {"sessions", "all connected sessions of current node", consoleSessions},
+		"session":  {"session <id>", "details of the session", consoleSession},
+		"routes":   {"routes", "registered handler and remote routes", consoleRoutes},
+		"cluster":  {"cluster", "live state of all servers in cluster", consoleCluster},
+		"rpcstats": {"rpcstats", "calls, errors and latency of each route", consoleRPCStats},
+		"stats":    {"stats", "traffic statistics of current node", consoleStats},
+		"loglevel": {"loglevel <level>", "adjust log level, e.g. loglevel debug", consoleLogLevel},
+		"invoke":   {"invoke <route> <data>", "inject a request to the route, responses and pushes are printed", consoleInvoke},
+	}
+}
+
+// Debug console is a line based text protocol served on a local unix socket,
+// connect it with e.g. `nc -U /path/to/socket` or `socat - UNIX:/path/to/socket`,
+// results are printed as indented json, type `quit` to disconnect
+func listenConsole(path string) (net.Listener, error) {
+	// remove socket file left by previous process
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// closeConsole close the listener of debug console, the socket file is kept
+// when upgrading, which has been taken over by the new process
+func closeConsole(l net.Listener) {
+	if ul, ok := l.(*net.UnixListener); ok && upgrader.isUpgrading() {
+		ul.SetUnlinkOnClose(false)
+	}
+	l.Close()
+}
+
+func serveConsole(l net.Listener) {
+	log.Infof("debug console listen at %s", l.Addr().String())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go newConsoleConn(conn).serve()
+	}
+}
+
+// consoleConn represents a connection of debug console, messages injected by
+// invoke share a session of the connection
+type consoleConn struct {
+	sync.Mutex // protect writing to rw, responses are written asynchronously
+	rw         io.ReadWriteCloser
+	session    *session.Session // session of injected messages, created on first invoke
+	lastID     uint             // last request id of injected messages
+}
+
+func newConsoleConn(rw io.ReadWriteCloser) *consoleConn {
+	return &consoleConn{rw: rw}
+}
+
+func (c *consoleConn) serve() {
+	defer c.rw.Close()
+
+	c.printf("starx debug console of %s, type help for usage\n", app.name)
+	scanner := bufio.NewScanner(c.rw)
+	for c.printf("> "); scanner.Scan(); c.printf("> ") {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			return
+		}
+		c.exec(line)
+	}
+}
+
+// exec run the command line and print the result
+func (c *consoleConn) exec(line string) {
+	parts := strings.SplitN(line, " ", 2)
+	cmd, ok := consoleCommands[parts[0]]
+	if !ok {
+		c.printf("error: %s\n", ErrConsoleCommand.Error())
+		return
+	}
+
+	arg := ""
+	if len(parts) > 1 {
+		arg = strings.TrimSpace(parts[1])
+	}
+	v, err := cmd.fn(c, arg)
+	if err != nil {
+		c.printf("error: %s\n", err.Error())
+		return
+	}
+
+	switch v := v.(type) {
+	case nil:
+	case string:
+		c.printf("%s\n", v)
+	default:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			c.printf("error: %s\n", err.Error())
+			return
+		}
+		c.printf("%s\n", data)
+	}
+}
+
+func (c *consoleConn) printf(format string, args ...interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	fmt.Fprintf(c.rw, format, args...)
+}
+
+func consoleHelp(c *consoleConn, arg string) (interface{}, error) {
+	names := make([]string, 0, len(consoleCommands))
+	for name := range consoleCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		cmd := consoleCommands[name]
+		lines = append(lines, fmt.Sprintf("  %-24s %s", cmd.usage, cmd.help))
+	}
+	lines = append(lines, fmt.Sprintf("  %-24s %s", "quit", "close the console"))
+	return strings.Join(lines, "\n"), nil
+}
+
+func consoleSessions(c *consoleConn, arg string) (interface{}, error) {
+	return adminSessions(), nil
+}
+
+// consoleSessionDetail represents the details of a connected session
+type consoleSessionDetail struct {
+	adminSession
+	ClientType string                 `json:"client_type"`
+	Tags       []string               `json:"tags"`
+	State      map[string]interface{} `json:"state"`
+	Stats      session.Stats          `json:"stats"`
+}
+
+func consoleSession(c *consoleConn, arg string) (interface{}, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return nil, ErrConsoleUsage
+	}
+	a, err := transporter.agent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string]interface{})
+	for k, v := range a.session.State() {
+		state[k] = v
+	}
+	return &consoleSessionDetail{
+		adminSession: adminSession{
+			ID:       a.session.ID,
+			Uid:      a.session.Uid,
+			Remote:   a.socket.RemoteAddr().String(),
+			LastTime: a.lastTime,
+		},
+		ClientType: a.session.ClientType,
+		Tags:       a.session.Tags(),
+		State:      state,
+		Stats:      a.Stats(),
+	}, nil
+}
+
+func consoleRoutes(c *consoleConn, arg string) (interface{}, error) {
+	return adminServices(), nil
+}
+
+func consoleCluster(c *consoleConn, arg string) (interface{}, error) {
+	return Cluster(), nil
+}
+
+func consoleRPCStats(c *consoleConn, arg string) (interface{}, error) {
+	s := metrics.Stats()
+	return map[string]interface{}{
+		"rpc_errors":  s.RPCErrors,
+		"rpc_retries": s.RPCRetries,
+		"routes":      s.Routes,
+	}, nil
+}
+
+func consoleStats(c *consoleConn, arg string) (interface{}, error) {
+	return Stats(), nil
+}
+
+func consoleLogLevel(c *consoleConn, arg string) (interface{}, error) {
+	if arg == "" {
+		return nil, ErrConsoleUsage
+	}
+	if err := log.SetLevelByName(arg); err != nil {
+		return nil, err
+	}
+	log.Infof("log level changed to %s by debug console", arg)
+	return "log level: " + arg, nil
+}
+
+// consoleInvoke inject a request to the route as if it's sent by a client,
+// the data should be encoded by the serializer of application, e.g. json
+func consoleInvoke(c *consoleConn, arg string) (interface{}, error) {
+	parts := strings.SplitN(arg, " ", 2)
+	if parts[0] == "" {
+		return nil, ErrConsoleUsage
+	}
+	data := ""
+	if len(parts) > 1 {
+		data = strings.TrimSpace(parts[1])
+	}
+
+	c.Lock()
+	if c.session == nil {
+		c.session = session.New(&consoleEntity{conn: c})
+	}
+	c.lastID++
+	s, id := c.session, c.lastID
+	c.Unlock()
+
+	handler.processMessage(s, &message.Message{
+		Type:  message.Request,
+		ID:    id,
+		Route: parts[0],
+		Data:  []byte(data),
+	})
+	return nil, nil
+}
+
+// consoleEntity is the network entity of the session of messages injected by
+// debug console, messages sent to the session are printed to console
+type consoleEntity struct {
+	conn *consoleConn
+}
+
+func (e *consoleEntity) ID() int64 {
+	return e.conn.session.ID
+}
+
+func (e *consoleEntity) Send(data []byte) error {
+	p, _, err := packet.Unpack(data)
+	if err != nil {
+		return err
+	}
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		return err
+	}
+	switch m.Type {
+	case message.Push:
+		e.conn.printf("<- push %s: %s\n", m.Route, m.Data)
+	case message.Response:
+		if m.Error {
+			e.conn.printf("<- error %d: %s\n", m.ID, m.Data)
+		} else {
+			e.conn.printf("<- response %d: %s\n", m.ID, m.Data)
+		}
+	}
+	return nil
+}
+
+func (e *consoleEntity) Push(s *session.Session, route string, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	return transporter.push(s, route, data)
+}
+
+func (e *consoleEntity) Response(s *session.Session, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	return transporter.response(s, data)
+}
+
+func (e *consoleEntity) Call(ctx context.Context, s *session.Session, route string, reply interface{}, args ...interface{}) error {
+	return userCall(ctx, s, route, reply, args...)
+}
+
+func (e *consoleEntity) Invoke(fn func()) error {
+	fn()
+	return nil
+}
+
+func (e *consoleEntity) Close() {}
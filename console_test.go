@@ -0,0 +1,113 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/session"
+)
+
+type ConsoleComp struct {
+	component.Base
+}
+
+func (c *ConsoleComp) Echo(s *session.Session, data []byte) error {
+	return s.Response(data)
+}
+
+// readConsole read the console output until the line contains want
+func readConsole(t *testing.T, conn net.Conn, r *bufio.Reader, want string) string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expect output contains %q, error: %v", want, err)
+		}
+		if strings.Contains(line, want) {
+			return line
+		}
+	}
+}
+
+func TestConsole(t *testing.T) {
+	if err := handler.register(&ConsoleComp{}); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.unregister("ConsoleComp")
+
+	dir, err := ioutil.TempDir("", "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "console.sock")
+
+	l, err := listenConsole(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveConsole(l)
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("console socket should be accessible to owner only, got %v, %v", fi, err)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	conn.Write([]byte("routes\n"))
+	readConsole(t, conn, r, `"ConsoleComp.Echo"`)
+
+	conn.Write([]byte("invoke ConsoleComp.Echo hello starx\n"))
+	readConsole(t, conn, r, "<- response 1: hello starx")
+
+	conn.Write([]byte("invoke Unknown.Method {}\n"))
+	readConsole(t, conn, r, "<- error 2:")
+
+	conn.Write([]byte("session abc\n"))
+	readConsole(t, conn, r, "error: "+ErrConsoleUsage.Error())
+
+	conn.Write([]byte("loglevel verbose\n"))
+	readConsole(t, conn, r, "error:")
+
+	conn.Write([]byte("whoami\n"))
+	readConsole(t, conn, r, "error: "+ErrConsoleCommand.Error())
+
+	conn.Write([]byte("quit\n"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatalf("console should be closed after quit, got %v", err)
+	}
+}
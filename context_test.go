@@ -0,0 +1,80 @@
+package starx
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/trace"
+)
+
+type CtxComp struct {
+	component.Base
+	ctxs chan context.Context
+}
+
+func (c *CtxComp) Wait(ctx context.Context, s *session.Session, data []byte) error {
+	c.ctxs <- ctx
+	<-ctx.Done()
+	return nil
+}
+
+func (c *CtxComp) Legacy(s *session.Session, data []byte) error {
+	c.ctxs <- nil
+	return nil
+}
+
+func TestHandlerContext(t *testing.T) {
+	// trace ids are generated only if tracing is enabled
+	SetTraceExporter(trace.ExporterFunc(func(s *trace.Span) {}))
+	defer SetTraceExporter(nil)
+
+	c := &CtxComp{ctxs: make(chan context.Context, 1)}
+	if err := handler.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.unregister("CtxComp")
+
+	s, _ := handler.service("CtxComp")
+	if !s.HandlerMethods["Wait"].Context || s.HandlerMethods["Legacy"].Context {
+		t.Fatal("methods accepting context should be marked")
+	}
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	handler.processMessage(a.session, &message.Message{Type: message.Notify, Route: "CtxComp.Legacy"})
+	if ctx := <-c.ctxs; ctx != nil {
+		t.Fatal("legacy handler should be called without context")
+	}
+
+	done := make(chan bool)
+	go func() {
+		handler.processMessage(a.session, &message.Message{Type: message.Notify, Route: "CtxComp.Wait"})
+		done <- true
+	}()
+
+	ctx := <-c.ctxs
+	if _, ok := ctx.Deadline(); !ok {
+		t.Fatal("context should carry the deadline of rpc timeout")
+	}
+	if traceID, _ := trace.FromContext(ctx); traceID == "" {
+		t.Fatal("context should carry the trace id of message")
+	}
+
+	// handler abandons the work after session closed
+	transporter.closeSession(a.session, session.CloseClient)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("context should be canceled after session closed")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("expect canceled, got %v", ctx.Err())
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/cron"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// crons represents the jobs added by AddCron, jobs start after components
+// initialized, and stop before components shut down
+var crons = &cronService{}
+
+type cronService struct {
+	sync.Mutex            // protect following
+	jobs       []*CronJob // jobs added by AddCron
+	started    bool
+
+	runLock sync.Mutex // jobs added by AddCron run one at a time
+}
+
+// CronJob represents a scheduled job
+type CronJob struct {
+	spec     string
+	schedule *cron.Schedule
+	fn       func()
+
+	done chan struct{} // closed when the job stopped
+
+	sync.Mutex // protect following
+	job        *cron.Job
+	stopped    bool
+}
+
+func (j *CronJob) start(fn func()) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.stopped || j.job != nil {
+		return
+	}
+	j.job = cron.Register(j.schedule, fn)
+}
+
+// Stop the job, it's safe to call Stop more than once, and before server
+// started
+func (j *CronJob) Stop() {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.stopped {
+		return
+	}
+	j.stopped = true
+	close(j.done)
+	if j.job != nil {
+		j.job.Stop()
+	}
+}
+
+// Done returns a channel that's closed when the job stopped
+func (j *CronJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Spec returns the cron expression of the job
+func (j *CronJob) Spec() string {
+	return j.spec
+}
+
+func (cs *cronService) add(j *CronJob) {
+	cs.Lock()
+	defer cs.Unlock()
+
+	cs.jobs = append(cs.jobs, j)
+	if cs.started {
+		j.start(cs.wrap(j))
+	}
+}
+
+func (cs *cronService) start() {
+	cs.Lock()
+	defer cs.Unlock()
+
+	cs.started = true
+	for _, j := range cs.jobs {
+		j.start(cs.wrap(j))
+	}
+}
+
+func (cs *cronService) stop() {
+	cs.Lock()
+	defer cs.Unlock()
+
+	cs.started = false
+	for _, j := range cs.jobs {
+		j.Stop()
+	}
+	cs.jobs = nil
+}
+
+// wrap the job function, which runs exclusively with other jobs, so the
+// states shared by jobs can be accessed without lock
+func (cs *cronService) wrap(j *CronJob) func() {
+	return func() {
+		cs.runLock.Lock()
+		defer cs.runLock.Unlock()
+
+		defer func() {
+			if err := recover(); err != nil {
+				log.Errorf("cron job(%s) panic: %+v", j.spec, err)
+			}
+		}()
+		j.fn()
+	}
+}
+
+func newCronJob(spec string, fn func()) (*CronJob, error) {
+	s, err := cron.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &CronJob{spec: spec, schedule: s, fn: fn, done: make(chan struct{})}, nil
+}
+
+// AddCron calls fn at every time matched by the cron expression in local
+// time, e.g. reset daily tasks at midnight:
+//
+//	starx.AddCron("0 0 * * *", resetDailyTasks)
+//
+// Jobs added before server started start after components initialized, and
+// all jobs stop before components shut down, jobs run one at a time
+func AddCron(spec string, fn func()) (*CronJob, error) {
+	j, err := newCronJob(spec, fn)
+	if err != nil {
+		return nil, err
+	}
+	crons.add(j)
+	return j, nil
+}
+
+// AddSessionCron calls fn at every time matched by the cron expression, fn
+// will be executed on the logic goroutine of the session, the job will be
+// stopped when the session closed
+func AddSessionCron(s *session.Session, spec string, fn func()) (*CronJob, error) {
+	j, err := newCronJob(spec, fn)
+	if err != nil {
+		return nil, err
+	}
+	j.start(timerFunc(s, fn))
+	timers.add(s, j)
+	return j, nil
+}
@@ -0,0 +1,230 @@
+// Package cron parses cron expressions and calls functions on the schedule.
+//
+// The expression consists of five space separated fields:
+//
+//	minute        0-59
+//	hour          0-23
+//	day of month  1-31
+//	month         1-12
+//	day of week   0-6, 0 is Sunday
+//
+// Each field is `*`, a value, a range `1-5`, a step `*/15` or `1-30/5`, or
+// a list of them `0,30`. When both day of month and day of week are
+// restricted, the time matches either of them, the same as unix cron. The
+// descriptors @yearly, @monthly, @weekly, @daily and @hourly are supported.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidSpec = errors.New("cron: invalid spec")
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// bounds of fields
+var bounds = [5]struct{ min, max int }{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week
+}
+
+// Schedule represents a parsed cron expression, each field is a bit set of
+// the values matched
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool // whether the day field is `*`
+}
+
+// Parse the cron expression, returns ErrInvalidSpec if malformed
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%v: %q, expect 5 fields", ErrInvalidSpec, spec)
+	}
+
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseField(f, bounds[i].min, bounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %q, %s", ErrInvalidSpec, spec, err.Error())
+		}
+		sets[i] = set
+	}
+
+	return &Schedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, expr := range strings.Split(f, ",") {
+		lo, hi, step := min, max, 1
+		rng := expr
+		if i := strings.Index(expr, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(expr[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q", expr)
+			}
+			rng = expr[:i]
+		}
+
+		if rng != "*" {
+			var err error
+			if i := strings.Index(rng, "-"); i >= 0 {
+				lo, err = strconv.Atoi(rng[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(rng[i+1:])
+				}
+			} else {
+				lo, err = strconv.Atoi(rng)
+				hi = lo
+				if strings.Contains(expr, "/") {
+					hi = max
+				}
+			}
+			if err != nil || lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("bad range %q", expr)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time matched after t, in the location of t, zero
+// time returned if no time matched in five years, e.g. `0 0 30 2 *`
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Job calls the function on the schedule until stopped
+type Job struct {
+	schedule *Schedule
+	fn       func()
+
+	sync.Mutex // protect following
+	timer      *time.Timer
+	next       time.Time // time of the next call
+	stopped    bool
+}
+
+// Register returns a new Job which calls fn in its own goroutine at every
+// time matched by the schedule, in local time
+func Register(s *Schedule, fn func()) *Job {
+	j := &Job{schedule: s, fn: fn}
+	j.Lock()
+	j.reschedule()
+	j.Unlock()
+	return j
+}
+
+// reschedule the next call, should be called with lock held, the time of
+// last call is used if timer fired earlier than expected
+func (j *Job) reschedule() {
+	now := time.Now()
+	from := now
+	if from.Before(j.next) {
+		from = j.next
+	}
+	j.next = j.schedule.Next(from)
+	if j.next.IsZero() {
+		return
+	}
+	j.timer = time.AfterFunc(j.next.Sub(now), j.run)
+}
+
+func (j *Job) run() {
+	j.Lock()
+	if j.stopped {
+		j.Unlock()
+		return
+	}
+	j.reschedule()
+	j.Unlock()
+
+	j.fn()
+}
+
+// Next returns the time of the next call, zero if no more call
+func (j *Job) Next() time.Time {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.stopped {
+		return time.Time{}
+	}
+	return j.next
+}
+
+// Stop turns off the job, it's safe to call Stop more than once
+func (j *Job) Stop() {
+	j.Lock()
+	defer j.Unlock()
+
+	j.stopped = true
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+}
@@ -0,0 +1,60 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{"* * * * *", "0 0 * * *", "*/15 1-5 1,15 * 1-5", "5/10 * * 1-12/2 0", "@daily"} {
+		if _, err := Parse(spec); err != nil {
+			t.Errorf("spec %q should be valid, got %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 7", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@never"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("spec %q should be invalid", spec)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	base := time.Date(2017, 3, 15, 10, 20, 30, 0, time.UTC) // Wednesday
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2017, 3, 15, 10, 21, 0, 0, time.UTC)},
+		{"0 0 * * *", time.Date(2017, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1", time.Date(2017, 3, 20, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2017, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// either day of month or day of week matches
+		{"0 0 20 * 5", time.Date(2017, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := s.Next(base); !next.Equal(c.next) {
+			t.Errorf("spec %q: expect %v, got %v", c.spec, c.next, next)
+		}
+	}
+}
+
+func TestJob_Stop(t *testing.T) {
+	s, _ := Parse("* * * * *")
+	j := Register(s, func() {})
+	if next := j.Next(); next.IsZero() || time.Until(next) > time.Minute {
+		t.Fatalf("unexpected next time: %v", next)
+	}
+	j.Stop()
+	j.Stop() // stop more than once
+	if !j.Next().IsZero() {
+		t.Fatal("stopped job should have no next time")
+	}
+}
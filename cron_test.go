@@ -0,0 +1,58 @@
+package starx
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAddCron(t *testing.T) {
+	if _, err := AddCron("* * *", func() {}); err == nil {
+		t.Fatal("invalid spec should be refused")
+	}
+
+	called := 0
+	j, err := AddCron("0 0 * * *", func() { called++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.job != nil {
+		t.Fatal("job should not start before server started")
+	}
+
+	crons.start()
+	if j.job == nil || j.job.Next().IsZero() {
+		t.Fatal("job should start after server started")
+	}
+	crons.wrap(j)()
+	if called != 1 {
+		t.Fatalf("expect job called once, got %d", called)
+	}
+
+	crons.stop()
+	if !j.job.Next().IsZero() {
+		t.Fatal("job should stop before server stopped")
+	}
+}
+
+func TestCronPanic(t *testing.T) {
+	j, _ := newCronJob("@hourly", func() { panic("boom") })
+	crons.wrap(j)()
+
+	// lock should be released after panic
+	crons.runLock.Lock()
+	crons.runLock.Unlock()
+}
+
+func TestSessionCronStoppedWhenSessionClosed(t *testing.T) {
+	c, _ := net.Pipe()
+	a := newAgent(c)
+
+	j, err := AddSessionCron(a.session, "@daily", func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timers.stopSessionTimers(a.session)
+	if !j.job.Next().IsZero() {
+		t.Fatal("session cron should stop when session closed")
+	}
+}
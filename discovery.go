@@ -0,0 +1,146 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+)
+
+// serving is set after current server listened, handshake of clients or
+// rpc requests of peers can be served since then
+var serving int32
+
+// discovery sync servers of cluster from provider periodically
+var discovery = &discoveryService{known: make(map[string]bool)}
+
+type discoveryService struct {
+	sync.Mutex
+	provider cluster.Provider
+	interval time.Duration
+	known    map[string]bool // servers registered by provider
+}
+
+func (d *discoveryService) setProvider(p cluster.Provider, interval time.Duration) {
+	d.provider = p
+	d.interval = interval
+}
+
+// watch sync servers immediately, and then every interval until shutdown
+func (d *discoveryService) watch() {
+	if d.provider == nil {
+		return
+	}
+	d.sync()
+	if d.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.sync()
+			case <-env.die:
+				return
+			}
+		}
+	}()
+}
+
+// sync register new servers discovered by provider, and remove the servers
+// which not discovered any more, servers from config file are untouched
+func (d *discoveryService) sync() {
+	svrs, err := d.provider.Servers()
+	if err != nil {
+		log.Errorf("discover servers error: %s", err.Error())
+		return
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	alive := make(map[string]bool, len(svrs))
+	for _, svr := range svrs {
+		if app.config != nil && svr.Id == app.config.Id {
+			continue
+		}
+		alive[svr.Id] = true
+		if _, err := cluster.Server(svr.Id); err == nil {
+			continue
+		}
+		cluster.Register(svr)
+		d.known[svr.Id] = true
+	}
+	for id := range d.known {
+		if !alive[id] {
+			delete(d.known, id)
+			cluster.RemoveServer(id)
+		}
+	}
+}
+
+// roleServer returns the config of current server in role mode, the id
+// defaults to hostname, which is the pod name in kubernetes
+func roleServer(role string) *cluster.ServerConfig {
+	c := &cluster.ServerConfig{Type: role, Id: env.serverId}
+	if c.Id == "" {
+		c.Id, _ = os.Hostname()
+	}
+	return c
+}
+
+// readiness represents the result of readiness probe
+type readiness struct {
+	Ready   bool              `json:"ready"`
+	Serving bool              `json:"serving"`
+	Peers   map[string]string `json:"peers"` // backend server id -> rpc connection state
+}
+
+// checkReady reports whether current server is serving, peers are listed
+// with the state of rpc connection for diagnosis only, the probe never dials
+// them, and an unreachable backend doesn't pull current server out of load
+// balancer, since rpc clients are established on demand
+func checkReady() *readiness {
+	r := &readiness{
+		Serving: atomic.LoadInt32(&serving) == 1,
+		Peers:   make(map[string]string),
+	}
+	r.Ready = r.Serving
+	for _, svr := range cluster.Servers() {
+		if svr.IsFrontend || (app.config != nil && svr.Id == app.config.Id) {
+			continue
+		}
+		if cluster.Connected(svr.Id) {
+			r.Peers[svr.Id] = "connected"
+		} else {
+			r.Peers[svr.Id] = "disconnected"
+		}
+	}
+	return r
+}
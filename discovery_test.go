@@ -0,0 +1,188 @@
+package starx
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/session"
+)
+
+type fakeProvider []*cluster.ServerConfig
+
+func (p *fakeProvider) Servers() ([]*cluster.ServerConfig, error) {
+	return *p, nil
+}
+
+func TestDiscoverySync(t *testing.T) {
+	p := &fakeProvider{
+		{Type: "gate", Id: "gate-0", IsFrontend: true},
+		{Type: "gate", Id: "gate-1", IsFrontend: true},
+		{Type: "test", Id: app.config.Id},
+	}
+	d := &discoveryService{known: make(map[string]bool)}
+	d.setProvider(p, 0)
+	defer func() {
+		cluster.RemoveServer("gate-0")
+		cluster.RemoveServer("gate-1")
+	}()
+
+	d.sync()
+	if _, err := cluster.Server("gate-1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.known) != 2 {
+		t.Fatalf("current server should not be synced, known: %v", d.known)
+	}
+
+	*p = (*p)[:1]
+	d.sync()
+	if _, err := cluster.Server("gate-1"); err != cluster.ErrServerNotFound {
+		t.Fatalf("gate-1 should be removed, got %v", err)
+	}
+	if _, err := cluster.Server("gate-0"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoleServer(t *testing.T) {
+	defer func(id string) { env.serverId = id }(env.serverId)
+
+	env.serverId = "game-0"
+	if c := roleServer("game"); c.Type != "game" || c.Id != "game-0" {
+		t.Fatalf("unexpected config: %s", c.String())
+	}
+
+	env.serverId = ""
+	if c := roleServer("game"); c.Id == "" {
+		t.Fatal("id should default to hostname")
+	}
+}
+
+func TestAdminReady(t *testing.T) {
+	cluster.SetAppConfig(app.config)
+	defer atomic.StoreInt32(&serving, 0)
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	cluster.Register(&cluster.ServerConfig{Type: "backend", Id: "backend-ready", Host: "127.0.0.1", Port: port})
+	defer cluster.RemoveServer("backend-ready")
+
+	srv := httptest.NewServer(adminHandler())
+	defer srv.Close()
+
+	probe := func() (int, *readiness) {
+		resp, err := http.Get(srv.URL + "/ready")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		r := &readiness{}
+		if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, r
+	}
+
+	if code, r := probe(); code != http.StatusServiceUnavailable || r.Ready || r.Serving {
+		t.Fatalf("should not be ready before serving, got %d %+v", code, r)
+	}
+
+	atomic.StoreInt32(&serving, 1)
+	code, r := probe()
+	if code != http.StatusOK || !r.Ready || r.Peers["backend-ready"] != "disconnected" {
+		t.Fatalf("should be ready without dialing peers, got %d %+v", code, r)
+	}
+	if cluster.Connected("backend-ready") {
+		t.Fatal("probe should not dial peers")
+	}
+
+	if _, err := cluster.Client("backend-ready"); err != nil {
+		t.Fatal(err)
+	}
+	if _, r := probe(); r.Peers["backend-ready"] != "connected" {
+		t.Fatalf("peer should be connected, got %+v", r)
+	}
+
+	// an unreachable backend doesn't affect readiness
+	cluster.Register(&cluster.ServerConfig{Type: "backend", Id: "backend-down", Host: "127.0.0.1", Port: 1})
+	defer cluster.RemoveServer("backend-down")
+	if code, r := probe(); code != http.StatusOK || !r.Ready || r.Peers["backend-down"] != "disconnected" {
+		t.Fatalf("should be ready with unreachable peer, got %d %+v", code, r)
+	}
+}
+
+func TestStickyRouting(t *testing.T) {
+	cluster.SetAppConfig(app.config)
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	for _, id := range []string{"sticky-1", "sticky-2"} {
+		cluster.Register(&cluster.ServerConfig{Type: "sticky", Id: id, Host: "127.0.0.1", Port: port})
+		defer cluster.RemoveServer(id)
+	}
+
+	s := session.New(nil)
+	if _, err := cluster.ClientByType("sticky", s); err != nil {
+		t.Fatal(err)
+	}
+	id := s.ServerID("sticky")
+	for i := 0; i < 10; i++ {
+		if _, err := cluster.ClientByType("sticky", s); err != nil || s.ServerID("sticky") != id {
+			t.Fatalf("session should stick to %s, got %s, error: %v", id, s.ServerID("sticky"), err)
+		}
+	}
+
+	// the server cached is invalidated after it left
+	cluster.RemoveServer(id)
+	if _, err := cluster.ClientByType("sticky", s); err != nil {
+		t.Fatal(err)
+	}
+	if other := s.ServerID("sticky"); other == id || other == "" {
+		t.Fatalf("session should be routed to another server, got %q", other)
+	}
+
+	SetSticky("sticky", false)
+	defer SetSticky("sticky", true)
+	s = session.New(nil)
+	if _, err := cluster.ClientByType("sticky", s); err != nil {
+		t.Fatal(err)
+	}
+	if id := s.ServerID("sticky"); id != "" {
+		t.Fatalf("server should not be cached for non-sticky type, got %s", id)
+	}
+}
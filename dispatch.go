@@ -0,0 +1,87 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/session"
+)
+
+// DispatchPolicy decide which goroutine the handler calls run on, handler
+// calls run on the logic goroutine of session by default
+type DispatchPolicy interface {
+	Dispatch(s *session.Session, fn func())
+}
+
+type workerPool struct {
+	once   sync.Once
+	queues []chan func()
+}
+
+// Pool returns a policy which run handler calls on a bounded pool of n
+// workers, calls of the same session always dispatched to the same worker,
+// so the ordering of each session is preserved
+func Pool(n int) DispatchPolicy {
+	if n < 1 {
+		n = 1
+	}
+	return &workerPool{queues: make([]chan func(), n)}
+}
+
+func (p *workerPool) Dispatch(s *session.Session, fn func()) {
+	p.once.Do(p.start)
+	// workers exit after the server closed, don't block the logic goroutine
+	select {
+	case p.queues[uint64(s.ID)%uint64(len(p.queues))] <- fn:
+	case <-s.Context().Done():
+	case <-env.die:
+	}
+}
+
+func (p *workerPool) start() {
+	for i := range p.queues {
+		q := make(chan func(), packetBufferSize)
+		p.queues[i] = q
+		go func() {
+			for {
+				select {
+				case fn := <-q:
+					safeCall(fn)
+				case <-env.die:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// dispatchPolicy returns the policy of route, policy of route takes
+// precedence over the policy of service
+func dispatchPolicy(service, method string) DispatchPolicy {
+	if len(env.dispatchPolicies) == 0 {
+		return nil
+	}
+	if p, ok := env.dispatchPolicies[service+"."+method]; ok {
+		return p
+	}
+	return env.dispatchPolicies[service]
+}
@@ -0,0 +1,123 @@
+package starx
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/session"
+)
+
+type DispatchComp struct {
+	component.Base
+	calls chan uint
+}
+
+func (c *DispatchComp) Search(s *session.Session, data []byte) error {
+	c.calls <- s.LastID
+	return nil
+}
+
+func (c *DispatchComp) Login(s *session.Session, data []byte) error {
+	s.Bind(int64(s.LastID))
+	s.Set("login", true)
+	c.calls <- s.LastID
+	return nil
+}
+
+// invokeEntity queues invoked functions like the logic goroutine of agent
+type invokeEntity struct {
+	session.NetworkEntity
+	tasks chan func()
+}
+
+func (e *invokeEntity) Invoke(fn func()) error {
+	e.tasks <- fn
+	return nil
+}
+
+func TestPoolOrdering(t *testing.T) {
+	p := Pool(4)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	got := map[int64][]int{}
+	for i := 0; i < 100; i++ {
+		for sid := int64(0); sid < 8; sid++ {
+			wg.Add(1)
+			sid, i := sid, i
+			p.Dispatch(&session.Session{ID: sid}, func() {
+				defer wg.Done()
+				mu.Lock()
+				got[sid] = append(got[sid], i)
+				mu.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+
+	for sid, seq := range got {
+		for i, v := range seq {
+			if i != v {
+				t.Fatalf("calls of session %d out of order: %v", sid, seq)
+			}
+		}
+	}
+}
+
+func TestSetDispatchPolicy(t *testing.T) {
+	SetDispatchPolicy("DispatchComp.Search", Pool(2))
+	defer func() { env.dispatchPolicies = nil }()
+
+	hs := newHandlerService()
+	c := &DispatchComp{calls: make(chan uint, 1)}
+	if err := hs.register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	s := session.New(nil)
+	msg := message.New()
+	msg.Route = "DispatchComp.Search"
+	msg.Type = message.Request
+	msg.ID = 7
+	hs.processMessage(s, msg)
+	s.LastID = 8 // logic goroutine processing the next message
+
+	if id := <-c.calls; id != 7 {
+		t.Fatalf("handler should see request id of its message, got: %d", id)
+	}
+	if dispatchPolicy("DispatchComp", "Other") != nil {
+		t.Fatal("route policy should not apply to other routes")
+	}
+}
+
+func TestDispatchSessionChanges(t *testing.T) {
+	SetDispatchPolicy("DispatchComp.Login", Pool(2))
+	defer func() { env.dispatchPolicies = nil }()
+
+	hs := newHandlerService()
+	c := &DispatchComp{calls: make(chan uint, 1)}
+	if err := hs.register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &invokeEntity{tasks: make(chan func(), 4)}
+	s := session.New(e)
+	msg := message.New()
+	msg.Route = "DispatchComp.Login"
+	msg.Type = message.Request
+	msg.ID = 9
+	hs.processMessage(s, msg)
+	<-c.calls
+
+	if s.Uid != 0 {
+		t.Fatal("session should only be changed on its logic goroutine")
+	}
+	for len(e.tasks) > 0 {
+		(<-e.tasks)()
+	}
+	if s.Uid != 9 || s.Value("login") != true {
+		t.Fatalf("changes of pooled handler should be applied to session, uid: %d", s.Uid)
+	}
+}
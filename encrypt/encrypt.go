@@ -0,0 +1,102 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+var ErrShortData = errors.New("encrypted data too short")
+
+// Cipher encrypts and decrypts data with AES-256-GCM, a random nonce is
+// prepended to every encrypted data, it's safe for concurrent use
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher create a cipher with 32 bytes key
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+func (c *Cipher) Encrypt(data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return nil, ErrShortData
+	}
+	return c.aead.Open(nil, data[:n], data[n:], nil)
+}
+
+// Exchange performs X25519 key exchange with the public key of peer, returns
+// the public key of local side which should be sent to peer, and the cipher
+// using the sha256 sum of shared secret as key
+func Exchange(peerKey []byte) ([]byte, *Cipher, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := shared(priv, peerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.PublicKey().Bytes(), c, nil
+}
+
+func shared(priv *ecdh.PrivateKey, peerKey []byte) (*Cipher, error) {
+	pub, err := ecdh.X25519().NewPublicKey(peerKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(secret)
+	return NewCipher(key[:])
+}
+
+// Key represents the X25519 private key of client side in key exchange
+type Key struct {
+	priv *ecdh.PrivateKey
+}
+
+// GenerateKey generate a X25519 private key, the public key should be sent
+// to server in handshake
+func GenerateKey() (*Key, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{priv: priv}, nil
+}
+
+// Public returns the public key
+func (k *Key) Public() []byte {
+	return k.priv.PublicKey().Bytes()
+}
+
+// Cipher returns the cipher using the shared secret with the public key of
+// server, which is the same as the cipher returned by Exchange in server side
+func (k *Key) Cipher(peerKey []byte) (*Cipher, error) {
+	return shared(k.priv, peerKey)
+}
@@ -0,0 +1,75 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func TestExchange(t *testing.T) {
+	client, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverKey, sc, err := Exchange(client.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := shared(client, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("hello world")
+	encrypted, err := sc.Encrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, data) {
+		t.Fatal("data should be encrypted")
+	}
+	decrypted, err := cc.Decrypt(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Fatalf("expect %s, got %s", data, decrypted)
+	}
+
+	encrypted[len(encrypted)-1] ^= 0xFF
+	if _, err := cc.Decrypt(encrypted); err == nil {
+		t.Fatal("tampered data should not be decrypted")
+	}
+	if _, err := cc.Decrypt([]byte{0x01}); err != ErrShortData {
+		t.Fatalf("expect ErrShortData, got %v", err)
+	}
+
+	if _, _, err := Exchange([]byte("invalid key")); err == nil {
+		t.Fatal("invalid public key should be refused")
+	}
+}
+
+func TestKey(t *testing.T) {
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKey, sc, err := Exchange(k.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := k.Cipher(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := cc.Encrypt([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := sc.Decrypt(encrypted); err != nil || string(data) != "hello world" {
+		t.Fatalf("unexpected decrypted data: %s, %v", data, err)
+	}
+}
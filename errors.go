@@ -0,0 +1,142 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/session"
+)
+
+// Default codes of error responses
+const (
+	CodeBadRequest      = 400 // message data can not be decoded
+	CodeUnauthorized    = 401 // session not authenticated
+	CodeForbidden       = 403 // route not exposed to clients
+	CodeNotFound        = 404 // server type, service or method of route not found
+	CodeTooManyRequests = 429 // message rate limit exceeded
+	CodeInternal        = 500 // handler returned an error or panicked
+	CodeBusy            = 503 // concurrency limit of route exceeded
+)
+
+// ErrorCodes represents the codes of error responses by the kind of failure,
+// which can be customized by SetErrorCodes
+type ErrorCodes struct {
+	BadRequest      int
+	Unauthorized    int
+	Forbidden       int
+	NotFound        int
+	TooManyRequests int
+	Internal        int
+	Busy            int
+}
+
+// Error represents the error envelope responded to the request which failed
+// in routing, decoding or handler execution, it's always encoded as json and
+// the response message is flagged as error, so clients can tell it apart from
+// normal responses. Handlers can return an *Error to respond the code and
+// message of their own, which are never hidden.
+type Error struct {
+	Code   int          `json:"code"`
+	Msg    string       `json:"msg"`
+	Fields []FieldError `json:"fields,omitempty"` // invalid fields refused by validators
+}
+
+// NewError returns an error envelope with the code and message
+func NewError(code int, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// errorEnvelope returns the envelope of err, the message is replaced by a
+// generic text when error details hidden, errors returned by rpc from backend
+// server carry the code and message already
+func errorEnvelope(code int, err error) *Error {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case *rpc.CodeError:
+		return &Error{Code: e.Code, Msg: e.Msg}
+	case *ValidationError:
+		return &Error{Code: code, Msg: e.Error(), Fields: e.Fields}
+	}
+
+	msg := err.Error()
+	if env.hideErrorDetails {
+		switch code {
+		case env.errorCodes.BadRequest:
+			msg = "bad request"
+		case env.errorCodes.Unauthorized:
+			msg = "unauthorized"
+		case env.errorCodes.Forbidden:
+			msg = "forbidden"
+		case env.errorCodes.NotFound:
+			msg = "not found"
+		case env.errorCodes.TooManyRequests:
+			msg = "too many requests"
+		case env.errorCodes.Busy:
+			msg = "busy"
+		default:
+			msg = "internal error"
+		}
+	}
+	return &Error{Code: code, Msg: msg}
+}
+
+// respondError respond the error envelope to the request of session, nothing
+// will be responded to notify
+func respondError(session *session.Session, code int, err error) {
+	respondErrorTo(session, session.LastID, code, err)
+}
+
+// rejectMessage respond the error envelope to the message refused before
+// dispatch, e.g. rate limited, nothing will be responded to notify
+func rejectMessage(session *session.Session, m *message.Message, code int, err error) {
+	if m.Type != message.Request {
+		return
+	}
+	respondErrorTo(session, m.ID, code, err)
+}
+
+func respondErrorTo(session *session.Session, id uint, code int, err error) {
+	if id <= 0 {
+		return
+	}
+
+	data, e := json.Marshal(errorEnvelope(code, err))
+	if e != nil {
+		sessionLogger(session).Errorf("marshal error envelope error: %s", e.Error())
+		return
+	}
+	if e := transporter.sendMessage(session, &message.Message{
+		Type:  message.Response,
+		ID:    id,
+		Data:  data,
+		Error: true,
+	}); e != nil {
+		sessionLogger(session).Errorf("respond error: %s", e.Error())
+	}
+}
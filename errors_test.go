@@ -0,0 +1,91 @@
+package starx
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
+)
+
+type ErrorComp struct {
+	component.Base
+}
+
+func (c *ErrorComp) Fail(s *session.Session, data []byte) error {
+	return NewError(1001, "custom error")
+}
+
+func (c *ErrorComp) Crash(s *session.Session, data []byte) error {
+	panic("crashed")
+}
+
+func TestErrorResponse(t *testing.T) {
+	handler.register(&ErrorComp{})
+	defer handler.unregister("ErrorComp")
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+
+	request := func(route string) (*message.Message, *Error) {
+		handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 5, Route: route, Data: []byte("{}")})
+		p, _, _ := packet.Unpack(<-a.sendBuffer)
+		m, err := message.Decode(p.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := &Error{}
+		if err := json.Unmarshal(m.Data, e); err != nil {
+			t.Fatal(err)
+		}
+		return m, e
+	}
+
+	for route, code := range map[string]int{
+		"Missing.Fail":      CodeNotFound,
+		"ErrorComp.Missing": CodeNotFound,
+		"ErrorComp.Fail":    1001,
+		"ErrorComp.Crash":   CodeInternal,
+		"invalid":           CodeBadRequest,
+	} {
+		m, e := request(route)
+		if !m.Error || m.ID != 5 || e.Code != code {
+			t.Fatalf("route %s: unexpected error response: %v, %+v", route, m, e)
+		}
+	}
+
+	// nothing responded to notify
+	handler.processMessage(a.session, &message.Message{Type: message.Notify, Route: "ErrorComp.Fail"})
+	select {
+	case data := <-a.sendBuffer:
+		t.Fatalf("notify should not be responded, got %v", data)
+	default:
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	defer func() { env.hideErrorDetails = false }()
+
+	if e := errorEnvelope(CodeInternal, errors.New("db down")); e.Code != CodeInternal || e.Msg != "db down" {
+		t.Fatalf("unexpected envelope: %+v", e)
+	}
+
+	HideErrorDetails()
+	for code, msg := range map[int]string{CodeBadRequest: "bad request", CodeNotFound: "not found", CodeInternal: "internal error"} {
+		if e := errorEnvelope(code, errors.New("details")); e.Msg != msg {
+			t.Fatalf("expect %s, got %s", msg, e.Msg)
+		}
+	}
+	if e := errorEnvelope(CodeInternal, NewError(1001, "custom")); e.Code != 1001 || e.Msg != "custom" {
+		t.Fatalf("messages of handler errors should not be hidden, got %+v", e)
+	}
+	if e := errorEnvelope(CodeInternal, &rpc.CodeError{Code: CodeNotFound, Msg: "not found"}); e.Code != CodeNotFound {
+		t.Fatalf("code of backend should be kept, got %+v", e)
+	}
+}
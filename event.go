@@ -0,0 +1,142 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/session"
+)
+
+// Event represents a framework lifecycle or session event
+type Event int
+
+const (
+	SessionCreated    Event = iota // new session created
+	SessionClosed                  // session closed, the session will not be available since then
+	SessionBound                   // session bound to a uid
+	ServerStarted                  // all components have been initialized, server will accept connections
+	PeerJoined                     // new server joined cluster after current server started
+	PeerLeft                       // server left cluster
+	PeerStatusChanged              // peer responded or failed heartbeat, see Cluster
+)
+
+var eventNames = [...]string{
+	SessionCreated:    "SessionCreated",
+	SessionClosed:     "SessionClosed",
+	SessionBound:      "SessionBound",
+	ServerStarted:     "ServerStarted",
+	PeerJoined:        "PeerJoined",
+	PeerLeft:          "PeerLeft",
+	PeerStatusChanged: "PeerStatusChanged",
+}
+
+func (e Event) String() string {
+	if e < 0 || int(e) >= len(eventNames) {
+		return "Unknown"
+	}
+	return eventNames[e]
+}
+
+// EventArgs contains the information of the event, Session is available in
+// session events, and Server is available in server and peer events
+type EventArgs struct {
+	Event   Event
+	Session *session.Session
+	Server  *cluster.ServerConfig
+	Reason  session.CloseReason // why the session closed, only for SessionClosed
+	Peer    *cluster.Peer       // live state of the server, only for PeerStatusChanged
+}
+
+// events represents the event bus of current process
+var events = newEventBus()
+
+type eventBus struct {
+	sync.RWMutex
+	seq      uint64
+	handlers map[Event][]eventHandler
+}
+
+type eventHandler struct {
+	id uint64
+	fn func(*EventArgs)
+}
+
+func newEventBus() *eventBus {
+	b := &eventBus{handlers: make(map[Event][]eventHandler)}
+	transporter.sessionClosedCallback(func(s *session.Session) {
+		b.emit(&EventArgs{Event: SessionClosed, Session: s, Reason: s.CloseReason})
+	})
+	session.OnBound(func(s *session.Session) {
+		b.emit(&EventArgs{Event: SessionBound, Session: s})
+	})
+	return b
+}
+
+// on register the handler and return a function to remove it
+func (b *eventBus) on(e Event, fn func(*EventArgs)) func() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.seq++
+	id := b.seq
+	b.handlers[e] = append(b.handlers[e], eventHandler{id: id, fn: fn})
+	return func() { b.off(e, id) }
+}
+
+func (b *eventBus) off(e Event, id uint64) {
+	b.Lock()
+	defer b.Unlock()
+
+	handlers := b.handlers[e]
+	for i, h := range handlers {
+		if h.id == id {
+			// copy on write, emit may be iterating the old slice
+			b.handlers[e] = append(handlers[:i:i], handlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// emit call all handlers of the event synchronously in current goroutine,
+// panics in handler will be recovered
+func (b *eventBus) emit(args *EventArgs) {
+	b.RLock()
+	handlers := b.handlers[args.Event]
+	b.RUnlock()
+
+	for _, h := range handlers {
+		fn := h.fn
+		safeCall(func() { fn(args) })
+	}
+}
+
+// watchPeers emit peer events when servers join or leave cluster, the
+// servers loaded from config file at startup are not included
+func (b *eventBus) watchPeers() {
+	cluster.OnServerAdded(func(svr *cluster.ServerConfig) {
+		b.emit(&EventArgs{Event: PeerJoined, Server: svr})
+	})
+	cluster.OnServerRemoved(func(svr *cluster.ServerConfig) {
+		b.emit(&EventArgs{Event: PeerLeft, Server: svr})
+	})
+}
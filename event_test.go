@@ -0,0 +1,125 @@
+package starx
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+func TestEventBus_Session(t *testing.T) {
+	var got []Event
+	record := func(args *EventArgs) { got = append(got, args.Event) }
+	defer On(SessionCreated, record)()
+	defer On(SessionBound, record)()
+	defer On(SessionClosed, record)()
+	defer On(SessionClosed, func(*EventArgs) { panic("should be recovered") })()
+
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	a.session.Bind(1)
+	a.Close()
+
+	if len(got) != 3 || got[0] != SessionCreated || got[1] != SessionBound || got[2] != SessionClosed {
+		t.Fatalf("unexpected events: %v", got)
+	}
+}
+
+func TestEventBus_Peer(t *testing.T) {
+	var got []string
+	record := func(args *EventArgs) { got = append(got, args.Event.String()+":"+args.Server.Id) }
+	defer On(PeerJoined, record)()
+	defer On(PeerLeft, record)()
+	events.watchPeers()
+
+	cluster.Register(&cluster.ServerConfig{Type: "peer", Id: "peer-1"})
+	cluster.RemoveServer("peer-1")
+
+	if len(got) != 2 || got[0] != "PeerJoined:peer-1" || got[1] != "PeerLeft:peer-1" {
+		t.Fatalf("unexpected events: %v", got)
+	}
+}
+
+func TestEventBus_CloseReason(t *testing.T) {
+	var mu sync.Mutex
+	reasons := make(map[int64]session.CloseReason)
+	defer On(SessionClosed, func(args *EventArgs) {
+		mu.Lock()
+		defer mu.Unlock()
+		if args.Reason != args.Session.CloseReason {
+			reasons[args.Session.ID] = session.CloseUnknown
+			return
+		}
+		reasons[args.Session.ID] = args.Reason
+	})()
+	reason := func(sid int64) session.CloseReason {
+		mu.Lock()
+		defer mu.Unlock()
+		return reasons[sid]
+	}
+
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	a.close(false, session.CloseKicked)
+	if r := reason(a.session.ID); r != session.CloseKicked {
+		t.Fatalf("expect Kicked, got %s", r)
+	}
+
+	c, _ = net.Pipe()
+	a = transporter.createAgent(c)
+	a.Close()
+	if r := reason(a.session.ID); r != session.CloseServer {
+		t.Fatalf("expect Server, got %s", r)
+	}
+
+	// connection closed by client
+	created := make(chan *session.Session, 1)
+	defer On(SessionCreated, func(args *EventArgs) {
+		select {
+		case created <- args.Session:
+		default:
+		}
+	})()
+	c, peer := net.Pipe()
+	peer.Close()
+	handler.handle(c)
+	s := <-created
+	if r := reason(s.ID); r != session.CloseClient {
+		t.Fatalf("expect Client, got %s", r)
+	}
+
+	// reason sent by frontend is delivered to backend sessions
+	conn, _ := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+	s = ac.Session(701)
+	remote.processRequest(ac, &rpc.Request{
+		ServiceMethod: sessionClosedRoute,
+		Sid:           701,
+		Kind:          rpc.Sys,
+		Data:          []byte{byte(session.CloseHeartbeatTimeout)},
+	})
+	if r := reason(s.ID); r != session.CloseHeartbeatTimeout {
+		t.Fatalf("expect HeartbeatTimeout, got %s", r)
+	}
+}
+
+func TestEventBus_Off(t *testing.T) {
+	b := &eventBus{handlers: make(map[Event][]eventHandler)}
+	var got []int
+	off1 := b.on(SessionCreated, func(*EventArgs) { got = append(got, 1) })
+	off2 := b.on(SessionCreated, func(*EventArgs) { got = append(got, 2) })
+
+	off1()
+	b.emit(&EventArgs{Event: SessionCreated})
+	off2()
+	off2()
+	b.emit(&EventArgs{Event: SessionCreated})
+
+	if len(got) != 1 || got[0] != 2 {
+		t.Fatalf("unexpected handlers called: %v", got)
+	}
+}
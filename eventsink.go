@@ -0,0 +1,123 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/sink"
+)
+
+// Topics of the session events published to event sink, events of frontend
+// sessions are published only
+const (
+	TopicSessionCreated = "session.created"
+	TopicSessionClosed  = "session.closed"
+	TopicSessionBound   = "session.bound"
+)
+
+// publisher publish session events and custom events to event sink
+var publisher = newPublishService()
+
+type sinkMessage struct {
+	topic string
+	data  []byte
+}
+
+// sessionEvent is the payload of session events, encoded in json
+type sessionEvent struct {
+	Server string `json:"server"`
+	Sid    int64  `json:"sid"`
+	Uid    int64  `json:"uid"`
+	Remote string `json:"remote,omitempty"`
+	Time   int64  `json:"time"` // unix time in milliseconds
+}
+
+type publishService struct {
+	sink  sink.Sink
+	queue chan sinkMessage // messages are published by a single goroutine
+}
+
+func newPublishService() *publishService {
+	p := &publishService{}
+	events.on(SessionCreated, func(args *EventArgs) { p.sessionEvent(TopicSessionCreated, args.Session) })
+	events.on(SessionClosed, func(args *EventArgs) { p.sessionEvent(TopicSessionClosed, args.Session) })
+	events.on(SessionBound, func(args *EventArgs) { p.sessionEvent(TopicSessionBound, args.Session) })
+	return p
+}
+
+func (p *publishService) setSink(s sink.Sink) {
+	p.sink = s
+	if p.queue == nil {
+		p.queue = make(chan sinkMessage, packetBufferSize)
+		go p.run()
+	}
+}
+
+func (p *publishService) run() {
+	for m := range p.queue {
+		if err := p.sink.Publish(m.topic, m.data); err != nil {
+			log.Errorf("publish event(%s) error: %s", m.topic, err.Error())
+		}
+	}
+}
+
+// publish the message asynchronously, the message will be dropped when the
+// queue is full, so a slow message queue never blocks game logic
+func (p *publishService) publish(topic string, data []byte) {
+	if p.sink == nil {
+		return
+	}
+	select {
+	case p.queue <- sinkMessage{topic: topic, data: data}:
+	default:
+		log.Warnf("event sink queue full, event(%s) dropped", topic)
+	}
+}
+
+func (p *publishService) sessionEvent(topic string, s *session.Session) {
+	if p.sink == nil {
+		return
+	}
+	if _, ok := s.Entity.(*acceptor); ok {
+		return
+	}
+
+	var server string
+	if app.config != nil {
+		server = app.config.Id
+	}
+	data, err := json.Marshal(&sessionEvent{
+		Server: server,
+		Sid:    s.ID,
+		Uid:    s.Uid,
+		Remote: s.Remote,
+		Time:   time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		log.Errorf("encode session event error: %s", err.Error())
+		return
+	}
+	p.publish(topic, data)
+}
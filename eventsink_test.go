@@ -0,0 +1,59 @@
+package starx
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+type chanSink chan sinkMessage
+
+func (c chanSink) Publish(topic string, data []byte) error {
+	c <- sinkMessage{topic: topic, data: data}
+	return nil
+}
+
+func TestEventSink(t *testing.T) {
+	c := make(chanSink, 8)
+	SetEventSink(c)
+	defer func() { publisher.sink = nil }()
+
+	recv := func() sinkMessage {
+		select {
+		case m := <-c:
+			return m
+		case <-time.After(time.Second):
+			t.Fatal("event should be published")
+		}
+		return sinkMessage{}
+	}
+
+	conn, _ := net.Pipe()
+	a := transporter.createAgent(conn)
+	m := recv()
+	ev := &sessionEvent{}
+	if err := json.Unmarshal(m.data, ev); err != nil {
+		t.Fatal(err)
+	}
+	if m.topic != TopicSessionCreated || ev.Sid != a.session.ID || ev.Server != "test-1" || ev.Time == 0 {
+		t.Fatalf("unexpected event: %s %s", m.topic, m.data)
+	}
+
+	a.session.Bind(9100)
+	if m := recv(); m.topic != TopicSessionBound {
+		t.Fatalf("expect session bound event, got %s", m.topic)
+	}
+
+	if err := Emit("game.win", []byte(`{"score":10}`)); err != nil {
+		t.Fatal(err)
+	}
+	if m := recv(); m.topic != "game.win" || string(m.data) != `{"score":10}` {
+		t.Fatalf("unexpected event: %s %s", m.topic, m.data)
+	}
+
+	a.Close()
+	if m := recv(); m.topic != TopicSessionClosed {
+		t.Fatalf("expect session closed event, got %s", m.topic)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/route"
+)
+
+var ErrRouteNotExposed = errors.New("route not exposed to clients")
+
+// exposedBy reports whether the handler methods of the component are exposed
+// to clients by the server type, components not implementing the
+// component.Exposer are exposed by all server types
+func exposedBy(c component.Component, serverType string) bool {
+	e, ok := c.(component.Exposer)
+	if !ok {
+		return true
+	}
+	for _, t := range e.ExposedBy() {
+		if t == serverType {
+			return true
+		}
+	}
+	return false
+}
+
+// internalService reports whether the service is internal, e.g. __Admin,
+// which serves peers only
+func internalService(name string) bool {
+	return strings.HasPrefix(name, "__")
+}
+
+// routeExposed reports whether the route can be called by clients through
+// frontend server, all routes are exposed if no route exposed explicitly,
+// internal routes are never exposed
+func routeExposed(r *route.Route) bool {
+	if internalService(r.Service) {
+		return false
+	}
+	if len(env.exposedRoutes) == 0 {
+		return true
+	}
+	services, ok := env.exposedRoutes[r.ServerType]
+	if !ok {
+		return false
+	}
+	return len(services) == 0 || services[r.Service]
+}
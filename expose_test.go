@@ -0,0 +1,145 @@
+package starx
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+type LoginComp struct {
+	component.Base
+	called bool
+}
+
+func (c *LoginComp) ExposedBy() []string { return []string{"gate"} }
+
+func (c *LoginComp) Login(s *session.Session, data []byte) error {
+	c.called = true
+	return nil
+}
+
+func exposeError(t *testing.T, a *agent) *Error {
+	p, _, _ := packet.Unpack(<-a.sendBuffer)
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Error{}
+	if err := json.Unmarshal(m.Data, e); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Error {
+		t.Fatalf("expect error response, got %s", m.Data)
+	}
+	return e
+}
+
+func TestExposedBy(t *testing.T) {
+	if !exposedBy(&ErrorComp{}, "game") {
+		t.Fatal("component should be exposed by all server types by default")
+	}
+	if !exposedBy(&LoginComp{}, "gate") || exposedBy(&LoginComp{}, "game") {
+		t.Fatal("component should be exposed by declared server types only")
+	}
+}
+
+func TestHiddenHandler(t *testing.T) {
+	c := &LoginComp{}
+	handler.register(c)
+	defer handler.unregister("LoginComp")
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 1, Route: "LoginComp.Login"})
+	if e := exposeError(t, a); e.Code != CodeForbidden || c.called {
+		t.Fatalf("hidden handler should not be called, got %+v", e)
+	}
+}
+
+func TestHiddenRemoteHandler(t *testing.T) {
+	c := &LoginComp{}
+	remote.register(c)
+	defer remote.unregister("LoginComp")
+
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	go remote.processRequest(ac, &rpc.Request{ServiceMethod: "LoginComp.Login", Sid: 100, Kind: rpc.Sys})
+
+	resp := readResponse(t, peer)
+	if resp.ErrorCode != CodeForbidden || c.called {
+		t.Fatalf("hidden handler should not be called, got %+v", resp)
+	}
+}
+
+func TestExposeRoutes(t *testing.T) {
+	defer func() { env.exposedRoutes = nil }()
+
+	ExposeRoutes("gate", "Login")
+	ExposeRoutes("chat")
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	for _, r := range []string{"game.Battle.Attack", "gate.Admin.Kick"} {
+		handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 1, Route: r})
+		if e := exposeError(t, a); e.Code != CodeForbidden {
+			t.Fatalf("route %s should not be exposed, got %+v", r, e)
+		}
+	}
+
+	for r, exposed := range map[string]bool{"gate.Login.Login": true, "chat.Room.Send": true, "gate.Room.Send": false} {
+		rt, _ := route.Decode(r)
+		if routeExposed(rt) != exposed {
+			t.Fatalf("route %s should be exposed: %t", r, exposed)
+		}
+	}
+}
+
+func TestInternalRouteForbidden(t *testing.T) {
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	data := []byte(`{"path":"/loglevel","form":{"level":["fatal"]}}`)
+	for _, r := range []string{"backend.__Admin.Exec", "__Admin.Exec", "gate.__Session.Migrate", "gate.__Session.PushUIDs"} {
+		handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 1, Route: r, Data: data})
+		if e := exposeError(t, a); e.Code != CodeForbidden {
+			t.Fatalf("internal route %s should be forbidden, got %+v", r, e)
+		}
+	}
+}
+
+func TestPeerRouteRequiresPeerRpc(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	called := false
+	peerRoutes["__Test.Peer"] = func(data []byte) ([]byte, error) {
+		called = true
+		return nil, nil
+	}
+	defer delete(peerRoutes, "__Test.Peer")
+
+	go remote.processRequest(ac, &rpc.Request{ServiceMethod: "__Test.Peer", Sid: 100, Kind: rpc.Sys})
+	if resp := readResponse(t, peer); resp.ErrorCode != CodeNotFound || called {
+		t.Fatalf("peer route should not be served to session requests, got %+v", resp)
+	}
+
+	go remote.processRequest(ac, &rpc.Request{ServiceMethod: "__Test.Peer", Kind: rpc.Peer})
+	if resp := readResponse(t, peer); resp.Error != "" || !called {
+		t.Fatalf("peer route should be served to peers, got %+v", resp)
+	}
+}
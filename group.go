@@ -52,12 +52,52 @@ type Group struct {
 	members []int64                    // all user ids
 }
 
+// groups contains all working groups, which used to find out the groups that
+// a session belongs to when migrating session
+var groups = struct {
+	sync.RWMutex
+	m map[string]*Group
+}{m: make(map[string]*Group)}
+
 func NewGroup(n string) *Group {
-	return &Group{
+	g := &Group{
 		status: groupStatusWorking,
 		name:   n,
 		uids:   make(map[int64]*session.Session),
 	}
+
+	groups.Lock()
+	groups.m[n] = g
+	groups.Unlock()
+	return g
+}
+
+// NewNamespaceGroup returns a group of the namespace, groups of different
+// namespaces are isolated even if they have the same name
+func NewNamespaceGroup(ns, n string) *Group {
+	return NewGroup(qualifiedName(ns, n))
+}
+
+// groupsOf return names of all groups that contain the uid
+func groupsOf(uid int64) []string {
+	groups.RLock()
+	defer groups.RUnlock()
+
+	var names []string
+	for n, g := range groups.m {
+		if g.IsContain(uid) {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func groupByName(n string) (*Group, bool) {
+	groups.RLock()
+	defer groups.RUnlock()
+
+	g, ok := groups.m[n]
+	return g, ok
 }
 
 func (c *Group) Member(uid int64) *session.Session {
@@ -88,22 +128,20 @@ func (c *Group) Multicast(route string, v interface{}, filter SessionFilter) err
 	log.Debugf("Type=Multicast Route=%s, Data=%+v", route, v)
 
 	c.RLock()
-	defer c.RUnlock()
-
+	sessions := make([]*session.Session, 0, len(c.uids))
 	for _, s := range c.uids {
-		if !filter(s) {
-			continue
-		}
-		err = transporter.push(s, route, data)
-		if err != nil {
-			log.Error(err.Error())
+		if filter(s) {
+			sessions = append(sessions, s)
 		}
 	}
+	c.RUnlock()
 
+	pushToSessions(sessions, route, data)
 	return nil
 }
 
-// Push message to all client
+// Push message to all client, messages to members on the same frontend server
+// are batched in one rpc when current server is backend server
 func (c *Group) Broadcast(route string, v interface{}) error {
 	if c.isClosed() {
 		return ErrClosedGroup
@@ -117,16 +155,13 @@ func (c *Group) Broadcast(route string, v interface{}) error {
 	log.Debugf("Type=broadcast Route=%s, Data=%+v", route, v)
 
 	c.RLock()
-	defer c.RUnlock()
-
+	sessions := make([]*session.Session, 0, len(c.uids))
 	for _, s := range c.uids {
-		err = transporter.push(s, route, data)
-		if err != nil {
-			log.Error(err.Error())
-		}
+		sessions = append(sessions, s)
 	}
+	c.RUnlock()
 
-	return err
+	return pushToSessions(sessions, route, data)
 }
 
 func (c *Group) IsContain(uid int64) bool {
@@ -216,6 +251,12 @@ func (c *Group) Close() error {
 
 	atomic.StoreInt32(&c.status, groupStatusClosed)
 
+	groups.Lock()
+	if groups.m[c.name] == c {
+		delete(groups.m, c.name)
+	}
+	groups.Unlock()
+
 	// release all reference
 	c.uids = make(map[int64]*session.Session)
 	c.members = []int64{}
@@ -21,19 +21,30 @@
 package starx
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net"
 	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/lonnng/starx/cluster"
 	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/compress"
+	"github.com/lonnng/starx/encrypt"
 	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/metrics"
 	"github.com/lonnng/starx/packet"
 	"github.com/lonnng/starx/route"
 	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/trace"
 )
 
 // Unhandled message buffer size
@@ -42,10 +53,56 @@ const (
 	packetBufferSize = 256
 )
 
+// Handshake response codes
+const (
+	handshakeOK         = 200 // handshake succeed
+	handshakeBadRequest = 400 // invalid handshake data, e.g. encryption required but key not found
+	handshakeRejected   = 403 // handshake rejected by validator
+	handshakeServerFull = 503 // connection count reached the limit of server
+)
+
+// protocolVersion represents the version of wire protocol, which will be
+// sent to client in handshake response
+const protocolVersion = 1
+
 var handler = newHandlerService()
 
+// handshakeRequest represents the data of handshake packet sent by client
+type handshakeRequest struct {
+	Sys struct {
+		Compress []string `json:"compress"` // compression algorithms supported by client
+		Encrypt  struct {
+			Key []byte `json:"key"` // X25519 public key of client(base64)
+		} `json:"encrypt"`
+		Protos struct {
+			Version string `json:"version"` // version of protos cached by client
+		} `json:"protos"`
+		Resume struct {
+			Token string `json:"token"` // resume token of the lost session
+		} `json:"resume"`
+		Batch bool   `json:"batch"` // whether client can split batched messages
+		Type  string `json:"type"`  // client type, e.g. native, web or bot
+	} `json:"sys"`
+	User struct {
+		Token string `json:"token"` // authentication token
+	} `json:"user"`
+}
+
+func (r *handshakeRequest) supportCompress(algorithm string) bool {
+	for _, a := range r.Sys.Compress {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
 type handlerService struct {
-	serviceMap map[string]*component.Service
+	sync.RWMutex                                          // protect serviceMap and namespaces
+	serviceMap   map[string]*component.Service            // all handler service
+	namespaces   map[string]map[string]*component.Service // handler services of namespaces
+	dict         map[string]uint16                        // route compression dictionary sent in handshake
+	protos       *protos                                  // message schemas sent in handshake
 }
 
 func newHandlerService() *handlerService {
@@ -55,56 +112,143 @@ func newHandlerService() *handlerService {
 }
 
 func (hs *handlerService) register(rcvr component.Component) error {
-	if hs.serviceMap == nil {
-		hs.serviceMap = make(map[string]*component.Service)
+	return hs.registerIn("", rcvr)
+}
+
+// registerIn register the component in the namespace, empty namespace means
+// the default one
+func (hs *handlerService) registerIn(ns string, rcvr component.Component) error {
+	s, err := hs.newService(rcvr)
+	if err != nil {
+		return err
 	}
+	_, err = hs.put(ns, s, false)
+	return err
+}
 
+// newService scan the handlers of the component without serving it
+func (hs *handlerService) newService(rcvr component.Component) (*component.Service, error) {
 	s := &component.Service{
 		Type: reflect.TypeOf(rcvr),
 		Rcvr: reflect.ValueOf(rcvr),
 	}
 	s.Name = reflect.Indirect(s.Rcvr).Type().Name()
 
-	if _, ok := hs.serviceMap[s.Name]; ok {
-		return errors.New("handler: service already defined: " + s.Name)
+	if err := s.ScanHandler(); err != nil {
+		return nil, err
 	}
+	s.Hidden = !exposedBy(rcvr, app.config.Type)
+	return s, nil
+}
 
-	if err := s.ScanHandler(); err != nil {
-		return err
+// put serve the service in the namespace, the service of the same name is
+// swapped out and returned when replace is set, which must exist then
+func (hs *handlerService) put(ns string, s *component.Service, replace bool) (*component.Service, error) {
+	hs.Lock()
+	defer hs.Unlock()
+
+	if hs.serviceMap == nil {
+		hs.serviceMap = make(map[string]*component.Service)
 	}
+	services := hs.serviceMap
+	if ns != "" {
+		if hs.namespaces == nil {
+			hs.namespaces = make(map[string]map[string]*component.Service)
+		}
+		if services = hs.namespaces[ns]; services == nil {
+			services = make(map[string]*component.Service)
+			hs.namespaces[ns] = services
+		}
+	}
+	old, ok := services[s.Name]
+	if ok && !replace {
+		return nil, errors.New("handler: service already defined: " + qualifiedName(ns, s.Name))
+	}
+	if !ok && replace {
+		return nil, ErrServiceNotFound
+	}
+	services[s.Name] = s
+
+	return old, nil
+}
+
+// unregister remove the service from handler service, the messages routed
+// to the service will be dropped since then, name of services registered in
+// namespace should be qualified, e.g. namespace.Service
+func (hs *handlerService) unregister(name string) (*component.Service, error) {
+	hs.Lock()
+	defer hs.Unlock()
+
+	ns, name := splitNamespace(name)
+	services := hs.serviceMap
+	if ns != "" {
+		services = hs.namespaces[ns]
+	}
+	s, ok := services[name]
+	if !ok {
+		return nil, ErrServiceNotFound
+	}
+	delete(services, name)
+	return s, nil
+}
+
+func (hs *handlerService) service(name string) (*component.Service, bool) {
+	return hs.serviceIn("", name)
+}
 
-	hs.serviceMap[s.Name] = s
+// serviceIn returns the service of the namespace
+func (hs *handlerService) serviceIn(ns, name string) (*component.Service, bool) {
+	hs.RLock()
+	defer hs.RUnlock()
 
-	return nil
+	if ns != "" {
+		s, ok := hs.namespaces[ns][name]
+		return s, ok
+	}
+	s, ok := hs.serviceMap[name]
+	return s, ok
 }
 
 // Handle network connection
 // Read data from Socket file descriptor and decode it, handle message in
 // individual logic goroutine
 func (hs *handlerService) handle(conn net.Conn) {
+	hs.handleCodec(conn, nil)
+}
+
+// handleCodec handle the connection with the packet codec of listener, nil
+// means the default codec
+func (hs *handlerService) handleCodec(conn net.Conn, codec packet.Codec) {
 	defer conn.Close()
 
 	// register new session when new connection connected in
 	agent := transporter.createAgent(conn)
+	agent.codec = codec
 	log.Debugf("New session established: %s", agent.String())
 
+	// outbound packets will be written in writer goroutine
+	go agent.write()
+
 	// all user logic will be handled in single goroutine
 	// synchronized in below routine
 	go func() {
 		for {
+			// packets are held while the remote call of last message in
+			// flight, so messages are processed in order, and tasks are
+			// still executed
+			recv := agent.recvBuffer
+			if agent.waiting {
+				recv = nil
+			}
 			select {
-			case p, ok := <-agent.recvBuffer:
+			case p, ok := <-recv:
 				if ok && p != nil {
+					agent.dequeued(p)
 					hs.processPacket(agent, p)
+					packet.Free(p)
 				}
-			case m, ok := <-agent.sendBuffer:
-				if ok && m != nil {
-					_, err := agent.socket.Write(m)
-					if err != nil {
-						log.Error(err)
-						agent.Close()
-					}
-				}
+			case fn := <-agent.tasks:
+				safeCall(fn)
 			case <-agent.die:
 				return
 
@@ -114,30 +258,59 @@ func (hs *handlerService) handle(conn net.Conn) {
 		}
 	}()
 
-	tmp := make([]byte, 0) // save truncated data
-	buf := make([]byte, 2048)
+	established, handshaked := time.Now(), false
+	decoder := agent.packetCodec().NewDecoder(countReader{conn, &agent.stats.bytesIn})
+	limiter, _ := decoder.(packet.Limiter)
 	for {
-		n, err := conn.Read(buf)
+		conn.SetReadDeadline(readDeadline(established, handshaked))
+		// the limit is checked by the length in header, so an oversized
+		// packet is refused before buffered
+		if limiter != nil {
+			limiter.SetLimit(maxPacketSize())
+		}
+		p, err := decoder.Decode()
 		if err != nil {
-			log.Errorf("Read message error: %s, session will be closed immediately", err.Error())
-			agent.Close()
-			break // break read packet loop
+			reason := session.CloseReadError
+			switch {
+			case isTimeout(err):
+				reason = session.CloseHeartbeatTimeout
+				sessionLogger(agent.session).Warnf("read message timeout, handshaked=%t, connection will be closed immediately", handshaked)
+			case err == io.EOF:
+				reason = session.CloseClient
+				sessionLogger(agent.session).Debugf("connection closed by client")
+			case err == packet.ErrPacketTooLarge:
+				reason = session.CloseServer
+				sessionLogger(agent.session).Errorf("packet length exceeds %d, connection will be closed immediately", maxPacketSize())
+			default:
+				sessionLogger(agent.session).Errorf("read message error: %s, connection will be closed immediately", err.Error())
+			}
+			agent.disconnect(reason)
+			return
+		}
+		if max := maxPacketSize(); max > 0 && len(p.Data) > max {
+			sessionLogger(agent.session).Errorf("packet length %d exceeds %d, connection will be closed immediately", len(p.Data), max)
+			agent.disconnect(session.CloseServer)
+			return
 		}
-		tmp = append(tmp, buf[:n]...)
+		metrics.PacketsReceived.Inc()
+		atomic.AddInt64(&agent.stats.packetsIn, 1)
+		agent.sniffInbound(p)
 
-		// save decoded packet
-		var p *packet.Packet
-		for len(tmp) >= packet.HeadLength {
-			p, tmp, err = packet.Unpack(tmp)
-			if err != nil {
-				agent.Close()
-				break
-			}
+		if p.Type == packet.HandshakeAck {
+			handshaked = true
+		}
 
-			if p == nil {
-				break
-			}
-			agent.recvBuffer <- p
+		// heartbeat will not be blocked by a busy logic goroutine
+		if p.Type == packet.Heartbeat {
+			agent.heartbeat()
+			packet.Free(p)
+			continue
+		}
+
+		if !agent.enqueue(p) {
+			sessionLogger(agent.session).Errorf("session too slow to consume packets, will be closed")
+			agent.Close()
+			return
 		}
 	}
 }
@@ -146,12 +319,103 @@ func (hs *handlerService) processPacket(a *agent, p *packet.Packet) {
 	switch p.Type {
 	case packet.Handshake:
 		a.status = statusHandshake
-		data, err := json.Marshal(map[string]interface{}{
-			"code": 200,
-			"sys":  map[string]float64{"heartbeat": env.heartbeatInternal.Seconds()},
-		})
+		if max := app.config.MaxConnections; max > 0 && transporter.count() > max {
+			sessionLogger(a.session).Warnf("connection count reached the limit(%d), handshake refused", max)
+			hs.refuseHandshake(a, handshakeServerFull, "server is full")
+			return
+		}
+
+		if env.handshakeValidator != nil {
+			if err := env.handshakeValidator(p.Data); err != nil {
+				sessionLogger(a.session).Warnf("handshake rejected: %s", err.Error())
+				hs.refuseHandshake(a, handshakeRejected, err.Error())
+				return
+			}
+		}
+
+		req := &handshakeRequest{}
+		if len(p.Data) > 0 {
+			if err := json.Unmarshal(p.Data, req); err != nil {
+				sessionLogger(a.session).Errorf("invalid handshake data: %s", err.Error())
+			}
+		}
+
+		sys := map[string]interface{}{
+			"heartbeat": heartbeatInterval().Seconds(),
+			"dict":      hs.dict,
+			"protocol":  protocolVersion,
+		}
+		if hs.protos != nil {
+			sys["protos"] = hs.protos.sys(req.Sys.Protos.Version)
+		}
+		if req.Sys.Type != "" {
+			a.session.ClientType = req.Sys.Type
+			sys["type"] = req.Sys.Type
+		}
+		if env.compressor != nil && req.supportCompress(env.compressor.Name()) {
+			a.compress = true
+			sys["compress"] = map[string]interface{}{
+				"algorithm": env.compressor.Name(),
+				"threshold": env.compressThreshold,
+			}
+		}
+
+		if env.batchWindow > 0 && req.Sys.Batch {
+			a.batch = newBatcher(a)
+			sys["batch"] = map[string]interface{}{
+				"window": int64(env.batchWindow / time.Millisecond),
+			}
+		}
+
+		if app.config.Encrypt {
+			key, c, err := encrypt.Exchange(req.Sys.Encrypt.Key)
+			if err != nil {
+				sessionLogger(a.session).Warnf("key exchange failed: %s", err.Error())
+				hs.refuseHandshake(a, handshakeBadRequest, "key exchange failed")
+				return
+			}
+			a.cipher = c
+			sys["encrypt"] = map[string]interface{}{
+				"key": key,
+			}
+		}
+
+		var replay []*message.Message
+		if env.resumeGrace > 0 || persistence.enabled() {
+			if token := req.Sys.Resume.Token; token != "" {
+				var ok bool
+				if replay, ok = resumes.resume(a, token); ok {
+					sessionLogger(a.session).Debugf("session resumed, replay %d messages", len(replay))
+					persistence.remove(token)
+				} else if persistence.restore(a.session, token) {
+					sessionLogger(a.session).Debugf("session settings restored from store")
+				}
+			}
+			sys["resume"] = map[string]interface{}{
+				"token": resumes.issue(a),
+			}
+			persistence.save(a.session)
+		}
+
+		if env.auth != nil && env.auth.verify != nil && req.User.Token != "" && a.session.Uid == 0 {
+			if err := authenticate(a.session, req.User.Token); err != nil {
+				sessionLogger(a.session).Warnf("authentication failed: %s", err.Error())
+				hs.refuseHandshake(a, handshakeRejected, "authentication failed")
+				return
+			}
+		}
+
+		res := map[string]interface{}{
+			"code": handshakeOK,
+			"sys":  sys,
+		}
+		if env.handshakeData != nil {
+			res["user"] = env.handshakeData
+		}
+
+		data, err := json.Marshal(res)
 		if err != nil {
-			log.Infof(err.Error())
+			log.Info(err.Error())
 		}
 
 		rp := &packet.Packet{
@@ -160,24 +424,76 @@ func (hs *handlerService) processPacket(a *agent, p *packet.Packet) {
 			Data:   data,
 		}
 
-		resp, err := rp.Pack()
+		resp, err := a.packetCodec().Encode(rp)
 		if err != nil {
-			log.Errorf(err.Error())
+			log.Error(err.Error())
 			a.Close()
 		}
 
 		if err := a.Send(resp); err != nil {
-			log.Errorf(err.Error())
+			log.Error(err.Error())
 			a.Close()
 		}
-		log.Debugf("Session handshake Id=%d, Remote=%s", a.id, a.socket.RemoteAddr())
+		for _, m := range replay {
+			ep, err := transporter.packMessage(a.session, m)
+			if err != nil {
+				log.Error(err.Error())
+				continue
+			}
+			a.Send(ep)
+		}
+		sessionLogger(a.session).Debugf("session handshake, remote=%s", a.socket.RemoteAddr())
 	case packet.HandshakeAck:
 		a.status = statusWorking
-		log.Debugf("Receive handshake ACK Id=%d, Remote=%s", a.id, a.socket.RemoteAddr())
+		a.waitAuth()
+		sessionLogger(a.session).Debugf("receive handshake ACK, remote=%s", a.socket.RemoteAddr())
 	case packet.Data:
-		m, err := message.Decode(p.Data)
+		// data packets are accepted only after handshake completed
+		if a.status < statusWorking {
+			sessionLogger(a.session).Warnf("data packet received before handshake completed, session will be closed")
+			a.Close()
+			return
+		}
+		data := p.Data
+		if a.cipher != nil {
+			var err error
+			if data, err = a.cipher.Decrypt(data); err != nil {
+				sessionLogger(a.session).Errorf("decrypt message error: %s", err.Error())
+				a.Close()
+				return
+			}
+		}
+		data, err := env.inbound.process(a.session, data)
 		if err != nil {
-			log.Errorf(err.Error())
+			sessionLogger(a.session).Errorf("inbound pipeline error: %s, message dropped", err.Error())
+			return
+		}
+		m, err := message.Decode(data)
+		if err != nil {
+			sessionLogger(a.session).Errorf("decode message error: %s", err.Error())
+			return
+		}
+		// the message is recycled after processed, handlers must not keep it
+		defer message.Free(m)
+		if m.DataCompressed {
+			if !a.compress {
+				sessionLogger(a.session).Errorf("compressed message received without negotiation")
+				return
+			}
+			if m.Data, err = compress.Decompress(env.compressor, m.Data, compress.MaxSize); err != nil {
+				sessionLogger(a.session).Errorf("decompress message error: %s", err.Error())
+				return
+			}
+			m.DataCompressed = false
+		}
+		if !a.allow(m.Route) {
+			sessionLogger(a.session).WithFields(log.Fields{"route": m.Route}).Warnf("message rate limit exceeded, message refused")
+			rejectMessage(a.session, m, env.errorCodes.TooManyRequests, ErrRateLimited)
+			return
+		}
+		if !a.authorized(m.Route) {
+			sessionLogger(a.session).WithFields(log.Fields{"route": m.Route}).Warnf("session not authenticated, message refused")
+			rejectMessage(a.session, m, env.errorCodes.Unauthorized, ErrUnauthenticated)
 			return
 		}
 		hs.processMessage(a.session, m)
@@ -190,7 +506,37 @@ func (hs *handlerService) processPacket(a *agent, p *packet.Packet) {
 	}
 }
 
+// refuseHandshake respond the handshake with an error code and close the
+// session, response will be written directly, since the session closed
+// immediately
+func (hs *handlerService) refuseHandshake(a *agent, code int, msg string) {
+	data, err := json.Marshal(map[string]interface{}{
+		"code": code,
+		"msg":  msg,
+	})
+	if err != nil {
+		log.Error(err.Error())
+	}
+
+	resp, err := a.packetCodec().Encode(&packet.Packet{
+		Type:   packet.Handshake,
+		Length: len(data),
+		Data:   data,
+	})
+	if err != nil {
+		log.Error(err.Error())
+		a.Close()
+		return
+	}
+	a.sniffOutbound(resp)
+	if _, err := a.socket.Write(resp); err != nil {
+		log.Error(err.Error())
+	}
+	a.Close()
+}
+
 func (hs *handlerService) processMessage(session *session.Session, msg *message.Message) {
+	logger := sessionLogger(session).WithFields(log.Fields{"route": msg.Route})
 	defer func() {
 		if err := recover(); err != nil {
 			log.Tracef("processMessage Error: %+v", err)
@@ -203,21 +549,42 @@ func (hs *handlerService) processMessage(session *session.Session, msg *message.
 	case message.Notify:
 		session.LastID = 0
 	default:
-		log.Errorf("invalid message type")
+		logger.Errorf("invalid message type")
 		return
 	}
+	if env.recorder != nil {
+		recordMessage(session, msg)
+	}
+	session.TraceID, session.SpanID = "", ""
+	if trace.Enabled() {
+		session.TraceID = trace.NewTraceID()
+	}
 
 	r, err := route.Decode(msg.Route)
 	if err != nil {
-		log.Errorf(err.Error())
+		logger.Errorf("decode route error: %s", err.Error())
+		respondError(session, env.errorCodes.BadRequest, err)
 		return
 	}
 
+	resolveNamespace(r)
+
 	// current server as default server type
 	if r.ServerType == "" {
 		r.ServerType = app.config.Type
 	}
 
+	if !routeExposed(r) {
+		logger.Warnf("route not exposed to clients")
+		respondError(session, env.errorCodes.Forbidden, ErrRouteNotExposed)
+		return
+	}
+
+	// all routes are served locally in single process mode
+	if env.single && !singleRoute(session, r) {
+		return
+	}
+
 	// message dispatch
 	if r.ServerType == app.config.Type {
 		hs.localProcess(session, r, msg)
@@ -228,15 +595,25 @@ func (hs *handlerService) processMessage(session *session.Session, msg *message.
 
 // current message handle in local server
 func (hs *handlerService) localProcess(session *session.Session, route *route.Route, msg *message.Message) {
-	s, ok := hs.serviceMap[route.Service]
+	logger := sessionLogger(session).WithFields(log.Fields{"route": route.String()})
+
+	s, ok := hs.serviceIn(route.Namespace, route.Service)
 	if !ok || s == nil {
-		log.Infof("handler: service: " + route.Service + " not found")
+		logger.Infof("handler: service not found")
+		respondError(session, env.errorCodes.NotFound, errors.New("service "+route.Service+" not found"))
+		return
+	}
+
+	if s.Hidden {
+		logger.Warnf("handler: service not exposed to clients")
+		respondError(session, env.errorCodes.Forbidden, ErrRouteNotExposed)
 		return
 	}
 
 	m, ok := s.HandlerMethods[route.Method]
 	if !ok || m == nil {
-		log.Infof("handler: " + route.Service + " does not contain method: " + route.Method)
+		logger.Infof("handler: method not found")
+		respondError(session, env.errorCodes.NotFound, errors.New("method "+route.Method+" not found"))
 		return
 	}
 
@@ -247,33 +624,207 @@ func (hs *handlerService) localProcess(session *session.Session, route *route.Ro
 		data = reflect.New(m.Type.Elem()).Interface()
 		err := serializer.Deserialize(msg.Data, data)
 		if err != nil {
-			log.Errorf("deserialize error: %s", err.Error())
+			logger.Errorf("deserialize error: %s", err.Error())
+			respondError(session, env.errorCodes.BadRequest, err)
 			return
 		}
 	}
 
-	log.Debugf("Uid=%d, Message={%s}, Data=%+v", session.Uid, msg.String(), data)
+	if err := validate(route.Name(), session, data); err != nil {
+		logger.Warnf("message refused by validator: %s", err.Error())
+		respondError(session, env.errorCodes.BadRequest, err)
+		return
+	}
 
-	ret := m.Method.Func.Call([]reflect.Value{s.Rcvr, reflect.ValueOf(session), reflect.ValueOf(data)})
-	if len(ret) > 0 {
-		err := ret[0].Interface()
-		if err != nil {
-			log.Errorf(err.(error).Error())
+	logger.Debugf("Message={%s}, Data=%+v", msg.String(), data)
+
+	// the slot of concurrency limit is acquired in the call, so it's never
+	// leaked if the call is dropped by a dispatch policy
+	bh := bulkheadOf(route.Service, route.Method)
+
+	// the message may be freed before the closure run by a dispatch policy
+	traceID, size, name := session.TraceID, len(msg.Data), route.Name()
+	target := session
+	call := func() {
+		if bh != nil {
+			if !bh.acquire(target.Context().Done()) {
+				logger.Warnf("handler: concurrency limit exceeded")
+				respondError(target, env.errorCodes.Busy, ErrBusy)
+				return
+			}
+			defer bh.release()
+		}
+		m.IncCalls()
+		span := trace.Start(traceID, "", name, app.config.Id)
+		start := time.Now()
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Errorf("handler panic: %+v", err)
+				respondError(target, env.errorCodes.Internal, fmt.Errorf("handler panic: %v", err))
+				span.Finish(fmt.Errorf("%v", err))
+			}
+		}()
+		defer watchHandler(name, size)()
+		var ctx context.Context
+		if m.Context {
+			var cancel context.CancelFunc
+			ctx, cancel = handlerContext(target, traceID, span)
+			defer cancel()
 		}
+		ret := m.Method.Func.Call(m.Args(s.Rcvr, ctx, target, data))
+		var failure error
+		if len(ret) > 0 {
+			if err := ret[0].Interface(); err != nil {
+				failure = err.(error)
+				logger.Errorf("handler error: %s", failure.Error())
+				respondError(target, env.errorCodes.Internal, failure)
+			}
+		}
+		metrics.ObserveRoute(name, time.Since(start), failure != nil)
+		span.Finish(failure)
+	}
+
+	policy := dispatchPolicy(route.Service, route.Method)
+	if policy == nil {
+		call()
+		return
+	}
+
+	// the logic goroutine keeps processing the following messages, so the
+	// handler works on a view of session which keeps the request id, and
+	// replays session changes on the logic goroutine
+	target = session.View()
+	policy.Dispatch(target, call)
+}
+
+// handlerContext returns the context passed to handlers, which carries the
+// trace id of message, and is canceled after the session closed or the rpc
+// timeout elapsed
+func handlerContext(s *session.Session, traceID string, span *trace.Span) (context.Context, context.CancelFunc) {
+	spanID := ""
+	if span != nil {
+		spanID = span.SpanID
+	}
+	ctx := trace.NewContext(s.Context(), traceID, spanID)
+	if d := cluster.CallTimeout(); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// retries returns the times to retry the request on other servers, only the
+// routes declared by SetIdempotent and the idempotent handler methods of
+// components registered in current server are retried
+func (hs *handlerService) retries(r *route.Route) int {
+	if env.retries <= 0 {
+		return 0
+	}
+	if env.idempotentRoutes[r.ServerType+"."+r.Service+"."+r.Method] {
+		return env.retries
+	}
+	s, ok := hs.serviceIn(r.Namespace, r.Service)
+	if !ok {
+		return 0
 	}
+	if m, ok := s.HandlerMethods[r.Method]; ok && m.Idempotent {
+		return env.retries
+	}
+	return 0
 }
 
-// current message handle in remote server
+// current message handle in remote server, the remote call is waited in
+// background so the logic goroutine is not blocked by a slow remote server,
+// and the following messages of the session are held until it completed
 func (hs *handlerService) remoteProcess(session *session.Session, route *route.Route, msg *message.Message) {
-	if _, err := cluster.Call(rpc.Sys, route, session, msg.Data); err != nil {
-		log.Errorf(err.Error())
+	span := trace.Start(session.TraceID, "", route.String(), app.config.Id)
+	if span != nil {
+		session.SpanID = span.SpanID
+	}
+
+	a, _ := session.Entity.(*agent)
+	if a != nil {
+		a.waiting = true
 	}
+
+	// changes of the session made by routing, e.g. sticky server id, are
+	// replayed on the logic goroutine by the view
+	view, data, retries := session.View(), append([]byte(nil), msg.Data...), hs.retries(route)
+	go func() {
+		_, err := cluster.CallRetry(context.Background(), rpc.Sys, route, view, data, retries)
+		span.Finish(err)
+		if err != nil {
+			sessionLogger(view).WithFields(log.Fields{"route": route.String()}).Errorf("remote process error: %s", err.Error())
+		}
+
+		done := func() {
+			if a != nil {
+				a.waiting = false
+			}
+			if err == nil {
+				return
+			}
+			code := env.errorCodes.Internal
+			if err == cluster.ErrClientNotFound {
+				code = env.errorCodes.NotFound
+			}
+			respondError(session, code, err)
+		}
+		if e := session.Invoke(done); e != nil {
+			sessionLogger(view).Debugf("session closed before remote process completed: %s", e.Error())
+		}
+	}()
 }
 
 func (hs *handlerService) dumpServiceMap() {
+	hs.RLock()
+	defer hs.RUnlock()
+
 	for sname, s := range hs.serviceMap {
 		for mname := range s.HandlerMethods {
 			log.Infof("registered service: %s.%s", sname, mname)
 		}
 	}
+	for ns, services := range hs.namespaces {
+		for sname, s := range services {
+			for mname := range s.HandlerMethods {
+				log.Infof("registered service: %s.%s.%s", ns, sname, mname)
+			}
+		}
+	}
+}
+
+// buildDict assign a code to every registered handler route, and merge them
+// into route dictionary, codes of routes that have been set by user-define
+// dictionary will be reserved, routes of namespaces are not contained
+func (hs *handlerService) buildDict() {
+	dict := message.Dict()
+
+	var code uint16
+	for _, c := range dict {
+		if c > code {
+			code = c
+		}
+	}
+
+	var routes []string
+	hs.RLock()
+	for sname, s := range hs.serviceMap {
+		for mname := range s.HandlerMethods {
+			r := sname + "." + mname
+			if _, ok := dict[r]; !ok {
+				routes = append(routes, r)
+			}
+		}
+	}
+	hs.RUnlock()
+	sort.Strings(routes)
+
+	added := make(map[string]uint16, len(routes))
+	for _, r := range routes {
+		code++
+		added[r] = code
+	}
+	message.SetDict(added)
+
+	hs.dict = message.Dict()
 }
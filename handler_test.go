@@ -1,21 +1,34 @@
 package starx
 
 import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	encjson "encoding/json"
+	"errors"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/encrypt"
 	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/metrics"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/route"
 	"github.com/lonnng/starx/serialize/json"
 	"github.com/lonnng/starx/serialize/protobuf"
 	"github.com/lonnng/starx/session"
 )
 
 func TestMain(m *testing.M) {
-	log.SetLevel(log.LevelClose)
+	log.SetLevel(log.LevelFatal)
 	app.master = &cluster.ServerConfig{
 		Type:        "test",
 		Id:          "test-1",
@@ -218,3 +231,401 @@ func BenchmarkHandlerCallProtobuf(b *testing.B) {
 	}
 	b.ReportAllocs()
 }
+
+func TestHandlerBuildDict(t *testing.T) {
+	SetDictionary(map[string]uint16{"onTestMessage": 100})
+	handler.register(&TestComp{})
+	handler.buildDict()
+
+	if handler.dict["onTestMessage"] != 100 {
+		t.Fatalf("user-define route code should be reserved")
+	}
+
+	json, proto := handler.dict["TestComp.HandleJson"], handler.dict["TestComp.HandleProto"]
+	if json <= 100 || proto <= 100 || json == proto {
+		t.Fatalf("wrong handler route code, HandleJson: %d, HandleProto: %d", json, proto)
+	}
+}
+
+func TestHandlerRefuseHandshake(t *testing.T) {
+	app.config.MaxConnections = 1
+	defer func() { app.config.MaxConnections = 0 }()
+
+	c1, _ := net.Pipe()
+	a1 := transporter.createAgent(c1)
+	defer a1.Close()
+
+	c2, peer := net.Pipe()
+	a2 := transporter.createAgent(c2)
+	go handler.processPacket(a2, &packet.Packet{Type: packet.Handshake})
+
+	resp := readHandshakeResponse(t, peer)
+	if resp["code"] != float64(handshakeServerFull) {
+		t.Fatalf("unexpected handshake response: %v", resp)
+	}
+}
+
+func TestHandlerHandshakeValidator(t *testing.T) {
+	SetHandshakeValidator(func(data []byte) error {
+		if string(data) != `{"token":"secret"}` {
+			return errors.New("invalid token")
+		}
+		return nil
+	})
+	SetHandshakeData(map[string]string{"motd": "hello"})
+	defer func() {
+		SetHandshakeValidator(nil)
+		SetHandshakeData(nil)
+	}()
+
+	c, peer := net.Pipe()
+	a := newAgent(c)
+	go handler.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: []byte(`{"token":"wrong"}`)})
+	if resp := readHandshakeResponse(t, peer); resp["code"] != float64(handshakeRejected) {
+		t.Fatalf("unexpected handshake response: %v", resp)
+	}
+
+	c, peer = net.Pipe()
+	a = newAgent(c)
+	defer a.Close()
+	go handler.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: []byte(`{"token":"secret"}`)})
+	// handshake response was written by logic goroutine
+	go func() { a.socket.Write(<-a.sendBuffer) }()
+
+	resp := readHandshakeResponse(t, peer)
+	if resp["code"] != float64(handshakeOK) {
+		t.Fatalf("unexpected handshake response: %v", resp)
+	}
+	sys := resp["sys"].(map[string]interface{})
+	if sys["protocol"] != float64(protocolVersion) {
+		t.Fatalf("protocol version should be sent, got: %v", sys)
+	}
+	if user := resp["user"].(map[string]interface{}); user["motd"] != "hello" {
+		t.Fatalf("user data should be sent, got: %v", resp)
+	}
+}
+
+func readHandshakeResponse(t *testing.T, conn net.Conn) map[string]interface{} {
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, err := packet.Unpack(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := map[string]interface{}{}
+	if err := encjson.Unmarshal(p.Data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHandlerHandshakeEncrypt(t *testing.T) {
+	app.config.Encrypt = true
+	defer func() { app.config.Encrypt = false }()
+
+	// key exchange required
+	c, peer := net.Pipe()
+	a := newAgent(c)
+	go handler.processPacket(a, &packet.Packet{Type: packet.Handshake})
+	if resp := readHandshakeResponse(t, peer); resp["code"] != float64(handshakeBadRequest) {
+		t.Fatalf("unexpected handshake response: %v", resp)
+	}
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := encjson.Marshal(map[string]interface{}{
+		"sys": map[string]interface{}{
+			"encrypt": map[string]interface{}{"key": priv.PublicKey().Bytes()},
+		},
+	})
+
+	c, peer = net.Pipe()
+	a = newAgent(c)
+	defer a.Close()
+	go handler.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: req})
+	go func() { a.socket.Write(<-a.sendBuffer) }()
+
+	resp := readHandshakeResponse(t, peer)
+	if resp["code"] != float64(handshakeOK) {
+		t.Fatalf("unexpected handshake response: %v", resp)
+	}
+	key, _ := base64.StdEncoding.DecodeString(resp["sys"].(map[string]interface{})["encrypt"].(map[string]interface{})["key"].(string))
+	pub, err := ecdh.X25519().NewPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := priv.ECDH(pub)
+	sum := sha256.Sum256(secret)
+	cipher, _ := encrypt.NewCipher(sum[:])
+
+	data, err := transporter.packMessage(a.session, &message.Message{Type: message.Push, Route: "onEncrypt", Data: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, _ := packet.Unpack(data)
+	raw, err := cipher.Decrypt(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := message.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Route != "onEncrypt" || string(m.Data) != "hello" {
+		t.Fatalf("unexpected message: %v", m)
+	}
+}
+
+func TestHandlerHandshakeProtos(t *testing.T) {
+	SetPushProto("onProto", &ProtoMessage{})
+	defer SetProtos(nil, nil)
+
+	hs := newHandlerService()
+	hs.register(&TestComp{})
+	hs.buildProtos()
+	if hs.protos == nil || hs.protos.Version == "" {
+		t.Fatal("protos should be built")
+	}
+	if _, ok := hs.protos.Client["TestComp.HandleProto"]; !ok {
+		t.Fatalf("schema of handler argument should be generated: %v", hs.protos.Client)
+	}
+	if _, ok := hs.protos.Client["TestComp.HandleJson"]; ok {
+		t.Fatal("schema of non-protobuf argument should be ignored")
+	}
+
+	handshake := func(version string) map[string]interface{} {
+		req, _ := encjson.Marshal(map[string]interface{}{
+			"sys": map[string]interface{}{
+				"protos": map[string]interface{}{"version": version},
+			},
+		})
+		c, _ := net.Pipe()
+		a := newAgent(c)
+		defer a.Close()
+		hs.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: req})
+
+		p, _, _ := packet.Unpack(<-a.sendBuffer)
+		resp := map[string]interface{}{}
+		encjson.Unmarshal(p.Data, &resp)
+		return resp["sys"].(map[string]interface{})["protos"].(map[string]interface{})
+	}
+
+	protos := handshake("")
+	if protos["version"] != hs.protos.Version || protos["server"] == nil || protos["client"] == nil {
+		t.Fatalf("protos should be sent: %v", protos)
+	}
+	protos = handshake(hs.protos.Version)
+	if protos["version"] != hs.protos.Version || protos["server"] != nil || protos["client"] != nil {
+		t.Fatalf("protos should be omitted when version matched: %v", protos)
+	}
+
+	SetSerializer(json.NewSerializer())
+	defer SetSerializer(protobuf.NewSerializer())
+	hs.buildProtos()
+	if hs.protos != nil {
+		t.Fatal("protos should be disabled when protobuf serializer not used")
+	}
+}
+
+func TestHandshakeClientType(t *testing.T) {
+	req, _ := encjson.Marshal(map[string]interface{}{
+		"sys": map[string]interface{}{"type": ClientBot},
+	})
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+	handler.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: req})
+
+	p, _, err := packet.Unpack(<-a.sendBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := map[string]interface{}{}
+	if err := encjson.Unmarshal(p.Data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["sys"].(map[string]interface{})["type"] != ClientBot || a.session.ClientType != ClientBot {
+		t.Fatalf("client type should be negotiated, got %v, session: %s", resp, a.session.ClientType)
+	}
+}
+
+type RetryComp struct {
+	component.Base
+}
+
+func (c *RetryComp) Query(s *session.Session, data []byte) error  { return nil }
+func (c *RetryComp) Update(s *session.Session, data []byte) error { return nil }
+
+func (c *RetryComp) IdempotentMethods() []string {
+	return []string{"Query"}
+}
+
+func TestRetries(t *testing.T) {
+	handler.register(&RetryComp{})
+	defer handler.unregister("RetryComp")
+	SetIdempotent("game.Room.Query")
+	defer func() { env.idempotentRoutes = nil }()
+	SetRetry(2)
+	defer SetRetry(0)
+
+	for r, n := range map[string]int{
+		"game.Room.Query":       2,
+		"game.Room.Join":        0,
+		"test.RetryComp.Query":  2,
+		"test.RetryComp.Update": 0,
+	} {
+		rt, _ := route.Decode(r)
+		if got := handler.retries(rt); got != n {
+			t.Errorf("retries of %s should be %d, got %d", r, n, got)
+		}
+	}
+}
+
+// serveRPC accept connections of rpc clients, requests are responded by
+// respond, and never responded if respond is nil
+func serveRPC(t *testing.T, respond func(*rpc.Request) bool) int {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				var tmp []byte
+				buf := make([]byte, 512)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					tmp = append(tmp, buf[:n]...)
+					for {
+						req := &rpc.Request{}
+						rest, err := req.UnmarshalMsg(tmp)
+						if err != nil {
+							break
+						}
+						tmp = rest
+						if respond(req) {
+							rpc.WriteResponse(conn, &rpc.Response{Kind: rpc.RemoteResponse, ServiceMethod: req.ServiceMethod, Seq: req.Seq})
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// completeRemote execute the tasks of agent until the remote call completed
+func completeRemote(a *agent) {
+	for a.waiting {
+		(<-a.tasks)()
+	}
+}
+
+func TestRemoteProcessAsync(t *testing.T) {
+	cluster.SetAppConfig(app.config)
+	release := make(chan struct{})
+	port := serveRPC(t, func(*rpc.Request) bool {
+		<-release
+		return true
+	})
+	cluster.Register(&cluster.ServerConfig{Type: "async", Id: "async-1", Host: "127.0.0.1", Port: port})
+	defer cluster.RemoveServer("async-1")
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	r, _ := route.Decode("async.AsyncComp.Slow")
+	handler.remoteProcess(a.session, r, &message.Message{Route: r.String()})
+	if !a.waiting {
+		t.Fatal("packets should be held until remote call completed")
+	}
+	if err := a.session.Invoke(func() {}); err != nil {
+		t.Fatal(err)
+	}
+	(<-a.tasks)()
+
+	close(release)
+	completeRemote(a)
+}
+
+func TestRemoteProcessRetry(t *testing.T) {
+	cluster.SetAppConfig(app.config)
+	SetIdempotent("retry.RetryComp.Query")
+	defer func() { env.idempotentRoutes = nil }()
+	SetRetry(1)
+	defer SetRetry(0)
+	SetRPCTimeout(100 * time.Millisecond)
+	defer SetRPCTimeout(5 * time.Second)
+
+	handled := make(chan string, 10)
+	bad := serveRPC(t, func(*rpc.Request) bool { return false })
+	good := serveRPC(t, func(req *rpc.Request) bool {
+		handled <- req.ServiceMethod
+		return true
+	})
+	cluster.Register(&cluster.ServerConfig{Type: "retry", Id: "retry-bad", Host: "127.0.0.1", Port: bad})
+	defer cluster.RemoveServer("retry-bad")
+	cluster.Register(&cluster.ServerConfig{Type: "retry", Id: "retry-good", Host: "127.0.0.1", Port: good})
+	defer cluster.RemoveServer("retry-good")
+
+	// router always selects the server which never responds
+	SetRouter("retry", func(*session.Session) string { return "retry-bad" })
+	defer SetRouter("retry", nil)
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	// requests of methods not idempotent are never retried
+	r, _ := route.Decode("retry.RetryComp.Update")
+	handler.remoteProcess(a.session, r, &message.Message{Route: r.String()})
+	completeRemote(a)
+	select {
+	case m := <-handled:
+		t.Fatalf("request should not be retried, got %s", m)
+	default:
+	}
+
+	retries := metrics.RPCRetries.Value()
+	r, _ = route.Decode("retry.RetryComp.Query")
+	handler.remoteProcess(a.session, r, &message.Message{Route: r.String()})
+	completeRemote(a)
+	select {
+	case m := <-handled:
+		if m != "RetryComp.Query" {
+			t.Fatalf("unexpected request: %s", m)
+		}
+	default:
+		t.Fatal("idempotent request should be retried on another server")
+	}
+	if metrics.RPCRetries.Value() != retries+1 {
+		t.Fatal("retry should be counted")
+	}
+	// the session sticks to the server of failover
+	if id := a.session.ServerID("retry"); id != "retry-good" {
+		t.Fatalf("session should stick to retry-good, got %s", id)
+	}
+
+	// the namespace of route is forwarded to backend server
+	r, _ = route.Decode("tenant.retry.RetryComp.Query")
+	handler.remoteProcess(a.session, r, &message.Message{Route: r.String()})
+	completeRemote(a)
+	if m := <-handled; m != "tenant.retry.RetryComp.Query" {
+		t.Fatalf("unexpected request: %s", m)
+	}
+}
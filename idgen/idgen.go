@@ -0,0 +1,56 @@
+// Package idgen provides the strategies to generate session ids, counter is
+// used by default, which is unique in process only, clustered deployments
+// should use snowflake or random ids to get globally unique session ids
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// Generator generates unique positive ids, it should be safe for concurrent use
+type Generator interface {
+	Next() int64
+}
+
+// GeneratorFunc is an adapter to allow the use of ordinary functions as
+// generator
+type GeneratorFunc func() int64
+
+func (fn GeneratorFunc) Next() int64 {
+	return fn()
+}
+
+// Counter generates sequential ids from 1
+type Counter struct {
+	n int64
+}
+
+// NewCounter returns a counter starts from 1
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+func (c *Counter) Next() int64 {
+	return atomic.AddInt64(&c.n, 1)
+}
+
+// Reset the counter, the next id will be 1
+func (c *Counter) Reset() {
+	atomic.StoreInt64(&c.n, 0)
+}
+
+// Random generates 63 bits random ids, like uuid, the probability of
+// collision is negligible without coordination between servers
+type Random struct{}
+
+func (Random) Next() int64 {
+	var b [8]byte
+	for {
+		rand.Read(b[:])
+		if id := int64(binary.BigEndian.Uint64(b[:]) >> 1); id > 0 {
+			return id
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package idgen
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Next()
+		}()
+	}
+	wg.Wait()
+
+	if id := c.Next(); id != 101 {
+		t.Fatalf("expect 101, got %d", id)
+	}
+	c.Reset()
+	if id := c.Next(); id != 1 {
+		t.Fatalf("expect 1 after reset, got %d", id)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	var g Generator = Random{}
+	seen := make(map[int64]bool)
+	for i := 0; i < 1000; i++ {
+		id := g.Next()
+		if id <= 0 || seen[id] {
+			t.Fatalf("invalid id: %d", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,82 @@
+// Package snowflake generates ids with the layout of twitter snowflake, ids
+// are roughly ordered by time, and unique across servers with distinct node
+// numbers:
+//
+//	| 1 bit unused | 41 bits milliseconds since epoch | 10 bits node | 12 bits sequence |
+package snowflake
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	nodeBits = 10
+	seqBits  = 12
+	maxNode  = 1<<nodeBits - 1
+	maxSeq   = 1<<seqBits - 1
+)
+
+// Epoch is the start time of ids, 2016-01-01 00:00:00 UTC
+var Epoch = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var ErrInvalidNode = errors.New("snowflake: node should be in [0, 1023]")
+
+// Generator generates snowflake ids of a node
+type Generator struct {
+	mu   sync.Mutex
+	node int64
+	last int64 // milliseconds of last id
+	seq  int64
+	now  func() time.Time // replaced in tests
+}
+
+// New returns the generator of node, node should be unique in cluster, e.g.
+// the ordinal of pod in kubernetes statefulset
+func New(node int64) (*Generator, error) {
+	if node < 0 || node > maxNode {
+		return nil, ErrInvalidNode
+	}
+	return &Generator{node: node, now: time.Now}, nil
+}
+
+func (g *Generator) Next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.millis()
+	// clock moved backwards, wait until it catches up
+	for ms < g.last {
+		time.Sleep(time.Duration(g.last-ms) * time.Millisecond)
+		ms = g.millis()
+	}
+
+	if ms == g.last {
+		g.seq = (g.seq + 1) & maxSeq
+		// sequence exhausted in current millisecond
+		if g.seq == 0 {
+			for ms <= g.last {
+				ms = g.millis()
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+	g.last = ms
+	return ms<<(nodeBits+seqBits) | g.node<<seqBits | g.seq
+}
+
+func (g *Generator) millis() int64 {
+	return g.now().Sub(Epoch).Nanoseconds() / int64(time.Millisecond)
+}
+
+// Node returns the node number of id
+func Node(id int64) int64 {
+	return id >> seqBits & maxNode
+}
+
+// Time returns the time when id generated
+func Time(id int64) time.Time {
+	return Epoch.Add(time.Duration(id>>(nodeBits+seqBits)) * time.Millisecond)
+}
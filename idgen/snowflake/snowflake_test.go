@@ -0,0 +1,46 @@
+package snowflake
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerator(t *testing.T) {
+	if _, err := New(1024); err != ErrInvalidNode {
+		t.Fatalf("expect ErrInvalidNode, got %v", err)
+	}
+
+	g, err := New(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+
+	first := g.Next()
+	second := g.Next()
+	if second != first+1 {
+		t.Fatalf("ids in the same millisecond should be sequential, got %d, %d", first, second)
+	}
+	if Node(first) != 7 || !Time(first).Equal(now) {
+		t.Fatalf("unexpected node %d or time %v", Node(first), Time(first))
+	}
+
+	now = now.Add(time.Millisecond)
+	if id := g.Next(); id <= second || id&maxSeq != 0 {
+		t.Fatalf("sequence should be reset in next millisecond, got %d", id)
+	}
+}
+
+func TestGeneratorUnique(t *testing.T) {
+	g, _ := New(1)
+	seen := make(map[int64]bool)
+	for i := 0; i < 10000; i++ {
+		id := g.Next()
+		if seen[id] {
+			t.Fatalf("duplicate id: %d", id)
+		}
+		seen[id] = true
+	}
+}
@@ -25,9 +25,22 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lonnng/starx/capture"
 	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/compress"
+	"github.com/lonnng/starx/idgen"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/record"
+	"github.com/lonnng/starx/serialize/protobuf"
+	"github.com/lonnng/starx/service"
 	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/sink"
+	"github.com/lonnng/starx/store"
+	"github.com/lonnng/starx/trace"
 )
 
 // Run server
@@ -35,8 +48,18 @@ func Run() {
 	// output welcome message
 	// welcomeMsg()
 
-	// load servers config from $env.serversConfigPath
-	loadServers()
+	// load server id and config path from environment variables and flags
+	loadEnv()
+
+	// load servers config from $env.serversConfigPath, a frontend server is
+	// registered instead in single process mode
+	if env.single {
+		svr := singleServer()
+		env.serverId = svr.Id
+		cluster.Register(svr)
+	} else {
+		loadServers()
+	}
 
 	// init cluster servers config
 	initSetting()
@@ -50,6 +73,25 @@ func Run() {
 	startup()
 }
 
+// RunRole run current server as the role without servers config file, which
+// suits containers, e.g. kubernetes. The server type is the role, id defaults
+// to hostname and can be set by STARX_SERVER_ID, other fields of server config
+// are set by STARX_ environment variables, e.g. STARX_PORT=3250,
+// STARX_IS_FRONTEND=true, STARX_ADMIN_PORT=3251. Peers are discovered by the
+// provider set by SetClusterProvider, and the readiness probe is served at
+// /ready of admin server.
+func RunRole(role string) {
+	loadEnv()
+
+	svr := roleServer(role)
+	env.serverId = svr.Id
+	cluster.Register(svr)
+
+	initSetting()
+	initServer()
+	startup()
+}
+
 // Set special server initial function, starx.Set("oneServerType | anotherServerType", func(){})
 func Set(svrTypes string, fn func()) {
 	var types = strings.Split(strings.TrimSpace(svrTypes), "|")
@@ -63,8 +105,65 @@ func SetRouter(svrType string, fn func(*session.Session) string) {
 	cluster.Router(svrType, fn)
 }
 
-func Register(c component.Component) {
-	comps = append(comps, c)
+// SetSticky set whether the sessions keep routing to the same server of the
+// server type, which is selected by router for the first message. Sessions
+// are sticky by default, so stateful backends see all messages of a session,
+// the server is reselected only when it has left the cluster.
+func SetSticky(svrType string, sticky bool) {
+	cluster.Sticky(svrType, sticky)
+}
+
+// Register a component, the component registered after server startup will
+// serve immediately, use Replace to swap in a new version of a component.
+// Routes that registered at runtime are not contained in route dictionary.
+func Register(c component.Component) error {
+	return registerComp(c)
+}
+
+// Replace swap in the component for the registered one of the same name
+// atomically, the routes are served by the old component until the new one
+// is initialized, and the old one is shutdown then.
+func Replace(c component.Component) error {
+	return replaceComp(c)
+}
+
+// Unregister stop serving the service of the name and shutdown the component,
+// messages routed to the service will be dropped since then, services of
+// namespaces are named with the namespace prefixed, e.g. tenant.Service
+func Unregister(name string) error {
+	return unregisterComp(name)
+}
+
+// RegisterNamespace register a component in the namespace, so a cluster can
+// host multiple games or shards with isolated handlers. The services of the
+// namespace serve the routes prefixed with the namespace only, clients route
+// messages to them by tenant.Service.Method, or tenant.server.Service.Method
+// for the services hosted by other server types. A component instance can be
+// registered in one namespace only.
+func RegisterNamespace(ns string, c component.Component) error {
+	if !validNamespace(ns) {
+		return ErrInvalidNamespace
+	}
+	addNamespace(ns, c)
+	if err := registerComp(c); err != nil {
+		removeComponentNamespace(c)
+		return err
+	}
+	return nil
+}
+
+// ReplaceNamespace swap in the component for the registered one of the same
+// name in the namespace, see Replace.
+func ReplaceNamespace(ns string, c component.Component) error {
+	if !validNamespace(ns) {
+		return ErrInvalidNamespace
+	}
+	addNamespace(ns, c)
+	if err := replaceComp(c); err != nil {
+		removeComponentNamespace(c)
+		return err
+	}
+	return nil
 }
 
 func SetServerID(id string) {
@@ -75,6 +174,17 @@ func SetServerID(id string) {
 	env.serverId = id
 }
 
+// RegisterConfigDecoder register the decoder of servers config file with
+// the extension, JSON(.json), YAML(.yaml, .yml) and TOML(.toml) are
+// supported by default, e.g. HCL:
+//
+//	starx.RegisterConfigDecoder(".hcl", hcl.Unmarshal)
+//
+// field names are the same as json tags of cluster.ServerConfig
+func RegisterConfigDecoder(ext string, fn func(data []byte, v interface{}) error) {
+	configDecoders[strings.ToLower(ext)] = fn
+}
+
 // Set the path of servers.json
 func SetServersConfig(path string) {
 	path = strings.TrimSpace(path)
@@ -89,11 +199,688 @@ func SetHeartbeatInternal(d time.Duration) {
 	env.heartbeatInternal = d
 }
 
+// SetAcceptFilter set the filter which decides whether the connection from the
+// remote address will be accepted, connections refused will be closed before
+// session created, the filter is evaluated after the allow and deny lists in
+// server config, which are CIDRs, e.g.
+//
+//	{"id": "gate-1", "type": "gate", "port": 3250, "deny": ["10.0.0.1", "192.168.0.0/16"]}
+//	{"id": "game-1", "type": "game", "port": 3260, "allow": ["10.0.0.0/8"]}
+//
+// The lists and filter apply to the client listeners of frontend servers, and
+// the listener of backend servers, the rpc port of frontend servers has its
+// own lists rpc_allow and rpc_deny, see SetRPCAcceptFilter.
+func SetAcceptFilter(f AcceptFilter) {
+	env.acceptFilter = f
+}
+
+// SetRPCAcceptFilter set the filter which decides whether the rpc connection
+// from the remote address will be accepted, which is evaluated after the
+// rpc_allow and rpc_deny lists in server config, so the rpc listeners can be
+// restricted to internal networks without blocking public clients, e.g.
+//
+//	{"id": "gate-1", "type": "gate", "port": 3250, "rpc_port": 3251, "rpc_allow": ["10.0.0.0/8"]}
+func SetRPCAcceptFilter(f AcceptFilter) {
+	env.rpcAcceptFilter = f
+}
+
+// SetHandshakeTimeout set how long a connection can take to finish handshake
+// since established, the connection will be closed when exceeded, 10 seconds
+// by default, disabled if zero
+func SetHandshakeTimeout(d time.Duration) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	env.handshakeTimeout = d
+}
+
+// SetIdleTimeout set how long a handshaked connection can be idle without
+// sending any packet, including heartbeat, the connection will be closed when
+// exceeded, twice of heartbeat interval by default
+func SetIdleTimeout(d time.Duration) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	env.idleTimeout = d
+}
+
+// SetWriteTimeout set the deadline of writing packets to connection, the
+// session will be closed when a stalled client can not receive packets in
+// timeout, 10 seconds by default, disabled if zero
+func SetWriteTimeout(d time.Duration) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	env.writeTimeout = d
+}
+
+// EnableBatch aggregate the pushes of normal priority within the window and
+// send them in one data packet, which reduces the framing overhead of state
+// sync heavy games. Batch is enabled for the clients which declare the
+// capability with `sys.batch: true` in handshake, see message.SplitBatch for
+// the format of batch.
+func EnableBatch(window time.Duration) {
+	env.batchWindow = window
+}
+
+// SetMaxPacketSize set the maximum length of packets sent by client, the
+// connection will be closed when a larger packet received, unlimited if zero
+func SetMaxPacketSize(n int) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	env.maxPacketSize = n
+}
+
+// OnConfigReload set the callback which will be called after the config file
+// reloaded by SIGHUP, components can read their own settings from c.Raw, see
+// ReloadConfig for details
+func OnConfigReload(fn func(c *ReloadConfig)) {
+	env.reloadCallbacks = append(env.reloadCallbacks, fn)
+}
+
+// SetFlushInterval set the interval that outbound packets are gathered before
+// written to socket, coalesce high-frequency pushes into fewer syscalls at the
+// cost of latency, packets are written as soon as possible by default
+func SetFlushInterval(d time.Duration) {
+	env.flushInterval = d
+}
+
+// SetPacketCodec set the wire protocol of packets, pomelo binary protocol
+// is used by default, call it in server init function of starx.Set to
+// change the protocol of the frontend server type only
+func SetPacketCodec(c packet.Codec) {
+	if c == nil {
+		c = packet.DefaultCodec
+	}
+	env.packetCodec = c
+	heartbeatPacket, _ = c.Encode(&packet.Packet{Type: packet.Heartbeat})
+	kickPacket, _ = c.Encode(&packet.Packet{Type: packet.Kick})
+}
+
+// RegisterPacketCodec register the packet codec with name, which can be
+// selected by `codec` field of listeners in servers config
+func RegisterPacketCodec(name string, c packet.Codec) {
+	if env.packetCodecs == nil {
+		env.packetCodecs = make(map[string]packet.Codec)
+	}
+	env.packetCodecs[name] = c
+}
+
+// SetLogger replace the logger backend, which can be an adapter of any
+// logging library, e.g. zap, logrus
+func SetLogger(l log.Logger) {
+	log.SetLogger(l)
+}
+
+// On register a handler for the event, handlers are called synchronously
+// in the goroutine which the event occurred, e.g. SessionClosed handlers can
+// be used to persist player state when client disconnected. The returned
+// function removes the handler
+func On(e Event, fn func(*EventArgs)) func() {
+	return events.on(e, fn)
+}
+
+// SetRateLimit limit the message rate of the route for each session, rate is
+// messages allowed per second and burst is the maximum messages allowed at
+// once, empty route applies to all messages, e.g. SetRateLimit("Chat.Send", 5, 5).
+// Excess messages will be refused before dispatch, and requests are responded
+// with the error code ErrorCodes.TooManyRequests.
+func SetRateLimit(route string, rate float64, burst int) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	env.rateLimits = withRateLimit(env.rateLimits, route, rateLimit{rate: rate, burst: burst})
+	limitsVersion++
+}
+
+// SetServerRateLimit limit the message rate of the messages routed to the
+// server type for each session, e.g. SetServerRateLimit("chat", 10, 20) limits
+// all messages of routes like "chat.Room.Send", the routes without server
+// type are served by current server type
+func SetServerRateLimit(svrType string, rate float64, burst int) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	env.serverRateLimits = withRateLimit(env.serverRateLimits, svrType, rateLimit{rate: rate, burst: burst})
+	limitsVersion++
+}
+
+// OnRateLimited set the callback which will be called when the message
+// rate of a session exceeded, abusive clients can be kicked in callback
+// by calling session.Close, the callback will be called in logic goroutine
+func OnRateLimited(fn func(s *session.Session, route string)) {
+	env.rateLimitedCb = fn
+}
+
+// SetHandshakeValidator set the function to validate the handshake data sent
+// by client, e.g. check client version or token, the handshake will be
+// rejected with code 403 when the function returns an error
+func SetHandshakeValidator(fn func(data []byte) error) {
+	env.handshakeValidator = fn
+}
+
+// SetHandshakeData set the user-define data, which will be sent to client
+// in handshake response as `user` field, the data will be json encoded
+func SetHandshakeData(v interface{}) {
+	env.handshakeData = v
+}
+
+// SetProtos set the user-define message schemas in pomelo-protobuf json
+// format, which will be sent to client in handshake as `sys.protos` when
+// protobuf serializer used, schemas of handler arguments are generated
+// automatically, the user-define schemas will override the generated ones
+func SetProtos(server, client map[string]interface{}) {
+	env.serverProtos = server
+	env.clientProtos = client
+}
+
+// SetPushProto generate the schema of the message pushed to client on route
+func SetPushProto(route string, v interface{}) error {
+	schema, err := protobuf.Schema(v)
+	if err != nil {
+		return err
+	}
+	if env.serverProtos == nil {
+		env.serverProtos = make(map[string]interface{})
+	}
+	env.serverProtos[route] = schema
+	return nil
+}
+
+// RegisterTransport register the listener of a transport, which can be
+// selected per server by `transport` field in servers config, tcp and kcp
+// (reliable udp, see package kcp) are registered by default, e.g. QUIC:
+//
+//	starx.RegisterTransport("quic", func(addr string) (net.Listener, error) {
+//		return quicListen(addr)
+//	})
+func RegisterTransport(name string, fn ListenFunc) {
+	registerTransport(name, fn)
+}
+
+// PipelineInbound append the function to inbound pipeline, which process
+// the raw bytes of messages received from client before decode, e.g. custom
+// decryption, checksum verification, the message will be dropped if the
+// function returns an error
+func PipelineInbound(fn PipelineFunc) {
+	env.inbound = append(env.inbound, fn)
+}
+
+// PipelineOutbound append the function to outbound pipeline, which process
+// the raw bytes of messages sent to client after encode, the message will
+// not be sent if the function returns an error
+func PipelineOutbound(fn PipelineFunc) {
+	env.outbound = append(env.outbound, fn)
+}
+
+// SetOutboundHook set the hook which transforms data of the messages sent to
+// the clients of the client type, which is declared by client in handshake,
+// so the handlers can push the same data to heterogeneous clients:
+//
+//	starx.SetOutboundHook(starx.ClientNative, func(s *session.Session, m *message.Message) ([]byte, error) {
+//		return jsonToProtobuf(m.Route, m.Data)
+//	})
+func SetOutboundHook(clientType string, fn OutboundHook) {
+	if env.outboundHooks == nil {
+		env.outboundHooks = make(map[string]OutboundHook)
+	}
+	env.outboundHooks[clientType] = fn
+}
+
+// EnableAuth enable token authentication, client can send the token in
+// handshake as `user.token`, or call the routes in whitelist(e.g. a login
+// handler calling starx.Authenticate) before authenticated, session will be
+// bound to the uid resolved by verify function, messages of other routes sent
+// by unauthenticated session will be dropped, and the session will be closed
+// if it is not authenticated in timeout, zero means no timeout
+func EnableAuth(verify Authenticator, whitelist []string, timeout time.Duration) {
+	env.auth = &auth{
+		verify:    verify,
+		whitelist: routeSet(whitelist),
+		timeout:   timeout,
+	}
+}
+
+// Validate register a validator of the route, e.g. Player.Move, validators
+// run in order of registration after the message deserialized and before the
+// handler called, on the server serving the route. Routes of namespaces are
+// prefixed with the namespace, e.g. tenant.Player.Move. Validators should be
+// registered before server started.
+func Validate(route string, fn Validator) {
+	if env.validators == nil {
+		env.validators = make(map[string][]Validator)
+	}
+	env.validators[route] = append(env.validators[route], fn)
+}
+
+// SetPreAuthRoutes set the routes callable before the session bound to a uid,
+// e.g. SetPreAuthRoutes("Auth.Login") with a login handler calling Bind,
+// messages of other routes will be dropped until the session is bound. It
+// replaces the whitelist of EnableAuth, and can be used without token
+// authentication.
+func SetPreAuthRoutes(routes ...string) {
+	if env.auth == nil {
+		env.auth = &auth{}
+	}
+	env.auth.whitelist = routeSet(routes)
+}
+
+// Authenticate verify the token with the authenticator set by EnableAuth,
+// and bind the session to the resolved uid
+func Authenticate(s *session.Session, token string) error {
+	return authenticate(s, token)
+}
+
+// PushToUID push the message to the session bound to uid, backend servers
+// push via the frontend server which owns the session, uids not bound in
+// current server are resolved by the frontend servers serving rpc, see
+// cluster.ServerConfig.RpcPort
+func PushToUID(uid int64, route string, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	n, err := pushToUIDs([]int64{uid}, route, data)
+	if err == nil && n == 0 {
+		return ErrUidNotFound
+	}
+	return err
+}
+
+// PushToUIDs push the message to the sessions bound to uids, messages to the
+// same frontend server will be batched, uids not bound in current server are
+// sent to the frontend servers which own them in one request per server, the
+// owners are learned from previous pushes, uids of unknown owner are sent to
+// all frontend servers serving rpc, uids not bound will be ignored
+func PushToUIDs(uids []int64, route string, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	_, err = pushToUIDs(uids, route, data)
+	return err
+}
+
+// SessionsByTag returns the sessions of current server which have the tag
+// added by Session.AddTag
+func SessionsByTag(tag string) []*session.Session {
+	return tags.members(tag)
+}
+
+// PushByTag push the message to the sessions of current server which have
+// the tag, e.g. the players in the same zone, messages to frontend sessions
+// of the same frontend server will be batched in one rpc response
+func PushByTag(tag, route string, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	return pushToSessions(tags.members(tag), route, data)
+}
+
+// BroadcastAll push the message to all sessions of all frontend servers, when
+// called in backend server, one rpc is sent to every frontend server connected
+// to current server, when called in frontend server, only sessions of current
+// server are pushed, frontend servers are not connected to each other
+func BroadcastAll(route string, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	return broadcastAll(route, data)
+}
+
+// SetEventSink set the sink which session events and custom events emitted
+// by Emit are published to, events are published asynchronously and dropped
+// when the sink falls behind, e.g. with nats:
+//
+//	starx.SetEventSink(nats.NewSink("127.0.0.1:4222", "starx."))
+func SetEventSink(s sink.Sink) {
+	publisher.setSink(s)
+}
+
+// Emit publish the custom event to the event sink, v is serialized by the
+// serializer unless it's []byte, it's a no-op when event sink not set
+func Emit(topic string, v interface{}) error {
+	if publisher.sink == nil {
+		return nil
+	}
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	publisher.publish(topic, data)
+	return nil
+}
+
+// SetPushPriority set the priority of messages pushed on the route, the
+// writer of session drains high priority messages first, and low priority
+// messages will be dropped when the low priority queue is full
+func SetPushPriority(route string, p Priority) {
+	if env.pushPriorities == nil {
+		env.pushPriorities = make(map[string]Priority)
+	}
+	env.pushPriorities[route] = p
+}
+
+// SetDispatchPolicy set the dispatch policy of the route(e.g. Game.Search)
+// or all routes of the service(e.g. Game), heavy handlers can be run on a
+// worker pool to avoid blocking light ones of the same session:
+//
+//	starx.SetDispatchPolicy("Game.Search", starx.Pool(8))
+//
+// handlers dispatched to pool run concurrently with the logic goroutine of
+// session, they receive a view of session(see session.View), changes such as
+// binding uid are applied to the session on its logic goroutine afterwards
+func SetDispatchPolicy(route string, p DispatchPolicy) {
+	if env.dispatchPolicies == nil {
+		env.dispatchPolicies = make(map[string]DispatchPolicy)
+	}
+	env.dispatchPolicies[route] = p
+}
+
+// SetConcurrencyLimit limit the in-flight handler calls of the route(e.g.
+// Game.Search) or all routes of the service(e.g. Game) across all sessions,
+// so an expensive route can't starve the process under load spikes:
+//
+//	starx.SetConcurrencyLimit("Game.Search", 16, 64)
+//
+// calls exceeding n wait in a queue of size queue, the waiting calls block
+// the sessions, and calls are refused with ErrBusy when the queue is full,
+// limit of route takes precedence over the limit of service
+func SetConcurrencyLimit(route string, n, queue int) {
+	if env.bulkheads == nil {
+		env.bulkheads = make(map[string]*bulkhead)
+	}
+	env.bulkheads[route] = newBulkhead(n, queue)
+}
+
+// SetEgressLimit limit the outbound bytes of each session, rate is bytes
+// allowed per second and burst is the maximum bytes allowed at once, writes
+// exceeding the limit are delayed in the writer of session, and the policy
+// decides what happens when a client can't keep up, which protects frontends
+// from slow readers, e.g. SetEgressLimit(64*1024, 256*1024, ThrottleDropLow).
+// Disabled if rate is not positive.
+func SetEgressLimit(rate float64, burst int, policy ThrottlePolicy) {
+	if rate <= 0 {
+		env.egress = nil
+		return
+	}
+	env.egress = &egressLimit{rate: rate, burst: burst, policy: policy}
+}
+
+// SetTopologyInterval set the interval of heartbeats sent to peers over the
+// rpc mesh, which update the live view returned by Cluster, default 10s,
+// disabled if zero
+func SetTopologyInterval(d time.Duration) {
+	env.topologyInterval = d
+}
+
+// SetResume enable session resuming, the session of a lost connection
+// will be kept for grace duration, client can reconnect and take over the
+// session with the resume token issued in handshake response, the latest
+// size messages sent to the suspended session will be replayed
+func SetResume(grace time.Duration, size int) {
+	env.resumeGrace = grace
+	env.replaySize = size
+}
+
+// SetSessionStore set the store to persist the bound uid and data of sessions,
+// the snapshot is saved with the resume token on every change, clients
+// reconnecting with a valid token will get their settings restored, even
+// after the frontend server restarted, e.g. with redis store:
+//
+//	starx.SetSessionStore(redis.NewStore("127.0.0.1:6379", "starx:", time.Hour))
+func SetSessionStore(s store.SessionStore) {
+	persistence.setStore(s)
+}
+
+// SetSessionManager replace the default sharded manager which stores the
+// sessions of connected clients, e.g. with an implementation evicting idle
+// anonymous sessions, which should be called before starting server
+//
+//	starx.SetSessionManager(session.NewShardedManager(128))
+func SetSessionManager(m session.Manager) {
+	transporter.sessions = m
+}
+
+// SetClusterProvider set the provider to discover servers of cluster, servers
+// are synced every interval after startup, synced once if interval is zero,
+// e.g. with headless services in kubernetes:
+//
+//	starx.SetClusterProvider(dns.NewProvider(dns.Service{Type: "game", Name: "game"}), 10*time.Second)
+func SetClusterProvider(p cluster.Provider, interval time.Duration) {
+	discovery.setProvider(p, interval)
+}
+
+// EnableGracefulRestart restart the server without closing the listening
+// sockets on SIGUSR2: a new process of the same executable and arguments is
+// started, which inherits the listening sockets and accepts new connections,
+// then current process closes the sessions evenly in drain duration and exits,
+// clients reconnect to the new process. Enable session store by SetSessionStore
+// to restore the sessions of reconnected clients with resume tokens.
+func EnableGracefulRestart(drain time.Duration) {
+	env.drainTimeout = drain
+}
+
+// SetIDGenerator set the generator of session ids, which should be called
+// before server startup, sequential ids from 1 are used by default, which are
+// unique in process only, use snowflake or random ids in clustered deployments
+// to get globally unique session ids, e.g.
+//
+//	g, _ := snowflake.New(node)
+//	starx.SetIDGenerator(g)
+func SetIDGenerator(g idgen.Generator) {
+	service.Connections.SetGenerator(g)
+}
+
+// SetTraceExporter set the exporter of spans, a span is recorded for every
+// handler call, spans of the same client message share the trace id, which
+// is forwarded across servers, e.g. export spans to OpenTelemetry by setting
+// the start and end time of spans explicitly
+func SetTraceExporter(e trace.Exporter) {
+	trace.SetExporter(e)
+}
+
+// EnableMetrics serve metrics in Prometheus text format at http://addr/metrics
+// after server startup, use metrics.Stats to retrieve metrics in process
+func EnableMetrics(addr string) {
+	env.metricsAddr = addr
+}
+
+// EnableConsole serve a debug console on the unix socket path after server
+// startup, which is only accessible to local users, e.g. `nc -U path`, commands
+// inspect sessions, routes and rpc statistics, adjust log level, or invoke
+// handlers with injected messages, type `help` in console for all commands
+func EnableConsole(path string) {
+	env.consolePath = path
+}
+
+// SetAdminToken set the token required by admin server, which can also be
+// set by environment variable STARX_ADMIN_TOKEN, requests should carry it in
+// the header `Authorization: Bearer <token>`. Only the readiness probe is
+// served by admin server if no token set
+func SetAdminToken(token string) {
+	env.adminToken = token
+}
+
+// SetDictionary set the route compression dictionary, which maps route to a
+// unique code, routes of all registered handlers will be appended to the
+// dictionary automatically, so it's used to compress routes of push message
+// generally, dictionary will be sent to client in handshake response
+func SetDictionary(dict map[string]uint16) {
+	message.SetDict(dict)
+}
+
+// SetCompressor enable message data compression, data longer than threshold
+// will be compressed by the compressor, if the client declared the algorithm
+// is supported in handshake request
+func SetCompressor(c compress.Compressor, threshold int) {
+	env.compressor = c
+	env.compressThreshold = threshold
+}
+
+// SetBackpressurePolicy set the policy which will be applied when the receive
+// buffer of a connection is full, default policy is BackpressureBlock
+func SetBackpressurePolicy(p BackpressurePolicy) {
+	env.backpressure = p
+}
+
+// SetServerBackpressurePolicy set the backpressure policy of the server type,
+// which overrides the default policy, so servers of a cluster that share the
+// same program can apply different policies, e.g. gates of game disconnect
+// slow clients while gates of chat drop the oldest messages
+func SetServerBackpressurePolicy(svrType string, p BackpressurePolicy) {
+	if env.serverBackpressure == nil {
+		env.serverBackpressure = make(map[string]BackpressurePolicy)
+	}
+	env.serverBackpressure[svrType] = p
+}
+
+// SetRPCTimeout set the default timeout of rpc call, which is applied when
+// the call context has no deadline, zero means never time out
+func SetRPCTimeout(d time.Duration) {
+	cluster.SetCallTimeout(d)
+}
+
+// SetRetry set the times to retry the requests forwarded to backend servers on
+// another server of the same type, when the selected server failed to handle
+// them. Only the routes declared by SetIdempotent are retried, disabled if
+// zero.
+func SetRetry(n int) {
+	env.retries = n
+}
+
+// SetIdempotent declare the routes which are safe to be handled more than
+// once, e.g. queries, the route consists of server type, service and method,
+// e.g. SetIdempotent("game.Room.Query"). It should be called in frontend
+// servers which forward the requests, the handler methods declared by
+// component.Idempotent are only known where the component registered.
+func SetIdempotent(routes ...string) {
+	if env.idempotentRoutes == nil {
+		env.idempotentRoutes = make(map[string]bool)
+	}
+	for _, r := range routes {
+		env.idempotentRoutes[r] = true
+	}
+}
+
+// SetRPCCompressor enable compression of rpc payload between servers, data
+// longer than threshold will be compressed if the peer server accepts the
+// algorithm, which is negotiated in every rpc request and response
+func SetRPCCompressor(c compress.Compressor, threshold int) {
+	rpc.SetCompressor(c, threshold)
+}
+
+// SetRPCMaxPayload set the maximum length of rpc payload between servers, the
+// call will fail with *rpc.PayloadTooLargeError when the arguments exceed the
+// limit, and backend server responds an error when receiving a larger request,
+// unlimited if zero
+func SetRPCMaxPayload(n int) {
+	rpc.SetMaxPayload(n)
+}
+
 // SetCheckOriginFunc set the function that check `Origin` in http headers
 func SetCheckOriginFunc(fn func(*http.Request) bool) {
 	env.checkOrigin = fn
 }
 
+// EnableSingleProcess run the application in one process without servers
+// config file, which suits small games. A frontend server of application name
+// type is started, id defaults to application name and port defaults to 3250,
+// which can be overridden by STARX_ environment variables and flags. The rpc
+// subsystem is not started, messages of all routes are handled by the local
+// services, and the messages targeting services not registered locally are
+// dropped with errors. Session.Call returns ErrSingleProcess. It also can be
+// enabled by STARX_SINGLE=true or -single flag.
+func EnableSingleProcess() {
+	env.single = true
+}
+
+// ExposeRoutes declare the services of the server type which clients can call
+// through frontend server, all services of the server type are exposed if no
+// service specified. Once any route exposed, requests of the routes not
+// exposed are refused by frontend server with forbidden error, e.g.
+//
+//	starx.ExposeRoutes("gate", "Login")
+//	starx.ExposeRoutes("game", "Battle", "Room")
+func ExposeRoutes(serverType string, services ...string) {
+	if env.exposedRoutes == nil {
+		env.exposedRoutes = make(map[string]map[string]bool)
+	}
+	m, ok := env.exposedRoutes[serverType]
+	if !ok {
+		m = make(map[string]bool)
+		env.exposedRoutes[serverType] = m
+	}
+	for _, s := range services {
+		m[s] = true
+	}
+}
+
+// SetSlowHandlerThreshold set the threshold of slow handler calls, a warning
+// with the route, data size and the stack of handler goroutine will be logged
+// when a handler runs longer than threshold, since a slow handler freezes all
+// messages of the session, disabled if zero
+func SetSlowHandlerThreshold(d time.Duration) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	env.slowThreshold = d
+}
+
+// EnableRecord record every inbound message to the file, one json object per
+// line, which can be fed back to handlers by Replay to reproduce the bugs of
+// game logic locally
+func EnableRecord(path string) error {
+	r, err := record.Create(path)
+	if err != nil {
+		return err
+	}
+	env.recorder = r
+	return nil
+}
+
+// SetPacketSniffer set the function receiving every packet on the wire of
+// client connections, e.g. to diagnose protocol mismatches of custom clients
+func SetPacketSniffer(fn PacketSniffer) {
+	env.sniffer = fn
+}
+
+// EnableCapture dump every packet on the wire of client connections to the
+// file in a pcap-like binary format, which can be read by capture.NewReader,
+// the file will be truncated if it exists
+func EnableCapture(path string) error {
+	w, err := capture.Create(path)
+	if err != nil {
+		return err
+	}
+	env.capture = w
+	return nil
+}
+
+// Replay feed the messages recorded by EnableRecord to the handlers of current
+// server in the recorded order, at original speed if speed is 1, accelerated
+// if speed is larger, or without waiting if speed is zero. Messages sent to
+// clients in replay are logged, and remote calls fail with ErrReplayCall.
+func Replay(path string, speed float64) error {
+	return replayFile(path, speed)
+}
+
+// SetErrorCodes set the codes of error responses, which are responded to
+// the requests failed in routing, decoding or handler execution
+func SetErrorCodes(codes ErrorCodes) {
+	env.errorCodes = codes
+}
+
+// HideErrorDetails respond generic messages, e.g. "internal error", instead
+// of error details in error responses, which is recommended in production.
+// Messages of *Error returned by handlers are not hidden.
+func HideErrorDetails() {
+	env.hideErrorDetails = true
+}
+
 // EnableCluster enable cluster mode
 func EnableCluster() {
 	app.standalone = false
@@ -110,6 +897,17 @@ func SetMasterServerID(id string) {
 	env.masterServerId = id
 }
 
+// Invoke push the function to the logic goroutine of the session which
+// has the special id, only available in frontend server, use Session.Invoke
+// when the session instance is reachable
+func Invoke(sid int64, fn func()) error {
+	s, err := transporter.Session(sid)
+	if err != nil {
+		return err
+	}
+	return s.Invoke(fn)
+}
+
 func Shutdown() {
 	close(env.die)
 }
@@ -1,6 +1,15 @@
 package starx
 
-import "testing"
+import (
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	pjson "github.com/lonnng/starx/packet/json"
+	"github.com/lonnng/starx/session"
+)
 
 func TestSetServerID(t *testing.T) {
 	SetServerID("test")
@@ -15,3 +24,146 @@ func TestSetServersConfig(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestInvoke(t *testing.T) {
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	defer a.Close()
+
+	called := false
+	if err := Invoke(a.session.ID, func() { called = true }); err != nil {
+		t.Fatal(err)
+	}
+	(<-a.tasks)()
+	if !called {
+		t.Fatal("invoked function should be called")
+	}
+
+	if err := Invoke(-1, func() {}); err != ErrSessionNotFound {
+		t.Fatalf("expect ErrSessionNotFound, got: %v", err)
+	}
+}
+
+type HotComp struct {
+	component.Base
+	inited   bool
+	shutdown bool
+}
+
+func (c *HotComp) Init()     { c.inited = true }
+func (c *HotComp) Shutdown() { c.shutdown = true }
+
+func (c *HotComp) HandleJson(s *session.Session, m *JsonMessage) error {
+	return nil
+}
+
+func TestRegisterAtRuntime(t *testing.T) {
+	compsStarted = true
+	defer func() { compsStarted = false }()
+
+	c := &HotComp{}
+	if err := Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := remote.service("HotComp"); !ok {
+		t.Fatal("component registered at runtime should serve immediately")
+	}
+	dup := &HotComp{}
+	if err := Register(dup); err != ErrServiceExists {
+		t.Fatalf("expect ErrServiceExists, got: %v", err)
+	}
+	if dup.inited {
+		t.Fatal("refused component should not be initialized")
+	}
+
+	if err := Unregister("HotComp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := remote.service("HotComp"); ok {
+		t.Fatal("service should be removed")
+	}
+	if !c.shutdown {
+		t.Fatal("component should be shutdown")
+	}
+	if err := Unregister("HotComp"); err != ErrServiceNotFound {
+		t.Fatalf("expect ErrServiceNotFound, got: %v", err)
+	}
+
+	// swap in a new version
+	if err := Register(&HotComp{}); err != nil {
+		t.Fatal(err)
+	}
+	Unregister("HotComp")
+}
+
+func TestReplaceAtRuntime(t *testing.T) {
+	compsStarted = true
+	defer func() {
+		compsStarted = false
+		comps = comps[:0]
+	}()
+
+	if err := Replace(&HotComp{}); err != ErrServiceNotFound {
+		t.Fatalf("expect ErrServiceNotFound, got: %v", err)
+	}
+
+	old := &HotComp{}
+	if err := Register(old); err != nil {
+		t.Fatal(err)
+	}
+	c := &HotComp{}
+	if err := Replace(c); err != nil {
+		t.Fatal(err)
+	}
+	s, ok := remote.service("HotComp")
+	if !ok || s.Rcvr.Interface() != c {
+		t.Fatal("service should be served by the new component")
+	}
+	if !c.inited || c.shutdown {
+		t.Fatal("new component should be initialized")
+	}
+	if !old.shutdown {
+		t.Fatal("old component should be shutdown")
+	}
+	for _, comp := range comps {
+		if comp == old {
+			t.Fatal("old component should be removed from components")
+		}
+	}
+
+	if err := Unregister("HotComp"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.shutdown {
+		t.Fatal("component should be shutdown")
+	}
+}
+
+func TestSetPacketCodec(t *testing.T) {
+	SetPacketCodec(pjson.NewCodec())
+	defer SetPacketCodec(nil)
+
+	c, peer := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+	go a.write()
+
+	if err := transporter.push(a.session, "onCodec", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := pjson.NewCodec().NewDecoder(peer).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != packet.Data {
+		t.Fatalf("unexpected packet: %v", p)
+	}
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Route != "onCodec" || string(m.Data) != "hello" {
+		t.Fatalf("unexpected message: %v", m)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AcceptFilter decides whether the connection from the remote address will
+// be accepted, which is evaluated after the allow and deny lists of server
+// config, before session created, client listeners and rpc listeners have
+// their own filters
+type AcceptFilter func(addr net.Addr) bool
+
+// ipFilter represents the allow and deny lists of server config, denied
+// addresses take precedence, and all addresses are allowed if allow list
+// is empty
+type ipFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func newIPFilter(allow, deny []string) (*ipFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	f := &ipFilter{}
+	var err error
+	if f.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseCIDRs parse the CIDR notations, a single ip address is treated as a
+// network of itself
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (f *ipFilter) accept(ip net.IP) bool {
+	if ip == nil {
+		return len(f.allow) == 0
+	}
+	for _, n := range f.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, n := range f.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrIP returns the ip address of the network address, nil if unknown
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// acceptConn reports whether the client connection from the remote address
+// will be accepted, the connections to backend servers are rpc connections
+// of peers, which are checked by acceptRPCConn
+func acceptConn(addr net.Addr) bool {
+	if env.ipFilter != nil && !env.ipFilter.accept(addrIP(addr)) {
+		return false
+	}
+	if env.acceptFilter != nil && !env.acceptFilter(addr) {
+		return false
+	}
+	return true
+}
+
+// acceptRPCConn reports whether the rpc connection from the remote address
+// will be accepted, the rpc allow and deny lists apply to the rpc listeners
+// of all servers, and the allow and deny lists also apply to the listener of
+// backend servers, which serves rpc only
+func acceptRPCConn(addr net.Addr) bool {
+	if env.rpcIPFilter != nil && !env.rpcIPFilter.accept(addrIP(addr)) {
+		return false
+	}
+	if env.rpcAcceptFilter != nil && !env.rpcAcceptFilter(addr) {
+		return false
+	}
+	if app.config != nil && app.config.IsFrontend {
+		return true
+	}
+	return acceptConn(addr)
+}
+
+// acceptRequest reports whether the websocket connection of the http request
+// will be accepted
+func acceptRequest(r *http.Request) bool {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return env.ipFilter == nil && env.acceptFilter == nil
+	}
+	return acceptConn(addr)
+}
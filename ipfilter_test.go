@@ -0,0 +1,121 @@
+package starx
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIPFilter(t *testing.T) {
+	if f, err := newIPFilter(nil, nil); f != nil || err != nil {
+		t.Fatalf("filter should be disabled, got %v, %v", f, err)
+	}
+	if _, err := newIPFilter([]string{"10.0.0.0/8", "bad"}, nil); err == nil {
+		t.Fatal("invalid cidr should be refused")
+	}
+
+	f, err := newIPFilter([]string{"10.0.0.0/8", "::1"}, []string{"10.0.0.1", "10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"10.0.0.2":    true,
+		"10.0.0.1":    false, // denied ip
+		"10.1.2.3":    false, // denied network
+		"192.168.0.1": false, // not allowed
+		"::1":         true,
+	}
+	for ip, accept := range cases {
+		if f.accept(net.ParseIP(ip)) != accept {
+			t.Errorf("ip %s should be accepted: %t", ip, accept)
+		}
+	}
+}
+
+func TestAcceptConn(t *testing.T) {
+	defer func() { env.ipFilter, env.acceptFilter = nil, nil }()
+
+	addr := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5000}
+	if !acceptConn(addr) {
+		t.Fatal("all connections should be accepted by default")
+	}
+
+	env.ipFilter, _ = newIPFilter(nil, []string{"192.168.1.0/24"})
+	if acceptConn(addr) {
+		t.Fatal("connection should be refused by deny list")
+	}
+
+	env.ipFilter = nil
+	SetAcceptFilter(func(a net.Addr) bool { return addrIP(a).Equal(net.ParseIP("192.168.1.11")) })
+	if acceptConn(addr) || !acceptConn(&net.TCPAddr{IP: net.ParseIP("192.168.1.11")}) {
+		t.Fatal("connection should be decided by accept filter")
+	}
+
+	r := &http.Request{RemoteAddr: "192.168.1.10:5000"}
+	if acceptRequest(r) {
+		t.Fatal("websocket request should be refused by accept filter")
+	}
+}
+
+func TestAcceptRPCConn(t *testing.T) {
+	defer func() {
+		env.ipFilter, env.acceptFilter = nil, nil
+		env.rpcIPFilter, env.rpcAcceptFilter = nil, nil
+		app.config.IsFrontend = false
+	}()
+
+	public := &net.TCPAddr{IP: net.ParseIP("8.8.8.8"), Port: 5000}
+	internal := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5000}
+
+	// the rpc port of gate is restricted to internal networks, while the
+	// clients are blocked by deny list only
+	app.config.IsFrontend = true
+	env.ipFilter, _ = newIPFilter(nil, []string{"1.2.3.4"})
+	env.rpcIPFilter, _ = newIPFilter([]string{"10.0.0.0/8"}, nil)
+	if !acceptConn(public) || acceptRPCConn(public) || !acceptRPCConn(internal) {
+		t.Fatal("rpc lists should apply to rpc connections only")
+	}
+
+	SetRPCAcceptFilter(func(a net.Addr) bool { return false })
+	if acceptRPCConn(internal) || !acceptConn(internal) {
+		t.Fatal("rpc accept filter should apply to rpc connections only")
+	}
+	env.rpcAcceptFilter = nil
+
+	// the listener of backend serves rpc only, both lists apply
+	app.config.IsFrontend = false
+	env.ipFilter, _ = newIPFilter(nil, []string{"10.0.0.2"})
+	if acceptRPCConn(internal) || !acceptRPCConn(&net.TCPAddr{IP: net.ParseIP("10.0.0.3")}) {
+		t.Fatal("allow and deny lists should apply to backend listener")
+	}
+}
+
+func TestServeRefused(t *testing.T) {
+	env.ipFilter, _ = newIPFilter(nil, []string{"127.0.0.1"})
+	defer func() { env.ipFilter = nil }()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan bool, 1)
+	go serve(l, func(conn net.Conn) { handled <- true }, acceptConn)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection should be closed")
+	}
+	select {
+	case <-handled:
+		t.Fatal("refused connection should not be handled")
+	default:
+	}
+}
@@ -0,0 +1,414 @@
+package kcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("kcp: use of closed connection")
+
+// options of connections, tuned for the lowest latency
+const (
+	updateInterval = 10 // millisecond
+	windowSize     = 128
+	readBufferSize = 4096 // larger than mtu
+	acceptBacklog  = 128
+)
+
+// refTime is the base of the millisecond clock of KCP
+var refTime = time.Now()
+
+func currentMs() uint32 {
+	return uint32(time.Since(refTime) / time.Millisecond)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "kcp: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Conn is a reliable connection over udp, which implements net.Conn. There
+// is no handshake or close notification in KCP, the connection is closed
+// when the remote stopped acknowledging data, idle connections should be
+// detected by heartbeats of upper layer
+type Conn struct {
+	mu            sync.Mutex
+	kcp           *KCP
+	conn          net.PacketConn
+	remote        net.Addr
+	l             *Listener // nil if dialed
+	pending       []byte    // data of the message received but not read
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readEvent  chan struct{}
+	writeEvent chan struct{}
+	die        chan struct{}
+	closeOnce  sync.Once
+}
+
+func newConn(conv uint32, conn net.PacketConn, remote net.Addr, l *Listener) *Conn {
+	c := &Conn{
+		conn:       conn,
+		remote:     remote,
+		l:          l,
+		readEvent:  make(chan struct{}, 1),
+		writeEvent: make(chan struct{}, 1),
+		die:        make(chan struct{}),
+	}
+	c.kcp = NewKCP(conv, func(data []byte) {
+		conn.WriteTo(data, remote)
+	})
+	c.kcp.NoDelay(1, updateInterval, 2, 1)
+	c.kcp.WndSize(windowSize, windowSize)
+	c.kcp.Update(currentMs())
+	go c.update()
+	return c
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// update flush the connection every interval, and close it once the remote
+// is unreachable
+func (c *Conn) update() {
+	ticker := time.NewTicker(updateInterval * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			c.kcp.Update(currentMs())
+			dead := c.kcp.state == stateDead
+			writable := c.kcp.WaitSnd() < int(c.kcp.sndWnd)
+			c.mu.Unlock()
+			if dead {
+				c.Close()
+				return
+			}
+			if writable {
+				notify(c.writeEvent)
+			}
+		case <-c.die:
+			return
+		}
+	}
+}
+
+// input process the datagram received from remote
+func (c *Conn) input(data []byte) {
+	c.mu.Lock()
+	c.kcp.current = currentMs()
+	c.kcp.Input(data)
+	// acknowledge immediately
+	if len(c.kcp.acklist) > 0 {
+		c.kcp.flush()
+	}
+	readable := c.kcp.PeekSize() > 0
+	c.mu.Unlock()
+
+	if readable {
+		notify(c.readEvent)
+	}
+}
+
+// Read read the data received, messages sent by remote are not preserved,
+// the connection is read as a stream
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if len(c.pending) > 0 {
+			n := copy(b, c.pending)
+			c.pending = c.pending[n:]
+			c.mu.Unlock()
+			return n, nil
+		}
+		if size := c.kcp.PeekSize(); size > 0 {
+			if len(b) >= size {
+				n := c.kcp.Recv(b)
+				c.mu.Unlock()
+				return n, nil
+			}
+			data := make([]byte, size)
+			c.kcp.Recv(data)
+			n := copy(b, data)
+			c.pending = data[n:]
+			c.mu.Unlock()
+			return n, nil
+		}
+		deadline := c.readDeadline
+		c.mu.Unlock()
+
+		if err := c.wait(c.readEvent, deadline); err != nil {
+			if err == ErrClosed {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+	}
+}
+
+// Write queue the data to be sent, it blocks when the send window is full
+func (c *Conn) Write(b []byte) (int, error) {
+	for {
+		select {
+		case <-c.die:
+			return 0, ErrClosed
+		default:
+		}
+
+		c.mu.Lock()
+		if c.kcp.WaitSnd() < 2*int(c.kcp.sndWnd) {
+			n := len(b)
+			for len(b) > 0 {
+				size := len(b)
+				if size > int(c.kcp.mss) {
+					size = int(c.kcp.mss)
+				}
+				c.kcp.Send(b[:size])
+				b = b[size:]
+			}
+			c.kcp.current = currentMs()
+			c.kcp.flush()
+			c.mu.Unlock()
+			return n, nil
+		}
+		deadline := c.writeDeadline
+		c.mu.Unlock()
+
+		if err := c.wait(c.writeEvent, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// wait until the event notified, connection closed or deadline exceeded
+func (c *Conn) wait(event chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return timeoutError{}
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-event:
+		return nil
+	case <-timeout:
+		return timeoutError{}
+	case <-c.die:
+		return ErrClosed
+	}
+}
+
+// Close close the connection, data not acknowledged by remote is discarded
+func (c *Conn) Close() error {
+	err := ErrClosed
+	c.closeOnce.Do(func() {
+		err = nil
+		close(c.die)
+		if c.l != nil {
+			c.l.remove(c)
+		} else {
+			c.conn.Close()
+		}
+	})
+	return err
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	notify(c.readEvent)
+	notify(c.writeEvent)
+	return nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	notify(c.readEvent)
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	notify(c.writeEvent)
+	return nil
+}
+
+// Listener accept KCP connections on a udp socket, which implements
+// net.Listener, all connections share the socket, so they are closed with
+// the listener
+type Listener struct {
+	conn      net.PacketConn
+	mu        sync.Mutex
+	conns     map[string]*Conn // remote address -> connection
+	accept    chan *Conn
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen announces on the udp address
+func Listen(addr string) (*Listener, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return ServeConn(conn), nil
+}
+
+// ServeConn accept KCP connections on the udp socket, e.g. a socket inherited
+// from parent process, the socket is closed with the listener
+func ServeConn(conn net.PacketConn) *Listener {
+	l := &Listener{
+		conn:   conn,
+		conns:  make(map[string]*Conn),
+		accept: make(chan *Conn, acceptBacklog),
+		die:    make(chan struct{}),
+	}
+	go l.serve()
+	return l
+}
+
+// serve dispatch datagrams to connections by remote address, a connection
+// is created by the first data segment of a new remote address
+func (l *Listener) serve() {
+	defer l.Close()
+
+	buf := make([]byte, readBufferSize)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < overhead {
+			continue
+		}
+		data := append([]byte(nil), buf[:n]...)
+
+		key := addr.String()
+		l.mu.Lock()
+		c, ok := l.conns[key]
+		if !ok {
+			if data[4] != cmdPush {
+				l.mu.Unlock()
+				continue
+			}
+			c = newConn(binary.LittleEndian.Uint32(data), l.conn, addr, l)
+			select {
+			case l.accept <- c:
+				l.conns[key] = c
+			default:
+				// backlog full, the remote will retransmit
+				l.mu.Unlock()
+				c.closeOnce.Do(func() { close(c.die) })
+				continue
+			}
+		}
+		l.mu.Unlock()
+		c.input(data)
+	}
+}
+
+func (l *Listener) remove(c *Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := c.remote.String()
+	if l.conns[key] == c {
+		delete(l.conns, key)
+	}
+}
+
+// Accept waits for and returns the next connection
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.die:
+		return nil, ErrClosed
+	}
+}
+
+// Close stop listening and close all connections
+func (l *Listener) Close() error {
+	err := ErrClosed
+	l.closeOnce.Do(func() {
+		err = nil
+		close(l.die)
+		l.conn.Close()
+
+		l.mu.Lock()
+		conns := l.conns
+		l.conns = make(map[string]*Conn)
+		l.mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	return err
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Dial connects to the KCP listener at the udp address
+func Dial(addr string) (*Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	network := "udp"
+	if raddr.IP.To4() != nil {
+		network = "udp4"
+	}
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newConn(rand.Uint32(), conn, raddr, nil)
+	go func() {
+		defer c.Close()
+		buf := make([]byte, readBufferSize)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < overhead || from.String() != raddr.String() {
+				continue
+			}
+			c.input(append([]byte(nil), buf[:n]...))
+		}
+	}()
+	return c, nil
+}
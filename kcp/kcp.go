@@ -0,0 +1,652 @@
+// Package kcp implements the KCP protocol, an ARQ protocol which provides
+// reliable and ordered delivery over udp with lower latency than tcp, at
+// the cost of more bandwidth. The wire format is compatible with the
+// original implementation without encryption and FEC.
+package kcp
+
+import "encoding/binary"
+
+const (
+	rtoNoDelay = 30    // minimum rto in nodelay mode
+	rtoMin     = 100   // normal minimum rto
+	rtoDef     = 200   // default rto
+	rtoMax     = 60000 // maximum rto
+
+	cmdPush = 81 // data
+	cmdAck  = 82 // ack
+	cmdWask = 83 // window probe(ask)
+	cmdWins = 84 // window size(tell)
+
+	askSend = 1 // need to send cmdWask
+	askTell = 2 // need to send cmdWins
+
+	wndSnd     = 32
+	wndRcv     = 128 // should be larger than the maximum fragments of a message
+	mtuDef     = 1400
+	interval   = 100
+	overhead   = 24
+	deadLink   = 20
+	threshInit = 2
+	threshMin  = 2
+	probeInit  = 7000   // 7s to probe window size
+	probeLimit = 120000 // up to 120s to probe window
+
+	stateDead = 0xffffffff
+)
+
+// segment is the unit of data sent over udp
+type segment struct {
+	conv     uint32
+	cmd      uint8
+	frg      uint8
+	wnd      uint16
+	ts       uint32
+	sn       uint32
+	una      uint32
+	rto      uint32
+	xmit     uint32
+	resendts uint32
+	fastack  uint32
+	data     []byte
+}
+
+// encode append the header of segment to b
+func (seg *segment) encode(b []byte) []byte {
+	var h [overhead]byte
+	binary.LittleEndian.PutUint32(h[0:], seg.conv)
+	h[4] = seg.cmd
+	h[5] = seg.frg
+	binary.LittleEndian.PutUint16(h[6:], seg.wnd)
+	binary.LittleEndian.PutUint32(h[8:], seg.ts)
+	binary.LittleEndian.PutUint32(h[12:], seg.sn)
+	binary.LittleEndian.PutUint32(h[16:], seg.una)
+	binary.LittleEndian.PutUint32(h[20:], uint32(len(seg.data)))
+	return append(b, h[:]...)
+}
+
+type ackItem struct {
+	sn uint32
+	ts uint32
+}
+
+// KCP is the state of a KCP connection, it's not safe for concurrent use
+type KCP struct {
+	conv, mtu, mss, state  uint32
+	sndUna, sndNxt, rcvNxt uint32
+	ssthresh               uint32
+	rxRttvar, rxSrtt       int32
+	rxRto, rxMinrto        uint32
+	sndWnd, rcvWnd, rmtWnd uint32
+	cwnd, probe            uint32
+	current, interval      uint32
+	tsFlush                uint32
+	nodelay, updated       uint32
+	tsProbe, probeWait     uint32
+	deadLink, incr         uint32
+	fastresend             int32
+	nocwnd                 int32
+
+	sndQueue []segment
+	rcvQueue []segment
+	sndBuf   []segment
+	rcvBuf   []segment
+	acklist  []ackItem
+
+	buffer []byte
+	output func(data []byte) // write a datagram, data is reused after returned
+}
+
+// NewKCP create a KCP connection, conv should be the same in both endpoints
+func NewKCP(conv uint32, output func(data []byte)) *KCP {
+	return &KCP{
+		conv:     conv,
+		sndWnd:   wndSnd,
+		rcvWnd:   wndRcv,
+		rmtWnd:   wndRcv,
+		mtu:      mtuDef,
+		mss:      mtuDef - overhead,
+		rxRto:    rtoDef,
+		rxMinrto: rtoMin,
+		interval: interval,
+		tsFlush:  interval,
+		ssthresh: threshInit,
+		deadLink: deadLink,
+		buffer:   make([]byte, 0, mtuDef),
+		output:   output,
+	}
+}
+
+// PeekSize returns the size of next message in receive queue, -1 if no
+// complete message
+func (kcp *KCP) PeekSize() int {
+	if len(kcp.rcvQueue) == 0 {
+		return -1
+	}
+
+	seg := &kcp.rcvQueue[0]
+	if seg.frg == 0 {
+		return len(seg.data)
+	}
+	if len(kcp.rcvQueue) < int(seg.frg)+1 {
+		return -1
+	}
+
+	length := 0
+	for i := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[i]
+		length += len(seg.data)
+		if seg.frg == 0 {
+			break
+		}
+	}
+	return length
+}
+
+// Recv read the next message into buffer, returns the length of message,
+// -1 if no complete message, -2 if buffer is too small
+func (kcp *KCP) Recv(buffer []byte) int {
+	size := kcp.PeekSize()
+	if size < 0 {
+		return -1
+	}
+	if size > len(buffer) {
+		return -2
+	}
+
+	fastRecover := len(kcp.rcvQueue) >= int(kcp.rcvWnd)
+
+	n, count := 0, 0
+	for i := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[i]
+		n += copy(buffer[n:], seg.data)
+		count++
+		if seg.frg == 0 {
+			break
+		}
+	}
+	kcp.rcvQueue = removeFront(kcp.rcvQueue, count)
+	kcp.moveRcvBuf()
+
+	// tell the remote the window reopened
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) && fastRecover {
+		kcp.probe |= askTell
+	}
+	return n
+}
+
+// Send queue the message, which will be split into fragments of mss,
+// returns -1 if the message is empty, -2 if it's too large
+func (kcp *KCP) Send(buffer []byte) int {
+	if len(buffer) == 0 {
+		return -1
+	}
+
+	count := (len(buffer) + int(kcp.mss) - 1) / int(kcp.mss)
+	if count >= wndRcv || count > 255 {
+		return -2
+	}
+
+	for i := 0; i < count; i++ {
+		size := len(buffer)
+		if size > int(kcp.mss) {
+			size = int(kcp.mss)
+		}
+		seg := segment{
+			frg:  uint8(count - i - 1),
+			data: append([]byte(nil), buffer[:size]...),
+		}
+		kcp.sndQueue = append(kcp.sndQueue, seg)
+		buffer = buffer[size:]
+	}
+	return 0
+}
+
+// moveRcvBuf move the continuous segments from receive buffer to queue
+func (kcp *KCP) moveRcvBuf() {
+	count := 0
+	for i := range kcp.rcvBuf {
+		if kcp.rcvBuf[i].sn != kcp.rcvNxt || len(kcp.rcvQueue)+count >= int(kcp.rcvWnd) {
+			break
+		}
+		kcp.rcvNxt++
+		count++
+	}
+	if count > 0 {
+		kcp.rcvQueue = append(kcp.rcvQueue, kcp.rcvBuf[:count]...)
+		kcp.rcvBuf = removeFront(kcp.rcvBuf, count)
+	}
+}
+
+func (kcp *KCP) updateAck(rtt int32) {
+	if kcp.rxSrtt == 0 {
+		kcp.rxSrtt = rtt
+		kcp.rxRttvar = rtt / 2
+	} else {
+		delta := rtt - kcp.rxSrtt
+		if delta < 0 {
+			delta = -delta
+		}
+		kcp.rxRttvar = (3*kcp.rxRttvar + delta) / 4
+		kcp.rxSrtt = (7*kcp.rxSrtt + rtt) / 8
+		if kcp.rxSrtt < 1 {
+			kcp.rxSrtt = 1
+		}
+	}
+	rto := uint32(kcp.rxSrtt) + max32(kcp.interval, uint32(4*kcp.rxRttvar))
+	kcp.rxRto = bound32(kcp.rxMinrto, rto, rtoMax)
+}
+
+func (kcp *KCP) shrinkBuf() {
+	if len(kcp.sndBuf) > 0 {
+		kcp.sndUna = kcp.sndBuf[0].sn
+	} else {
+		kcp.sndUna = kcp.sndNxt
+	}
+}
+
+func (kcp *KCP) parseAck(sn uint32) {
+	if timediff(sn, kcp.sndUna) < 0 || timediff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for i := range kcp.sndBuf {
+		seg := &kcp.sndBuf[i]
+		if sn == seg.sn {
+			kcp.sndBuf = append(kcp.sndBuf[:i], kcp.sndBuf[i+1:]...)
+			return
+		}
+		if timediff(sn, seg.sn) < 0 {
+			return
+		}
+	}
+}
+
+func (kcp *KCP) parseFastack(sn uint32) {
+	if timediff(sn, kcp.sndUna) < 0 || timediff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for i := range kcp.sndBuf {
+		seg := &kcp.sndBuf[i]
+		if timediff(sn, seg.sn) < 0 {
+			return
+		}
+		if sn != seg.sn {
+			seg.fastack++
+		}
+	}
+}
+
+func (kcp *KCP) parseUna(una uint32) {
+	count := 0
+	for i := range kcp.sndBuf {
+		if timediff(una, kcp.sndBuf[i].sn) <= 0 {
+			break
+		}
+		count++
+	}
+	kcp.sndBuf = removeFront(kcp.sndBuf, count)
+}
+
+func (kcp *KCP) parseData(newseg segment) {
+	sn := newseg.sn
+	if timediff(sn, kcp.rcvNxt+kcp.rcvWnd) >= 0 || timediff(sn, kcp.rcvNxt) < 0 {
+		return
+	}
+
+	// the buffer is ordered by sn, find the position from the tail
+	insert := 0
+	for i := len(kcp.rcvBuf) - 1; i >= 0; i-- {
+		seg := &kcp.rcvBuf[i]
+		if seg.sn == sn {
+			return
+		}
+		if timediff(sn, seg.sn) > 0 {
+			insert = i + 1
+			break
+		}
+	}
+
+	newseg.data = append([]byte(nil), newseg.data...)
+	kcp.rcvBuf = append(kcp.rcvBuf, segment{})
+	copy(kcp.rcvBuf[insert+1:], kcp.rcvBuf[insert:])
+	kcp.rcvBuf[insert] = newseg
+	kcp.moveRcvBuf()
+}
+
+// Input process the datagram received from remote, returns -1 if the
+// datagram is malformed or belongs to other conversation, -2 if truncated,
+// -3 if unknown command
+func (kcp *KCP) Input(data []byte) int {
+	una := kcp.sndUna
+	if len(data) < overhead {
+		return -1
+	}
+
+	var maxack uint32
+	var acked bool
+	for len(data) >= overhead {
+		seg := segment{
+			conv: binary.LittleEndian.Uint32(data),
+			cmd:  data[4],
+			frg:  data[5],
+			wnd:  binary.LittleEndian.Uint16(data[6:]),
+			ts:   binary.LittleEndian.Uint32(data[8:]),
+			sn:   binary.LittleEndian.Uint32(data[12:]),
+			una:  binary.LittleEndian.Uint32(data[16:]),
+		}
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[overhead:]
+
+		if seg.conv != kcp.conv {
+			return -1
+		}
+		if uint32(len(data)) < length {
+			return -2
+		}
+		if seg.cmd != cmdPush && seg.cmd != cmdAck && seg.cmd != cmdWask && seg.cmd != cmdWins {
+			return -3
+		}
+
+		kcp.rmtWnd = uint32(seg.wnd)
+		kcp.parseUna(seg.una)
+		kcp.shrinkBuf()
+
+		switch seg.cmd {
+		case cmdAck:
+			if rtt := timediff(kcp.current, seg.ts); rtt >= 0 {
+				kcp.updateAck(rtt)
+			}
+			kcp.parseAck(seg.sn)
+			kcp.shrinkBuf()
+			if !acked || timediff(seg.sn, maxack) > 0 {
+				acked, maxack = true, seg.sn
+			}
+		case cmdPush:
+			if timediff(seg.sn, kcp.rcvNxt+kcp.rcvWnd) < 0 {
+				kcp.acklist = append(kcp.acklist, ackItem{sn: seg.sn, ts: seg.ts})
+				if timediff(seg.sn, kcp.rcvNxt) >= 0 {
+					seg.data = data[:length]
+					kcp.parseData(seg)
+				}
+			}
+		case cmdWask:
+			kcp.probe |= askTell
+		}
+		data = data[length:]
+	}
+
+	if acked {
+		kcp.parseFastack(maxack)
+	}
+
+	// congestion window grows on acknowledged
+	if timediff(kcp.sndUna, una) > 0 && kcp.cwnd < kcp.rmtWnd {
+		mss := kcp.mss
+		if kcp.cwnd < kcp.ssthresh {
+			kcp.cwnd++
+			kcp.incr += mss
+		} else {
+			if kcp.incr < mss {
+				kcp.incr = mss
+			}
+			kcp.incr += (mss*mss)/kcp.incr + mss/16
+			if (kcp.cwnd+1)*mss <= kcp.incr {
+				kcp.cwnd++
+			}
+		}
+		if kcp.cwnd > kcp.rmtWnd {
+			kcp.cwnd = kcp.rmtWnd
+			kcp.incr = kcp.rmtWnd * mss
+		}
+	}
+	return 0
+}
+
+func (kcp *KCP) wndUnused() uint16 {
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) {
+		return uint16(int(kcp.rcvWnd) - len(kcp.rcvQueue))
+	}
+	return 0
+}
+
+// flush send the acks, window probes and segments due
+func (kcp *KCP) flush() {
+	if kcp.updated == 0 {
+		return
+	}
+	current := kcp.current
+
+	buf := kcp.buffer[:0]
+	reserve := func(space int) {
+		if len(buf)+space > int(kcp.mtu) {
+			kcp.output(buf)
+			buf = buf[:0]
+		}
+	}
+
+	seg := segment{conv: kcp.conv, cmd: cmdAck, wnd: kcp.wndUnused(), una: kcp.rcvNxt}
+	for _, ack := range kcp.acklist {
+		reserve(overhead)
+		seg.sn, seg.ts = ack.sn, ack.ts
+		buf = seg.encode(buf)
+	}
+	kcp.acklist = kcp.acklist[:0]
+
+	// probe the window size if the remote window is full
+	if kcp.rmtWnd == 0 {
+		if kcp.probeWait == 0 {
+			kcp.probeWait = probeInit
+			kcp.tsProbe = current + kcp.probeWait
+		} else if timediff(current, kcp.tsProbe) >= 0 {
+			if kcp.probeWait < probeInit {
+				kcp.probeWait = probeInit
+			}
+			kcp.probeWait += kcp.probeWait / 2
+			if kcp.probeWait > probeLimit {
+				kcp.probeWait = probeLimit
+			}
+			kcp.tsProbe = current + kcp.probeWait
+			kcp.probe |= askSend
+		}
+	} else {
+		kcp.tsProbe = 0
+		kcp.probeWait = 0
+	}
+
+	seg.sn, seg.ts = 0, 0
+	if kcp.probe&askSend != 0 {
+		seg.cmd = cmdWask
+		reserve(overhead)
+		buf = seg.encode(buf)
+	}
+	if kcp.probe&askTell != 0 {
+		seg.cmd = cmdWins
+		reserve(overhead)
+		buf = seg.encode(buf)
+	}
+	kcp.probe = 0
+
+	cwnd := min32(kcp.sndWnd, kcp.rmtWnd)
+	if kcp.nocwnd == 0 {
+		cwnd = min32(kcp.cwnd, cwnd)
+	}
+
+	// move segments from queue to buffer in window
+	count := 0
+	for i := range kcp.sndQueue {
+		if timediff(kcp.sndNxt, kcp.sndUna+cwnd) >= 0 {
+			break
+		}
+		newseg := kcp.sndQueue[i]
+		newseg.conv = kcp.conv
+		newseg.cmd = cmdPush
+		newseg.sn = kcp.sndNxt
+		kcp.sndBuf = append(kcp.sndBuf, newseg)
+		kcp.sndNxt++
+		count++
+	}
+	kcp.sndQueue = removeFront(kcp.sndQueue, count)
+
+	resent := uint32(kcp.fastresend)
+	if kcp.fastresend <= 0 {
+		resent = 0xffffffff
+	}
+	rtomin := kcp.rxRto >> 3
+	if kcp.nodelay != 0 {
+		rtomin = 0
+	}
+
+	var change, lost bool
+	for i := range kcp.sndBuf {
+		s := &kcp.sndBuf[i]
+		send := false
+		switch {
+		case s.xmit == 0:
+			send = true
+			s.rto = kcp.rxRto
+			s.resendts = current + s.rto + rtomin
+		case timediff(current, s.resendts) >= 0:
+			send = true
+			if kcp.nodelay == 0 {
+				s.rto += max32(s.rto, kcp.rxRto)
+			} else {
+				s.rto += kcp.rxRto / 2
+			}
+			s.resendts = current + s.rto
+			lost = true
+		case s.fastack >= resent:
+			send = true
+			s.fastack = 0
+			s.resendts = current + s.rto
+			change = true
+		}
+		if !send {
+			continue
+		}
+
+		s.xmit++
+		s.ts = current
+		s.wnd = seg.wnd
+		s.una = kcp.rcvNxt
+		reserve(overhead + len(s.data))
+		buf = s.encode(buf)
+		buf = append(buf, s.data...)
+		if s.xmit >= kcp.deadLink {
+			kcp.state = stateDead
+		}
+	}
+	if len(buf) > 0 {
+		kcp.output(buf)
+	}
+
+	if change {
+		inflight := kcp.sndNxt - kcp.sndUna
+		kcp.ssthresh = max32(inflight/2, threshMin)
+		kcp.cwnd = kcp.ssthresh + resent
+		kcp.incr = kcp.cwnd * kcp.mss
+	}
+	if lost {
+		kcp.ssthresh = max32(cwnd/2, threshMin)
+		kcp.cwnd = 1
+		kcp.incr = kcp.mss
+	}
+	if kcp.cwnd < 1 {
+		kcp.cwnd = 1
+		kcp.incr = kcp.mss
+	}
+}
+
+// Update should be called repeatedly with the current time in millisecond,
+// the pending data will be flushed every interval
+func (kcp *KCP) Update(current uint32) {
+	kcp.current = current
+	if kcp.updated == 0 {
+		kcp.updated = 1
+		kcp.tsFlush = current
+	}
+
+	slap := timediff(current, kcp.tsFlush)
+	if slap >= 10000 || slap < -10000 {
+		kcp.tsFlush = current
+		slap = 0
+	}
+	if slap >= 0 {
+		kcp.tsFlush += kcp.interval
+		if timediff(current, kcp.tsFlush) >= 0 {
+			kcp.tsFlush = current + kcp.interval
+		}
+		kcp.flush()
+	}
+}
+
+// NoDelay set the options of latency, negative values are ignored:
+// nodelay enables nodelay mode if not zero, interval is the interval of
+// update in millisecond, resend enables fast retransmit after resend
+// duplicated acks if not zero, nc disables congestion control if not zero.
+// e.g. NoDelay(1, 10, 2, 1) for the lowest latency
+func (kcp *KCP) NoDelay(nodelay, interval, resend, nc int) {
+	if nodelay >= 0 {
+		kcp.nodelay = uint32(nodelay)
+		if nodelay != 0 {
+			kcp.rxMinrto = rtoNoDelay
+		} else {
+			kcp.rxMinrto = rtoMin
+		}
+	}
+	if interval >= 0 {
+		kcp.interval = bound32(10, uint32(interval), 5000)
+	}
+	if resend >= 0 {
+		kcp.fastresend = int32(resend)
+	}
+	if nc >= 0 {
+		kcp.nocwnd = int32(nc)
+	}
+}
+
+// WndSize set the maximum window size, in segments
+func (kcp *KCP) WndSize(snd, rcv int) {
+	if snd > 0 {
+		kcp.sndWnd = uint32(snd)
+	}
+	if rcv > 0 {
+		kcp.rcvWnd = max32(uint32(rcv), wndRcv)
+	}
+}
+
+// WaitSnd returns the number of segments waiting to be sent or acknowledged
+func (kcp *KCP) WaitSnd() int {
+	return len(kcp.sndBuf) + len(kcp.sndQueue)
+}
+
+func removeFront(q []segment, n int) []segment {
+	if n == 0 {
+		return q
+	}
+	m := copy(q, q[n:])
+	for i := m; i < len(q); i++ {
+		q[i] = segment{}
+	}
+	return q[:m]
+}
+
+func timediff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func bound32(lower, middle, upper uint32) uint32 {
+	return min32(max32(lower, middle), upper)
+}
@@ -0,0 +1,137 @@
+package kcp
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKCP_LossyLink(t *testing.T) {
+	var a, b *KCP
+	rnd := rand.New(rand.NewSource(1))
+	// drop 20% datagrams, and deliver the others in random order
+	var toA, toB [][]byte
+	a = NewKCP(1, func(data []byte) {
+		if rnd.Intn(5) > 0 {
+			toB = append(toB, append([]byte(nil), data...))
+		}
+	})
+	b = NewKCP(1, func(data []byte) {
+		if rnd.Intn(5) > 0 {
+			toA = append(toA, append([]byte(nil), data...))
+		}
+	})
+	a.NoDelay(1, 10, 2, 1)
+	b.NoDelay(1, 10, 2, 1)
+
+	var sent, received [][]byte
+	for i := 0; i < 100; i++ {
+		msg := bytes.Repeat([]byte{byte(i)}, 1+rnd.Intn(3000))
+		sent = append(sent, msg)
+		if a.Send(msg) != 0 {
+			t.Fatalf("send message %d failed", i)
+		}
+	}
+
+	buf := make([]byte, 4096)
+	for now := uint32(0); now < 60000 && len(received) < len(sent); now += 10 {
+		a.Update(now)
+		b.Update(now)
+		rnd.Shuffle(len(toB), func(i, j int) { toB[i], toB[j] = toB[j], toB[i] })
+		for _, d := range toB {
+			b.Input(d)
+		}
+		for _, d := range toA {
+			a.Input(d)
+		}
+		toA, toB = nil, nil
+		for {
+			n := b.Recv(buf)
+			if n < 0 {
+				break
+			}
+			received = append(received, append([]byte(nil), buf[:n]...))
+		}
+	}
+
+	if len(received) != len(sent) {
+		t.Fatalf("expect %d messages, got %d", len(sent), len(received))
+	}
+	for i := range sent {
+		if !bytes.Equal(sent[i], received[i]) {
+			t.Fatalf("message %d mismatched", i)
+		}
+	}
+}
+
+func TestKCP_Input(t *testing.T) {
+	k := NewKCP(1, func([]byte) {})
+	if k.Input(make([]byte, overhead-1)) != -1 {
+		t.Fatal("short datagram should be rejected")
+	}
+
+	seg := segment{conv: 2, cmd: cmdPush}
+	if k.Input(seg.encode(nil)) != -1 {
+		t.Fatal("datagram of other conversation should be rejected")
+	}
+
+	seg = segment{conv: 1, cmd: cmdPush, data: []byte("hello")}
+	if k.Input(seg.encode(nil)) != -2 {
+		t.Fatal("truncated datagram should be rejected")
+	}
+	if k.Send(make([]byte, wndRcv*int(k.mss))) != -2 {
+		t.Fatal("message too large should be rejected")
+	}
+}
+
+func TestConn(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// echo server
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	data := make([]byte, 256*1024)
+	rand.Read(data)
+	go c.Write(data)
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(c, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, got) {
+		t.Fatal("echoed data mismatched")
+	}
+
+	// read timeout
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := c.Read(got); err == nil || !err.(net.Error).Timeout() {
+		t.Fatalf("expect timeout, got: %v", err)
+	}
+
+	c.Close()
+	if _, err := c.Write(data); err != ErrClosed {
+		t.Fatalf("expect ErrClosed, got: %v", err)
+	}
+}
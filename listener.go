@@ -0,0 +1,112 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
+)
+
+var ErrUnknownCodec = errors.New("unknown packet codec")
+
+// serveListener serve the additional listener of frontend server
+func serveListener(lc *cluster.ListenerConfig) error {
+	var codec packet.Codec
+	if lc.Codec != "" {
+		c, ok := env.packetCodecs[lc.Codec]
+		if !ok {
+			return ErrUnknownCodec
+		}
+		codec = c
+	}
+
+	host := lc.Host
+	if host == "" {
+		host = app.config.Host
+	}
+	addr := fmt.Sprintf("%s:%d", host, lc.Port)
+	secure := lc.TLSCert != "" && lc.TLSKey != ""
+
+	if lc.IsWebsocket {
+		listener, err := upgrader.listenTCP(addr)
+		if err != nil {
+			return err
+		}
+		log.Infof("websocket listen at %s, tls: %t", addr, secure)
+		if secure {
+			err = http.ServeTLS(listener, wsHandler(codec), lc.TLSCert, lc.TLSKey)
+		} else {
+			err = http.Serve(listener, wsHandler(codec))
+		}
+		if upgrader.isUpgrading() {
+			return nil
+		}
+		return err
+	}
+
+	listener, err := listenTransport(lc.Transport, addr)
+	if err != nil {
+		return err
+	}
+	if secure {
+		cert, err := tls.LoadX509KeyPair(lc.TLSCert, lc.TLSKey)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
+	log.Infof("listen at %s, tls: %t", addr, secure)
+	serve(listener, func(conn net.Conn) {
+		handler.handleCodec(conn, codec)
+	}, acceptConn)
+	return nil
+}
+
+// packetCodec returns the packet codec of the listener which accepted the
+// connection of agent
+func (a *agent) packetCodec() packet.Codec {
+	if a.codec == nil {
+		return env.packetCodec
+	}
+	return a.codec
+}
+
+// controlPacket returns the encoded control packet, e.g. heartbeat or kick,
+// encoded is the packet encoded with default codec
+func (a *agent) controlPacket(typ packet.PacketType, encoded []byte) []byte {
+	if a.codec == nil {
+		return encoded
+	}
+	data, err := a.codec.Encode(&packet.Packet{Type: typ})
+	if err != nil {
+		log.Error(err.Error())
+	}
+	return data
+}
@@ -0,0 +1,44 @@
+package starx
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/packet"
+	pjson "github.com/lonnng/starx/packet/json"
+)
+
+func TestListenerCodec(t *testing.T) {
+	codec := pjson.NewCodec()
+	RegisterPacketCodec("json", codec)
+	defer func() { env.packetCodecs = nil }()
+
+	c, peer := net.Pipe()
+	go handler.handleCodec(c, codec)
+	defer peer.Close()
+
+	data, _ := codec.Encode(&packet.Packet{Type: packet.Handshake, Data: []byte("{}")})
+	if _, err := peer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	p, err := codec.NewDecoder(peer).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != packet.Handshake {
+		t.Fatalf("handshake should be responded with codec of listener, got: %v", p)
+	}
+
+	a := newAgent(c)
+	a.codec = codec
+	hb, _ := codec.Encode(&packet.Packet{Type: packet.Heartbeat})
+	if string(a.controlPacket(packet.Heartbeat, heartbeatPacket)) != string(hb) {
+		t.Fatal("control packet should be encoded with codec of listener")
+	}
+
+	err = serveListener(&cluster.ListenerConfig{Port: 0, Codec: "unknown"})
+	if err != ErrUnknownCodec {
+		t.Fatalf("expect ErrUnknownCodec, got: %v", err)
+	}
+}
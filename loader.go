@@ -0,0 +1,345 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix is the prefix of environment variables which override configs
+const envPrefix = "STARX_"
+
+// configDecoders decode servers config by file extension, the decoder has
+// the same signature with json.Unmarshal
+var configDecoders = map[string]func([]byte, interface{}) error{
+	".json": json.Unmarshal,
+	".yaml": yaml.Unmarshal,
+	".yml":  yaml.Unmarshal,
+	".toml": toml.Unmarshal,
+}
+
+// flags represents the command-line flags bound by BindFlags
+var flags = &struct {
+	serverId      string
+	serverType    string
+	masterId      string
+	serversConfig string
+	config        string
+	port          int
+	single        bool
+}{}
+
+// BindFlags define the command-line flags of starx in the flag set, which
+// take precedence over environment variables and config file:
+//
+//	-server-id       id of current server
+//	-server-type     type of current server, a server config of this type will
+//	                 be derived when the server id not found in config file
+//	-master-id       id of master server
+//	-servers-config  path of servers config file
+//	-config          path of config file which can be reloaded by SIGHUP
+//	-port            port of current server
+//	-single          run in single process mode, see EnableSingleProcess
+func BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&flags.serverId, "server-id", "", "id of current server")
+	fs.StringVar(&flags.serverType, "server-type", "", "type of current server")
+	fs.StringVar(&flags.masterId, "master-id", "", "id of master server")
+	fs.StringVar(&flags.serversConfig, "servers-config", "", "path of servers config file")
+	fs.StringVar(&flags.config, "config", "", "path of config file which can be reloaded by SIGHUP")
+	fs.IntVar(&flags.port, "port", 0, "port of current server")
+	fs.BoolVar(&flags.single, "single", false, "run in single process mode")
+}
+
+// loadEnv load the server id, master id, config paths, admin token and single
+// process mode from environment variables and command-line flags
+func loadEnv() {
+	for _, o := range []struct {
+		name, flag string
+		value      *string
+	}{
+		{"SERVER_ID", flags.serverId, &env.serverId},
+		{"MASTER_ID", flags.masterId, &env.masterServerId},
+		{"SERVERS_CONFIG", flags.serversConfig, &env.serversConfigPath},
+		{"CONFIG", flags.config, &env.configPath},
+		{"ADMIN_TOKEN", "", &env.adminToken},
+	} {
+		if v := os.Getenv(envPrefix + o.name); v != "" {
+			*o.value = v
+		}
+		if o.flag != "" {
+			*o.value = o.flag
+		}
+	}
+
+	if v := os.Getenv(envPrefix + "SINGLE"); v != "" {
+		single, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("%sSINGLE should be a boolean, got %q", envPrefix, v)
+		}
+		env.single = single
+	}
+	if flags.single {
+		env.single = true
+	}
+}
+
+// findServersConfig returns the servers config in $wd/configs, which has an
+// extension supported by config decoders, json is preferred
+func findServersConfig() string {
+	return findConfig("servers")
+}
+
+// findConfig returns the config file of name in $wd/configs, which has an
+// extension supported by config decoders, json is preferred
+func findConfig(name string) string {
+	exts := make([]string, 0, len(configDecoders))
+	for ext := range configDecoders {
+		if ext != ".json" {
+			exts = append(exts, ext)
+		}
+	}
+	sort.Strings(exts)
+
+	for _, ext := range append([]string{".json"}, exts...) {
+		p := filepath.Join(env.wd, "configs", name+ext)
+		if fileExists(p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// readServers read and decode servers config file, the file is decoded to
+// generic values first, and then mapped to server configs by json tags
+func readServers(path string) (map[string][]*cluster.ServerConfig, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	decode, ok := configDecoders[ext]
+	if !ok {
+		return nil, fmt.Errorf("unsupported config format %q, decoder can be registered by starx.RegisterConfigDecoder", ext)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err := decode(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode %s error: %s", path, err.Error())
+	}
+	buf, err := json.Marshal(normalize(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var servers map[string][]*cluster.ServerConfig
+	if err := json.Unmarshal(buf, &servers); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %s", path, err.Error())
+	}
+	for typ, svrs := range servers {
+		for _, svr := range svrs {
+			svr.Type = typ
+			if err := validateServer(svr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return servers, nil
+}
+
+// normalize convert the maps with interface keys decoded by yaml decoder to
+// maps with string keys, which can be encoded by json
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case []map[string]interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = normalize(e)
+		}
+		return s
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+		return v
+	}
+	return v
+}
+
+// deriveServer register a server config with the server id from flags or
+// environment variables, which derived from the first server of the type,
+// so replicas can be started in containers without listing them in config
+func deriveServer() {
+	if env.serverId == "" || flags.serverType == "" {
+		return
+	}
+	if svr, err := cluster.Server(env.serverId); err == nil {
+		if svr.Type != flags.serverType {
+			log.Fatalf("server %s is type %s, not %s", env.serverId, svr.Type, flags.serverType)
+		}
+		return
+	}
+
+	for _, svr := range cluster.Servers() {
+		if svr.Type == flags.serverType {
+			derived := *svr
+			derived.Id = env.serverId
+			cluster.Register(&derived)
+			return
+		}
+	}
+	log.Fatalf("server %s not found, and no server of type %s to derive from", env.serverId, flags.serverType)
+}
+
+// overrideServer override the fields of server config with environment
+// variables, the name of variable is STARX_ with the upper case of json tag,
+// e.g. STARX_PORT=3250, STARX_IS_FRONTEND=true, id, type and listeners can
+// not be overridden
+func overrideServer(c *cluster.ServerConfig, lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "id" || tag == "type" {
+			continue
+		}
+		name := envPrefix + strings.ToUpper(tag)
+		s, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(s)
+		case reflect.Int:
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("%s should be an integer, got %q", name, s)
+			}
+			f.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("%s should be a boolean, got %q", name, s)
+			}
+			f.SetBool(b)
+		case reflect.Slice:
+			// comma separated list, e.g. STARX_DENY=10.0.0.1,10.1.0.0/16
+			if f.Type().Elem().Kind() == reflect.String {
+				var list []string
+				for _, item := range strings.Split(s, ",") {
+					if item = strings.TrimSpace(item); item != "" {
+						list = append(list, item)
+					}
+				}
+				f.Set(reflect.ValueOf(list))
+			}
+		}
+	}
+	if flags.port > 0 {
+		c.Port = flags.port
+	}
+	return nil
+}
+
+// validateServer check the server config, all problems are reported at once
+func validateServer(c *cluster.ServerConfig) error {
+	var problems []string
+	if c.Id == "" {
+		problems = append(problems, "id is required")
+	}
+	if c.Type == "" {
+		problems = append(problems, "type is required")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %d out of range", c.Port))
+	}
+	if c.AdminPort < 0 || c.AdminPort > 65535 {
+		problems = append(problems, fmt.Sprintf("admin_port %d out of range", c.AdminPort))
+	}
+	if c.RpcPort < 0 || c.RpcPort > 65535 {
+		problems = append(problems, fmt.Sprintf("rpc_port %d out of range", c.RpcPort))
+	}
+	if !c.IsFrontend && c.RpcPort > 0 {
+		problems = append(problems, "rpc_port only available for frontend server, backend server serves rpc on port")
+	}
+	if c.MaxConnections < 0 {
+		problems = append(problems, "max_connections should not be negative")
+	}
+	if !c.IsFrontend && len(c.Listeners) > 0 {
+		problems = append(problems, "listeners only available for frontend server")
+	}
+	for i, l := range c.Listeners {
+		if l.Port < 1 || l.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("port %d of listener %d out of range", l.Port, i))
+		} else if l.Port == c.Port && (l.Host == "" || l.Host == c.Host) {
+			problems = append(problems, fmt.Sprintf("port of listener %d conflicts with server port", i))
+		}
+		if (l.TLSCert == "") != (l.TLSKey == "") {
+			problems = append(problems, fmt.Sprintf("both tls_cert and tls_key of listener %d are required", i))
+		}
+	}
+
+	if _, err := parseCIDRs(c.Allow); err != nil {
+		problems = append(problems, "allow: "+err.Error())
+	}
+	if _, err := parseCIDRs(c.Deny); err != nil {
+		problems = append(problems, "deny: "+err.Error())
+	}
+	if _, err := parseCIDRs(c.RpcAllow); err != nil {
+		problems = append(problems, "rpc_allow: "+err.Error())
+	}
+	if _, err := parseCIDRs(c.RpcDeny); err != nil {
+		problems = append(problems, "rpc_deny: "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config of server %q: %s", c.Id, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package starx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "starx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestReadServers(t *testing.T) {
+	p := writeConfig(t, "servers.json", `{"gate": [{"id": "gate-1", "host": "127.0.0.1", "port": 3250, "is_frontend": true}]}`)
+	defer os.RemoveAll(filepath.Dir(p))
+
+	servers, err := readServers(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svr := servers["gate"][0]; svr.Id != "gate-1" || svr.Type != "gate" || !svr.IsFrontend {
+		t.Fatalf("unexpected server config: %s", svr)
+	}
+
+	p = writeConfig(t, "servers.yaml", `
+chat:
+  - id: chat-1
+    port: 3260
+    allow: [10.0.0.0/8]
+`)
+	defer os.RemoveAll(filepath.Dir(p))
+	if servers, err = readServers(p); err != nil {
+		t.Fatal(err)
+	}
+	if svr := servers["chat"][0]; svr.Id != "chat-1" || svr.Port != 3260 || len(svr.Allow) != 1 {
+		t.Fatalf("unexpected server config: %s", svr)
+	}
+
+	p = writeConfig(t, "servers.toml", `
+[[game]]
+id = "game-1"
+host = "127.0.0.1"
+port = 3270
+
+[[game]]
+id = "game-2"
+port = 3271
+`)
+	defer os.RemoveAll(filepath.Dir(p))
+	if servers, err = readServers(p); err != nil {
+		t.Fatal(err)
+	}
+	if svrs := servers["game"]; len(svrs) != 2 || svrs[0].Host != "127.0.0.1" || svrs[1].Id != "game-2" || svrs[1].Port != 3271 {
+		t.Fatalf("unexpected server configs: %v", svrs)
+	}
+
+	p = writeConfig(t, "servers.ini", "")
+	defer os.RemoveAll(filepath.Dir(p))
+	if _, err := readServers(p); err == nil || !strings.Contains(err.Error(), "unsupported config format") {
+		t.Fatalf("unsupported format should be reported, got: %v", err)
+	}
+}
+
+func TestOverrideServer(t *testing.T) {
+	vars := map[string]string{
+		"STARX_HOST":        "10.0.0.1",
+		"STARX_PORT":        "4000",
+		"STARX_IS_FRONTEND": "true",
+		"STARX_ID":          "ignored",
+		"STARX_DENY":        "10.0.0.2, 10.1.0.0/16",
+	}
+	lookup := func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	}
+
+	c := &cluster.ServerConfig{Id: "gate-1", Type: "gate", Port: 3250}
+	if err := overrideServer(c, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if c.Host != "10.0.0.1" || c.Port != 4000 || !c.IsFrontend || c.Id != "gate-1" {
+		t.Fatalf("unexpected server config: %s", c)
+	}
+	if !reflect.DeepEqual(c.Deny, []string{"10.0.0.2", "10.1.0.0/16"}) {
+		t.Fatalf("unexpected deny list: %v", c.Deny)
+	}
+
+	vars["STARX_PORT"] = "abc"
+	if err := overrideServer(c, lookup); err == nil || !strings.Contains(err.Error(), "STARX_PORT") {
+		t.Fatalf("invalid value should be reported, got: %v", err)
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	c := &cluster.ServerConfig{
+		Id:        "chat-1",
+		Type:      "chat",
+		Port:      70000,
+		Listeners: []*cluster.ListenerConfig{{Port: 3251}},
+		Deny:      []string{"10.0.0.0/33"},
+		RpcAllow:  []string{"internal"},
+	}
+	err := validateServer(c)
+	if err == nil {
+		t.Fatal("invalid config should be reported")
+	}
+	for _, s := range []string{"port 70000 out of range", "listeners only available for frontend server", "deny: invalid cidr", "rpc_allow: invalid ip address"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("problem %q should be reported, got: %s", s, err)
+		}
+	}
+
+	c.Port, c.IsFrontend, c.Deny, c.RpcAllow = 3250, true, []string{"10.0.0.0/8"}, []string{"10.0.0.0/8"}
+	if err := validateServer(c); err != nil {
+		t.Fatal(err)
+	}
+}
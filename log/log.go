@@ -6,8 +6,10 @@ import (
 	stdlog "log"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 type LogLevel byte
@@ -30,6 +32,9 @@ const (
 	LogFatal = "FATAL"
 )
 
+// levelTrace used internally to mark the trace log record
+const levelTrace = LevelClose
+
 var (
 	ErrWrongLogLevel = errors.New("log level not define")
 )
@@ -43,16 +48,70 @@ var names = []string{
 }
 
 func (l LogLevel) String() string {
+	if l < LevelDebug || l > LevelFatal {
+		return "UNKNOWN"
+	}
 	return names[l]
 }
 
+// Fields represents the contextual information attached to a log record,
+// e.g. session id, route, server id
+type Fields map[string]interface{}
+
+// Logger represents a leveled logger backend, which can be replaced by an
+// adapter of zap, logrus or other logging library via SetLogger, fields
+// may be nil when log record has no contextual information
+type Logger interface {
+	Debug(msg string, fields Fields)
+	Info(msg string, fields Fields)
+	Warn(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
 var (
-	logLevel LogLevel                                                     // log level
-	logger   *stdlog.Logger = stdlog.New(os.Stdout, "", stdlog.LstdFlags) // logger
+	logLevel int32                                                        // log level, accessed atomically
+	std      *stdlog.Logger = stdlog.New(os.Stdout, "", stdlog.LstdFlags) // standard output logger
+	logger   Logger         = &defaultLogger{}                            // logger backend
 )
 
+// defaultLogger is the default logger backend, which writes log record to
+// standard output
+type defaultLogger struct{}
+
+func (l *defaultLogger) Debug(msg string, fields Fields) { l.write(LogDebug, "", msg, fields) }
+func (l *defaultLogger) Info(msg string, fields Fields)  { l.write(LogInfo, "", msg, fields) }
+func (l *defaultLogger) Warn(msg string, fields Fields)  { l.write(LogWarn, "", msg, fields) }
+func (l *defaultLogger) Error(msg string, fields Fields) { l.write(LogError, "", msg, fields) }
+
+func (l *defaultLogger) write(level, site, msg string, fields Fields) {
+	if site == "" {
+		std.Printf("[%s] %s%s", level, msg, formatFields(fields))
+		return
+	}
+	std.Printf("[%s] [%s] %s%s", level, site, msg, formatFields(fields))
+}
+
+// format fields as ", key1=value1, key2=value2" ordered by key
+func formatFields(fields Fields) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := make([]string, 0, len(keys))
+	for _, k := range keys {
+		buf = append(buf, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+	return ", " + strings.Join(buf, ", ")
+}
+
 func logSite() string {
-	_, file, line, ok := runtime.Caller(3)
+	_, file, line, ok := runtime.Caller(4)
 	if !ok {
 		file = "???"
 		line = 0
@@ -61,126 +120,219 @@ func logSite() string {
 	return c
 }
 
-func writeLog(level string, v ...interface{}) {
-	logger.Printf(fmt.Sprintf("[%s] [%s] %s", level, logSite(), fmt.Sprint(v...)))
+// output dispatch log record to logger backend, must be called by exported
+// function directly, otherwise the log site will be wrong
+func output(level LogLevel, msg string, fields Fields) {
+	if l, ok := logger.(*defaultLogger); ok {
+		name := "Trace"
+		if level != levelTrace {
+			name = names[level]
+		}
+		l.write(name, logSite(), msg, fields)
+		return
+	}
+
+	switch level {
+	case LevelDebug:
+		logger.Debug(msg, fields)
+	case LevelInfo:
+		logger.Info(msg, fields)
+	case LevelWarn:
+		logger.Warn(msg, fields)
+	default:
+		logger.Error(msg, fields)
+	}
 }
 
-func writeLogf(level, format string, v ...interface{}) {
-	logger.Printf(fmt.Sprintf("[%s] [%s] %s", level, logSite(), format), v...)
+func writeLog(level LogLevel, fields Fields, v ...interface{}) {
+	output(level, fmt.Sprint(v...), fields)
+}
+
+func writeLogf(level LogLevel, fields Fields, format string, v ...interface{}) {
+	output(level, fmt.Sprintf(format, v...), fields)
+}
+
+func stack() string {
+	buf := make([]byte, 10000)
+	n := runtime.Stack(buf, false)
+	return string(buf[:n])
 }
 
 func Tracef(f string, v ...interface{}) {
-	if logLevel > LevelFatal {
+	if level() > LevelFatal {
 		return
 	}
-	buf := make([]byte, 10000)
-	n := runtime.Stack(buf, false)
-	buf = buf[:n]
-	v = append(v, string(buf))
-	writeLogf("Trace", f+"\n%s", v...)
+	v = append(v, stack())
+	writeLogf(levelTrace, nil, f+"\n%s", v...)
 }
 
 func Debugf(f string, v ...interface{}) {
-	if logLevel > LevelDebug {
+	if level() > LevelDebug {
 		return
 	}
-	writeLogf(LogDebug, f, v...)
+	writeLogf(LevelDebug, nil, f, v...)
 }
 
 func Infof(f string, v ...interface{}) {
-	if logLevel > LevelInfo {
+	if level() > LevelInfo {
 		return
 	}
-	writeLogf(LogInfo, f, v...)
+	writeLogf(LevelInfo, nil, f, v...)
 }
 
 func Warnf(f string, v ...interface{}) {
-	if logLevel > LevelWarn {
+	if level() > LevelWarn {
 		return
 	}
-	writeLogf(LogWarn, f, v...)
+	writeLogf(LevelWarn, nil, f, v...)
 }
 
 func Errorf(f string, v ...interface{}) {
-	if logLevel > LevelError {
+	if level() > LevelError {
 		return
 	}
-	writeLogf(LogError, f, v...)
+	writeLogf(LevelError, nil, f, v...)
 }
 
 func Fatalf(f string, v ...interface{}) {
-	if logLevel > LevelFatal {
+	if level() > LevelFatal {
 		return
 	}
-	writeLogf(LogFatal, f, v...)
+	writeLogf(LevelFatal, nil, f, v...)
 	os.Exit(-1)
 }
 
 func Trace(v ...interface{}) {
-	if logLevel > LevelFatal {
+	if level() > LevelFatal {
 		return
 	}
-	buf := make([]byte, 10000)
-	n := runtime.Stack(buf, false)
-	buf = buf[:n]
-	v = append(v, string(buf))
-	writeLogf("Trace", "%s\n%s", v...)
+	v = append(v, stack())
+	writeLogf(levelTrace, nil, "%s\n%s", v...)
 }
 
 func Debug(v ...interface{}) {
-	if logLevel > LevelDebug {
+	if level() > LevelDebug {
 		return
 	}
-	writeLog(LogDebug, v...)
+	writeLog(LevelDebug, nil, v...)
 }
 
 func Info(v ...interface{}) {
-	if logLevel > LevelInfo {
+	if level() > LevelInfo {
 		return
 	}
-	writeLog(LogInfo, v...)
+	writeLog(LevelInfo, nil, v...)
 }
 
 func Warn(f string, v ...interface{}) {
-	if logLevel > LevelWarn {
+	if level() > LevelWarn {
 		return
 	}
-	writeLog(LogWarn, v...)
+	writeLog(LevelWarn, nil, append([]interface{}{f}, v...)...)
 }
 
 func Error(v ...interface{}) {
-	if logLevel > LevelError {
+	if level() > LevelError {
 		return
 	}
-	writeLog(LogError, v...)
+	writeLog(LevelError, nil, v...)
 }
 
 func Fatal(v ...interface{}) {
-	if logLevel > LevelFatal {
+	if level() > LevelFatal {
 		return
 	}
-	writeLog(LogFatal, v...)
+	writeLog(LevelFatal, nil, v...)
 	os.Exit(-1)
 }
 
+// Entry represents a log record with contextual fields
+type Entry struct {
+	fields Fields
+}
+
+// WithFields returns an Entry, log records written by the entry will carry
+// the fields
+func WithFields(fields Fields) *Entry {
+	return &Entry{fields: fields}
+}
+
+// WithFields returns a new Entry which contains the fields of current entry
+// and the new fields
+func (e *Entry) WithFields(fields Fields) *Entry {
+	f := make(Fields, len(e.fields)+len(fields))
+	for k, v := range e.fields {
+		f[k] = v
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	return &Entry{fields: f}
+}
+
+func (e *Entry) Debugf(f string, v ...interface{}) {
+	if level() > LevelDebug {
+		return
+	}
+	writeLogf(LevelDebug, e.fields, f, v...)
+}
+
+func (e *Entry) Infof(f string, v ...interface{}) {
+	if level() > LevelInfo {
+		return
+	}
+	writeLogf(LevelInfo, e.fields, f, v...)
+}
+
+func (e *Entry) Warnf(f string, v ...interface{}) {
+	if level() > LevelWarn {
+		return
+	}
+	writeLogf(LevelWarn, e.fields, f, v...)
+}
+
+func (e *Entry) Errorf(f string, v ...interface{}) {
+	if level() > LevelError {
+		return
+	}
+	writeLogf(LevelError, e.fields, f, v...)
+}
+
+// SetLogger replace the logger backend, log level filter still works
+// before log record dispatch to the logger
+func SetLogger(l Logger) {
+	if l == nil {
+		l = &defaultLogger{}
+	}
+	logger = l
+}
+
+// level returns current log level
+func level() LogLevel {
+	return LogLevel(atomic.LoadInt32(&logLevel))
+}
+
+// SetLevel set the log level, records below the level are discarded, it's
+// safe to be called concurrently
 func SetLevel(l LogLevel) error {
-	if l < LevelDebug || l > LevelClose {
+	if l < LevelDebug || l > LevelFatal {
 		return ErrWrongLogLevel
 	}
-	logLevel = l
+	atomic.StoreInt32(&logLevel, int32(l))
 	return nil
 }
 
+// SetLevelByName set the log level by name case-insensitively, e.g. "debug"
 func SetLevelByName(n string) error {
-	for k, v := range names {
-		if v == strings.ToUpper(n) {
-			logLevel = LogLevel(k)
-			return nil
+	n = strings.ToUpper(n)
+	for l := LevelDebug; l <= LevelFatal; l++ {
+		if names[l] == n {
+			return SetLevel(l)
 		}
 	}
 	return ErrWrongLogLevel
 }
 
 func init() {
-	logLevel = LevelInfo
+	SetLevel(LevelInfo)
 }
@@ -57,8 +57,12 @@ func TestSetLevelByName(t *testing.T) {
 		t.Fail()
 	}
 
+	if err := SetLevelByName(""); err == nil {
+		t.Error("empty level name should be refused")
+	}
+
 	SetLevelByName("faTal")
-	if logLevel != LevelFatal {
+	if level() != LevelFatal {
 		t.Error("log level mismatch")
 		t.Fail()
 	}
@@ -106,7 +110,7 @@ func TestSetLevel(t *testing.T) {
 	}
 
 	SetLevel(LogLevel(4))
-	if logLevel != LevelError {
+	if level() != LevelError {
 		t.Error("log level mismatch")
 		t.Fail()
 	}
@@ -137,4 +141,52 @@ func TestLogLevel_String(t *testing.T) {
 		t.Errorf("wrong level string: %s", LevelInfo.String())
 		t.Fail()
 	}
+
+	if LogLevel(0).String() != "UNKNOWN" || LogLevel(255).String() != "UNKNOWN" {
+		t.Error("invalid level should be unknown")
+	}
+}
+
+type testLogger struct {
+	level  string
+	msg    string
+	fields Fields
+}
+
+func (l *testLogger) record(level, msg string, fields Fields) {
+	l.level, l.msg, l.fields = level, msg, fields
+}
+
+func (l *testLogger) Debug(msg string, fields Fields) { l.record(LogDebug, msg, fields) }
+func (l *testLogger) Info(msg string, fields Fields)  { l.record(LogInfo, msg, fields) }
+func (l *testLogger) Warn(msg string, fields Fields)  { l.record(LogWarn, msg, fields) }
+func (l *testLogger) Error(msg string, fields Fields) { l.record(LogError, msg, fields) }
+
+func TestSetLogger(t *testing.T) {
+	l := &testLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+	SetLevel(LevelInfo)
+
+	Infof("hello %s", "world")
+	if l.level != LogInfo || l.msg != "hello world" || l.fields != nil {
+		t.Errorf("wrong log record: %+v", l)
+	}
+
+	WithFields(Fields{"sid": 1}).WithFields(Fields{"route": "Test.Route"}).Errorf("failed")
+	if l.level != LogError || l.msg != "failed" || l.fields["sid"] != 1 || l.fields["route"] != "Test.Route" {
+		t.Errorf("wrong log record: %+v", l)
+	}
+
+	l.msg = ""
+	Debugf("filtered")
+	if l.msg != "" {
+		t.Error("debug log should be filtered")
+	}
+}
+
+func TestFormatFields(t *testing.T) {
+	if s := formatFields(Fields{"route": "A.B", "sid": 1}); s != ", route=A.B, sid=1" {
+		t.Errorf("wrong fields format: %s", s)
+	}
 }
@@ -0,0 +1,68 @@
+package message
+
+import "errors"
+
+// Batch format carries multiple encoded messages in one data packet, the
+// first byte is the batch flag which never be a valid message flag, and
+// each message is prefixed with 3 bytes length(big end):
+//
+// -<flag>-|--<length>--|-<message>-|--<length>--|-<message>-|...
+// --------|------------|-----------|------------|-----------|
+const (
+	BatchFlag         = 0x80
+	batchLengthSize   = 3
+	maxBatchedMessage = 1<<24 - 1
+)
+
+var (
+	ErrInvalidBatch    = errors.New("invalid batch")
+	ErrMessageTooLarge = errors.New("message too large to be batched")
+)
+
+// IsBatch reports whether the packet data is a batch of messages
+func IsBatch(data []byte) bool {
+	return len(data) > 0 && data[0] == BatchFlag
+}
+
+// EncodeBatch join the encoded messages into a batch
+func EncodeBatch(msgs [][]byte) ([]byte, error) {
+	size := 1
+	for _, m := range msgs {
+		if len(m) > maxBatchedMessage {
+			return nil, ErrMessageTooLarge
+		}
+		size += batchLengthSize + len(m)
+	}
+
+	buf := make([]byte, 0, size)
+	buf = append(buf, BatchFlag)
+	for _, m := range msgs {
+		n := len(m)
+		buf = append(buf, byte(n>>16), byte(n>>8), byte(n))
+		buf = append(buf, m...)
+	}
+	return buf, nil
+}
+
+// SplitBatch split the batch into encoded messages, which can be decoded by
+// Decode, messages share the underlying array with data
+func SplitBatch(data []byte) ([][]byte, error) {
+	if !IsBatch(data) {
+		return nil, ErrInvalidBatch
+	}
+
+	var msgs [][]byte
+	for offset := 1; offset < len(data); {
+		if offset+batchLengthSize > len(data) {
+			return nil, ErrInvalidBatch
+		}
+		n := int(data[offset])<<16 | int(data[offset+1])<<8 | int(data[offset+2])
+		offset += batchLengthSize
+		if offset+n > len(data) {
+			return nil, ErrInvalidBatch
+		}
+		msgs = append(msgs, data[offset:offset+n:offset+n])
+		offset += n
+	}
+	return msgs, nil
+}
@@ -0,0 +1,48 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	var msgs [][]byte
+	for _, m := range []*Message{
+		{Type: Push, Route: "room.move", Data: []byte(`{"x":1}`)},
+		{Type: Push, Route: "room.chat", Data: []byte(`hello`)},
+		{Type: Response, ID: 10, Data: []byte{}},
+	} {
+		em, err := m.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, em)
+	}
+
+	data, err := EncodeBatch(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsBatch(data) {
+		t.Fatal("should be a batch")
+	}
+	if IsBatch(msgs[0]) {
+		t.Fatal("message should not be a batch")
+	}
+
+	split, err := SplitBatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(split, msgs) {
+		t.Fatalf("messages not equal: %v, %v", split, msgs)
+	}
+	m, err := Decode(split[1])
+	if err != nil || m.Route != "room.chat" || string(m.Data) != "hello" {
+		t.Fatalf("unexpected message: %+v, %v", m, err)
+	}
+
+	if _, err := SplitBatch(data[:len(data)-1]); err != ErrInvalidBatch {
+		t.Fatalf("expect ErrInvalidBatch, got %v", err)
+	}
+}
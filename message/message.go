@@ -20,6 +20,8 @@ const (
 
 const (
 	msgRouteCompressMask = 0x01
+	msgDataCompressMask  = 0x10
+	msgErrorMask         = 0x20
 	msgTypeMask          = 0x07
 	msgRouteLengthMask   = 0xFF
 	msgHeadLength        = 0x03
@@ -44,11 +46,13 @@ var (
 )
 
 type Message struct {
-	Type       MessageType
-	ID         uint
-	Route      string
-	Data       []byte
-	compressed bool
+	Type           MessageType
+	ID             uint
+	Route          string
+	Data           []byte
+	DataCompressed bool // whether the data has been compressed
+	Error          bool // whether the data is an error envelope, only for response
+	compressed     bool
 }
 
 func New() *Message {
@@ -56,11 +60,12 @@ func New() *Message {
 }
 
 func (m *Message) String() string {
-	return fmt.Sprintf("Type: %s, ID: %d, Route: %s, Compressed: %t, BodyLength: %d",
+	return fmt.Sprintf("Type: %s, ID: %d, Route: %s, Compressed: %t, DataCompressed: %t, BodyLength: %d",
 		types[m.Type],
 		m.ID,
 		m.Route,
 		m.compressed,
+		m.DataCompressed,
 		len(m.Data))
 }
 
@@ -87,7 +92,16 @@ func invalidType(t MessageType) bool {
 // response |----010-|<message id>
 // push     |----011-|<route>
 // The figure above indicates that the bit does not affect the type of message.
+// The 5th bit of flag field indicates whether the data has been compressed,
+// and the 6th bit indicates whether the data of response is an error envelope.
 func Encode(m *Message) ([]byte, error) {
+	return EncodeWithDict(m, routeDict)
+}
+
+// EncodeWithDict encode message with the route dictionary which maps route to
+// code, instead of the dictionary set by SetDict, it's used by clients which
+// receive the dictionary in handshake
+func EncodeWithDict(m *Message, dict map[string]uint16) ([]byte, error) {
 	if invalidType(m.Type) {
 		log.Errorf("wrong message type")
 		return nil, ErrWrongMessageType
@@ -96,10 +110,16 @@ func Encode(m *Message) ([]byte, error) {
 	buf := make([]byte, 0)
 	flag := byte(m.Type) << 1
 
-	code, compressed := routeDict[m.Route]
+	code, compressed := dict[m.Route]
 	if compressed {
 		flag |= msgRouteCompressMask
 	}
+	if m.DataCompressed {
+		flag |= msgDataCompressMask
+	}
+	if m.Error {
+		flag |= msgErrorMask
+	}
 	buf = append(buf, flag)
 
 	if m.Type == Request || m.Type == Response {
@@ -132,17 +152,26 @@ func Encode(m *Message) ([]byte, error) {
 }
 
 func Decode(data []byte) (*Message, error) {
+	return DecodeWithDict(data, codeDict)
+}
+
+// DecodeWithDict decode message with the route dictionary which maps code to
+// route, instead of the dictionary set by SetDict
+func DecodeWithDict(data []byte, dict map[uint16]string) (*Message, error) {
 	if len(data) <= msgHeadLength {
 		log.Infof("invalid message")
 		return nil, ErrInvalidMessage
 	}
-	m := New()
+	m := Alloc()
 	flag := data[0]
 	offset := 1
 	m.Type = MessageType((flag >> 1) & msgTypeMask)
+	m.DataCompressed = flag&msgDataCompressMask == msgDataCompressMask
+	m.Error = flag&msgErrorMask == msgErrorMask
 
 	if invalidType(m.Type) {
 		log.Errorf("wrong message type")
+		Free(m)
 		return nil, ErrWrongMessageType
 	}
 
@@ -166,9 +195,10 @@ func Decode(data []byte) (*Message, error) {
 		if flag&msgRouteCompressMask == 1 {
 			m.compressed = true
 			code := binary.BigEndian.Uint16(data[offset:(offset + 2)])
-			route, ok := codeDict[code]
+			route, ok := dict[code]
 			if !ok {
 				log.Errorf("message compressed, but can not find route infomation in dictionary")
+				Free(m)
 				return nil, ErrRouteInfoNotFound
 			}
 			m.Route = route
@@ -206,3 +236,12 @@ func SetDict(dict map[string]uint16) {
 		codeDict[code] = r
 	}
 }
+
+// Dict return a copy of current route dictionary, which maps route to code
+func Dict() map[string]uint16 {
+	dict := make(map[string]uint16, len(routeDict))
+	for route, code := range routeDict {
+		dict[route] = code
+	}
+	return dict
+}
@@ -162,3 +162,88 @@ func TestEncode(t *testing.T) {
 		t.Error("not equal")
 	}
 }
+
+func TestDict(t *testing.T) {
+	dict := map[string]uint16{
+		"test.dict.test1": 1001,
+		"test.dict.test2": 1002,
+	}
+	SetDict(dict)
+
+	d := Dict()
+	for route, code := range dict {
+		if d[route] != code {
+			t.Errorf("route: %s, expect code: %d, got: %d", route, code, d[route])
+		}
+	}
+
+	// modify the copy should not affect the dictionary
+	d["test.dict.test3"] = 1003
+	if _, ok := routeDict["test.dict.test3"]; ok {
+		t.Error("dictionary should not be modified by copy")
+	}
+}
+
+func TestEncodeDataCompressed(t *testing.T) {
+	m := &Message{
+		Type:           Push,
+		Route:          "test.compress.test",
+		Data:           []byte(`hello world`),
+		DataCompressed: true,
+	}
+	em, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := Decode(em)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(m, dm) {
+		t.Error("not equal")
+	}
+}
+
+func TestEncodeWithDict(t *testing.T) {
+	m := &Message{
+		Type:       Push,
+		Route:      "chat.Room.onMessage",
+		Data:       []byte(`hello world`),
+		compressed: true,
+	}
+	em, err := EncodeWithDict(m, map[string]uint16{"chat.Room.onMessage": 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(em); err != ErrRouteInfoNotFound {
+		t.Fatalf("expect ErrRouteInfoNotFound, got %v", err)
+	}
+	dm, err := DecodeWithDict(em, map[uint16]string{1000: "chat.Room.onMessage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, dm) {
+		t.Fatalf("not equal: %v", dm)
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	m := &Message{
+		Type:  Response,
+		ID:    100,
+		Data:  []byte(`{"code":404,"msg":"not found"}`),
+		Error: true,
+	}
+	em, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := Decode(em)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, dm) {
+		t.Fatalf("not equal: %v", dm)
+	}
+}
@@ -0,0 +1,25 @@
+package message
+
+import "sync"
+
+var pool = sync.Pool{
+	New: func() interface{} { return &Message{} },
+}
+
+// Alloc returns an empty message from pool, messages returned by Decode are
+// allocated by Alloc
+func Alloc() *Message {
+	return pool.Get().(*Message)
+}
+
+// Free reset the message and put it back to pool, the message must not be
+// used after freed. Server frees inbound messages once the handlers returned,
+// so handlers should never keep the message, and copy the data of message if
+// it would be kept, e.g. by a goroutine
+func Free(m *Message) {
+	if m == nil {
+		return
+	}
+	*m = Message{}
+	pool.Put(m)
+}
@@ -0,0 +1,57 @@
+package message
+
+import "testing"
+
+func TestFree(t *testing.T) {
+	em, err := Encode(&Message{Type: Request, ID: 1, Route: "test.test.test", Data: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Decode(em)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := m.Data
+	Free(m)
+	if m.Type != 0 || m.ID != 0 || m.Route != "" || m.Data != nil {
+		t.Fatalf("message should be reset when freed: %v", m)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("data should not be modified: %s", data)
+	}
+	Free(nil)
+}
+
+func benchmarkMessage(b *testing.B) []byte {
+	em, err := Encode(&Message{Type: Request, ID: 100, Route: "chat.Room.Message", Data: make([]byte, 100)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return em
+}
+
+func BenchmarkDecode(b *testing.B) {
+	em := benchmarkMessage(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(em); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeFree(b *testing.B) {
+	em := benchmarkMessage(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m, err := Decode(em)
+		if err != nil {
+			b.Fatal(err)
+		}
+		Free(m)
+	}
+}
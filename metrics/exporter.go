@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const namespace = "starx"
+
+// Handler returns a http.Handler which exports all metrics in Prometheus
+// text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteTo(w)
+	})
+}
+
+// WriteTo writes all metrics to w in Prometheus text exposition format
+func WriteTo(w io.Writer) error {
+	s := Stats()
+	bw := bufio.NewWriter(w)
+
+	writeMetric(bw, "sessions", "gauge", "Current connected sessions.", float64(s.Sessions))
+	writeMetric(bw, "packets_received_total", "counter", "Packets received from clients.", float64(s.PacketsReceived))
+	writeMetric(bw, "packets_sent_total", "counter", "Packets sent to clients.", float64(s.PacketsSent))
+	writeMetric(bw, "packets_dropped_total", "counter", "Outbound packets dropped under backpressure.", float64(s.PacketsDropped))
+	writeMetric(bw, "bytes_received_total", "counter", "Bytes received from clients.", float64(s.BytesReceived))
+	writeMetric(bw, "bytes_sent_total", "counter", "Bytes sent to clients.", float64(s.BytesSent))
+	writeMetric(bw, "rpc_errors_total", "counter", "RPC calls failed.", float64(s.RPCErrors))
+	writeMetric(bw, "rpc_retries_total", "counter", "RPC calls retried on another server.", float64(s.RPCRetries))
+	writeMetric(bw, "slow_handlers_total", "counter", "Handler calls running longer than the slow threshold.", float64(s.SlowHandlers))
+
+	names := make([]string, 0, len(s.Routes))
+	for name := range s.Routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		writeHeader(bw, "route_calls_total", "counter", "Handler calls of route.")
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s_route_calls_total{route=%q} %d\n", namespace, name, s.Routes[name].Calls)
+		}
+
+		writeHeader(bw, "route_errors_total", "counter", "Handler calls of route which returned error.")
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s_route_errors_total{route=%q} %d\n", namespace, name, s.Routes[name].Errors)
+		}
+
+		writeHeader(bw, "route_duration_seconds", "histogram", "Handler latency of route.")
+		for _, name := range names {
+			h := s.Routes[name].Latency
+			for i, le := range h.Buckets {
+				fmt.Fprintf(bw, "%s_route_duration_seconds_bucket{route=%q,le=%q} %d\n", namespace, name, formatFloat(le), h.Counts[i])
+			}
+			fmt.Fprintf(bw, "%s_route_duration_seconds_sum{route=%q} %s\n", namespace, name, formatFloat(h.Sum))
+			fmt.Fprintf(bw, "%s_route_duration_seconds_count{route=%q} %d\n", namespace, name, h.Count)
+		}
+	}
+
+	gaugeFuncsLock.RLock()
+	gauges := make([]string, 0, len(gaugeFuncs))
+	for name := range gaugeFuncs {
+		gauges = append(gauges, name)
+	}
+	sort.Strings(gauges)
+	for _, name := range gauges {
+		writeMetric(bw, name, "gauge", gaugeFuncs[name].help, s.Gauges[name])
+	}
+	gaugeFuncsLock.RUnlock()
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n", namespace, name, help)
+	fmt.Fprintf(w, "# TYPE %s_%s %s\n", namespace, name, typ)
+}
+
+func writeMetric(w io.Writer, name, typ, help string, v float64) {
+	writeHeader(w, name, typ, help)
+	fmt.Fprintf(w, "%s_%s %s\n", namespace, name, formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,232 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// default latency buckets in seconds
+var defaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+type Counter struct {
+	v int64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.v, 1)
+}
+
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.v, n)
+}
+
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.v)
+}
+
+type Gauge struct {
+	v int64
+}
+
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.v, 1)
+}
+
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.v, -1)
+}
+
+func (g *Gauge) Set(n int64) {
+	atomic.StoreInt64(&g.v, n)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.v)
+}
+
+// Histogram counts observations in configurable buckets, bucket counts are
+// not cumulative, they will be accumulated when exported
+type Histogram struct {
+	sync.Mutex
+	buckets []float64 // upper bounds of buckets
+	counts  []uint64  // the last one is +Inf bucket
+	sum     float64
+	count   uint64
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{
+		buckets: b,
+		counts:  make([]uint64, len(b)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// HistogramSnapshot represents the state of a histogram at a moment,
+// bucket counts are cumulative
+type HistogramSnapshot struct {
+	Buckets []float64 // upper bounds, the last one is +Inf
+	Counts  []uint64  // cumulative count of each bucket
+	Sum     float64
+	Count   uint64
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.Lock()
+	defer h.Unlock()
+
+	s := HistogramSnapshot{
+		Buckets: append(append([]float64(nil), h.buckets...), math.Inf(1)),
+		Counts:  make([]uint64, len(h.counts)),
+		Sum:     h.sum,
+		Count:   h.count,
+	}
+	var acc uint64
+	for i, c := range h.counts {
+		acc += c
+		s.Counts[i] = acc
+	}
+	return s
+}
+
+// routeStat represents call statistics of a route
+type routeStat struct {
+	calls   Counter
+	errors  Counter
+	latency *Histogram
+}
+
+// gaugeFunc represents a gauge whose value is computed when collected
+type gaugeFunc struct {
+	help string
+	fn   func() float64
+}
+
+var (
+	Sessions        Gauge   // current connected sessions
+	PacketsReceived Counter // packets received from clients
+	PacketsSent     Counter // packets sent to clients
+	PacketsDropped  Counter // outbound packets dropped under backpressure
+	BytesReceived   Counter // bytes received from clients
+	BytesSent       Counter // bytes sent to clients
+	RPCErrors       Counter // rpc calls failed
+	RPCRetries      Counter // rpc calls retried on another server
+	SlowHandlers    Counter // handler calls running longer than the slow threshold
+
+	routesLock sync.RWMutex
+	routes     = make(map[string]*routeStat)
+
+	gaugeFuncsLock sync.RWMutex
+	gaugeFuncs     = make(map[string]*gaugeFunc)
+)
+
+func route(name string) *routeStat {
+	routesLock.RLock()
+	r, ok := routes[name]
+	routesLock.RUnlock()
+	if ok {
+		return r
+	}
+
+	routesLock.Lock()
+	defer routesLock.Unlock()
+
+	if r, ok = routes[name]; ok {
+		return r
+	}
+	r = &routeStat{latency: NewHistogram(defaultBuckets)}
+	routes[name] = r
+	return r
+}
+
+// ObserveRoute record a call of the route, failed indicates whether the
+// handler returned an error
+func ObserveRoute(name string, d time.Duration, failed bool) {
+	r := route(name)
+	r.calls.Inc()
+	if failed {
+		r.errors.Inc()
+	}
+	r.latency.Observe(d.Seconds())
+}
+
+// RegisterGaugeFunc register a gauge whose value will be computed by fn when
+// collected, e.g. queue depths, name should be unique, the last one wins
+func RegisterGaugeFunc(name, help string, fn func() float64) {
+	gaugeFuncsLock.Lock()
+	defer gaugeFuncsLock.Unlock()
+
+	gaugeFuncs[name] = &gaugeFunc{help: help, fn: fn}
+}
+
+// RouteSnapshot represents call statistics of a route at a moment
+type RouteSnapshot struct {
+	Calls   int64
+	Errors  int64
+	Latency HistogramSnapshot
+}
+
+// Snapshot represents all metrics at a moment
+type Snapshot struct {
+	Sessions        int64
+	PacketsReceived int64
+	PacketsSent     int64
+	PacketsDropped  int64
+	BytesReceived   int64
+	BytesSent       int64
+	RPCErrors       int64
+	RPCRetries      int64
+	SlowHandlers    int64
+	Routes          map[string]RouteSnapshot
+	Gauges          map[string]float64
+}
+
+// Stats returns the snapshot of all metrics
+func Stats() *Snapshot {
+	s := &Snapshot{
+		Sessions:        Sessions.Value(),
+		PacketsReceived: PacketsReceived.Value(),
+		PacketsSent:     PacketsSent.Value(),
+		PacketsDropped:  PacketsDropped.Value(),
+		BytesReceived:   BytesReceived.Value(),
+		BytesSent:       BytesSent.Value(),
+		RPCErrors:       RPCErrors.Value(),
+		RPCRetries:      RPCRetries.Value(),
+		SlowHandlers:    SlowHandlers.Value(),
+		Routes:          make(map[string]RouteSnapshot),
+		Gauges:          make(map[string]float64),
+	}
+
+	routesLock.RLock()
+	for name, r := range routes {
+		s.Routes[name] = RouteSnapshot{
+			Calls:   r.calls.Value(),
+			Errors:  r.errors.Value(),
+			Latency: r.latency.Snapshot(),
+		}
+	}
+	routesLock.RUnlock()
+
+	gaugeFuncsLock.RLock()
+	for name, g := range gaugeFuncs {
+		s.Gauges[name] = g.fn()
+	}
+	gaugeFuncsLock.RUnlock()
+
+	return s
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h := NewHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 7, 20} {
+		h.Observe(v)
+	}
+
+	s := h.Snapshot()
+	expect := []uint64{2, 3, 4, 5}
+	for i, c := range expect {
+		if s.Counts[i] != c {
+			t.Errorf("bucket %d, expect: %d, got: %d", i, c, s.Counts[i])
+		}
+	}
+	if s.Count != 5 || s.Sum != 31.5 {
+		t.Errorf("wrong count or sum, count: %d, sum: %f", s.Count, s.Sum)
+	}
+}
+
+func TestObserveRoute(t *testing.T) {
+	ObserveRoute("Test.Observe", time.Millisecond, false)
+	ObserveRoute("Test.Observe", time.Millisecond, true)
+
+	r := Stats().Routes["Test.Observe"]
+	if r.Calls != 2 || r.Errors != 1 || r.Latency.Count != 2 {
+		t.Errorf("wrong route stats: %+v", r)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	Sessions.Set(3)
+	ObserveRoute("Test.Write", time.Millisecond, false)
+	RegisterGaugeFunc("queue_depth", "Test queue depth.", func() float64 { return 10 })
+
+	buf := bytes.NewBuffer(nil)
+	if err := WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, line := range []string{
+		"starx_sessions 3",
+		`starx_route_calls_total{route="Test.Write"} 1`,
+		`starx_route_duration_seconds_bucket{route="Test.Write",le="+Inf"} 1`,
+		"starx_queue_depth 10",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output should contain: %s", line)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strconv"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+const migrateSessionRoute = "__Session.Migrate"
+
+// peerMigrateRoute is requested over the rpc mesh to pull the state of session
+// from the frontend server where the client connected before
+var peerMigrateRoute = &route.Route{Service: "__Session", Method: "Migrate"}
+
+// sessionSnapshot represents the state of a session which can be transferred
+// between frontend servers
+type sessionSnapshot struct {
+	Uid      int64
+	Data     map[string]interface{}
+	Groups   []string // names of groups that session belongs to
+	Channels []string // names of channels that session subscribed
+}
+
+// ExportSession export the state of the session, includes bound uid, session
+// data, groups and channels, so the session can be resumed in another frontend
+// server by ImportSession after client reconnected, session data should be gob
+// encodable, custom types in session data need to be registered by gob.Register.
+// The exported state can be transferred by application, e.g. store it with
+// a reconnect token in database, or pulled by MigrateSession
+func ExportSession(sid int64) ([]byte, error) {
+	s, err := transporter.Session(sid)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotOf(s)
+}
+
+// ImportSession restore the state exported by ExportSession to the session,
+// the session will rejoin the groups and channels with the same names in
+// current server, it should be called in logic goroutine, e.g. in a handler
+func ImportSession(sid int64, state []byte) error {
+	s, err := transporter.Session(sid)
+	if err != nil {
+		return err
+	}
+	return restoreSnapshot(s, state)
+}
+
+// MigrateSession pull the state of session fromSid from the frontend server
+// svrId where the client connected before, and import it to the session sid,
+// the session in svrId is closed with session.CloseMigrated after exported.
+// svrId should serve rpc, see cluster.ServerConfig.RpcPort, it should be
+// called in logic goroutine, e.g. in a handler
+func MigrateSession(sid int64, svrId string, fromSid int64) error {
+	s, err := transporter.Session(sid)
+	if err != nil {
+		return err
+	}
+	state, err := cluster.CallServer(context.Background(), svrId, peerMigrateRoute, strconv.AppendInt(nil, fromSid, 10))
+	if err != nil {
+		return err
+	}
+	return restoreSnapshot(s, state)
+}
+
+// migrateToPeer export the session requested by peer, and close it since
+// the client has been reconnected to the peer, the session may have been
+// suspended for resuming when the client disconnected. It's a peer route,
+// which is never served to the requests routed by clients
+func migrateToPeer(data []byte) ([]byte, error) {
+	sid, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	s, err := transporter.Session(sid)
+	if err != nil {
+		return nil, err
+	}
+	state, err := snapshotOf(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e := s.Entity.(type) {
+	case *agent:
+		e.Invoke(func() { e.close(false, session.CloseMigrated) })
+	case *suspendedEntity:
+		if resumes.remove(e) {
+			e.timer.Stop()
+			transporter.closeSession(s, session.CloseMigrated)
+		}
+	}
+	return state, nil
+}
+
+func snapshotOf(s *session.Session) ([]byte, error) {
+	snapshot := &sessionSnapshot{
+		Uid:  s.Uid,
+		Data: s.State(),
+	}
+	if s.Uid > 0 {
+		snapshot.Groups = groupsOf(s.Uid)
+		snapshot.Channels = channelsOf(s.Uid)
+	}
+
+	buf := bytes.NewBuffer([]byte(nil))
+	if err := gob.NewEncoder(buf).Encode(snapshot); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func restoreSnapshot(s *session.Session, state []byte) error {
+	snapshot := &sessionSnapshot{}
+	if err := gob.NewDecoder(bytes.NewReader(state)).Decode(snapshot); err != nil {
+		return err
+	}
+
+	if snapshot.Uid > 0 {
+		if err := s.Bind(snapshot.Uid); err != nil {
+			return err
+		}
+	}
+	if snapshot.Data == nil {
+		snapshot.Data = make(map[string]interface{})
+	}
+	s.Restore(snapshot.Data)
+
+	for _, n := range snapshot.Groups {
+		g, ok := groupByName(n)
+		if !ok {
+			sessionLogger(s).Warnf("group %s not found, skip rejoining", n)
+			continue
+		}
+		rejoin(g, s)
+	}
+	for _, n := range snapshot.Channels {
+		c, ok := channelByName(n)
+		if !ok {
+			sessionLogger(s).Warnf("channel %s not found, skip resubscribing", n)
+			continue
+		}
+		// replace the stale session
+		c.Leave(s.Uid)
+		c.Add(s)
+	}
+	return nil
+}
+
+func rejoin(g *Group, s *session.Session) {
+	if g.IsContain(s.Uid) {
+		// replace the stale session
+		g.Leave(s.Uid)
+	}
+	if err := g.Add(s); err != nil {
+		log.Error(err.Error())
+	}
+}
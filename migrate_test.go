@@ -0,0 +1,131 @@
+package starx
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/session"
+)
+
+func TestExportImportSession(t *testing.T) {
+	g := NewGroup("migrate")
+	defer g.Close()
+	ch := newChannel("migrate")
+	defer ch.Destroy()
+
+	c1, _ := net.Pipe()
+	a1 := transporter.createAgent(c1)
+	defer a1.Close()
+	a1.session.Bind(3000)
+	a1.session.Set("level", 10)
+	g.Add(a1.session)
+	ch.Add(a1.session)
+
+	state, err := ExportSession(a1.session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, _ := net.Pipe()
+	a2 := transporter.createAgent(c2)
+	defer a2.Close()
+	if err := ImportSession(a2.session.ID, state); err != nil {
+		t.Fatal(err)
+	}
+
+	s := a2.session
+	if s.Uid != 3000 || s.Int("level") != 10 {
+		t.Fatalf("session state should be imported, uid=%d, data=%v", s.Uid, s.State())
+	}
+	if g.Member(3000) != s {
+		t.Fatal("session should rejoin the group")
+	}
+	if ch.Member(3000) != s || ch.Count() != 1 {
+		t.Fatal("session should resubscribe the channel")
+	}
+
+	if err := ImportSession(a2.session.ID, []byte("invalid")); err == nil {
+		t.Fatal("invalid state should be refused")
+	}
+	if _, err := ExportSession(-1); err != ErrSessionNotFound {
+		t.Fatalf("expect ErrSessionNotFound, got: %v", err)
+	}
+}
+
+func TestMigrateSession(t *testing.T) {
+	cluster.SetAppConfig(app.config)
+
+	// the previous frontend server serves rpc in current process
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serve(l, remote.handle, acceptRPCConn)
+
+	cluster.Register(&cluster.ServerConfig{Type: "migrate-gate", Id: "migrate-gate-1", Host: "127.0.0.1", Port: 1, IsFrontend: true, RpcPort: l.Addr().(*net.TCPAddr).Port})
+	defer cluster.RemoveServer("migrate-gate-1")
+
+	c1, _ := net.Pipe()
+	a1 := transporter.createAgent(c1)
+	a1.session.Bind(3100)
+	a1.session.Set("level", 20)
+
+	c2, _ := net.Pipe()
+	a2 := transporter.createAgent(c2)
+	defer a2.Close()
+	if err := MigrateSession(a2.session.ID, "migrate-gate-1", a1.session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s := a2.session; s.Uid != 3100 || s.Int("level") != 20 {
+		t.Fatalf("session state should be migrated, uid=%d, data=%v", s.Uid, s.State())
+	}
+
+	(<-a1.tasks)()
+	if a1.session.CloseReason != session.CloseMigrated {
+		t.Fatalf("previous session should be closed, reason=%s", a1.session.CloseReason)
+	}
+
+	if err := MigrateSession(a2.session.ID, "migrate-gate-1", -1); err == nil {
+		t.Fatal("migrating unknown session should fail")
+	}
+}
+
+func TestMigrateRouteFromClient(t *testing.T) {
+	c1, _ := net.Pipe()
+	a1 := transporter.createAgent(c1)
+	defer a1.Close()
+	a1.session.Bind(3200)
+
+	// clients route the internal route through frontend
+	c2, _ := net.Pipe()
+	a2 := newAgent(c2)
+	defer a2.Close()
+	sid := []byte(strconv.FormatInt(a1.session.ID, 10))
+	handler.processMessage(a2.session, &message.Message{Type: message.Request, ID: 1, Route: "gate.__Session.Migrate", Data: sid})
+	if e := exposeError(t, a2); e.Code != CodeForbidden {
+		t.Fatalf("migrate route should be forbidden to clients, got %+v", e)
+	}
+
+	// session requests forwarded by frontend are not peer requests
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+	go remote.processRequest(ac, &rpc.Request{ServiceMethod: migrateSessionRoute, Sid: 100, Kind: rpc.Sys, Data: sid})
+	if resp := readResponse(t, peer); resp.Error == "" || len(resp.Data) > 0 {
+		t.Fatalf("migrate route should be served to peers only, got %+v", resp)
+	}
+
+	select {
+	case <-a1.tasks:
+		t.Fatal("session should not be closed")
+	default:
+	}
+	if a1.session.CloseReason != session.CloseUnknown {
+		t.Fatalf("session should not be migrated, reason=%s", a1.session.CloseReason)
+	}
+}
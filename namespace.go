@@ -0,0 +1,104 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/route"
+)
+
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// namespaces isolate the services of games or shards hosted by a cluster,
+// a component registered in namespace serves the routes prefixed with the
+// namespace only, e.g. tenant.Service.Method
+var namespaces = struct {
+	sync.RWMutex
+	names map[string]bool                // all namespaces registered
+	comps map[component.Component]string // namespace of components
+}{
+	names: make(map[string]bool),
+	comps: make(map[component.Component]string),
+}
+
+func validNamespace(ns string) bool {
+	return strings.TrimSpace(ns) != "" && !strings.Contains(ns, ".")
+}
+
+func addNamespace(ns string, c component.Component) {
+	namespaces.Lock()
+	defer namespaces.Unlock()
+
+	namespaces.names[ns] = true
+	namespaces.comps[c] = ns
+}
+
+func removeComponentNamespace(c component.Component) {
+	namespaces.Lock()
+	defer namespaces.Unlock()
+
+	delete(namespaces.comps, c)
+}
+
+func isNamespace(ns string) bool {
+	namespaces.RLock()
+	defer namespaces.RUnlock()
+
+	return namespaces.names[ns]
+}
+
+// namespaceOf returns the namespace of component, empty for the default one
+func namespaceOf(c component.Component) string {
+	namespaces.RLock()
+	defer namespaces.RUnlock()
+
+	return namespaces.comps[c]
+}
+
+// resolveNamespace takes the first segment of three-segment route as the
+// namespace if it's registered, e.g. tenant.Service.Method, which is routed
+// to the current server type
+func resolveNamespace(r *route.Route) {
+	if r.Namespace != "" || r.ServerType == "" || !isNamespace(r.ServerType) {
+		return
+	}
+	r.Namespace, r.ServerType = r.ServerType, ""
+}
+
+// qualifiedName returns the service name prefixed with namespace
+func qualifiedName(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+	return ns + "." + name
+}
+
+// splitNamespace split the qualified service name into namespace and name
+func splitNamespace(name string) (string, string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
@@ -0,0 +1,130 @@
+package starx
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/metrics"
+	"github.com/lonnng/starx/serialize/json"
+	"github.com/lonnng/starx/session"
+)
+
+type NamespaceComp struct {
+	component.Base
+	ns   string
+	hits chan string
+}
+
+func (c *NamespaceComp) Hit(s *session.Session, m *JsonMessage) error {
+	c.hits <- c.ns
+	return nil
+}
+
+func TestNamespace(t *testing.T) {
+	SetSerializer(json.NewSerializer())
+	hits := make(chan string, 10)
+	for _, ns := range []string{"tenant1", "tenant2"} {
+		c := &NamespaceComp{ns: ns, hits: hits}
+		addNamespace(ns, c)
+		if err := handler.registerIn(ns, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		handler.unregister("tenant1.NamespaceComp")
+		handler.unregister("tenant2.NamespaceComp")
+	}()
+
+	// services of namespaces are not registered in the default namespace
+	if _, ok := handler.service("NamespaceComp"); ok {
+		t.Fatal("service of namespace should be isolated")
+	}
+
+	process := func(r string) {
+		msg := message.New()
+		msg.Type = message.Notify
+		msg.Route = r
+		msg.Data = []byte(`{"code":1}`)
+		handler.processMessage(session.New(nil), msg)
+	}
+
+	for _, c := range []struct{ route, ns string }{
+		{"tenant1.NamespaceComp.Hit", "tenant1"},
+		{"tenant2.NamespaceComp.Hit", "tenant2"},
+		{"tenant2.test.NamespaceComp.Hit", "tenant2"},
+	} {
+		process(c.route)
+		select {
+		case ns := <-hits:
+			if ns != c.ns {
+				t.Fatalf("route %s: expect handled in %s, got %s", c.route, c.ns, ns)
+			}
+		default:
+			t.Fatalf("route %s should be handled", c.route)
+		}
+	}
+
+	// metrics of routes are recorded per namespace
+	routes := metrics.Stats().Routes
+	if routes["tenant1.NamespaceComp.Hit"].Calls != 1 || routes["tenant2.NamespaceComp.Hit"].Calls != 2 {
+		t.Fatalf("unexpected route metrics: %+v", routes)
+	}
+
+	if _, err := handler.unregister("tenant1.NamespaceComp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := handler.serviceIn("tenant2", "NamespaceComp"); !ok {
+		t.Fatal("services of other namespaces should not be unregistered")
+	}
+}
+
+func TestNamespaceGroup(t *testing.T) {
+	g1, g2 := NewNamespaceGroup("tenant1", "room"), NewNamespaceGroup("tenant2", "room")
+	defer g1.Close()
+	defer g2.Close()
+
+	s := session.New(nil)
+	s.Uid = 9001
+	if err := g1.Add(s); err != nil {
+		t.Fatal(err)
+	}
+	if g2.IsContain(9001) {
+		t.Fatal("groups of different namespaces should be isolated")
+	}
+	if g, ok := groupByName("tenant1.room"); !ok || g != g1 {
+		t.Fatal("group should be registered with qualified name")
+	}
+}
+
+func TestRegisterNamespace(t *testing.T) {
+	for _, ns := range []string{"", " ", "a.b"} {
+		if err := RegisterNamespace(ns, &NamespaceComp{}); err != ErrInvalidNamespace {
+			t.Fatalf("namespace %q: expect ErrInvalidNamespace, got %v", ns, err)
+		}
+	}
+}
+
+func TestRemoteNamespace(t *testing.T) {
+	c := &ContextComp{}
+	if err := remote.registerIn("tenant1", c); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.unregister("tenant1.ContextComp")
+
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	go remote.processRequest(ac, &rpc.Request{ServiceMethod: "test.ContextComp.Handle", Sid: 102, Kind: rpc.Sys})
+	if resp := readResponse(t, peer); resp.ErrorCode != CodeNotFound || c.session != nil {
+		t.Fatalf("service of namespace should not serve default routes, code=%d", resp.ErrorCode)
+	}
+
+	go remote.processRequest(ac, &rpc.Request{ServiceMethod: "tenant1.test.ContextComp.Handle", Sid: 102, Kind: rpc.Sys})
+	if resp := readResponse(t, peer); resp.Error != "" || c.session == nil {
+		t.Fatalf("request of namespace should be handled, error=%s", resp.Error)
+	}
+}
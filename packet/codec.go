@@ -0,0 +1,39 @@
+package packet
+
+import "io"
+
+// Codec represents the wire protocol of packets, which makes it possible to
+// interoperate with clients that speak a different protocol
+type Codec interface {
+	// Encode packet to wire format
+	Encode(p *Packet) ([]byte, error)
+
+	// NewDecoder returns a decoder which reads packets from the stream
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder reads packets from a stream
+type Decoder interface {
+	// Decode read the next packet, it blocks until a whole packet received
+	Decode() (*Packet, error)
+}
+
+// Limiter is implemented by the decoders which refuse the packets longer than
+// the limit by the length in header, before the data of packet buffered
+type Limiter interface {
+	// SetLimit set the maximum length of packet data, unlimited if zero
+	SetLimit(n int)
+}
+
+// DefaultCodec is the codec of pomelo binary protocol
+var DefaultCodec Codec = defaultCodec{}
+
+type defaultCodec struct{}
+
+func (defaultCodec) Encode(p *Packet) ([]byte, error) {
+	return Pack(p)
+}
+
+func (defaultCodec) NewDecoder(r io.Reader) Decoder {
+	return NewDecoder(r)
+}
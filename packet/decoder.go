@@ -0,0 +1,87 @@
+package packet
+
+import "io"
+
+const chunkSize = 4096 // size of buffer chunk to read from stream
+
+// decoder reads packets from a stream, e.g. a network connection. Data is
+// read into a buffer chunk, and packet data is sliced from the chunk without
+// copy, a new chunk will be allocated when current chunk is full, only the
+// truncated packet would be copied to the new chunk. Chunks are never reused,
+// so data of packets returned by decoder are safe to be held by caller, the
+// packets are allocated from pool and owned by caller, see Free
+type decoder struct {
+	r          io.Reader
+	buf        []byte // current chunk
+	start, end int    // buf[start:end] is the data not decoded
+	err        error  // error returned by last read
+	limit      int    // maximum length of packet data, unlimited if zero
+}
+
+// NewDecoder returns a decoder of pomelo binary protocol
+func NewDecoder(r io.Reader) Decoder {
+	return &decoder{r: r}
+}
+
+// SetLimit set the maximum length of packet data, ErrPacketTooLarge will be
+// returned once a longer packet header read, unlimited if zero
+func (d *decoder) SetLimit(n int) {
+	d.limit = n
+}
+
+// Decode read the next packet from stream, it blocks until a whole packet
+// received, io.EOF returned only if stream ended at packet boundary
+func (d *decoder) Decode() (*Packet, error) {
+	for {
+		if n := d.end - d.start; n >= HeadLength {
+			h := d.buf[d.start:d.end]
+			t := PacketType(h[0])
+			if t < Handshake || t > Kick {
+				return nil, ErrWrongPacketType
+			}
+
+			length := bytesToInt(h[1:HeadLength])
+			if d.limit > 0 && length > d.limit {
+				return nil, ErrPacketTooLarge
+			}
+			size := HeadLength + length
+			if n >= size {
+				p := Alloc()
+				p.Type = t
+				p.Length = length
+				p.Data = h[HeadLength:size:size]
+				d.start += size
+				return p, nil
+			}
+			d.grow(size)
+		} else {
+			d.grow(HeadLength)
+		}
+
+		if d.err != nil {
+			if d.err == io.EOF && d.end > d.start {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, d.err
+		}
+
+		n, err := d.r.Read(d.buf[d.end:])
+		d.end += n
+		d.err = err
+	}
+}
+
+// grow make sure that current chunk has enough room for a packet of size
+func (d *decoder) grow(size int) {
+	if len(d.buf)-d.start >= size {
+		return
+	}
+
+	n := chunkSize
+	if size > n {
+		n = size
+	}
+	buf := make([]byte, n)
+	d.end = copy(buf, d.buf[d.start:d.end])
+	d.buf, d.start = buf, 0
+}
@@ -0,0 +1,118 @@
+package packet
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	p1 := &Packet{Type: Handshake, Data: []byte("hello world")}
+	p2 := &Packet{Type: Heartbeat, Data: []byte{}}
+	p3 := &Packet{Type: Data, Data: bytes.Repeat([]byte("x"), 10000)}
+
+	var buf bytes.Buffer
+	for _, p := range []*Packet{p1, p2, p3} {
+		b, err := p.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(b)
+	}
+
+	d := NewDecoder(&buf)
+	var decoded []*Packet
+	for range []*Packet{p1, p2, p3} {
+		p, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, p)
+	}
+	// packets should not be overwritten by later decoding
+	if !reflect.DeepEqual(decoded, []*Packet{p1, p2, p3}) {
+		t.Fatalf("unexpected packets: %v", decoded)
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+
+	d = NewDecoder(bytes.NewReader([]byte{0x06, 0x00, 0x00, 0x00}))
+	if _, err := d.Decode(); err != ErrWrongPacketType {
+		t.Fatalf("expect ErrWrongPacketType, got %v", err)
+	}
+
+	// truncated packet
+	d = NewDecoder(bytes.NewReader([]byte{Data, 0x00, 0x00, 0x05, 0x01}))
+	if _, err := d.Decode(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+// 10k data packets, which are read in chunks of 2048 bytes as network reads
+func benchmarkStream(b *testing.B) []byte {
+	data, _ := Pack(&Packet{Type: Data, Data: bytes.Repeat([]byte("x"), 100)})
+	return bytes.Repeat(data, 10000)
+}
+
+func BenchmarkUnpack(b *testing.B) {
+	stream := benchmarkStream(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := bytes.NewReader(stream)
+		tmp := make([]byte, 0)
+		buf := make([]byte, 2048)
+		for {
+			n, err := r.Read(buf)
+			if err != nil {
+				break
+			}
+			tmp = append(tmp, buf[:n]...)
+			for len(tmp) >= HeadLength {
+				var p *Packet
+				if p, tmp, err = Unpack(tmp); err != nil || p == nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	stream := benchmarkStream(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(bytes.NewReader(stream))
+		for {
+			if _, err := d.Decode(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func TestDecoderLimit(t *testing.T) {
+	b, err := (&Packet{Type: Data, Data: bytes.Repeat([]byte("x"), 100)}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the header is read before the packet refused
+	r := bytes.NewReader(b)
+	d := NewDecoder(io.LimitReader(r, HeadLength))
+	d.(Limiter).SetLimit(99)
+	if _, err := d.Decode(); err != ErrPacketTooLarge {
+		t.Fatalf("expect ErrPacketTooLarge, got %v", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(b))
+	d.(Limiter).SetLimit(100)
+	if p, err := d.Decode(); err != nil || len(p.Data) != 100 {
+		t.Fatalf("packet within limit should be decoded, err=%v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package json
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/lonnng/starx/packet"
+)
+
+// maxLength is the maximum length of a frame
+const maxLength = 16 << 20
+
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// frame represents a packet in json format, data field will be encoded
+// as base64 string
+type frame struct {
+	Type packet.PacketType `json:"type"`
+	Data []byte            `json:"data,omitempty"`
+}
+
+// Codec is a plain length-prefixed json protocol, every packet is encoded
+// as a json object prefixed with 4 bytes length(big end)
+type Codec struct{}
+
+func NewCodec() *Codec {
+	return &Codec{}
+}
+
+func (c *Codec) Encode(p *packet.Packet) ([]byte, error) {
+	if p.Type < packet.Handshake || p.Type > packet.Kick {
+		return nil, packet.ErrWrongPacketType
+	}
+
+	data, err := json.Marshal(&frame{Type: p.Type, Data: p.Data})
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	return buf, nil
+}
+
+func (c *Codec) NewDecoder(r io.Reader) packet.Decoder {
+	return &decoder{r: r}
+}
+
+type decoder struct {
+	r      io.Reader
+	header [4]byte
+}
+
+func (d *decoder) Decode() (*packet.Packet, error) {
+	if _, err := io.ReadFull(d.r, d.header[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(d.header[:])
+	if length > maxLength {
+		return nil, ErrFrameTooLarge
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return nil, err
+	}
+
+	f := &frame{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+	if f.Type < packet.Handshake || f.Type > packet.Kick {
+		return nil, packet.ErrWrongPacketType
+	}
+	p := packet.Alloc()
+	p.Type, p.Length, p.Data = f.Type, len(f.Data), f.Data
+	return p, nil
+}
@@ -0,0 +1,38 @@
+package json
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestCodec(t *testing.T) {
+	c := NewCodec()
+	p := &packet.Packet{Type: packet.Data, Length: 11, Data: []byte("hello world")}
+
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		data, err := c.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+	}
+
+	d := c.NewDecoder(&buf)
+	for i := 0; i < 2; i++ {
+		p1, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p, p1) {
+			t.Fatalf("expect %v, got %v", p, p1)
+		}
+	}
+
+	if _, err := c.Encode(&packet.Packet{Type: packet.PacketType(6)}); err != packet.ErrWrongPacketType {
+		t.Fatalf("expect ErrWrongPacketType, got %v", err)
+	}
+}
@@ -19,7 +19,10 @@ const (
 
 const HeadLength = 4
 
-var ErrWrongPacketType = errors.New("wrong packet type")
+var (
+	ErrWrongPacketType = errors.New("wrong packet type")
+	ErrPacketTooLarge  = errors.New("packet too large")
+)
 
 type Packet struct {
 	Type   PacketType
@@ -0,0 +1,26 @@
+package packet
+
+import "sync"
+
+var pool = sync.Pool{
+	New: func() interface{} { return &Packet{} },
+}
+
+// Alloc returns an empty packet from pool, decoders allocate packets by Alloc
+// so the packets can be recycled by Free after processed
+func Alloc() *Packet {
+	return pool.Get().(*Packet)
+}
+
+// Free reset the packet and put it back to pool. The owner of packet, who
+// received it from a decoder, should call Free only when nobody else refers
+// to the packet, it must not be used after freed. The data of packet is never
+// reused, but it may share buffer with other packets, so copy the data if it
+// would be kept for a long time
+func Free(p *Packet) {
+	if p == nil {
+		return
+	}
+	*p = Packet{}
+	pool.Put(p)
+}
@@ -0,0 +1,41 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFree(t *testing.T) {
+	p := Alloc()
+	p.Type, p.Length, p.Data = Data, 5, []byte("hello")
+	data := p.Data
+	Free(p)
+
+	if p.Type != 0 || p.Length != 0 || p.Data != nil {
+		t.Fatalf("packet should be reset when freed: %v", p)
+	}
+	// data of packet is never reused
+	if string(data) != "hello" {
+		t.Fatalf("data should not be modified: %s", data)
+	}
+	Free(nil)
+}
+
+// BenchmarkDecoderFree decodes the stream as BenchmarkDecoder, the packets
+// are freed after processed as the server does
+func BenchmarkDecoderFree(b *testing.B) {
+	stream := benchmarkStream(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(bytes.NewReader(stream))
+		for {
+			p, err := d.Decode()
+			if err != nil {
+				break
+			}
+			Free(p)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/store"
+)
+
+// persistence snapshot the sessions to session store on change, keyed by the
+// resume token, so the settings can be restored after frontend restarted
+var persistence = newPersistService()
+
+type persistOp struct {
+	key  string
+	data []byte // nil means delete
+}
+
+type persistService struct {
+	store store.SessionStore
+	queue chan persistOp // operations are serialized to keep ordering
+}
+
+func newPersistService() *persistService {
+	p := &persistService{}
+	session.OnChanged(p.save)
+	transporter.sessionClosedCallback(func(s *session.Session) {
+		// snapshots of sessions drained on graceful restart are kept for
+		// restoring in the new process
+		if token := tokenOf(s); token != "" && !upgrader.isUpgrading() {
+			p.remove(token)
+		}
+	})
+	return p
+}
+
+func (p *persistService) setStore(s store.SessionStore) {
+	p.store = s
+	if p.queue == nil {
+		p.queue = make(chan persistOp, packetBufferSize)
+		go p.run()
+	}
+}
+
+func (p *persistService) enabled() bool {
+	return p.store != nil
+}
+
+func (p *persistService) run() {
+	for op := range p.queue {
+		var err error
+		if op.data == nil {
+			err = p.store.Delete(op.key)
+		} else {
+			err = p.store.Save(op.key, op.data)
+		}
+		if err != nil {
+			log.Errorf("session store error: %s", err.Error())
+		}
+	}
+}
+
+// save the snapshot of frontend session which has been issued a resume token
+func (p *persistService) save(s *session.Session) {
+	if p.store == nil {
+		return
+	}
+	token := tokenOf(s)
+	if token == "" {
+		return
+	}
+
+	data, err := snapshotOf(s)
+	if err != nil {
+		sessionLogger(s).Errorf("snapshot session error: %s", err.Error())
+		return
+	}
+	p.queue <- persistOp{key: token, data: data}
+}
+
+func (p *persistService) remove(token string) {
+	if p.store == nil {
+		return
+	}
+	p.queue <- persistOp{key: token}
+}
+
+// restore the session settings stored with the token, returns false if not
+// found, the snapshot will be removed since the token can be used only once
+func (p *persistService) restore(s *session.Session, token string) bool {
+	if p.store == nil {
+		return false
+	}
+
+	data, err := p.store.Load(token)
+	if err != nil {
+		if err != store.ErrNotFound {
+			sessionLogger(s).Errorf("load session error: %s", err.Error())
+		}
+		return false
+	}
+	p.remove(token)
+
+	if err := restoreSnapshot(s, data); err != nil {
+		sessionLogger(s).Errorf("restore session error: %s", err.Error())
+		return false
+	}
+	return true
+}
+
+// tokenOf returns the resume token of frontend session
+func tokenOf(s *session.Session) string {
+	switch e := s.Entity.(type) {
+	case *agent:
+		return e.token
+	case *suspendedEntity:
+		return e.token
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package starx
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/store"
+)
+
+type memStore struct {
+	sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memStore) Save(key string, data []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	m.data[key] = data
+	return nil
+}
+
+func (m *memStore) Load(key string) ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	data, ok := m.data[key]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *memStore) Delete(key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+func (m *memStore) has(key string) bool {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.data[key]
+	return ok
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition not satisfied in time")
+}
+
+func TestSessionStoreRestore(t *testing.T) {
+	m := &memStore{data: make(map[string][]byte)}
+	SetSessionStore(m)
+	defer func() { persistence.store = nil }()
+
+	c1, _ := net.Pipe()
+	a1 := transporter.createAgent(c1)
+	resp, _ := resumeHandshake(t, a1, "")
+	token := resumeToken(resp)
+	a1.session.Bind(9000)
+	a1.session.Set("level", 20)
+
+	// server restarted, the session lost without closing
+	transporter.sessions.Delete(a1.session)
+	a1.token = ""
+	waitFor(t, func() bool { return m.has(token) })
+
+	c2, _ := net.Pipe()
+	a2 := transporter.createAgent(c2)
+	defer a2.Close()
+	resp, _ = resumeHandshake(t, a2, token)
+	if a2.session.Uid != 9000 || a2.session.Int("level") != 20 {
+		t.Fatalf("session settings should be restored, uid=%d, data=%v", a2.session.Uid, a2.session.State())
+	}
+
+	newToken := resumeToken(resp)
+	waitFor(t, func() bool { return !m.has(token) && m.has(newToken) })
+
+	a2.Close()
+	waitFor(t, func() bool { return !m.has(newToken) })
+}
@@ -0,0 +1,57 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/session"
+)
+
+// Client types declared by clients in handshake as `sys.type`, other types
+// are accepted as well
+const (
+	ClientNative = "native"
+	ClientWeb    = "web"
+	ClientBot    = "bot"
+)
+
+// OutboundHook transform the data of messages sent to the clients of a client
+// type, e.g. translate json to protobuf for native clients, and returns the
+// data to be sent. The data may be shared with messages sent to other
+// sessions, so it should not be modified in place
+type OutboundHook func(s *session.Session, m *message.Message) ([]byte, error)
+
+// PipelineFunc process the raw message bytes of session, the returned bytes
+// will be passed to the next function in pipeline
+type PipelineFunc func(s *session.Session, data []byte) ([]byte, error)
+
+type pipeline []PipelineFunc
+
+// process the data through all functions in order, abort when any error
+func (p pipeline) process(s *session.Session, data []byte) ([]byte, error) {
+	var err error
+	for _, fn := range p {
+		if data, err = fn(s, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
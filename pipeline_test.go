@@ -0,0 +1,52 @@
+package starx
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
+)
+
+func xor(s *session.Session, data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ 0x5a
+	}
+	return out, nil
+}
+
+func TestPipeline(t *testing.T) {
+	PipelineOutbound(xor)
+	defer func() { env.inbound, env.outbound = nil, nil }()
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	a.status = statusWorking
+	defer a.Close()
+
+	m := &message.Message{Type: message.Push, Route: "onPipeline", Data: []byte("hello")}
+	data, err := transporter.packMessage(a.session, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, _ := packet.Unpack(data)
+	em, _ := message.Encode(m)
+	if out, _ := xor(nil, p.Data); !bytes.Equal(out, em) {
+		t.Fatal("outbound pipeline should process encoded message")
+	}
+
+	var received []byte
+	PipelineInbound(xor)
+	PipelineInbound(func(s *session.Session, data []byte) ([]byte, error) {
+		received = data
+		return nil, errors.New("drop")
+	})
+	handler.processPacket(a, p)
+	if !bytes.Equal(received, em) {
+		t.Fatal("inbound pipeline should be processed in order")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"time"
+
+	"github.com/lonnng/starx/metrics"
+)
+
+// Priority represents the priority of outbound messages, the writer of
+// session drains higher priority queue first
+type Priority byte
+
+const (
+	PriorityNormal Priority = iota // default priority
+	PriorityHigh                   // realtime messages, e.g. movement
+	PriorityLow                    // messages can be delayed or dropped under backpressure, e.g. mail notifications
+)
+
+var priorityNames = []string{
+	PriorityNormal: "Normal",
+	PriorityHigh:   "High",
+	PriorityLow:    "Low",
+}
+
+func (p Priority) String() string {
+	if int(p) < len(priorityNames) {
+		return priorityNames[p]
+	}
+	return "Unknown"
+}
+
+// sendPriority put the packet to the queue of priority, packets of low
+// priority will be dropped when the low priority queue is full
+func (a *agent) sendPriority(data []byte, p Priority) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = ErrSendChannelClosed
+		}
+	}()
+
+	if a.status >= statusClosed {
+		return ErrSendChannelClosed
+	}
+
+	switch p {
+	case PriorityHigh:
+		a.highBuffer <- data
+	case PriorityLow:
+		if env.egress != nil && env.egress.policy == ThrottleDropLow && a.isThrottled() {
+			metrics.PacketsDropped.Inc()
+			sessionLogger(a.session).Debugf("session throttled by egress limit, packet dropped")
+			return nil
+		}
+		select {
+		case a.lowBuffer <- data:
+		default:
+			metrics.PacketsDropped.Inc()
+			sessionLogger(a.session).Debugf("low priority queue full, packet dropped")
+		}
+	default:
+		a.sendBuffer <- data
+	}
+	return nil
+}
+
+// next returns the next outbound packet, packets of higher priority first,
+// flushed is true when the flush timer fired before any packet available,
+// ok is false when the agent closed
+func (a *agent) next(flush <-chan time.Time) (data []byte, ok, flushed bool) {
+	select {
+	case data, ok = <-a.highBuffer:
+		return
+	default:
+	}
+
+	select {
+	case data, ok = <-a.highBuffer:
+		return
+	case data, ok = <-a.sendBuffer:
+		return
+	default:
+	}
+
+	select {
+	case data, ok = <-a.highBuffer:
+	case data, ok = <-a.sendBuffer:
+	case data, ok = <-a.lowBuffer:
+	case <-flush:
+		return nil, true, true
+	}
+	return
+}
+
+// queued returns the number of outbound packets in all queues
+func (a *agent) queued() int {
+	return len(a.highBuffer) + len(a.sendBuffer) + len(a.lowBuffer)
+}
@@ -0,0 +1,45 @@
+package starx
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/metrics"
+)
+
+func TestAgentWritePriority(t *testing.T) {
+	c, peer := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+
+	a.sendPriority([]byte("mail"), PriorityLow)
+	a.sendPriority([]byte("chat"), PriorityNormal)
+	a.sendPriority([]byte("move"), PriorityHigh)
+	go a.write()
+
+	buf := make([]byte, 64)
+	n, err := peer.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], []byte("movechatmail")) {
+		t.Fatalf("packets should be written by priority, got: %s", buf[:n])
+	}
+}
+
+func TestAgentDropLowPriority(t *testing.T) {
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+
+	dropped := metrics.PacketsDropped.Value()
+	for i := 0; i < cap(a.lowBuffer)+1; i++ {
+		if err := a.sendPriority([]byte("mail"), PriorityLow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if metrics.PacketsDropped.Value() != dropped+1 {
+		t.Fatal("low priority packet should be dropped when queue full")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/serialize/protobuf"
+)
+
+// protos holds the message schemas sent to client in handshake as `sys.protos`
+type protos struct {
+	Version string                 `json:"version"`
+	Server  map[string]interface{} `json:"server,omitempty"` // schemas of messages pushed by server
+	Client  map[string]interface{} `json:"client,omitempty"` // schemas of messages sent by client
+}
+
+// sys returns the protos sent in handshake, schemas will be omitted when
+// client has the same version
+func (p *protos) sys(version string) *protos {
+	if version == p.Version {
+		return &protos{Version: p.Version}
+	}
+	return p
+}
+
+// buildProtos generate schemas of handler arguments which are protobuf
+// messages, and merge them with user-define schemas, schemas only available
+// when protobuf serializer used
+func (hs *handlerService) buildProtos() {
+	if _, ok := serializer.(*protobuf.Serializer); !ok {
+		hs.protos = nil
+		return
+	}
+
+	p := &protos{
+		Server: make(map[string]interface{}),
+		Client: make(map[string]interface{}),
+	}
+	for r, s := range env.serverProtos {
+		p.Server[r] = s
+	}
+
+	hs.RLock()
+	for sname, s := range hs.serviceMap {
+		for mname, h := range s.HandlerMethods {
+			if h.Raw {
+				continue
+			}
+			v, ok := reflect.New(h.Type.Elem()).Interface().(proto.Message)
+			if !ok {
+				continue
+			}
+			if schema, err := protobuf.Schema(v); err == nil {
+				p.Client[sname+"."+mname] = schema
+			}
+		}
+	}
+	hs.RUnlock()
+
+	for r, s := range env.clientProtos {
+		p.Client[r] = s
+	}
+
+	if len(p.Server) == 0 && len(p.Client) == 0 {
+		hs.protos = nil
+		return
+	}
+
+	// map keys are sorted by encoding/json, so the version is stable
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Errorf("build protos error: %s", err.Error())
+		return
+	}
+	sum := md5.Sum(data)
+	p.Version = hex.EncodeToString(sum[:])
+	hs.protos = p
+}
@@ -0,0 +1,119 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+
+	"github.com/lonnng/starx/ratelimit"
+	"github.com/lonnng/starx/route"
+)
+
+var ErrRateLimited = errors.New("message rate limit exceeded")
+
+// rateLimit represents the token bucket settings of a route
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// withRateLimit returns a copy of limits with the limit of key set, limits
+// are never modified in place since they are read without lock held
+func withRateLimit(limits map[string]rateLimit, key string, l rateLimit) map[string]rateLimit {
+	m := make(map[string]rateLimit, len(limits)+1)
+	for k, v := range limits {
+		m[k] = v
+	}
+	m[key] = l
+	return m
+}
+
+// limiterKey returns the key of limiter of the server type, which never
+// conflicts with routes
+func limiterKey(svrType string) string {
+	return "@" + svrType
+}
+
+// routeServerType returns the server type which serves the route of client
+// message, current server type if route has no server type
+func routeServerType(r string) string {
+	rt, err := route.Decode(r)
+	if err != nil {
+		return ""
+	}
+	resolveNamespace(rt)
+	if rt.ServerType == "" {
+		return app.config.Type
+	}
+	return rt.ServerType
+}
+
+// allow check whether the message of route exceeds the rate limit of current
+// session, the global limit, the limit of server type which the route served
+// by and the limit of route will be checked. only be called in logic goroutine
+func (a *agent) allow(route string) bool {
+	reloadLock.RLock()
+	limits, typeLimits, version := env.rateLimits, env.serverRateLimits, limitsVersion
+	reloadLock.RUnlock()
+
+	if len(limits) == 0 && len(typeLimits) == 0 {
+		return true
+	}
+
+	// rebuild limiters after rate limits reloaded
+	if a.limiters == nil || a.limitsVersion != version {
+		a.limiters = make(map[string]*ratelimit.Bucket)
+		a.limitsVersion = version
+	}
+
+	type limit struct {
+		key string
+		rateLimit
+	}
+	checks := make([]limit, 0, 3)
+	if l, ok := limits[""]; ok {
+		checks = append(checks, limit{"", l})
+	}
+	if len(typeLimits) > 0 {
+		svrType := routeServerType(route)
+		if l, ok := typeLimits[svrType]; ok {
+			checks = append(checks, limit{limiterKey(svrType), l})
+		}
+	}
+	if l, ok := limits[route]; ok && route != "" {
+		checks = append(checks, limit{route, l})
+	}
+
+	for _, l := range checks {
+		b, ok := a.limiters[l.key]
+		if !ok {
+			b = ratelimit.NewBucket(l.rate, l.burst)
+			a.limiters[l.key] = b
+		}
+		if !b.Allow() {
+			if env.rateLimitedCb != nil {
+				env.rateLimitedCb(a.session, route)
+			}
+			return false
+		}
+	}
+	return true
+}
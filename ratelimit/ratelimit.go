@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket, tokens are added at rate per second, and
+// the bucket can hold burst tokens at most
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64   // tokens added per second
+	burst  float64   // capacity of bucket
+	tokens float64   // available tokens
+	last   time.Time // last time tokens were taken
+}
+
+// NewBucket create a full bucket, burst will be at least 1
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow take a token from the bucket, returns false if no token available
+func (b *Bucket) Allow() bool {
+	return b.take(time.Now())
+}
+
+func (b *Bucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Take n tokens from the bucket, the bucket may go into debt if tokens not
+// enough, returns the duration to wait until the debt paid off, e.g. to
+// throttle bytes larger than burst
+func (b *Bucket) Take(n int) time.Duration {
+	return b.takeN(time.Now(), n)
+}
+
+func (b *Bucket) takeN(now time.Time, n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// refill add tokens elapsed since last time, mu should be held
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	b := NewBucket(5, 2)
+	now := b.last
+
+	if !b.take(now) || !b.take(now) {
+		t.Fatal("burst tokens should be available")
+	}
+	if b.take(now) {
+		t.Fatal("bucket should be empty")
+	}
+
+	// 200ms adds one token at 5/sec
+	now = now.Add(200 * time.Millisecond)
+	if !b.take(now) {
+		t.Fatal("token should be refilled")
+	}
+	if b.take(now) {
+		t.Fatal("bucket should be empty")
+	}
+
+	// refill never exceeds burst
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 2; i++ {
+		if !b.take(now) {
+			t.Fatal("burst tokens should be available")
+		}
+	}
+	if b.take(now) {
+		t.Fatal("tokens should not exceed burst")
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	b := NewBucket(1000, 500)
+	now := b.last
+
+	if d := b.takeN(now, 400); d != 0 {
+		t.Fatalf("burst tokens should be available, got %v", d)
+	}
+
+	// 300 tokens in debt, paid off in 300ms at 1000/sec
+	if d := b.takeN(now, 400); d != 300*time.Millisecond {
+		t.Fatalf("expect 300ms, got %v", d)
+	}
+	now = now.Add(300 * time.Millisecond)
+	if d := b.takeN(now, 0); d != 0 {
+		t.Fatalf("debt should be paid off, got %v", d)
+	}
+}
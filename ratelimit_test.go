@@ -0,0 +1,83 @@
+package starx
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
+)
+
+func TestAgentAllow(t *testing.T) {
+	SetRateLimit("", 0, 3)
+	SetRateLimit("Chat.Send", 0, 1)
+	defer func() {
+		env.rateLimits = nil
+		env.rateLimitedCb = nil
+	}()
+
+	var violated []string
+	OnRateLimited(func(s *session.Session, route string) {
+		violated = append(violated, route)
+	})
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+
+	if !a.allow("Chat.Send") {
+		t.Fatal("first message should be allowed")
+	}
+	if a.allow("Chat.Send") {
+		t.Fatal("route rate limit should be exceeded")
+	}
+	if !a.allow("Chat.Join") {
+		t.Fatal("other routes should be allowed")
+	}
+	if a.allow("Chat.Join") {
+		t.Fatal("global rate limit should be exceeded")
+	}
+
+	if len(violated) != 2 || violated[0] != "Chat.Send" || violated[1] != "Chat.Join" {
+		t.Fatalf("unexpected violations: %v", violated)
+	}
+}
+
+func TestAgentAllowServerType(t *testing.T) {
+	SetServerRateLimit("chat", 0, 1)
+	SetServerRateLimit("test", 0, 1)
+	defer func() { env.serverRateLimits = nil }()
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+
+	if !a.allow("chat.Room.Send") || a.allow("chat.Room.Join") {
+		t.Fatal("messages routed to chat should share the limit")
+	}
+	if !a.allow("game.Room.Join") {
+		t.Fatal("other server types should be allowed")
+	}
+	if !a.allow("Room.Join") || a.allow("Room.Leave") {
+		t.Fatal("routes without server type should be limited by current server type")
+	}
+}
+
+func TestRateLimitedRequest(t *testing.T) {
+	SetRateLimit("Chat.Send", 0, 1)
+	defer func() { env.rateLimits = nil }()
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer a.Close()
+	a.status = statusWorking
+	a.allow("Chat.Send")
+
+	data, err := message.Encode(&message.Message{Type: message.Request, ID: 7, Route: "Chat.Send", Data: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.processPacket(a, &packet.Packet{Type: packet.Data, Data: data})
+	if e := exposeError(t, a); e.Code != CodeTooManyRequests {
+		t.Fatalf("rate limited request should be refused, got %+v", e)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/record"
+	"github.com/lonnng/starx/session"
+)
+
+var ErrReplayCall = errors.New("remote call not available in replay")
+
+// recordMessage write the inbound message to recording, messages replayed
+// or injected by debug console are not recorded
+func recordMessage(s *session.Session, m *message.Message) {
+	switch s.Entity.(type) {
+	case *replayEntity, *consoleEntity:
+		return
+	}
+	err := env.recorder.Record(&record.Record{
+		Time:  time.Now().UnixNano(),
+		Sid:   s.ID,
+		Uid:   s.Uid,
+		Type:  m.Type,
+		ID:    m.ID,
+		Route: m.Route,
+		Data:  m.Data,
+	})
+	if err != nil {
+		sessionLogger(s).Errorf("record message error: %s", err.Error())
+	}
+}
+
+func closeRecorder() {
+	if env.recorder == nil {
+		return
+	}
+	if err := env.recorder.Close(); err != nil {
+		log.Errorf("close recorder error: %s", err.Error())
+	}
+}
+
+// replay feed the records to handlers in order, the interval between records
+// is divided by speed, and no wait if speed is not positive
+func replay(r *record.Reader, speed float64) error {
+	sessions := make(map[int64]*session.Session) // recorded session id -> session
+	var last int64
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if speed > 0 && last > 0 && rec.Time > last {
+			time.Sleep(time.Duration(float64(rec.Time-last) / speed))
+		}
+		last = rec.Time
+
+		s, ok := sessions[rec.Sid]
+		if !ok {
+			s = session.New(&replayEntity{id: rec.Sid})
+			sessions[rec.Sid] = s
+		}
+		s.Uid = rec.Uid
+		handler.processMessage(s, &message.Message{
+			Type:  rec.Type,
+			ID:    rec.ID,
+			Route: rec.Route,
+			Data:  rec.Data,
+		})
+	}
+}
+
+// replayEntity is the network entity of the sessions replayed, messages
+// sent to client are logged, and tasks are executed immediately since all
+// messages are replayed in one goroutine
+type replayEntity struct {
+	id int64 // recorded session id
+}
+
+func (e *replayEntity) ID() int64 {
+	return e.id
+}
+
+func (e *replayEntity) Send(data []byte) error {
+	p, _, err := packet.Unpack(data)
+	if err != nil {
+		return err
+	}
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"sid": e.id}).Infof("replay output: %s", m.String())
+	return nil
+}
+
+func (e *replayEntity) Push(s *session.Session, route string, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	return transporter.push(s, route, data)
+}
+
+func (e *replayEntity) Response(s *session.Session, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	return transporter.response(s, data)
+}
+
+func (e *replayEntity) Call(ctx context.Context, s *session.Session, route string, reply interface{}, args ...interface{}) error {
+	return ErrReplayCall
+}
+
+func (e *replayEntity) Invoke(fn func()) error {
+	fn()
+	return nil
+}
+
+func (e *replayEntity) Close() {}
+
+// open the recording file and replay it
+func replayFile(path string, speed float64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return replay(record.NewReader(f), speed)
+}
@@ -0,0 +1,93 @@
+// Package record writes and reads the recordings of inbound messages, one
+// json object per line, so the messages can be replayed for debugging.
+package record
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/message"
+)
+
+// Record represents an inbound message received by session
+type Record struct {
+	Time  int64               `json:"time"` // unix time in nanoseconds when received
+	Sid   int64               `json:"sid"`  // session id
+	Uid   int64               `json:"uid"`  // uid bound to session
+	Type  message.MessageType `json:"type"` // request or notify
+	ID    uint                `json:"id"`   // request id
+	Route string              `json:"route"`
+	Data  []byte              `json:"data"` // message data, base64 encoded in json
+}
+
+// At returns the time when the message received
+func (r *Record) At() time.Time {
+	return time.Unix(0, r.Time)
+}
+
+// Recorder writes records, it's safe to call Record in multiple goroutines
+type Recorder struct {
+	sync.Mutex // protect following
+	enc        *json.Encoder
+	closer     io.Closer
+}
+
+// NewRecorder returns a recorder writing records to w
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{enc: json.NewEncoder(w)}
+	if c, ok := w.(io.Closer); ok {
+		r.closer = c
+	}
+	return r
+}
+
+// Create returns a recorder writing records to the file, records will be
+// appended if the file exists
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Record write the record
+func (r *Recorder) Record(rec *Record) error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.enc.Encode(rec)
+}
+
+// Close the underlying writer if it's an io.Closer
+func (r *Recorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Reader reads the records written by Recorder in order
+type Reader struct {
+	dec *json.Decoder
+}
+
+// NewReader returns a reader reading records from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: json.NewDecoder(r)}
+}
+
+// Next returns the next record, io.EOF returned at the end of records
+func (r *Reader) Next() (*Record, error) {
+	rec := &Record{}
+	if err := r.dec.Decode(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
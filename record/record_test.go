@@ -0,0 +1,41 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/lonnng/starx/message"
+)
+
+func TestRecorder(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	r := NewRecorder(buf)
+	records := []*Record{
+		{Time: 1, Sid: 1, Uid: 100, Type: message.Request, ID: 1, Route: "game.Room.Join", Data: []byte(`{"room":1}`)},
+		{Time: 2, Sid: 2, Type: message.Notify, Route: "game.Room.Move", Data: []byte{0x00, 0xff}},
+	}
+	for _, rec := range records {
+		if err := r.Record(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewReader(buf)
+	for i, expect := range records {
+		rec, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Time != expect.Time || rec.Sid != expect.Sid || rec.Uid != expect.Uid || rec.Type != expect.Type ||
+			rec.ID != expect.ID || rec.Route != expect.Route || !bytes.Equal(rec.Data, expect.Data) {
+			t.Fatalf("record %d mismatch: %+v", i, rec)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package starx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/record"
+	"github.com/lonnng/starx/session"
+)
+
+type RecordComp struct {
+	component.Base
+	moves []string
+	uids  []int64
+}
+
+func (c *RecordComp) Move(s *session.Session, data []byte) error {
+	c.moves = append(c.moves, string(data))
+	c.uids = append(c.uids, s.Uid)
+	return nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	c := &RecordComp{}
+	if err := handler.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.unregister("RecordComp")
+
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "messages.rec")
+	if err := EnableRecord(path); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+	a.session.Uid = 7000
+	for _, data := range []string{"left", "right"} {
+		handler.processMessage(a.session, &message.Message{Type: message.Notify, Route: "RecordComp.Move", Data: []byte(data)})
+	}
+	closeRecorder()
+	env.recorder = nil
+
+	c.moves, c.uids = nil, nil
+	if err := Replay(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.moves) != 2 || c.moves[0] != "left" || c.moves[1] != "right" || c.uids[0] != 7000 {
+		t.Fatalf("messages should be replayed in order, got %v, uids: %v", c.moves, c.uids)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	c := &RecordComp{}
+	if err := handler.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.unregister("RecordComp")
+
+	buf := bytes.NewBuffer(nil)
+	r := record.NewRecorder(buf)
+	start := time.Now().UnixNano()
+	for i := int64(0); i < 3; i++ {
+		r.Record(&record.Record{Time: start + i*int64(20*time.Millisecond), Sid: 1, Type: message.Notify, Route: "RecordComp.Move"})
+	}
+
+	// 40ms recorded, replayed twice as fast
+	begin := time.Now()
+	if err := replay(record.NewReader(buf), 2); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(begin); d < 20*time.Millisecond {
+		t.Fatalf("replay should keep the intervals at the speed, took %v", d)
+	}
+	if len(c.moves) != 3 {
+		t.Fatalf("expect 3 messages replayed, got %d", len(c.moves))
+	}
+}
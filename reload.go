@@ -0,0 +1,200 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/timer"
+)
+
+var ErrConfigNotFound = errors.New("reload config not found")
+
+var (
+	reloadLock     sync.RWMutex // protect configs which can be reloaded at runtime
+	limitsVersion  int          // increased when rate limits reloaded, limiters of sessions will be rebuilt
+	heartbeatTimer *timer.Timer // heartbeat timer of frontend server
+)
+
+// ReloadConfig represents the configs which can be reloaded by sending SIGHUP
+// to the process without dropping connections, the config file is found by
+// STARX_CONFIG, -config flag or $wd/configs/starx.json, e.g.
+//
+//	{
+//	    "heartbeat": 30,
+//	    "rate_limits": {"": {"rate": 20, "burst": 40}, "Chat.Send": {"rate": 5, "burst": 5}},
+//	    "server_rate_limits": {"chat": {"rate": 10, "burst": 20}},
+//	    "max_packet_size": 65536,
+//	    "log_level": "debug"
+//	}
+//
+// zero values keep current settings, and an empty rate_limits or
+// server_rate_limits object removes all rate limits of routes or server types
+type ReloadConfig struct {
+	Heartbeat        int                        `json:"heartbeat"`          // heartbeat interval in seconds, sent to clients in next handshake
+	RateLimits       map[string]RateLimitConfig `json:"rate_limits"`        // route -> rate limit, empty route means all messages
+	ServerRateLimits map[string]RateLimitConfig `json:"server_rate_limits"` // server type -> rate limit of messages routed to it
+	MaxPacketSize    int                        `json:"max_packet_size"`    // maximum length of packets sent by client
+	LogLevel         string                     `json:"log_level"`
+	Raw              map[string]interface{}     `json:"-"` // all values in config file, for components which have own settings
+}
+
+// RateLimitConfig represents the rate limit of a route in reload config
+type RateLimitConfig struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// watchReload load the reload config if present, and reload it on SIGHUP
+func watchReload() {
+	if err := reload(); err != nil && err != ErrConfigNotFound {
+		log.Error(err.Error())
+	}
+
+	sg := make(chan os.Signal, 1)
+	signal.Notify(sg, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-sg:
+				log.Info("got SIGHUP, reloading config")
+				if err := reload(); err != nil {
+					log.Errorf("reload config error: %s", err.Error())
+				}
+			case <-env.die:
+				signal.Stop(sg)
+				return
+			}
+		}
+	}()
+}
+
+// reload read the reload config, apply it and notify the callbacks
+func reload() error {
+	path := env.configPath
+	if path == "" {
+		path = findConfig("starx")
+	}
+	if path == "" || !fileExists(path) {
+		return ErrConfigNotFound
+	}
+
+	c, err := readReloadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := applyReload(c); err != nil {
+		return err
+	}
+	for _, fn := range env.reloadCallbacks {
+		fn(c)
+	}
+	return nil
+}
+
+func readReloadConfig(path string) (*ReloadConfig, error) {
+	decode, ok := configDecoders[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported config format %q", filepath.Ext(path))
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err := decode(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode %s error: %s", path, err.Error())
+	}
+	buf, err := json.Marshal(normalize(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ReloadConfig{Raw: raw}
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %s", path, err.Error())
+	}
+	return c, nil
+}
+
+func applyReload(c *ReloadConfig) error {
+	if c.LogLevel != "" {
+		if err := log.SetLevelByName(c.LogLevel); err != nil {
+			return fmt.Errorf("log_level %q: %s", c.LogLevel, err.Error())
+		}
+	}
+
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	if c.Heartbeat > 0 && time.Duration(c.Heartbeat)*time.Second != env.heartbeatInternal {
+		env.heartbeatInternal = time.Duration(c.Heartbeat) * time.Second
+		if heartbeatTimer != nil {
+			heartbeatTimer.Stop()
+			heartbeatTimer = timer.Register(env.heartbeatInternal, transporter.heartbeat)
+		}
+	}
+	if c.RateLimits != nil {
+		env.rateLimits = rateLimitsOf(c.RateLimits)
+		limitsVersion++
+	}
+	if c.ServerRateLimits != nil {
+		env.serverRateLimits = rateLimitsOf(c.ServerRateLimits)
+		limitsVersion++
+	}
+	if c.MaxPacketSize > 0 {
+		env.maxPacketSize = c.MaxPacketSize
+	}
+	return nil
+}
+
+func rateLimitsOf(configs map[string]RateLimitConfig) map[string]rateLimit {
+	limits := make(map[string]rateLimit, len(configs))
+	for k, l := range configs {
+		limits[k] = rateLimit{rate: l.Rate, burst: l.Burst}
+	}
+	return limits
+}
+
+func heartbeatInterval() time.Duration {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return env.heartbeatInternal
+}
+
+func maxPacketSize() int {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return env.maxPacketSize
+}
@@ -0,0 +1,102 @@
+package starx
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "starx.json")
+	data := `{"heartbeat": 7, "rate_limits": {"Chat.Send": {"rate": 0, "burst": 1}}, "server_rate_limits": {"chat": {"rate": 0, "burst": 1}}, "max_packet_size": 1024, "log_level": "error", "custom": "value"}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	heartbeat := env.heartbeatInternal
+	env.configPath = path
+	defer func() {
+		env.configPath = ""
+		env.heartbeatInternal = heartbeat
+		env.rateLimits = nil
+		env.serverRateLimits = nil
+		env.maxPacketSize = 0
+		env.reloadCallbacks = nil
+		log.SetLevel(log.LevelInfo)
+	}()
+
+	var got *ReloadConfig
+	OnConfigReload(func(c *ReloadConfig) { got = c })
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	a.allow("Chat.Send")
+
+	if err := reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Raw["custom"] != "value" {
+		t.Fatalf("callback should be called with raw values, got %+v", got)
+	}
+	if d := heartbeatInterval(); d != 7*time.Second {
+		t.Fatalf("heartbeat should be reloaded, got %v", d)
+	}
+	if n := maxPacketSize(); n != 1024 {
+		t.Fatalf("max packet size should be reloaded, got %d", n)
+	}
+
+	// limiters of existing sessions should be rebuilt
+	if !a.allow("Chat.Send") {
+		t.Fatal("first message after reload should be allowed")
+	}
+	if a.allow("Chat.Send") {
+		t.Fatal("reloaded rate limit should be exceeded")
+	}
+	if !a.allow("chat.Room.Send") || a.allow("chat.Room.Join") {
+		t.Fatal("reloaded rate limit of server type should be exceeded")
+	}
+
+	// invalid config keeps current settings
+	ioutil.WriteFile(path, []byte(`{"heartbeat": 9, "log_level": "loud"}`), 0644)
+	if err := reload(); err == nil {
+		t.Fatal("invalid log level should be reported")
+	}
+	if d := heartbeatInterval(); d != 7*time.Second {
+		t.Fatalf("heartbeat should not be changed, got %v", d)
+	}
+
+	env.configPath = filepath.Join(dir, "missing.json")
+	if err := reload(); err != ErrConfigNotFound {
+		t.Fatalf("expect ErrConfigNotFound, got %v", err)
+	}
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	SetMaxPacketSize(8)
+	defer SetMaxPacketSize(0)
+
+	conn, peer := net.Pipe()
+	go handler.handle(conn)
+
+	// the packet is refused by the header, before its data received
+	data, _ := packet.Pack(&packet.Packet{Type: packet.Data, Data: make([]byte, 16)})
+	go peer.Write(data[:packet.HeadLength])
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := peer.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); err == nil || ok && ne.Timeout() {
+		t.Fatalf("connection should be closed, got %v", err)
+	}
+}
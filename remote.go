@@ -22,23 +22,31 @@ package starx
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"net"
 	"os"
 	"reflect"
 	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/component"
 	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/metrics"
 	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/trace"
 )
 
 var remote = newRemote()
 
 type remoteService struct {
-	serviceMap map[string]*component.Service // all handler service
+	sync.RWMutex                                          // protect serviceMap and namespaces
+	serviceMap   map[string]*component.Service            // all handler service
+	namespaces   map[string]map[string]*component.Service // handler services of namespaces
 }
 
 type unhandledRequest struct {
@@ -46,6 +54,23 @@ type unhandledRequest struct {
 	rr *rpc.Request
 }
 
+// requests are queued for logic goroutine in unhandledRequest, which is
+// recycled after processed
+var unhandledRequests = sync.Pool{
+	New: func() interface{} { return &unhandledRequest{} },
+}
+
+func allocRequest(bs *acceptor, rr *rpc.Request) *unhandledRequest {
+	r := unhandledRequests.Get().(*unhandledRequest)
+	r.bs, r.rr = bs, rr
+	return r
+}
+
+func freeRequest(r *unhandledRequest) {
+	r.bs, r.rr = nil, nil
+	unhandledRequests.Put(r)
+}
+
 func newRemote() *remoteService {
 	return &remoteService{
 		serviceMap: make(map[string]*component.Service),
@@ -53,28 +78,104 @@ func newRemote() *remoteService {
 }
 
 func (rs *remoteService) register(rcvr component.Component) error {
-	if rs.serviceMap == nil {
-		rs.serviceMap = make(map[string]*component.Service)
+	return rs.registerIn("", rcvr)
+}
+
+// registerIn register the component in the namespace, empty namespace means
+// the default one
+func (rs *remoteService) registerIn(ns string, rcvr component.Component) error {
+	s, err := rs.newService(rcvr)
+	if err != nil {
+		return err
 	}
+	_, err = rs.put(ns, s, false)
+	return err
+}
 
+// newService scan the handlers and remote methods of the component without
+// serving it
+func (rs *remoteService) newService(rcvr component.Component) (*component.Service, error) {
 	s := &component.Service{
 		Type: reflect.TypeOf(rcvr),
 		Rcvr: reflect.ValueOf(rcvr),
 	}
 	s.Name = reflect.Indirect(s.Rcvr).Type().Name()
-	if _, present := rs.serviceMap[s.Name]; present {
-		return errors.New("remote: service already defined: " + s.Name)
-	}
 
 	if err := s.ScanHandler(); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := s.ScanRemote(); err != nil {
-		return err
+		return nil, err
 	}
-	rs.serviceMap[s.Name] = s
-	return nil
+	s.Hidden = !exposedBy(rcvr, app.config.Type)
+	return s, nil
+}
+
+// put serve the service in the namespace, the service of the same name is
+// swapped out and returned when replace is set, which must exist then
+func (rs *remoteService) put(ns string, s *component.Service, replace bool) (*component.Service, error) {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if rs.serviceMap == nil {
+		rs.serviceMap = make(map[string]*component.Service)
+	}
+	services := rs.serviceMap
+	if ns != "" {
+		if rs.namespaces == nil {
+			rs.namespaces = make(map[string]map[string]*component.Service)
+		}
+		if services = rs.namespaces[ns]; services == nil {
+			services = make(map[string]*component.Service)
+			rs.namespaces[ns] = services
+		}
+	}
+	old, present := services[s.Name]
+	if present && !replace {
+		return nil, errors.New("remote: service already defined: " + qualifiedName(ns, s.Name))
+	}
+	if !present && replace {
+		return nil, ErrServiceNotFound
+	}
+	services[s.Name] = s
+	return old, nil
+}
+
+// unregister remove the service, name of services registered in namespace
+// should be qualified, e.g. namespace.Service
+func (rs *remoteService) unregister(name string) (*component.Service, error) {
+	rs.Lock()
+	defer rs.Unlock()
+
+	ns, name := splitNamespace(name)
+	services := rs.serviceMap
+	if ns != "" {
+		services = rs.namespaces[ns]
+	}
+	s, ok := services[name]
+	if !ok {
+		return nil, ErrServiceNotFound
+	}
+	delete(services, name)
+	return s, nil
+}
+
+func (rs *remoteService) service(name string) (*component.Service, bool) {
+	return rs.serviceIn("", name)
+}
+
+// serviceIn returns the service of the namespace
+func (rs *remoteService) serviceIn(ns, name string) (*component.Service, bool) {
+	rs.RLock()
+	defer rs.RUnlock()
+
+	if ns != "" {
+		s, ok := rs.namespaces[ns][name]
+		return s, ok
+	}
+	s, ok := rs.serviceMap[name]
+	return s, ok
 }
 
 // Server handle request
@@ -83,6 +184,8 @@ func (rs *remoteService) handle(conn net.Conn) {
 	// message buffer
 	requestChan := make(chan *unhandledRequest, packetBufferSize)
 	endChan := make(chan bool, 1)
+	acceptor := transporter.createAcceptor(conn)
+
 	// all user logic will be handled in single goroutine
 	// synchronized in below routine
 	go func() {
@@ -90,6 +193,9 @@ func (rs *remoteService) handle(conn net.Conn) {
 			select {
 			case r := <-requestChan:
 				rs.processRequest(r.bs, r.rr)
+				freeRequest(r)
+			case fn := <-acceptor.tasks:
+				safeCall(fn)
 			case <-endChan:
 				close(requestChan)
 				return
@@ -97,14 +203,13 @@ func (rs *remoteService) handle(conn net.Conn) {
 		}
 	}()
 
-	acceptor := transporter.createAcceptor(conn)
 	transporter.dumpAcceptor()
 	tmp := make([]byte, 0) // save truncated data
 	buf := make([]byte, 512)
 	for {
 		n, err := conn.Read(buf)
 		if err != nil {
-			log.Infof("session closed(" + err.Error() + ")")
+			log.Info("session closed(" + err.Error() + ")")
 			transporter.dumpAcceptor()
 			acceptor.Close()
 			endChan <- true
@@ -116,11 +221,13 @@ func (rs *remoteService) handle(conn net.Conn) {
 		// read all request from buffer, and send to handle queue
 		for {
 			rr := &rpc.Request{} // save decoded packet
-			if tmp, err = rr.UnmarshalMsg(tmp); err != nil {
+			rest, err := rr.UnmarshalMsg(tmp)
+			if err != nil {
+				// keep the truncated data until the rest arrives
 				break
-			} else {
-				requestChan <- &unhandledRequest{acceptor, rr}
 			}
+			tmp = rest
+			requestChan <- allocRequest(acceptor, rr)
 		}
 	}
 }
@@ -129,15 +236,37 @@ func isSessionClosedRequest(rr *rpc.Request) bool {
 	return rr.ServiceMethod == sessionClosedRoute
 }
 
+// closeReasonOf returns the close reason carried by session closed request,
+// which is sent by frontend server as one byte data
+func closeReasonOf(rr *rpc.Request) session.CloseReason {
+	if err := rr.DecodePayload(); err != nil || len(rr.Data) != 1 {
+		return session.CloseUnknown
+	}
+	return session.CloseReason(rr.Data[0])
+}
+
 func (rs *remoteService) processRequest(ac *acceptor, rr *rpc.Request) {
+	// internal requests of peers carry no session, which are honored only
+	// if requested by peer rpc, clients can't produce it
+	if rr.Kind == rpc.Peer {
+		fn, ok := peerRoutes[rr.ServiceMethod]
+		if !ok {
+			fn = unknownPeerRoute
+		}
+		respondPeer(ac, rr, fn)
+		return
+	}
+
 	var session = ac.Session(rr.Sid)
 
 	// session closed notify request
 	if isSessionClosedRequest(rr) {
-		transporter.closeSession(session)
+		transporter.closeSession(session, closeReasonOf(rr))
 		return
 	}
 
+	restoreSessionContext(session, rr)
+
 	var (
 		err      error
 		service  *component.Service
@@ -147,31 +276,49 @@ func (rs *remoteService) processRequest(ac *acceptor, rr *rpc.Request) {
 			Seq:           rr.Seq,
 			Sid:           rr.Sid,
 			Kind:          rpc.RemoteResponse,
+			TraceID:       rr.TraceID,
 		}
+		span = trace.Start(rr.TraceID, rr.SpanID, rr.ServiceMethod, app.config.Id)
 	)
+	if span != nil {
+		session.SpanID = span.SpanID
+	}
 
 	route, err := route.Decode(rr.ServiceMethod)
 	if err != nil {
-		log.Errorf(err.Error())
-		response.Error = err.Error()
+		log.Error(err.Error())
+		setResponseError(rr, response, env.errorCodes.BadRequest, err)
 		goto WRITE_RESPONSE
 	}
 
-	service, ok = rs.serviceMap[route.Service]
+	// decompress data and check the size limit before decoding arguments
+	if err := rr.DecodePayload(); err != nil {
+		log.Error(err.Error())
+		setResponseError(rr, response, env.errorCodes.BadRequest, err)
+		goto WRITE_RESPONSE
+	}
+
+	service, ok = rs.serviceIn(route.Namespace, route.Service)
 	if !ok || service == nil {
 		str := "remote: servive " + route.Service + " does not exists"
-		log.Errorf(str)
-		response.Error = str
+		log.Error(str)
+		setResponseError(rr, response, env.errorCodes.NotFound, errors.New(str))
 		goto WRITE_RESPONSE
 	}
 
 	switch rr.Kind {
 	case rpc.Sys:
+		if service.Hidden {
+			str := "remote: service " + route.Service + " not exposed to clients"
+			log.Error(str)
+			setResponseError(rr, response, env.errorCodes.Forbidden, ErrRouteNotExposed)
+			goto WRITE_RESPONSE
+		}
 		m, ok := service.HandlerMethods[route.Method]
 		if !ok || m == nil {
 			str := "remote: service " + route.Service + "does not contain method: " + route.Method
-			log.Errorf(str)
-			response.Error = str
+			log.Error(str)
+			setResponseError(rr, response, env.errorCodes.NotFound, errors.New(str))
 			goto WRITE_RESPONSE
 		}
 		var data interface{}
@@ -182,26 +329,53 @@ func (rs *remoteService) processRequest(ac *acceptor, rr *rpc.Request) {
 			err := serializer.Deserialize(rr.Data, data)
 			if err != nil {
 				str := "deserialize error: " + err.Error()
-				log.Errorf(str)
-				response.Error = str
+				log.Error(str)
+				setResponseError(rr, response, env.errorCodes.BadRequest, errors.New(str))
 				goto WRITE_RESPONSE
 			}
 		}
+		if err := validate(route.Name(), session, data); err != nil {
+			log.Warnf("message of %s refused by validator: %s", rr.ServiceMethod, err.Error())
+			setResponseError(rr, response, env.errorCodes.BadRequest, err)
+			goto WRITE_RESPONSE
+		}
+		bh := bulkheadOf(route.Service, route.Method)
+		if bh != nil && !bh.acquire(session.Context().Done()) {
+			log.Warnf("handler call of %s refused by concurrency limit", rr.ServiceMethod)
+			setResponseError(rr, response, env.errorCodes.Busy, ErrBusy)
+			goto WRITE_RESPONSE
+		}
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+		if m.Context {
+			ctx, cancel = handlerContext(session, rr.TraceID, span)
+		}
 
-		ret, err := rs.call(m.Method, []reflect.Value{
-			service.Rcvr,
-			reflect.ValueOf(session),
-			reflect.ValueOf(data)})
+		m.IncCalls()
+		start := time.Now()
+		done := watchHandler(rr.ServiceMethod, len(rr.Data))
+		ret, err := rs.call(m.Method, m.Args(service.Rcvr, ctx, session, data))
+		done()
+		if cancel != nil {
+			cancel()
+		}
+		if bh != nil {
+			bh.release()
+		}
 		if err != nil {
-			log.Errorf(err.Error())
-			response.Error = err.Error()
+			log.Error(err.Error())
+			setResponseError(rr, response, env.errorCodes.Internal, err)
 		} else {
 			// handler method encounter error
 			if err := ret[0].Interface(); err != nil {
-				log.Errorf(err.(error).Error())
-				response.Error = err.(error).Error()
+				log.Error(err.(error).Error())
+				setResponseError(rr, response, env.errorCodes.Internal, err.(error))
 			}
 		}
+		metrics.ObserveRoute(rr.ServiceMethod, time.Since(start), response.Error != "")
 	case rpc.User:
 		var args []interface{}
 		var params = []reflect.Value{service.Rcvr}
@@ -217,7 +391,12 @@ func (rs *remoteService) processRequest(ac *acceptor, rr *rpc.Request) {
 			response.Error = "remote: service " + route.Service + " does not contain method: " + route.Method
 			goto WRITE_RESPONSE
 		}
+		m.IncCalls()
+		start := time.Now()
+		done := watchHandler(rr.ServiceMethod, len(rr.Data))
 		ret, err := rs.call(m.Method, params)
+		done()
+		metrics.ObserveRoute(rr.ServiceMethod, time.Since(start), err != nil || ret[1].Interface() != nil)
 		if err != nil {
 			response.Error = err.Error()
 		} else {
@@ -239,8 +418,40 @@ func (rs *remoteService) processRequest(ac *acceptor, rr *rpc.Request) {
 	}
 
 WRITE_RESPONSE:
+	if err := response.EncodePayload(rr.Accept); err != nil {
+		log.Error(err.Error())
+		setResponseError(rr, response, env.errorCodes.Internal, err)
+	}
+	if response.Error != "" {
+		span.Finish(errors.New(response.Error))
+	} else {
+		span.Finish(nil)
+	}
 	if err := rpc.WriteResponse(ac.socket, response); err != nil {
-		log.Errorf(err.Error())
+		log.Error(err.Error())
+	}
+}
+
+// restoreSessionContext sync the context of frontend session forwarded in
+// request to backend session, values of frontend session data will overwrite
+// the values of backend session data with the same key
+func restoreSessionContext(s *session.Session, rr *rpc.Request) {
+	s.Uid = rr.Uid
+	s.Remote = rr.Remote
+	s.TraceID = rr.TraceID
+	s.SpanID = rr.SpanID
+	bindings.bind(s)
+	if len(rr.State) == 0 {
+		return
+	}
+
+	state := make(map[string]interface{})
+	if err := gob.NewDecoder(bytes.NewReader(rr.State)).Decode(&state); err != nil {
+		sessionLogger(s).Errorf("decode session state error: %s", err.Error())
+		return
+	}
+	for k, v := range state {
+		s.Set(k, v)
 	}
 }
 
@@ -261,6 +472,9 @@ func (rs *remoteService) call(method reflect.Method, args []reflect.Value) (rets
 }
 
 func (rs *remoteService) dumpServiceMap() {
+	rs.RLock()
+	defer rs.RUnlock()
+
 	for sn, s := range rs.serviceMap {
 		for mn := range s.HandlerMethods {
 			log.Infof("registered service: %s.%s", sn, mn)
@@ -270,4 +484,64 @@ func (rs *remoteService) dumpServiceMap() {
 			log.Infof("registered service: %s.%s", sn, mn)
 		}
 	}
+	for ns, services := range rs.namespaces {
+		for sn, s := range services {
+			for mn := range s.HandlerMethods {
+				log.Infof("registered service: %s.%s.%s", ns, sn, mn)
+			}
+			for mn := range s.RemoteMethods {
+				log.Infof("registered service: %s.%s.%s", ns, sn, mn)
+			}
+		}
+	}
+}
+
+// peerRoutes are the internal routes requested by peers over the rpc mesh,
+// which carry no session, e.g. heartbeats and admin commands, they are served
+// to the requests of rpc.Peer kind only, see cluster.CallServer
+var peerRoutes = map[string]func(data []byte) ([]byte, error){
+	clusterHeartbeatRoute: heartbeatReport,
+	adminExecRoute:        adminExec,
+	pushUIDsRoute:         pushFromPeer,
+	migrateSessionRoute:   migrateToPeer,
+}
+
+func unknownPeerRoute(data []byte) ([]byte, error) {
+	return nil, ErrServiceNotFound
+}
+
+// respondPeer respond the result of internal route to the peer
+func respondPeer(ac *acceptor, rr *rpc.Request, fn func([]byte) ([]byte, error)) {
+	response := &rpc.Response{
+		ServiceMethod: rr.ServiceMethod,
+		Seq:           rr.Seq,
+		Sid:           rr.Sid,
+		Kind:          rpc.RemoteResponse,
+	}
+	if err := rr.DecodePayload(); err != nil {
+		response.Error = err.Error()
+	} else if data, err := fn(rr.Data); err != nil {
+		response.Error = err.Error()
+	} else {
+		response.Data = data
+	}
+	if err := response.EncodePayload(rr.Accept); err != nil {
+		log.Error(err.Error())
+		return
+	}
+	if err := rpc.WriteResponse(ac.socket, response); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// setResponseError set the error of response, the code and message of error
+// envelope are set for the requests of clients, which will be responded to
+// clients by frontend server
+func setResponseError(rr *rpc.Request, response *rpc.Response, code int, err error) {
+	if rr.Kind != rpc.Sys {
+		response.Error = err.Error()
+		return
+	}
+	e := errorEnvelope(code, err)
+	response.Error, response.ErrorCode = e.Msg, e.Code
 }
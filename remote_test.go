@@ -0,0 +1,105 @@
+package starx
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/compress/gzip"
+	"github.com/lonnng/starx/session"
+)
+
+type ContextComp struct {
+	component.Base
+	session *session.Session
+}
+
+func (c *ContextComp) Handle(s *session.Session, data []byte) error {
+	c.session = s
+	return nil
+}
+
+func TestRemoteSessionContext(t *testing.T) {
+	c := &ContextComp{}
+	if err := remote.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.unregister("ContextComp")
+
+	conn, peer := net.Pipe()
+	go io.Copy(ioutil.Discard, peer)
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	buf := bytes.NewBuffer([]byte(nil))
+	gob.NewEncoder(buf).Encode(map[string]interface{}{"level": 10})
+
+	remote.processRequest(ac, &rpc.Request{
+		ServiceMethod: "ContextComp.Handle",
+		Sid:           100,
+		Kind:          rpc.Sys,
+		Uid:           1000,
+		Remote:        "127.0.0.1:10000",
+		State:         buf.Bytes(),
+	})
+
+	s := c.session
+	if s == nil {
+		t.Fatal("handler should be called")
+	}
+	if s.Uid != 1000 || s.Remote != "127.0.0.1:10000" || s.Int("level") != 10 {
+		t.Fatalf("session context should be restored, uid=%d, remote=%s, data=%v", s.Uid, s.Remote, s.State())
+	}
+}
+
+func TestRemotePayload(t *testing.T) {
+	c := &ContextComp{}
+	if err := remote.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.unregister("ContextComp")
+
+	SetRPCCompressor(gzip.NewCompressor(), 0)
+	defer SetRPCCompressor(nil, 0)
+	SetRPCMaxPayload(100)
+	defer SetRPCMaxPayload(0)
+
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	// compressed data exceeds the limit after decompressed
+	data, _ := gzip.NewCompressor().Compress(make([]byte, 1000))
+	go remote.processRequest(ac, &rpc.Request{
+		ServiceMethod: "ContextComp.Handle",
+		Sid:           101,
+		Kind:          rpc.Sys,
+		Data:          data,
+		Compression:   "gzip",
+		Accept:        "gzip",
+	})
+	resp := readResponse(t, peer)
+	if resp.ErrorCode != CodeBadRequest || c.session != nil {
+		t.Fatalf("request too large should be refused, code=%d", resp.ErrorCode)
+	}
+	if resp.Accept != "gzip" {
+		t.Fatalf("server should accept gzip, got %q", resp.Accept)
+	}
+
+	data, _ = gzip.NewCompressor().Compress(make([]byte, 100))
+	go remote.processRequest(ac, &rpc.Request{
+		ServiceMethod: "ContextComp.Handle",
+		Sid:           101,
+		Kind:          rpc.Sys,
+		Data:          data,
+		Compression:   "gzip",
+	})
+	if resp := readResponse(t, peer); resp.Error != "" || c.session == nil {
+		t.Fatalf("compressed request should be handled, error=%s", resp.Error)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/metrics"
+	"github.com/lonnng/starx/session"
+)
+
+// resumes manages the sessions which lost connection and are waiting for
+// client reconnecting with resume token
+var resumes = newResumeService()
+
+type resumeService struct {
+	sync.Mutex
+	tokens   map[string]*suspendedEntity // resume token -> suspended session
+	sessions map[int64]*suspendedEntity  // session id -> suspended session
+}
+
+// suspendedEntity replace the closed agent as the network entity of session
+// when session suspended, messages sent to the session will be buffered
+type suspendedEntity struct {
+	*agent
+	sync.Mutex
+	pending []*message.Message // messages waiting to be replayed, oldest first
+	timer   *time.Timer        // close session when grace period expired
+}
+
+func newResumeService() *resumeService {
+	return &resumeService{
+		tokens:   make(map[string]*suspendedEntity),
+		sessions: make(map[int64]*suspendedEntity),
+	}
+}
+
+// issue generate a resume token for the agent
+func (rs *resumeService) issue(a *agent) string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		sessionLogger(a.session).Errorf("generate resume token error: %s", err.Error())
+		return ""
+	}
+	a.token = hex.EncodeToString(buf)
+	return a.token
+}
+
+// suspend the session of the closed agent, returns false if resume not enabled
+func (rs *resumeService) suspend(a *agent) bool {
+	if env.resumeGrace <= 0 || a.token == "" {
+		return false
+	}
+
+	e := &suspendedEntity{agent: a}
+	rs.Lock()
+	rs.tokens[a.token] = e
+	rs.sessions[a.session.ID] = e
+	rs.Unlock()
+
+	a.session.Entity = e
+	e.timer = time.AfterFunc(env.resumeGrace, func() {
+		if rs.remove(e) {
+			sessionLogger(e.session).Debugf("session resume grace period expired")
+			transporter.closeSession(e.session, e.session.CloseReason)
+		}
+	})
+
+	if transporter.sessions.Delete(a.session) {
+		metrics.Sessions.Dec()
+	}
+
+	sessionLogger(a.session).Debugf("session suspended, waiting for resuming")
+	return true
+}
+
+func (rs *resumeService) remove(e *suspendedEntity) bool {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if rs.tokens[e.token] != e {
+		return false
+	}
+	delete(rs.tokens, e.token)
+	delete(rs.sessions, e.session.ID)
+	return true
+}
+
+func (rs *resumeService) entity(sid int64) (*suspendedEntity, bool) {
+	rs.Lock()
+	defer rs.Unlock()
+
+	e, ok := rs.sessions[sid]
+	return e, ok
+}
+
+// resume attach the suspended session of the token to the agent, and
+// returns the messages need to be replayed, returns false if token invalid
+// or grace period expired
+func (rs *resumeService) resume(a *agent, token string) ([]*message.Message, bool) {
+	rs.Lock()
+	e, ok := rs.tokens[token]
+	rs.Unlock()
+	if !ok || !rs.remove(e) {
+		return nil, false
+	}
+	e.timer.Stop()
+
+	// the new agent takes over the suspended session, and the session
+	// created for the new connection will be discarded
+	s := e.session
+	transporter.sessions.Delete(a.session)
+	a.id = s.ID
+	a.session = s
+	s.Entity = a
+	s.CloseReason = session.CloseUnknown
+	transporter.sessions.Store(s)
+
+	e.Lock()
+	defer e.Unlock()
+	return e.pending, true
+}
+
+// buffer the message, the oldest message will be discarded when buffer full
+func (e *suspendedEntity) buffer(m *message.Message) {
+	e.Lock()
+	defer e.Unlock()
+
+	if len(e.pending) >= env.replaySize {
+		if env.replaySize <= 0 {
+			return
+		}
+		e.pending = e.pending[1:]
+	}
+	e.pending = append(e.pending, m)
+}
+
+// Close the suspended session immediately
+func (e *suspendedEntity) Close() {
+	if resumes.remove(e) {
+		e.timer.Stop()
+		transporter.closeSession(e.session, session.CloseServer)
+	}
+}
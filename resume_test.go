@@ -0,0 +1,130 @@
+package starx
+
+import (
+	encjson "encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
+)
+
+func resumeHandshake(t *testing.T, a *agent, token string) (map[string]interface{}, []*message.Message) {
+	req, _ := encjson.Marshal(map[string]interface{}{
+		"sys": map[string]interface{}{
+			"resume": map[string]interface{}{"token": token},
+		},
+	})
+	handler.processPacket(a, &packet.Packet{Type: packet.Handshake, Data: req})
+
+	var resp map[string]interface{}
+	var replay []*message.Message
+	for len(a.sendBuffer) > 0 {
+		p, _, err := packet.Unpack(<-a.sendBuffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Type == packet.Handshake {
+			if err := encjson.Unmarshal(p.Data, &resp); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		m, err := message.Decode(p.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replay = append(replay, m)
+	}
+	return resp, replay
+}
+
+func resumeToken(resp map[string]interface{}) string {
+	sys := resp["sys"].(map[string]interface{})
+	return sys["resume"].(map[string]interface{})["token"].(string)
+}
+
+func TestResumeSession(t *testing.T) {
+	SetResume(time.Minute, 2)
+	defer SetResume(0, 0)
+
+	c1, _ := net.Pipe()
+	a1 := transporter.createAgent(c1)
+	resp, _ := resumeHandshake(t, a1, "")
+	token := resumeToken(resp)
+	if token == "" {
+		t.Fatal("resume token should be issued")
+	}
+	a1.status = statusWorking
+	a1.session.Bind(4000)
+	s := a1.session
+
+	a1.disconnect(session.CloseReadError)
+	if ss, err := transporter.Session(s.ID); err != nil || ss != s {
+		t.Fatalf("session should be suspended, err=%v", err)
+	}
+	for _, route := range []string{"onA", "onB", "onC"} {
+		if err := s.Push(route, []byte(route)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// invalid token starts a new session
+	c2, _ := net.Pipe()
+	a2 := transporter.createAgent(c2)
+	defer a2.Close()
+	if _, replay := resumeHandshake(t, a2, "invalid"); a2.session == s || len(replay) != 0 {
+		t.Fatal("invalid token should not resume session")
+	}
+
+	c3, _ := net.Pipe()
+	a3 := transporter.createAgent(c3)
+	defer a3.Close()
+	resp, replay := resumeHandshake(t, a3, token)
+	if a3.session != s || a3.ID() != s.ID || s.Uid != 4000 {
+		t.Fatal("session should be resumed")
+	}
+	if a, err := transporter.agent(s.ID); err != nil || a != a3 {
+		t.Fatalf("resumed agent should be registered, err=%v", err)
+	}
+	if resumeToken(resp) == token {
+		t.Fatal("new resume token should be issued")
+	}
+	if len(replay) != 2 || replay[0].Route != "onB" || replay[1].Route != "onC" {
+		t.Fatalf("latest messages should be replayed, got: %v", replay)
+	}
+
+	// token can be used only once
+	c4, _ := net.Pipe()
+	a4 := transporter.createAgent(c4)
+	defer a4.Close()
+	if resumeHandshake(t, a4, token); a4.session == s {
+		t.Fatal("token should not be reused")
+	}
+}
+
+func TestResumeExpired(t *testing.T) {
+	SetResume(10*time.Millisecond, 2)
+	defer SetResume(0, 0)
+
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	resp, _ := resumeHandshake(t, a, "")
+	a.status = statusWorking
+	sid := a.session.ID
+
+	a.disconnect(session.CloseReadError)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := transporter.Session(sid); err == nil {
+		t.Fatal("session should be closed after grace period")
+	}
+
+	c, _ = net.Pipe()
+	a = transporter.createAgent(c)
+	defer a.Close()
+	if resumeHandshake(t, a, resumeToken(resp)); a.session.ID == sid {
+		t.Fatal("expired session should not be resumed")
+	}
+}
@@ -14,19 +14,41 @@ var (
 )
 
 type Route struct {
+	Namespace  string // optional, services of namespaces are isolated
 	ServerType string
 	Service    string
 	Method     string
 }
 
 func NewRoute(server, service, method string) *Route {
-	return &Route{server, service, method}
+	return &Route{ServerType: server, Service: service, Method: method}
 }
 
+// String returns the full route, the namespace is prefixed if not empty
 func (r *Route) String() string {
+	if r.Namespace != "" {
+		return fmt.Sprintf("%s.%s.%s.%s", r.Namespace, r.ServerType, r.Service, r.Method)
+	}
 	return fmt.Sprintf("%s.%s.%s", r.ServerType, r.Service, r.Method)
 }
 
+// Name returns the route without server type, e.g. Service.Method, or
+// namespace.Service.Method if namespace is not empty
+func (r *Route) Name() string {
+	if r.Namespace != "" {
+		return r.Namespace + "." + r.Service + "." + r.Method
+	}
+	return r.Service + "." + r.Method
+}
+
+// Decode the route, which consists of namespace, server type, service and
+// method, namespace and server type are optional:
+//
+//	Service.Method
+//	server.Service.Method
+//	namespace.server.Service.Method
+//
+// the first segment of three-segment routes is always decoded as server type
 func Decode(route string) (*Route, error) {
 	r := strings.Split(route, ".")
 	for _, s := range r {
@@ -35,12 +57,16 @@ func Decode(route string) (*Route, error) {
 		}
 	}
 	switch len(r) {
+	case 4:
+		rt := NewRoute(r[1], r[2], r[3])
+		rt.Namespace = r[0]
+		return rt, nil
 	case 3:
 		return NewRoute(r[0], r[1], r[2]), nil
 	case 2:
 		return NewRoute("", r[0], r[1]), nil
 	default:
-		log.Errorf("invalid route: " + route)
+		log.Error("invalid route: " + route)
 		return nil, ErrInvalidRoute
 	}
 }
@@ -7,7 +7,15 @@ func TestDecodeRoute(t *testing.T) {
 		t.Error(err.Error())
 	}
 
-	if _, err := Decode("a.b.c.d"); err == nil {
+	r, err := Decode("a.b.c.d")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if r.Namespace != "a" || r.String() != "a.b.c.d" || r.Name() != "a.c.d" {
+		t.Fatalf("unexpected route: %+v", r)
+	}
+
+	if _, err := Decode("a.b.c.d.e"); err == nil {
 		t.Fail()
 	}
 
@@ -56,4 +56,47 @@ func BenchmarkSerializer_Deserialize(b *testing.B) {
 		m1 := &Message{}
 		s.Deserialize(d, m1)
 	}
-}
\ No newline at end of file
+}
+type Item struct {
+	Id *int32 `protobuf:"varint,1,opt,name=id"`
+}
+
+func (m *Item) Reset()         { *m = Item{} }
+func (m *Item) String() string { return proto.CompactTextString(m) }
+func (*Item) ProtoMessage()    {}
+
+type Bag struct {
+	Name  *string          `protobuf:"bytes,1,req,name=name"`
+	Items []*Item          `protobuf:"bytes,2,rep,name=items"`
+	Score *float64         `protobuf:"fixed64,3,opt,name=score"`
+	Delta int64            `protobuf:"zigzag64,4,opt,name=delta"`
+	Attrs map[string]int32 `protobuf:"bytes,5,rep,name=attrs" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+}
+
+func (m *Bag) Reset()         { *m = Bag{} }
+func (m *Bag) String() string { return proto.CompactTextString(m) }
+func (*Bag) ProtoMessage()    {}
+
+func TestSchema(t *testing.T) {
+	s, err := Schema(&Bag{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]interface{}{
+		"required string name":  1,
+		"repeated Item items":   2,
+		"optional double score": 3,
+		"optional sint64 delta": 4,
+		"message Item": map[string]interface{}{
+			"optional int32 id": 1,
+		},
+	}
+	if !reflect.DeepEqual(s, expect) {
+		t.Fatalf("expect %v, got %v", expect, s)
+	}
+
+	if _, err := Schema(struct{}{}); err != ErrWrongValueType {
+		t.Fatalf("expect ErrWrongValueType, got %v", err)
+	}
+}
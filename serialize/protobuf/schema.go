@@ -0,0 +1,128 @@
+package protobuf
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Schema describe the message in pomelo-protobuf json format, which can be
+// used by js/lua client to decode message dynamically, e.g.
+//
+//	{
+//		"required string name": 1,
+//		"repeated Item items": 2,
+//		"message Item": {"optional int32 id": 1}
+//	}
+//
+// the schema is built from the struct tags generated by protoc-gen-go, map
+// and oneof fields are not supported and will be ignored
+func Schema(v interface{}) (map[string]interface{}, error) {
+	if _, ok := v.(proto.Message); !ok {
+		return nil, ErrWrongValueType
+	}
+	return schema(reflect.TypeOf(v)), nil
+}
+
+func schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	s := make(map[string]interface{})
+	if t.Kind() != reflect.Struct {
+		return s
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("protobuf")
+		if tag == "" || f.Type.Kind() == reflect.Map {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		if len(parts) < 2 {
+			continue
+		}
+		num, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+
+		label := "optional"
+		name := f.Name
+		for _, p := range parts[2:] {
+			switch {
+			case p == "req":
+				label = "required"
+			case p == "rep":
+				label = "repeated"
+			case strings.HasPrefix(p, "name="):
+				name = p[len("name="):]
+			}
+		}
+
+		typ, nested := fieldType(parts[0], f.Type)
+		if nested != nil {
+			s["message "+typ] = schema(nested)
+		}
+		s[label+" "+typ+" "+name] = num
+	}
+	return s
+}
+
+// fieldType returns the protobuf type name of field, and the struct type
+// when the field is a nested message
+func fieldType(wire string, t reflect.Type) (string, reflect.Type) {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		t = t.Elem()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch wire {
+	case "varint":
+		switch t.Kind() {
+		case reflect.Bool:
+			return "bool", nil
+		case reflect.Int64:
+			return "int64", nil
+		case reflect.Uint32:
+			return "uint32", nil
+		case reflect.Uint64:
+			return "uint64", nil
+		}
+		return "int32", nil // enums are encoded as int32
+	case "zigzag32":
+		return "sint32", nil
+	case "zigzag64":
+		return "sint64", nil
+	case "fixed32":
+		switch t.Kind() {
+		case reflect.Float32:
+			return "float", nil
+		case reflect.Int32:
+			return "sfixed32", nil
+		}
+		return "fixed32", nil
+	case "fixed64":
+		switch t.Kind() {
+		case reflect.Float64:
+			return "double", nil
+		case reflect.Int64:
+			return "sfixed64", nil
+		}
+		return "fixed64", nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string", nil
+	case reflect.Struct:
+		return t.Name(), t
+	}
+	return "bytes", nil
+}
@@ -2,17 +2,22 @@ package service
 
 import (
 	"sync/atomic"
+
+	"github.com/lonnng/starx/idgen"
 )
 
 var Connections = newConnectionService()
 
 type connectionService struct {
-	count int64
-	sid   int64
+	count   int64
+	counter *idgen.Counter  // default session id generator
+	sid     idgen.Generator // session id generator
 }
 
 func newConnectionService() *connectionService {
-	return &connectionService{sid: 0}
+	c := &connectionService{counter: idgen.NewCounter()}
+	c.sid = c.counter
+	return c
 }
 
 func (c *connectionService) Increment() {
@@ -29,9 +34,17 @@ func (c *connectionService) Count() int64 {
 
 func (c *connectionService) Reset() {
 	atomic.StoreInt64(&c.count, 0)
-	atomic.StoreInt64(&c.sid, 0)
+	c.counter.Reset()
+}
+
+// SetGenerator replace the session id generator, nil means the default counter
+func (c *connectionService) SetGenerator(g idgen.Generator) {
+	if g == nil {
+		g = c.counter
+	}
+	c.sid = g
 }
 
 func (c *connectionService) SessionID() int64 {
-	return atomic.AddInt64(&c.sid, 1)
+	return c.sid.Next()
 }
@@ -2,6 +2,8 @@ package service
 
 import (
 	"testing"
+
+	"github.com/lonnng/starx/idgen"
 )
 
 const paraCount = 500000
@@ -29,3 +31,16 @@ func TestNewConnectionService(t *testing.T) {
 		t.Error("wrong session id")
 	}
 }
+
+func TestConnectionService_SetGenerator(t *testing.T) {
+	service := newConnectionService()
+	service.SetGenerator(idgen.GeneratorFunc(func() int64 { return 42 }))
+	if id := service.SessionID(); id != 42 {
+		t.Fatalf("session id should be generated by generator, got %d", id)
+	}
+
+	service.SetGenerator(nil)
+	if id := service.SessionID(); id != 1 {
+		t.Fatalf("session id should be generated by default counter, got %d", id)
+	}
+}
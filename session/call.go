@@ -0,0 +1,56 @@
+package session
+
+import (
+	"context"
+
+	"github.com/lonnng/starx/log"
+)
+
+// Call represents an asynchronous remote call invoked by Go, mirroring the
+// Call of net/rpc
+type Call struct {
+	Route string        // route of the remote method
+	Args  []interface{} // arguments of the remote method
+	Reply interface{}   // the reply from the remote method
+	Error error         // after completion, the error status
+	Done  chan *Call    // receives the call itself when completed
+}
+
+// Go invoke remote method of the route asynchronously with the default rpc
+// timeout, it returns immediately so the logic goroutine won't be blocked by
+// a slow remote server. The Done channel of returned Call receives the call
+// when completed, and callback, if not nil, will be called on the logic
+// goroutine of the session, so it's safe to access session data in callback:
+//
+//	s.Go("chat.Room.Join", &reply, func(c *session.Call) {
+//		if c.Error != nil {
+//			return
+//		}
+//		s.Set("room", reply.RoomID)
+//	}, "room-1")
+func (s *Session) Go(route string, reply interface{}, callback func(*Call), args ...interface{}) *Call {
+	return s.GoContext(context.Background(), route, reply, callback, args...)
+}
+
+// GoContext is the same as Go, the call will be abandoned when the context
+// is done
+func (s *Session) GoContext(ctx context.Context, route string, reply interface{}, callback func(*Call), args ...interface{}) *Call {
+	call := &Call{
+		Route: route,
+		Args:  args,
+		Reply: reply,
+		Done:  make(chan *Call, 1),
+	}
+
+	go func() {
+		call.Error = s.CallContext(ctx, route, reply, args...)
+		call.Done <- call
+		if callback == nil {
+			return
+		}
+		if err := s.Invoke(func() { callback(call) }); err != nil {
+			log.Errorf("deliver result of %s to session %d error: %s", route, s.ID, err.Error())
+		}
+	}()
+	return call
+}
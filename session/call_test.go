@@ -0,0 +1,65 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// callEntity replies the first argument, and runs invoked functions on the
+// tasks channel
+type callEntity struct {
+	NetworkEntity
+	release chan struct{}
+	tasks   chan func()
+}
+
+func (e *callEntity) Call(ctx context.Context, s *Session, route string, reply interface{}, args ...interface{}) error {
+	<-e.release
+	if len(args) == 0 {
+		return errors.New("no args")
+	}
+	*reply.(*string) = args[0].(string)
+	return nil
+}
+
+func (e *callEntity) Invoke(fn func()) error {
+	e.tasks <- fn
+	return nil
+}
+
+func TestSession_Go(t *testing.T) {
+	e := &callEntity{release: make(chan struct{}), tasks: make(chan func(), 1)}
+	s := New(e)
+
+	var reply string
+	var result *Call
+	call := s.Go("test.Echo.Echo", &reply, func(c *Call) { result = c }, "hello")
+
+	// the call should not block the caller
+	select {
+	case <-call.Done:
+		t.Fatal("call should not be completed before released")
+	default:
+	}
+
+	close(e.release)
+	if c := <-call.Done; c != call || c.Error != nil || reply != "hello" {
+		t.Fatalf("unexpected call result: %+v, reply: %s", c, reply)
+	}
+
+	// callback runs on the task queue of session
+	fn := <-e.tasks
+	if result != nil {
+		t.Fatal("callback should not be called before task executed")
+	}
+	fn()
+	if result != call {
+		t.Fatal("callback should be called with the call")
+	}
+
+	call = s.Go("test.Echo.Echo", &reply, nil)
+	if c := <-call.Done; c.Error == nil {
+		t.Fatal("error of call should be reported")
+	}
+}
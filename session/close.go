@@ -0,0 +1,34 @@
+package session
+
+// CloseReason represents why the session closed, it's set before the session
+// closed listeners called
+type CloseReason int
+
+const (
+	CloseUnknown          CloseReason = iota // reason not known
+	CloseClient                              // connection closed by client
+	CloseHeartbeatTimeout                    // no heartbeat or packet received in time
+	CloseReadError                           // failed to read from connection
+	CloseKicked                              // kicked by server
+	CloseShutdown                            // server shutdown or restarting
+	CloseServer                              // closed by server, e.g. protocol violation or Close called
+	CloseMigrated                            // migrated to another frontend server
+)
+
+var closeReasonNames = [...]string{
+	CloseUnknown:          "Unknown",
+	CloseClient:           "Client",
+	CloseHeartbeatTimeout: "HeartbeatTimeout",
+	CloseReadError:        "ReadError",
+	CloseKicked:           "Kicked",
+	CloseShutdown:         "Shutdown",
+	CloseServer:           "Server",
+	CloseMigrated:         "Migrated",
+}
+
+func (r CloseReason) String() string {
+	if r < 0 || int(r) >= len(closeReasonNames) {
+		return "Unknown"
+	}
+	return closeReasonNames[r]
+}
@@ -0,0 +1,19 @@
+package session
+
+import "context"
+
+// Context returns the context of session, which is canceled after the session
+// closed, so handlers can abandon the work for disconnected players
+func (s *Session) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Cancel the context of session, it's called when the session closed
+func (s *Session) Cancel() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
@@ -0,0 +1,26 @@
+package session
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSession_Context(t *testing.T) {
+	s := New(nil)
+	ctx := s.Context()
+	if ctx.Err() != nil {
+		t.Fatal("context should not be canceled before session closed")
+	}
+
+	// shallow copies share the context
+	ss := *s
+	ss.Cancel()
+	if ctx.Err() != context.Canceled || s.Context().Err() != context.Canceled {
+		t.Fatalf("context should be canceled, got %v", ctx.Err())
+	}
+
+	if (&Session{}).Context() != context.Background() {
+		t.Fatal("context of session not created by New should be background")
+	}
+	(&Session{}).Cancel()
+}
@@ -0,0 +1,118 @@
+package session
+
+import "sync"
+
+// DefaultShards is the number of shards of the default session manager
+const DefaultShards = 32
+
+// Manager stores the sessions of connected clients by session id, which
+// should be safe for concurrent use. Implementations can evict sessions, e.g.
+// idle anonymous sessions, by closing them, closed sessions will be deleted
+// from manager by server.
+type Manager interface {
+	// Store the session, which replaces the session of the same id
+	Store(s *Session)
+
+	// Load returns the session of the id
+	Load(id int64) (*Session, bool)
+
+	// Delete the session if it's stored, returns false if the session of
+	// the id is not the session
+	Delete(s *Session) bool
+
+	// Len returns the number of sessions
+	Len() int
+
+	// Range calls fn for each session until fn returns false, fn can modify
+	// the manager, sessions stored during iteration may not be visited
+	Range(fn func(*Session) bool)
+}
+
+// shardedManager is the default session manager, sessions are spread across
+// shards by id to reduce lock contention
+type shardedManager struct {
+	shards []*shard
+}
+
+type shard struct {
+	sync.RWMutex
+	sessions map[int64]*Session
+}
+
+// NewShardedManager returns a session manager which spreads sessions across
+// n shards by id, DefaultShards is used if n less than 1
+func NewShardedManager(n int) Manager {
+	if n < 1 {
+		n = DefaultShards
+	}
+	m := &shardedManager{shards: make([]*shard, n)}
+	for i := range m.shards {
+		m.shards[i] = &shard{sessions: make(map[int64]*Session)}
+	}
+	return m
+}
+
+func (m *shardedManager) shard(id int64) *shard {
+	if id < 0 {
+		id = -id
+	}
+	return m.shards[id%int64(len(m.shards))]
+}
+
+func (m *shardedManager) Store(s *Session) {
+	sh := m.shard(s.ID)
+	sh.Lock()
+	defer sh.Unlock()
+
+	sh.sessions[s.ID] = s
+}
+
+func (m *shardedManager) Load(id int64) (*Session, bool) {
+	sh := m.shard(id)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	s, ok := sh.sessions[id]
+	return s, ok
+}
+
+func (m *shardedManager) Delete(s *Session) bool {
+	sh := m.shard(s.ID)
+	sh.Lock()
+	defer sh.Unlock()
+
+	if sh.sessions[s.ID] != s {
+		return false
+	}
+	delete(sh.sessions, s.ID)
+	return true
+}
+
+func (m *shardedManager) Len() int {
+	n := 0
+	for _, sh := range m.shards {
+		sh.RLock()
+		n += len(sh.sessions)
+		sh.RUnlock()
+	}
+	return n
+}
+
+// Range iterates over a snapshot of each shard, so fn is called without
+// holding the lock
+func (m *shardedManager) Range(fn func(*Session) bool) {
+	for _, sh := range m.shards {
+		sh.RLock()
+		sessions := make([]*Session, 0, len(sh.sessions))
+		for _, s := range sh.sessions {
+			sessions = append(sessions, s)
+		}
+		sh.RUnlock()
+
+		for _, s := range sessions {
+			if !fn(s) {
+				return
+			}
+		}
+	}
+}
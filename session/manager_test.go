@@ -0,0 +1,83 @@
+package session
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestShardedManager(t *testing.T) {
+	m := NewShardedManager(4)
+	s1, s2 := New(nil), New(nil)
+	m.Store(s1)
+	m.Store(s2)
+	if m.Len() != 2 {
+		t.Fatalf("expect 2 sessions, got %d", m.Len())
+	}
+	if s, ok := m.Load(s1.ID); !ok || s != s1 {
+		t.Fatal("session should be loaded")
+	}
+
+	// the session of the same id has been replaced
+	s3 := &Session{ID: s1.ID}
+	m.Store(s3)
+	if m.Delete(s1) {
+		t.Fatal("replaced session should not be deleted")
+	}
+	if !m.Delete(s3) || m.Len() != 1 {
+		t.Fatal("session should be deleted")
+	}
+	if _, ok := m.Load(s1.ID); ok {
+		t.Fatal("deleted session should not be loaded")
+	}
+}
+
+func TestShardedManager_Range(t *testing.T) {
+	m := NewShardedManager(0)
+	for i := 0; i < 100; i++ {
+		m.Store(New(nil))
+	}
+
+	// deleting in fn should not dead lock
+	n := 0
+	m.Range(func(s *Session) bool {
+		m.Delete(s)
+		n++
+		return true
+	})
+	if n != 100 || m.Len() != 0 {
+		t.Fatalf("expect 100 sessions visited and deleted, got %d visited, %d left", n, m.Len())
+	}
+
+	m.Store(New(nil))
+	m.Store(New(nil))
+	n = 0
+	m.Range(func(s *Session) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatalf("range should stop, got %d visited", n)
+	}
+}
+
+func TestShardedManager_Concurrent(t *testing.T) {
+	m := NewShardedManager(8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s := New(nil)
+				m.Store(s)
+				m.Load(s.ID)
+				m.Range(func(*Session) bool { return true })
+				m.Delete(s)
+			}
+		}()
+	}
+	wg.Wait()
+	if m.Len() != 0 {
+		t.Fatalf("expect no session, got %d", m.Len())
+	}
+}
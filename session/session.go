@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"strings"
@@ -15,7 +16,8 @@ type NetworkEntity interface {
 	Send([]byte) error
 	Push(session *Session, route string, v interface{}) error
 	Response(session *Session, v interface{}) error
-	Call(session *Session, route string, reply interface{}, args ...interface{}) error
+	Call(ctx context.Context, session *Session, route string, reply interface{}, args ...interface{}) error
+	Invoke(fn func()) error
 	Close()
 }
 
@@ -26,6 +28,29 @@ var (
 	ErrReplyShouldBePtr = errors.New("reply should be a pointer")
 )
 
+// callback on session bound to a uid
+var boundCallback func(*Session)
+
+// OnBound set the callback which will be called after session bound to a uid
+func OnBound(fn func(*Session)) {
+	boundCallback = fn
+}
+
+// callback on session uid or data changed
+var changedCallback func(*Session)
+
+// OnChanged set the callback which will be called after the bound uid or
+// session data changed
+func OnChanged(fn func(*Session)) {
+	changedCallback = fn
+}
+
+func (s *Session) changed() {
+	if changedCallback != nil {
+		changedCallback(s)
+	}
+}
+
 // This session type as argument pass to Handler method, is a proxy session
 // for frontend session in frontend server or backend session in backend
 // server, correspond frontend session or backend session id as a field
@@ -33,23 +58,36 @@ var (
 //
 // This is user sessions, does not contain raw sockets information
 type Session struct {
-	ID        int64                  // session global unique id
-	Uid       int64                  // binding user id
-	Entity    NetworkEntity          // raw session id, agent in frontend server, or acceptor in backend server
-	LastID    uint                   // last request id
-	data      map[string]interface{} // session data store
-	lastTime  int64                  // last heartbeat time
-	serverIDs map[string]string      // map of server type -> server id
+	ID         int64                  // session global unique id
+	Uid        int64                  // binding user id
+	Remote     string                 // remote address of client
+	Entity     NetworkEntity          // raw session id, agent in frontend server, or acceptor in backend server
+	LastID     uint                   // last request id
+	TraceID    string                 // trace id of current message, forwarded to remote servers
+	SpanID     string                 // span id of current handler call, parent of spans in remote servers
+	ClientType string                 // type of client declared in handshake, e.g. native, web or bot
+	data       map[string]interface{} // session data store
+	lastTime   int64                  // last heartbeat time
+	serverIDs  map[string]string      // map of server type -> server id
+	tags       map[string]bool        // tags added by AddTag
+	ctx        context.Context        // canceled after session closed
+	cancel     context.CancelFunc     // cancel ctx
+	origin     *Session               // session which the view created from, see View
+
+	CloseReason CloseReason // why the session closed, available to session closed listeners
 }
 
 // Create new session instance
 func New(entity NetworkEntity) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Session{
 		ID:        service.Connections.SessionID(),
 		Entity:    entity,
 		data:      make(map[string]interface{}),
 		lastTime:  time.Now().Unix(),
 		serverIDs: make(map[string]string),
+		ctx:       ctx,
+		cancel:    cancel,
 	}
 }
 
@@ -73,9 +111,10 @@ func (s *Session) SetServerID(svrType, svrID string) {
 
 	if svrID == "" {
 		delete(s.serverIDs, svrType)
-		return
+	} else {
+		s.serverIDs[svrType] = svrID
 	}
-	s.serverIDs[svrType] = svrID
+	s.forward(func(o *Session) { o.SetServerID(svrType, svrID) })
 }
 
 // Session send packet data
@@ -99,14 +138,35 @@ func (s *Session) Bind(uid int64) error {
 		return ErrIllegalUID
 	}
 	s.Uid = uid
+	if s.forward(func(o *Session) { o.Bind(uid) }) {
+		return nil
+	}
+	if boundCallback != nil {
+		boundCallback(s)
+	}
+	s.changed()
 	return nil
 }
 
+// Call invoke remote method of the route with the default rpc timeout
 func (s *Session) Call(route string, reply interface{}, args ...interface{}) error {
+	return s.CallContext(context.Background(), route, reply, args...)
+}
+
+// CallContext invoke remote method of the route, the call will be abandoned
+// when the context is done
+func (s *Session) CallContext(ctx context.Context, route string, reply interface{}, args ...interface{}) error {
 	if reflect.TypeOf(reply).Kind() != reflect.Ptr {
 		return ErrReplyShouldBePtr
 	}
-	return s.Entity.Call(s, route, reply, args...)
+	return s.Entity.Call(ctx, s, route, reply, args...)
+}
+
+// Invoke push the function to the logic goroutine of the session, which
+// is the goroutine that handler methods run on, it's used to marshal async
+// results back to the session without racing with handler execution
+func (s *Session) Invoke(fn func()) error {
+	return s.Entity.Invoke(fn)
 }
 
 func (s *Session) Close() {
@@ -115,10 +175,18 @@ func (s *Session) Close() {
 
 func (s *Session) Remove(key string) {
 	delete(s.data, key)
+	if s.forward(func(o *Session) { o.Remove(key) }) {
+		return
+	}
+	s.changed()
 }
 
 func (s *Session) Set(key string, value interface{}) {
 	s.data[key] = value
+	if s.forward(func(o *Session) { o.Set(key, value) }) {
+		return
+	}
+	s.changed()
 }
 
 func (s *Session) HasKey(key string) bool {
@@ -307,9 +375,22 @@ func (s *Session) State() map[string]interface{} {
 // Restore session state after reconnect
 func (s *Session) Restore(data map[string]interface{}) {
 	s.data = data
+	if s.origin != nil {
+		state := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			state[k] = v
+		}
+		s.forward(func(o *Session) { o.Restore(state) })
+		return
+	}
+	s.changed()
 }
 
 func (s *Session) Clear() {
 	log.Debugf("Clear session data: Id=%d, Uid=%d", s.ID, s.Uid)
 	s.data = map[string]interface{}{}
+	if s.forward((*Session).Clear) {
+		return
+	}
+	s.changed()
 }
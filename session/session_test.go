@@ -173,3 +173,77 @@ func TestSession_Restore(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestSession_OnChanged(t *testing.T) {
+	var count int
+	OnChanged(func(s *Session) { count++ })
+	defer OnChanged(nil)
+
+	s := New(nil)
+	s.Bind(100)
+	s.Set("key", 1)
+	s.Remove("key")
+	s.Restore(map[string]interface{}{})
+	s.Clear()
+	if count != 5 {
+		t.Fatalf("expect 5 changes, got %d", count)
+	}
+}
+
+type statsEntityStub struct {
+	NetworkEntity
+}
+
+func (statsEntityStub) Stats() Stats {
+	return Stats{BytesIn: 10, PacketsIn: 1}
+}
+
+func TestSession_Stats(t *testing.T) {
+	if st := New(nil).Stats(); st != (Stats{}) {
+		t.Fatalf("zero stats expected, got %+v", st)
+	}
+	if st := New(statsEntityStub{}).Stats(); st.BytesIn != 10 || st.PacketsIn != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+}
+
+func TestSession_Tags(t *testing.T) {
+	s := New(nil)
+	s.AddTag("zone:1")
+	s.AddTag("zone:1")
+	if !s.HasTag("zone:1") || len(s.Tags()) != 1 {
+		t.Fatalf("unexpected tags: %v", s.Tags())
+	}
+	s.RemoveTag("zone:1")
+	if s.HasTag("zone:1") || len(s.Tags()) != 0 {
+		t.Fatalf("tag should be removed, got %v", s.Tags())
+	}
+}
+
+func TestSession_View(t *testing.T) {
+	e := &callEntity{tasks: make(chan func(), 8)}
+	s := New(e)
+	s.Set("level", 1)
+	s.LastID = 7
+
+	v := s.View()
+	s.LastID = 8
+	s.Set("level", 2)
+
+	v.Bind(100)
+	v.Set("gold", 10)
+	v.AddTag("zone:1")
+	if v.LastID != 7 || v.Uid != 100 || v.Int("level") != 1 || v.Int("gold") != 10 || !v.HasTag("zone:1") {
+		t.Fatalf("view should see its own changes, got %+v", v)
+	}
+	if s.Uid != 0 || s.HasKey("gold") || s.HasTag("zone:1") {
+		t.Fatal("changes should not be applied before invoked")
+	}
+
+	for len(e.tasks) > 0 {
+		(<-e.tasks)()
+	}
+	if s.Uid != 100 || s.Int("gold") != 10 || s.Int("level") != 2 || !s.HasTag("zone:1") {
+		t.Fatalf("changes should be replayed on session, got uid=%d data=%v", s.Uid, s.State())
+	}
+}
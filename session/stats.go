@@ -0,0 +1,29 @@
+package session
+
+import "time"
+
+// Stats represents the traffic statistics of the connection of a session
+type Stats struct {
+	BytesIn       int64     // bytes received from client
+	BytesOut      int64     // bytes sent to client
+	PacketsIn     int64     // packets received from client
+	PacketsOut    int64     // packets sent to client
+	LastHeartbeat time.Time // last time heartbeat received
+	RecvQueue     int       // packets waiting to be processed
+	SendQueue     int       // packets waiting to be written
+}
+
+// statsEntity is implemented by the network entities which track traffic
+// statistics, e.g. agent in frontend server
+type statsEntity interface {
+	Stats() Stats
+}
+
+// Stats returns the traffic statistics of the connection, it's safe to call
+// in any goroutine, zero value returned for sessions in backend server
+func (s *Session) Stats() Stats {
+	if e, ok := s.Entity.(statsEntity); ok {
+		return e.Stats()
+	}
+	return Stats{}
+}
@@ -0,0 +1,56 @@
+package session
+
+// callback on session tag added or removed
+var tagCallback func(s *Session, tag string, added bool)
+
+// OnTagChanged set the callback which will be called after a tag added to or
+// removed from session
+func OnTagChanged(fn func(s *Session, tag string, added bool)) {
+	tagCallback = fn
+}
+
+// AddTag add the tag to session, e.g. "zone:12", sessions of a tag can be
+// queried and pushed together, which is lighter than channel membership
+func (s *Session) AddTag(tag string) {
+	if s.tags == nil {
+		s.tags = make(map[string]bool)
+	}
+	if s.tags[tag] {
+		return
+	}
+	s.tags[tag] = true
+	if s.forward(func(o *Session) { o.AddTag(tag) }) {
+		return
+	}
+	if tagCallback != nil {
+		tagCallback(s, tag, true)
+	}
+}
+
+// RemoveTag remove the tag from session
+func (s *Session) RemoveTag(tag string) {
+	if !s.tags[tag] {
+		return
+	}
+	delete(s.tags, tag)
+	if s.forward(func(o *Session) { o.RemoveTag(tag) }) {
+		return
+	}
+	if tagCallback != nil {
+		tagCallback(s, tag, false)
+	}
+}
+
+// HasTag returns whether the session has the tag
+func (s *Session) HasTag(tag string) bool {
+	return s.tags[tag]
+}
+
+// Tags returns all tags of session
+func (s *Session) Tags() []string {
+	tags := make([]string, 0, len(s.tags))
+	for tag := range s.tags {
+		tags = append(tags, tag)
+	}
+	return tags
+}
@@ -0,0 +1,40 @@
+package session
+
+import "github.com/lonnng/starx/log"
+
+// View returns a request scoped view of the session for handlers which run
+// off the logic goroutine, e.g. on a worker pool. The view carries the id of
+// current request and a snapshot of session state, changes made through the
+// view are applied to the snapshot and replayed on the session by Invoke, so
+// they are visible to the following messages without racing with the logic
+// goroutine
+func (s *Session) View() *Session {
+	v := *s
+	v.origin = s
+	v.data = make(map[string]interface{}, len(s.data))
+	for k, val := range s.data {
+		v.data[k] = val
+	}
+	v.serverIDs = make(map[string]string, len(s.serverIDs))
+	for k, id := range s.serverIDs {
+		v.serverIDs[k] = id
+	}
+	v.tags = make(map[string]bool, len(s.tags))
+	for tag := range s.tags {
+		v.tags[tag] = true
+	}
+	return &v
+}
+
+// forward replay the change on the session which the view created from,
+// returns false if s is not a view
+func (s *Session) forward(fn func(*Session)) bool {
+	origin := s.origin
+	if origin == nil {
+		return false
+	}
+	if err := origin.Invoke(func() { fn(origin) }); err != nil {
+		log.Warnf("session %d change discarded: %s", origin.ID, err.Error())
+	}
+	return true
+}
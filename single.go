@@ -0,0 +1,79 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+	routelib "github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+// defaultSinglePort is the port of server in single process mode, which can
+// be overridden by STARX_PORT or -port
+const defaultSinglePort = 3250
+
+// ErrSingleProcess returned when calling a remote server in single process
+// mode, there is no rpc subsystem in single process mode
+var ErrSingleProcess = errors.New("rpc is not available in single process mode")
+
+// singleServer returns the server config in single process mode, which is a
+// frontend server of application name type, id defaults to application name
+func singleServer() *cluster.ServerConfig {
+	c := &cluster.ServerConfig{
+		Type:       app.name,
+		Id:         env.serverId,
+		Port:       defaultSinglePort,
+		IsFrontend: true,
+	}
+	if c.Id == "" {
+		c.Id = app.name
+	}
+	return c
+}
+
+// singleRoute rewrites the server type of route to current server type in
+// single process mode, all routes are served locally, returns false if no
+// local service of the route
+func singleRoute(session *session.Session, r *routelib.Route) bool {
+	if r.ServerType == app.config.Type {
+		return true
+	}
+	if _, ok := handler.serviceIn(r.Namespace, r.Service); !ok {
+		err := fmt.Errorf("route %s targets server type %s, which is not available in single process mode",
+			r.String(), r.ServerType)
+		sessionLogger(session).Errorf("%s", err.Error())
+		respondError(session, env.errorCodes.NotFound, err)
+		return false
+	}
+	r.ServerType = app.config.Type
+	return true
+}
+
+// warnSingle logs the features disabled in single process mode
+func warnSingle() {
+	if discovery.provider != nil {
+		log.Warnf("cluster provider is ignored in single process mode")
+	}
+}
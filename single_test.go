@@ -0,0 +1,53 @@
+package starx
+
+import (
+	"context"
+	"testing"
+
+	routelib "github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+func TestSingleServer(t *testing.T) {
+	defer func(id string) { env.serverId = id }(env.serverId)
+
+	env.serverId = ""
+	c := singleServer()
+	if c.Type != app.name || c.Id != app.name || !c.IsFrontend || c.Port != defaultSinglePort {
+		t.Fatalf("unexpected config: %s", c.String())
+	}
+
+	env.serverId = "game-0"
+	if c := singleServer(); c.Id != "game-0" {
+		t.Fatalf("id should be game-0, got %s", c.Id)
+	}
+}
+
+func TestSingleRoute(t *testing.T) {
+	handler.register(&TestComp{})
+	s := session.New(nil)
+
+	r := &routelib.Route{ServerType: "chat", Service: "TestComp", Method: "HandleJson"}
+	if !singleRoute(s, r) {
+		t.Fatal("route of local service should be served")
+	}
+	if r.ServerType != app.config.Type {
+		t.Fatalf("server type should be rewritten to %s, got %s", app.config.Type, r.ServerType)
+	}
+
+	r = &routelib.Route{ServerType: "chat", Service: "Room", Method: "Join"}
+	if singleRoute(s, r) {
+		t.Fatal("route of foreign service should be dropped")
+	}
+}
+
+func TestSingleCall(t *testing.T) {
+	defer func() { env.single = false }()
+	env.single = true
+
+	a := &agent{}
+	var reply string
+	if err := a.Call(context.Background(), session.New(nil), "chat.Room.Join", &reply); err != ErrSingleProcess {
+		t.Fatalf("expect ErrSingleProcess, got %v", err)
+	}
+}
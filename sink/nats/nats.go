@@ -0,0 +1,154 @@
+package nats
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/log"
+)
+
+var ErrProtocol = errors.New("nats: invalid protocol message")
+
+const timeout = 5 * time.Second
+
+// Sink publish events to nats server, the topic prefixed with prefix is used
+// as subject, a single connection will be established lazily and
+// re-established after network error
+type Sink struct {
+	sync.Mutex // protect following
+	addr       string
+	prefix     string // prefix of subjects
+	conn       net.Conn
+}
+
+// NewSink returns a sink connecting the nats server at addr, e.g. events of
+// topic session.created are published to subject starx.session.created
+// with prefix "starx."
+func NewSink(addr, prefix string) *Sink {
+	return &Sink{addr: addr, prefix: prefix}
+}
+
+func (s *Sink) Publish(topic string, data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 0, len(s.prefix)+len(topic)+len(data)+32)
+	buf = append(buf, "PUB "...)
+	buf = append(buf, s.prefix...)
+	buf = append(buf, topic...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(len(data)), 10)
+	buf = append(buf, '\r', '\n')
+	buf = append(buf, data...)
+	buf = append(buf, '\r', '\n')
+
+	s.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := s.conn.Write(buf); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close the connection to nats server
+func (s *Sink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// connect to nats server, and wait for the PONG of PING sent after CONNECT,
+// which ensures the connection accepted, should be called with lock held
+func (s *Sink) connect() error {
+	conn, err := net.DialTimeout("tcp", s.addr, timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(conn)
+
+	fail := func(err error) error {
+		conn.Close()
+		return err
+	}
+	line, err := readLine(r)
+	if err != nil {
+		return fail(err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fail(ErrProtocol)
+	}
+	if _, err := conn.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"starx\"}\r\nPING\r\n")); err != nil {
+		return fail(err)
+	}
+	if line, err = readLine(r); err != nil {
+		return fail(err)
+	}
+	if strings.HasPrefix(line, "-ERR") {
+		return fail(errors.New("nats: " + strings.TrimSpace(line[4:])))
+	}
+	if line != "PONG" {
+		return fail(ErrProtocol)
+	}
+
+	conn.SetDeadline(time.Time{})
+	s.conn = conn
+	go s.serve(conn, r)
+	return nil
+}
+
+// serve the messages sent by server, PING will be replied, otherwise server
+// closes the connection
+func (s *Sink) serve(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			break
+		}
+		switch {
+		case line == "PING":
+			s.Lock()
+			conn.SetWriteDeadline(time.Now().Add(timeout))
+			conn.Write([]byte("PONG\r\n"))
+			s.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Errorf("nats error: %s", strings.TrimSpace(line[4:]))
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.conn == conn {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", ErrProtocol
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,104 @@
+package nats
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type message struct {
+	subject string
+	data    string
+}
+
+// fakeServer accept connections, handshake like nats server, and send the
+// published messages to channel
+func fakeServer(t *testing.T) (net.Listener, chan message) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(chan message, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("INFO {\"server_id\":\"fake\"}\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := readLine(r)
+					if err != nil {
+						return
+					}
+					switch fields := strings.Fields(line); fields[0] {
+					case "PING":
+						conn.Write([]byte("PONG\r\n"))
+						// ping client after connected
+						conn.Write([]byte("PING\r\n"))
+					case "PUB":
+						n, _ := strconv.Atoi(fields[2])
+						data := make([]byte, n+2)
+						if _, err := io.ReadFull(r, data); err != nil {
+							return
+						}
+						messages <- message{subject: fields[1], data: string(data[:n])}
+					}
+				}
+			}()
+		}
+	}()
+	return l, messages
+}
+
+func TestSink(t *testing.T) {
+	l, messages := fakeServer(t)
+	defer l.Close()
+
+	s := NewSink(l.Addr().String(), "starx.")
+	defer s.Close()
+
+	if err := s.Publish("session.created", []byte(`{"sid":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-messages:
+		if m.subject != "starx.session.created" || m.data != `{"sid":1}` {
+			t.Fatalf("unexpected message: %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message should be published")
+	}
+
+	// reconnect after connection closed
+	s.Close()
+	if err := s.Publish("game.win", []byte("10")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-messages:
+		if m.subject != "starx.game.win" || m.data != "10" {
+			t.Fatalf("unexpected message: %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message should be published after reconnected")
+	}
+}
+
+func TestSinkConnectError(t *testing.T) {
+	l, _ := fakeServer(t)
+	addr := l.Addr().String()
+	l.Close()
+
+	if err := NewSink(addr, "").Publish("topic", nil); err == nil {
+		t.Fatal("publish should fail when server unavailable")
+	}
+}
@@ -0,0 +1,11 @@
+// Package sink defines the interface of message queues which framework
+// events and custom events are published to, so analytics and other backend
+// systems can consume them without coupling to the rpc mesh.
+package sink
+
+// Sink publishes events to message queue, e.g. NATS or Kafka, Publish is
+// called by a single goroutine, events are dropped when Publish returns
+// error, implementations should reconnect on the next call
+type Sink interface {
+	Publish(topic string, data []byte) error
+}
@@ -0,0 +1,97 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/lonnng/starx/capture"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
+)
+
+// PacketSniffer receives the packets on the wire of client connections, raw
+// is the bytes of the packet including the framing of codec, it's called in
+// the read and write goroutines of connections, so it should never block and
+// raw should not be modified
+type PacketSniffer func(dir capture.Direction, sid int64, t packet.PacketType, raw []byte)
+
+func sniffing() bool {
+	return env.sniffer != nil || env.capture != nil
+}
+
+func sniff(dir capture.Direction, sid int64, t packet.PacketType, raw []byte) {
+	if env.sniffer != nil {
+		env.sniffer(dir, sid, t, raw)
+	}
+	if env.capture != nil {
+		err := env.capture.Write(&capture.Packet{
+			Time:      time.Now().UnixNano(),
+			Sid:       sid,
+			Direction: dir,
+			Type:      t,
+			Raw:       raw,
+		})
+		if err != nil {
+			log.Errorf("capture packet error: %s", err.Error())
+		}
+	}
+}
+
+// sniffInbound sniff the packet decoded by the codec of agent, the raw bytes
+// are encoded again by the codec, since decoder reads ahead of packets
+func (a *agent) sniffInbound(p *packet.Packet) {
+	if !sniffing() {
+		return
+	}
+	raw, err := a.packetCodec().Encode(p)
+	if err != nil {
+		sessionLogger(a.session).Errorf("sniff inbound packet error: %s", err.Error())
+		return
+	}
+	sniff(capture.Inbound, a.session.ID, p.Type, raw)
+}
+
+// sniffOutbound sniff the packet encoded by the codec of agent, packet type
+// is decoded by the codec
+func (a *agent) sniffOutbound(raw []byte) {
+	if !sniffing() {
+		return
+	}
+	p, err := a.packetCodec().NewDecoder(bytes.NewReader(raw)).Decode()
+	if err != nil {
+		sessionLogger(a.session).Errorf("sniff outbound packet error: %s", err.Error())
+		return
+	}
+	t := p.Type
+	packet.Free(p)
+	sniff(capture.Outbound, a.session.ID, t, raw)
+}
+
+func closeCapture() {
+	if env.capture == nil {
+		return
+	}
+	if err := env.capture.Close(); err != nil {
+		log.Errorf("close capture error: %s", err.Error())
+	}
+}
@@ -0,0 +1,102 @@
+package starx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/lonnng/starx/capture"
+	"github.com/lonnng/starx/packet"
+)
+
+func TestPacketSniffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "packets.cap")
+	if err := EnableCapture(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		sniffed []*capture.Packet
+	)
+	SetPacketSniffer(func(dir capture.Direction, sid int64, t packet.PacketType, raw []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		sniffed = append(sniffed, &capture.Packet{Sid: sid, Direction: dir, Type: t, Raw: raw})
+	})
+	defer func() {
+		closeCapture()
+		env.sniffer, env.capture = nil, nil
+	}()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go handler.handle(conn)
+
+	heartbeat, _ := packet.Pack(&packet.Packet{Type: packet.Heartbeat})
+	if _, err := peer.Write(heartbeat); err != nil {
+		t.Fatal(err)
+	}
+
+	var a *agent
+	waitFor(t, func() bool {
+		transporter.rangeAgents(func(ag *agent) bool {
+			if ag.socket == conn {
+				a = ag
+			}
+			return true
+		})
+		return a != nil && a.Stats().PacketsIn == 1
+	})
+
+	kick, _ := packet.Pack(&packet.Packet{Type: packet.Kick, Data: []byte("bye")})
+	a.Send(kick)
+	if _, err := peer.Read(make([]byte, len(kick))); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sniffed) == 2
+	})
+	expects := []*capture.Packet{
+		{Sid: a.session.ID, Direction: capture.Inbound, Type: packet.Heartbeat, Raw: heartbeat},
+		{Sid: a.session.ID, Direction: capture.Outbound, Type: packet.Kick, Raw: kick},
+	}
+	mu.Lock()
+	for i, p := range sniffed {
+		expect := expects[i]
+		if p.Sid != expect.Sid || p.Direction != expect.Direction || p.Type != expect.Type || !bytes.Equal(p.Raw, expect.Raw) {
+			t.Fatalf("sniffed packet %d mismatch: %+v", i, p)
+		}
+	}
+	mu.Unlock()
+
+	closeCapture()
+	env.capture = nil
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := capture.NewReader(f)
+	for i, expect := range expects {
+		p, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Sid != expect.Sid || p.Direction != expect.Direction || p.Type != expect.Type || !bytes.Equal(p.Raw, expect.Raw) || p.Time == 0 {
+			t.Fatalf("captured packet %d mismatch: %+v", i, p)
+		}
+	}
+}
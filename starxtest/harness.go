@@ -0,0 +1,136 @@
+package starxtest
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/serialize"
+	"github.com/lonnng/starx/serialize/json"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	ErrServiceNotFound = errors.New("starxtest: service not found")
+	ErrMethodNotFound  = errors.New("starxtest: method not found")
+)
+
+// Harness invokes the handler methods of components directly with fabricated
+// messages, the same as server does, the output of handlers are captured by
+// the fake network entity of session
+type Harness struct {
+	serializer serialize.Serializer
+	services   map[string]*component.Service
+	comps      []component.Component // in registration order
+	lastID     uint
+}
+
+// NewHarness scan the handler methods of components, Init and AfterInit of
+// components are called
+func NewHarness(comps ...component.Component) (*Harness, error) {
+	h := &Harness{
+		serializer: json.NewSerializer(),
+		services:   make(map[string]*component.Service),
+		comps:      comps,
+	}
+	for _, c := range comps {
+		s := &component.Service{
+			Type: reflect.TypeOf(c),
+			Rcvr: reflect.ValueOf(c),
+		}
+		s.Name = reflect.Indirect(s.Rcvr).Type().Name()
+		if err := s.ScanHandler(); err != nil {
+			return nil, err
+		}
+		if _, ok := h.services[s.Name]; ok {
+			return nil, errors.New("starxtest: service already defined: " + s.Name)
+		}
+		h.services[s.Name] = s
+	}
+
+	for _, c := range comps {
+		c.Init()
+	}
+	for _, c := range comps {
+		c.AfterInit()
+	}
+	return h, nil
+}
+
+// SetSerializer set the serializer of messages, which should be called
+// before creating sessions, json by default
+func (h *Harness) SetSerializer(s serialize.Serializer) {
+	h.serializer = s
+}
+
+// NewSession returns a session of fake network entity, messages are
+// serialized by the serializer of harness
+func (h *Harness) NewSession() *session.Session {
+	return session.New(NewEntity(h.serializer))
+}
+
+// Request invoke the handler method of route with a request message, v is
+// serialized as message data unless it's []byte, the error returned by handler
+// is returned
+func (h *Harness) Request(s *session.Session, route string, v interface{}) error {
+	h.lastID++
+	s.LastID = h.lastID
+	return h.call(s, route, v)
+}
+
+// Notify invoke the handler method of route with a notify message
+func (h *Harness) Notify(s *session.Session, route string, v interface{}) error {
+	s.LastID = 0
+	return h.call(s, route, v)
+}
+
+// Shutdown calls BeforeShutdown and Shutdown of components
+func (h *Harness) Shutdown() {
+	for _, c := range h.comps {
+		c.BeforeShutdown()
+	}
+	for _, c := range h.comps {
+		c.Shutdown()
+	}
+}
+
+func (h *Harness) call(s *session.Session, r string, v interface{}) error {
+	rt, err := route.Decode(r)
+	if err != nil {
+		return err
+	}
+
+	service, ok := h.services[rt.Service]
+	if !ok {
+		return ErrServiceNotFound
+	}
+	m, ok := service.HandlerMethods[rt.Method]
+	if !ok {
+		return ErrMethodNotFound
+	}
+
+	data, ok := v.([]byte)
+	if !ok {
+		if data, err = h.serializer.Serialize(v); err != nil {
+			return err
+		}
+	}
+
+	var arg interface{}
+	if m.Raw {
+		arg = data
+	} else {
+		arg = reflect.New(m.Type.Elem()).Interface()
+		if err := h.serializer.Deserialize(data, arg); err != nil {
+			return err
+		}
+	}
+
+	m.IncCalls()
+	ret := m.Method.Func.Call(m.Args(service.Rcvr, s.Context(), s, arg))
+	if err := ret[0].Interface(); err != nil {
+		return err.(error)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Package starxtest provides a mock session and a handler harness for unit
+// testing components without opening sockets or running server.
+//
+//	h, err := starxtest.NewHarness(&Room{})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	s := h.NewSession()
+//	if err := h.Request(s, "Room.Join", &JoinRequest{Name: "foo"}); err != nil {
+//		t.Fatal(err)
+//	}
+//	res := &JoinResponse{}
+//	if err := starxtest.EntityOf(s).LastResponse().Decode(res); err != nil {
+//		t.Fatal(err)
+//	}
+package starxtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/serialize"
+	"github.com/lonnng/starx/serialize/json"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	ErrNoStub = errors.New("starxtest: no stub for the route")
+	ErrClosed = errors.New("starxtest: session closed")
+)
+
+// entityID is the last id of entities
+var entityID int64
+
+// Output represents a message written by handler
+type Output struct {
+	Type       message.MessageType // message.Response or message.Push
+	ID         uint                // request id of response
+	Route      string              // route of push
+	Data       []byte              // serialized data
+	serializer serialize.Serializer
+}
+
+// Decode deserialize the data of output to v
+func (o *Output) Decode(v interface{}) error {
+	return o.serializer.Deserialize(o.Data, v)
+}
+
+// CallFunc stubs the remote method called by handler
+type CallFunc func(reply interface{}, args ...interface{}) error
+
+// Entity is a fake network entity of session, which captures the responses
+// and pushes written by handlers, and the raw data sent by Send
+type Entity struct {
+	id         int64
+	serializer serialize.Serializer
+
+	sync.Mutex // protect following
+	outputs    []*Output
+	sent       [][]byte
+	stubs      map[string]CallFunc
+	closed     bool
+}
+
+// NewEntity returns a fake network entity, messages are serialized by the
+// serializer
+func NewEntity(serializer serialize.Serializer) *Entity {
+	return &Entity{
+		id:         atomic.AddInt64(&entityID, 1),
+		serializer: serializer,
+		stubs:      make(map[string]CallFunc),
+	}
+}
+
+// NewSession returns a session of fake network entity, messages are
+// serialized by json serializer
+func NewSession() *session.Session {
+	return session.New(NewEntity(json.NewSerializer()))
+}
+
+// EntityOf returns the fake network entity of session, panics if the session
+// is not created by starxtest
+func EntityOf(s *session.Session) *Entity {
+	return s.Entity.(*Entity)
+}
+
+func (e *Entity) ID() int64 {
+	return e.id
+}
+
+func (e *Entity) Send(data []byte) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+	e.sent = append(e.sent, data)
+	return nil
+}
+
+func (e *Entity) Push(s *session.Session, route string, v interface{}) error {
+	return e.write(&Output{Type: message.Push, Route: route}, v)
+}
+
+func (e *Entity) Response(s *session.Session, v interface{}) error {
+	return e.write(&Output{Type: message.Response, ID: s.LastID}, v)
+}
+
+// Call the stub of route registered by Stub, returns ErrNoStub if not found
+func (e *Entity) Call(ctx context.Context, s *session.Session, route string, reply interface{}, args ...interface{}) error {
+	e.Lock()
+	fn, ok := e.stubs[route]
+	e.Unlock()
+	if !ok {
+		return ErrNoStub
+	}
+	return fn(reply, args...)
+}
+
+// Invoke calls the function immediately
+func (e *Entity) Invoke(fn func()) error {
+	fn()
+	return nil
+}
+
+func (e *Entity) Close() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.closed = true
+}
+
+// Stub the remote method of route called by Session.Call
+func (e *Entity) Stub(route string, fn CallFunc) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.stubs[route] = fn
+}
+
+// Outputs returns the responses and pushes in the order written
+func (e *Entity) Outputs() []*Output {
+	e.Lock()
+	defer e.Unlock()
+
+	return append([]*Output(nil), e.outputs...)
+}
+
+// Responses returns the responses in the order written
+func (e *Entity) Responses() []*Output {
+	return e.filter(func(o *Output) bool { return o.Type == message.Response })
+}
+
+// Pushes returns the pushes of route in the order written, all pushes are
+// returned if route is empty
+func (e *Entity) Pushes(route string) []*Output {
+	return e.filter(func(o *Output) bool {
+		return o.Type == message.Push && (route == "" || o.Route == route)
+	})
+}
+
+// LastResponse returns the last response, nil if no response
+func (e *Entity) LastResponse() *Output {
+	responses := e.Responses()
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses[len(responses)-1]
+}
+
+// Sent returns the raw data sent by Session.Send
+func (e *Entity) Sent() [][]byte {
+	e.Lock()
+	defer e.Unlock()
+
+	return append([][]byte(nil), e.sent...)
+}
+
+// Closed reports whether the session has been closed
+func (e *Entity) Closed() bool {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.closed
+}
+
+// Reset clear the captured outputs and sent data
+func (e *Entity) Reset() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.outputs, e.sent = nil, nil
+}
+
+func (e *Entity) write(o *Output, v interface{}) error {
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = e.serializer.Serialize(v); err != nil {
+			return err
+		}
+	}
+	o.Data, o.serializer = data, e.serializer
+
+	e.Lock()
+	defer e.Unlock()
+
+	if e.closed {
+		return ErrClosed
+	}
+	e.outputs = append(e.outputs, o)
+	return nil
+}
+
+func (e *Entity) filter(fn func(*Output) bool) []*Output {
+	e.Lock()
+	defer e.Unlock()
+
+	var outputs []*Output
+	for _, o := range e.outputs {
+		if fn(o) {
+			outputs = append(outputs, o)
+		}
+	}
+	return outputs
+}
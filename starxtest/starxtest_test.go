@@ -0,0 +1,116 @@
+package starxtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/session"
+)
+
+type JoinRequest struct {
+	Name string `json:"name"`
+}
+
+type JoinResponse struct {
+	Code  int    `json:"code"`
+	Level int    `json:"level"`
+	Name  string `json:"name"`
+}
+
+type Room struct {
+	component.Base
+	inited, shutdown bool
+}
+
+func (r *Room) Init()     { r.inited = true }
+func (r *Room) Shutdown() { r.shutdown = true }
+
+func (r *Room) Join(s *session.Session, req *JoinRequest) error {
+	if req.Name == "" {
+		return errors.New("name required")
+	}
+	var level int
+	if err := s.Call("game.Player.Level", &level, req.Name); err != nil {
+		return err
+	}
+	if err := s.Push("onJoin", req); err != nil {
+		return err
+	}
+	return s.Response(&JoinResponse{Level: level, Name: req.Name})
+}
+
+func (r *Room) Leave(s *session.Session, data []byte) error {
+	s.Close()
+	return nil
+}
+
+func TestHarness(t *testing.T) {
+	room := &Room{}
+	h, err := NewHarness(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !room.inited {
+		t.Fatal("component should be initialized")
+	}
+
+	s := h.NewSession()
+	e := EntityOf(s)
+	if err := h.Request(s, "Room.Join", &JoinRequest{Name: "foo"}); err != ErrNoStub {
+		t.Fatalf("expect ErrNoStub, got %v", err)
+	}
+
+	e.Stub("game.Player.Level", func(reply interface{}, args ...interface{}) error {
+		if args[0] != "foo" {
+			return errors.New("unknown player")
+		}
+		*reply.(*int) = 10
+		return nil
+	})
+	if err := h.Request(s, "connector.Room.Join", []byte(`{"name":"foo"}`)); err != nil {
+		t.Fatal(err)
+	}
+	res := &JoinResponse{}
+	if err := e.LastResponse().Decode(res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Level != 10 || res.Name != "foo" || e.LastResponse().ID != 2 {
+		t.Fatalf("unexpected response: %+v, id: %d", res, e.LastResponse().ID)
+	}
+	if pushes := e.Pushes("onJoin"); len(pushes) != 1 || string(pushes[0].Data) != `{"name":"foo"}` {
+		t.Fatalf("unexpected pushes: %v", pushes)
+	}
+
+	if err := h.Request(s, "Room.Join", &JoinRequest{}); err == nil || err.Error() != "name required" {
+		t.Fatalf("expect handler error, got %v", err)
+	}
+	if err := h.Notify(s, "Room.Missing", nil); err != ErrMethodNotFound {
+		t.Fatalf("expect ErrMethodNotFound, got %v", err)
+	}
+	if err := h.Notify(s, "Lobby.Join", nil); err != ErrServiceNotFound {
+		t.Fatalf("expect ErrServiceNotFound, got %v", err)
+	}
+
+	e.Reset()
+	if err := h.Notify(s, "Room.Leave", []byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	if !e.Closed() || len(e.Outputs()) != 0 {
+		t.Fatal("session should be closed")
+	}
+	if err := s.Push("onJoin", nil); err != ErrClosed {
+		t.Fatalf("expect ErrClosed, got %v", err)
+	}
+
+	h.Shutdown()
+	if !room.shutdown {
+		t.Fatal("component should be shut down")
+	}
+}
+
+func TestNewHarnessDuplicated(t *testing.T) {
+	if _, err := NewHarness(&Room{}, &Room{}); err == nil {
+		t.Fatal("duplicated service should be refused")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/metrics"
+	"github.com/lonnng/starx/session"
+)
+
+// Statistics represents the traffic statistics of current server
+type Statistics struct {
+	Sessions       int64 // current connected sessions
+	BytesIn        int64 // bytes received from clients
+	BytesOut       int64 // bytes sent to clients
+	PacketsIn      int64 // packets received from clients
+	PacketsOut     int64 // packets sent to clients
+	PacketsDropped int64 // outbound packets dropped under backpressure
+	RecvQueue      int   // packets waiting to be processed of all sessions
+	SendQueue      int   // packets waiting to be written of all sessions
+}
+
+// agentStats counts the traffic of an agent, updated with atomics
+type agentStats struct {
+	bytesIn    int64
+	bytesOut   int64
+	packetsIn  int64
+	packetsOut int64
+}
+
+// Stats returns the traffic statistics of the agent, implementation for
+// statistics of session
+func (a *agent) Stats() session.Stats {
+	return session.Stats{
+		BytesIn:       atomic.LoadInt64(&a.stats.bytesIn),
+		BytesOut:      atomic.LoadInt64(&a.stats.bytesOut),
+		PacketsIn:     atomic.LoadInt64(&a.stats.packetsIn),
+		PacketsOut:    atomic.LoadInt64(&a.stats.packetsOut),
+		LastHeartbeat: time.Unix(atomic.LoadInt64(&a.lastTime), 0),
+		RecvQueue:     len(a.recvBuffer),
+		SendQueue:     a.queued(),
+	}
+}
+
+// Stats returns the traffic statistics of current server, counters are
+// accumulated since startup, e.g. poll it periodically for dashboards
+func Stats() *Statistics {
+	s := &Statistics{
+		Sessions:       metrics.Sessions.Value(),
+		BytesIn:        metrics.BytesReceived.Value(),
+		BytesOut:       metrics.BytesSent.Value(),
+		PacketsIn:      metrics.PacketsReceived.Value(),
+		PacketsOut:     metrics.PacketsSent.Value(),
+		PacketsDropped: metrics.PacketsDropped.Value(),
+	}
+
+	transporter.rangeAgents(func(a *agent) bool {
+		s.RecvQueue += len(a.recvBuffer)
+		s.SendQueue += a.queued()
+		return true
+	})
+	return s
+}
@@ -0,0 +1,49 @@
+package starx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestStats(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go handler.handle(conn)
+
+	heartbeat, _ := packet.Pack(&packet.Packet{Type: packet.Heartbeat})
+	if _, err := peer.Write(heartbeat); err != nil {
+		t.Fatal(err)
+	}
+
+	var a *agent
+	waitFor(t, func() bool {
+		transporter.rangeAgents(func(ag *agent) bool {
+			if ag.socket == conn {
+				a = ag
+			}
+			return true
+		})
+		return a != nil && a.Stats().PacketsIn == 1
+	})
+
+	a.Send(heartbeat)
+	if _, err := peer.Read(make([]byte, len(heartbeat))); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return a.session.Stats().PacketsOut == 1 })
+
+	st := a.session.Stats()
+	if st.BytesIn != int64(len(heartbeat)) || st.BytesOut != int64(len(heartbeat)) {
+		t.Fatalf("unexpected bytes, in: %d, out: %d", st.BytesIn, st.BytesOut)
+	}
+	if time.Since(st.LastHeartbeat) > time.Minute {
+		t.Fatalf("last heartbeat should be updated, got %v", st.LastHeartbeat)
+	}
+
+	if s := Stats(); s.PacketsIn < 1 || s.BytesOut < int64(len(heartbeat)) || s.Sessions < 0 {
+		t.Fatalf("unexpected server stats: %+v", s)
+	}
+}
@@ -0,0 +1,178 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/store"
+)
+
+var ErrProtocol = errors.New("redis: invalid reply")
+
+// Store persist session snapshots in redis, a single connection will be
+// established lazily and re-established after network error
+type Store struct {
+	sync.Mutex
+	addr   string
+	prefix string        // prefix of keys
+	ttl    time.Duration // expiration of snapshots, never expire if zero
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewStore returns a store connecting the redis server at addr, snapshots
+// will be stored with key prefix+token and expired after ttl
+func NewStore(addr, prefix string, ttl time.Duration) *Store {
+	return &Store{addr: addr, prefix: prefix, ttl: ttl}
+}
+
+func (s *Store) Save(key string, data []byte) error {
+	args := []string{"SET", s.prefix + key, string(data)}
+	if s.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(s.ttl/time.Millisecond), 10))
+	}
+	_, err := s.do(args...)
+	return err
+}
+
+func (s *Store) Load(key string) ([]byte, error) {
+	reply, err := s.do("GET", s.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, store.ErrNotFound
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, ErrProtocol
+	}
+	return data, nil
+}
+
+func (s *Store) Delete(key string) error {
+	_, err := s.do("DEL", s.prefix+key)
+	return err
+}
+
+// Close the connection to redis server
+func (s *Store) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn, s.reader = nil, nil
+	return err
+}
+
+// do send the command and read the reply, the connection will be closed on
+// network error, and re-established by the next command
+func (s *Store) do(args ...string) (interface{}, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.addr, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		s.conn, s.reader = conn, bufio.NewReader(conn)
+	}
+
+	reply, err := s.roundTrip(args)
+	if err != nil {
+		if _, ok := err.(replyError); !ok {
+			s.conn.Close()
+			s.conn, s.reader = nil, nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (s *Store) roundTrip(args []string) (interface{}, error) {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	s.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := s.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(s.reader)
+}
+
+// replyError represents the error reply of redis server
+type replyError string
+
+func (e replyError) Error() string {
+	return "redis: " + string(e)
+}
+
+// readReply parse the reply in RESP, bulk string returned as []byte, and nil
+// bulk string returned as nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, replyError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/store"
+)
+
+// fakeServer serve SET/GET/DEL commands with RESP
+func fakeServer(t *testing.T) (string, map[string][]string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	commands := make(map[string][]string)
+	data := make(map[string]string)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					reply, err := readReply(r)
+					if err != nil {
+						return
+					}
+					var args []string
+					for _, arg := range reply.([]interface{}) {
+						args = append(args, string(arg.([]byte)))
+					}
+
+					mu.Lock()
+					commands[args[0]] = args[1:]
+					switch strings.ToUpper(args[0]) {
+					case "SET":
+						data[args[1]] = args[2]
+						conn.Write([]byte("+OK\r\n"))
+					case "GET":
+						if v, ok := data[args[1]]; ok {
+							conn.Write([]byte("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"))
+						} else {
+							conn.Write([]byte("$-1\r\n"))
+						}
+					case "DEL":
+						delete(data, args[1])
+						conn.Write([]byte(":1\r\n"))
+					default:
+						conn.Write([]byte("-ERR unknown command\r\n"))
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), commands
+}
+
+func TestStore(t *testing.T) {
+	addr, commands := fakeServer(t)
+	s := NewStore(addr, "starx:", time.Minute)
+	defer s.Close()
+
+	value := []byte("hello\r\nworld")
+	if err := s.Save("token", value); err != nil {
+		t.Fatal(err)
+	}
+	if args := commands["SET"]; len(args) != 4 || args[0] != "starx:token" || args[3] != "60000" {
+		t.Fatalf("unexpected SET arguments: %v", args)
+	}
+
+	data, err := s.Load("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, value) {
+		t.Fatalf("expect %q, got %q", value, data)
+	}
+
+	if err := s.Delete("token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("token"); err != store.ErrNotFound {
+		t.Fatalf("expect ErrNotFound, got: %v", err)
+	}
+
+	if _, err := s.do("PING"); err == nil {
+		t.Fatal("error reply should be returned")
+	}
+	if err := s.Save("token", value); err != nil {
+		t.Fatalf("connection should be kept after error reply: %v", err)
+	}
+}
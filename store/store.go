@@ -0,0 +1,14 @@
+package store
+
+import "errors"
+
+var ErrNotFound = errors.New("store: session not found")
+
+// SessionStore persist the snapshots of sessions, so the session settings
+// can be restored after frontend server restarted, key is the resume token
+// issued to client
+type SessionStore interface {
+	Save(key string, data []byte) error
+	Load(key string) ([]byte, error) // returns ErrNotFound if key not exists
+	Delete(key string) error
+}
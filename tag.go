@@ -0,0 +1,87 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/session"
+)
+
+// tags index the sessions of current server by their tags, sessions are
+// removed from index when closed
+var tags = newTagService()
+
+type tagService struct {
+	sync.RWMutex
+	sessions map[string]map[int64]*session.Session // tag -> session id -> session
+}
+
+func newTagService() *tagService {
+	t := &tagService{sessions: make(map[string]map[int64]*session.Session)}
+	session.OnTagChanged(t.changed)
+	events.on(SessionClosed, func(args *EventArgs) { t.removeAll(args.Session) })
+	return t
+}
+
+func (t *tagService) changed(s *session.Session, tag string, added bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if added {
+		if t.sessions[tag] == nil {
+			t.sessions[tag] = make(map[int64]*session.Session)
+		}
+		t.sessions[tag][s.ID] = s
+		return
+	}
+	t.remove(s, tag)
+}
+
+// remove the session from index of the tag, should be called with lock held
+func (t *tagService) remove(s *session.Session, tag string) {
+	if sessions := t.sessions[tag]; sessions[s.ID] == s {
+		delete(sessions, s.ID)
+		if len(sessions) == 0 {
+			delete(t.sessions, tag)
+		}
+	}
+}
+
+func (t *tagService) removeAll(s *session.Session) {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, tag := range s.Tags() {
+		t.remove(s, tag)
+	}
+}
+
+func (t *tagService) members(tag string) []*session.Session {
+	t.RLock()
+	defer t.RUnlock()
+
+	sessions := make([]*session.Session, 0, len(t.sessions[tag]))
+	for _, s := range t.sessions[tag] {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
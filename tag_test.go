@@ -0,0 +1,59 @@
+package starx
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+func TestPushByTag(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	for i := 0; i < 4; i++ {
+		s := ac.Session(int64(300 + i))
+		if i%2 == 0 {
+			s.AddTag("zone:12")
+		}
+		s.AddTag("world")
+	}
+	if n := len(SessionsByTag("world")); n != 4 {
+		t.Fatalf("expect 4 sessions tagged, got %d", n)
+	}
+
+	go PushByTag("zone:12", "onZone", []byte("hello"))
+
+	resp := readResponse(t, peer)
+	if resp.Kind != rpc.HandlerMulticast || resp.Route != "onZone" || string(resp.Data) != "hello" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	sort.Slice(resp.Sids, func(i, j int) bool { return resp.Sids[i] < resp.Sids[j] })
+	if !reflect.DeepEqual(resp.Sids, []int64{300, 302}) {
+		t.Fatalf("push should be sent to tagged sessions, got sids: %v", resp.Sids)
+	}
+
+	s := ac.Session(300)
+	s.RemoveTag("zone:12")
+	if sessions := SessionsByTag("zone:12"); len(sessions) != 1 || sessions[0] != ac.Session(302) {
+		t.Fatalf("session should be removed from tag, got %v", sessions)
+	}
+
+	// closed sessions are removed from all tags
+	for i := 0; i < 4; i++ {
+		transporter.closeSession(ac.Session(int64(300+i)), session.CloseClient)
+	}
+	if len(SessionsByTag("world")) != 0 || len(SessionsByTag("zone:12")) != 0 {
+		t.Fatal("closed sessions should be removed from tags")
+	}
+	tags.RLock()
+	n := len(tags.sessions)
+	tags.RUnlock()
+	if n != 0 {
+		t.Fatalf("empty tags should be removed, got %d", n)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/metrics"
+	"github.com/lonnng/starx/ratelimit"
+)
+
+// ErrEgressExceeded represents that the client can't keep up with the egress
+// limit, the session will be closed under ThrottleDisconnect policy
+var ErrEgressExceeded = errors.New("send queue full while throttled by egress limit")
+
+// ThrottlePolicy represents the strategy applied when the outbound traffic of
+// a session exceeds the egress limit, writes of the session are always
+// delayed until the bytes allowed
+type ThrottlePolicy byte
+
+const (
+	ThrottleDelay      ThrottlePolicy = iota // only delay writes, packets wait in queues
+	ThrottleDropLow                          // drop low priority pushes while throttled
+	ThrottleDisconnect                       // close the session if send queue full while throttled
+)
+
+var throttlePolicyNames = []string{
+	ThrottleDelay:      "Delay",
+	ThrottleDropLow:    "DropLow",
+	ThrottleDisconnect: "Disconnect",
+}
+
+func (p ThrottlePolicy) String() string {
+	if int(p) < len(throttlePolicyNames) {
+		return throttlePolicyNames[p]
+	}
+	return "Unknown"
+}
+
+// egressLimit represents the token bucket settings of outbound bytes
+type egressLimit struct {
+	rate   float64
+	burst  int
+	policy ThrottlePolicy
+}
+
+// throttle wait until n bytes allowed by the egress limit of session, only be
+// called in writer goroutine, returns ErrEgressExceeded if the client can't
+// keep up under ThrottleDisconnect policy
+func (a *agent) throttle(n int) error {
+	l := env.egress
+	if l == nil {
+		return nil
+	}
+	if a.egress == nil {
+		a.egress = ratelimit.NewBucket(l.rate, l.burst)
+	}
+
+	d := a.egress.Take(n)
+	if d <= 0 {
+		return nil
+	}
+
+	switch l.policy {
+	case ThrottleDropLow:
+		a.dropLow()
+	case ThrottleDisconnect:
+		if len(a.sendBuffer) == cap(a.sendBuffer) {
+			return ErrEgressExceeded
+		}
+	}
+
+	atomic.StoreInt32(&a.throttled, 1)
+	defer atomic.StoreInt32(&a.throttled, 0)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-env.die:
+	}
+	return nil
+}
+
+// isThrottled reports whether the writer is waiting for the egress limit
+func (a *agent) isThrottled() bool {
+	return atomic.LoadInt32(&a.throttled) == 1
+}
+
+// dropLow discard the low priority packets waiting in queue
+func (a *agent) dropLow() {
+	for {
+		select {
+		case _, ok := <-a.lowBuffer:
+			if !ok {
+				return
+			}
+			metrics.PacketsDropped.Inc()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package starx
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestEgressDelay(t *testing.T) {
+	SetEgressLimit(10000, 100, ThrottleDelay)
+	defer SetEgressLimit(0, 0, ThrottleDelay)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := newAgent(conn)
+	go a.write()
+	defer a.Close()
+
+	data, _ := packet.Pack(&packet.Packet{Type: packet.Data, Data: make([]byte, 996)})
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		a.Send(data)
+		if _, err := io.ReadFull(peer, make([]byte, len(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 2000 bytes with 100 bytes burst take 190ms at 10000 bytes/sec
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Fatalf("writes should be delayed by egress limit, took %v", d)
+	}
+}
+
+func TestEgressDropLow(t *testing.T) {
+	SetEgressLimit(10000, 100, ThrottleDropLow)
+	defer SetEgressLimit(0, 0, ThrottleDelay)
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	data, _ := packet.Pack(&packet.Packet{Type: packet.Data, Data: []byte("mail")})
+	a.sendPriority(data, PriorityLow)
+	a.sendPriority(data, PriorityLow)
+
+	// queued low priority packets are dropped once throttled
+	done := make(chan error)
+	go func() { done <- a.throttle(3100) }()
+	waitFor(t, func() bool { return a.isThrottled() })
+	if n := len(a.lowBuffer); n != 0 {
+		t.Fatalf("low priority packets should be dropped, got %d", n)
+	}
+
+	// and new ones are dropped while throttled
+	a.sendPriority(data, PriorityLow)
+	a.sendPriority(data, PriorityNormal)
+	if len(a.lowBuffer) != 0 || len(a.sendBuffer) != 1 {
+		t.Fatalf("only low priority packets should be dropped, low: %d, normal: %d", len(a.lowBuffer), len(a.sendBuffer))
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&a.throttled) != 0 {
+		t.Fatal("throttled should be reset after waiting")
+	}
+}
+
+func TestEgressDisconnect(t *testing.T) {
+	SetEgressLimit(1000, 100, ThrottleDisconnect)
+	defer SetEgressLimit(0, 0, ThrottleDelay)
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	if err := a.throttle(100); err != nil {
+		t.Fatalf("burst bytes should be allowed, got %v", err)
+	}
+	for i := 0; i < cap(a.sendBuffer); i++ {
+		a.sendBuffer <- nil
+	}
+	if err := a.throttle(100); err != ErrEgressExceeded {
+		t.Fatalf("expect ErrEgressExceeded, got %v", err)
+	}
+}
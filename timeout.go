@@ -0,0 +1,73 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	defaultHandshakeTimeout = 10 * time.Second
+	defaultWriteTimeout     = 10 * time.Second
+)
+
+// readTimeouts returns the handshake timeout and idle timeout, idle timeout
+// is twice of heartbeat interval by default, disabled if zero
+func readTimeouts() (handshake, idle time.Duration) {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+
+	idle = env.idleTimeout
+	if idle <= 0 {
+		idle = 2 * env.heartbeatInternal
+	}
+	return env.handshakeTimeout, idle
+}
+
+// readDeadline returns the deadline of the next read, the deadline of
+// handshake is fixed since connection established, and the idle deadline
+// extends on every packet received, zero means no deadline
+func readDeadline(established time.Time, handshaked bool) time.Time {
+	handshake, idle := readTimeouts()
+	if !handshaked {
+		if handshake <= 0 {
+			return time.Time{}
+		}
+		return established.Add(handshake)
+	}
+	if idle > 0 {
+		return time.Now().Add(idle)
+	}
+	return time.Time{}
+}
+
+func writeTimeout() time.Duration {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return env.writeTimeout
+}
+
+// isTimeout reports whether the error is caused by deadline exceeded
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
@@ -0,0 +1,92 @@
+package starx
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/packet"
+)
+
+// waitClosed wait for the connection closed by server
+func waitClosed(t *testing.T, peer net.Conn) {
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	for {
+		if _, err := peer.Read(buf); err != nil {
+			if err != io.EOF && err != io.ErrClosedPipe {
+				t.Fatalf("connection should be closed by server, got %v", err)
+			}
+			return
+		}
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	timeout, _ := readTimeouts()
+	SetHandshakeTimeout(50 * time.Millisecond)
+	defer SetHandshakeTimeout(timeout)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go handler.handle(conn)
+
+	waitClosed(t, peer)
+}
+
+func TestReadDeadline(t *testing.T) {
+	reloadLock.Lock()
+	handshake, idle, heartbeat := env.handshakeTimeout, env.idleTimeout, env.heartbeatInternal
+	reloadLock.Unlock()
+	defer func() {
+		reloadLock.Lock()
+		env.handshakeTimeout, env.idleTimeout, env.heartbeatInternal = handshake, idle, heartbeat
+		reloadLock.Unlock()
+	}()
+	set := func(fn func()) {
+		reloadLock.Lock()
+		fn()
+		reloadLock.Unlock()
+	}
+
+	established := time.Now().Add(-time.Second)
+	set(func() { env.handshakeTimeout = 5 * time.Second })
+	if d := readDeadline(established, false); !d.Equal(established.Add(5 * time.Second)) {
+		t.Fatalf("handshake deadline should be fixed since established, got %v", d)
+	}
+	set(func() { env.handshakeTimeout = 0 })
+	if d := readDeadline(established, false); !d.IsZero() {
+		t.Fatalf("handshake deadline should be disabled, got %v", d)
+	}
+
+	// twice of heartbeat by default
+	set(func() { env.idleTimeout, env.heartbeatInternal = 0, 10*time.Second })
+	if d := time.Until(readDeadline(established, true)); d < 19*time.Second || d > 20*time.Second {
+		t.Fatalf("idle deadline should be twice of heartbeat, got %v", d)
+	}
+	set(func() { env.idleTimeout = time.Second })
+	if d := time.Until(readDeadline(established, true)); d < 0 || d > time.Second {
+		t.Fatalf("idle deadline should extend from now, got %v", d)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	timeout := writeTimeout()
+	SetWriteTimeout(50 * time.Millisecond)
+	defer SetWriteTimeout(timeout)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := newAgent(conn)
+	go a.write()
+
+	// the peer never reads
+	heartbeat, _ := packet.Pack(&packet.Packet{Type: packet.Heartbeat})
+	a.Send(heartbeat)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := peer.Write(heartbeat); err != io.ErrClosedPipe {
+		t.Fatalf("socket should be closed after write timeout, got %v", err)
+	}
+}
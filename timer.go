@@ -0,0 +1,137 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/timer"
+)
+
+// timers represents all timers created by application, which will be
+// stopped when the session that timer belongs to closed
+var timers = newTimerManager()
+
+// stopper is implemented by timers and cron jobs
+type stopper interface {
+	Stop()
+	Done() <-chan struct{}
+}
+
+type timerManager struct {
+	sync.Mutex
+	timers map[int64]map[stopper]bool // session id -> timers
+}
+
+func newTimerManager() *timerManager {
+	m := &timerManager{timers: make(map[int64]map[stopper]bool)}
+	transporter.sessionClosedCallback(m.stopSessionTimers)
+	return m
+}
+
+// add the timer of the session, which is removed when it's stopped or
+// finished, so long-lived sessions don't hold the timers fired already, the
+// timer is stopped immediately if the session has been closed
+func (m *timerManager) add(s *session.Session, t stopper) {
+	m.Lock()
+	// the context is canceled before the timers of session stopped
+	if s.Context().Err() != nil {
+		m.Unlock()
+		t.Stop()
+		return
+	}
+	ts := m.timers[s.ID]
+	if ts == nil {
+		ts = make(map[stopper]bool)
+		m.timers[s.ID] = ts
+	}
+	ts[t] = true
+	m.Unlock()
+
+	go func() {
+		<-t.Done()
+		m.remove(s.ID, t)
+	}()
+}
+
+func (m *timerManager) remove(sid int64, t stopper) {
+	m.Lock()
+	defer m.Unlock()
+
+	ts, ok := m.timers[sid]
+	if !ok {
+		return
+	}
+	delete(ts, t)
+	if len(ts) == 0 {
+		delete(m.timers, sid)
+	}
+}
+
+func (m *timerManager) stopSessionTimers(s *session.Session) {
+	m.Lock()
+	ts := m.timers[s.ID]
+	delete(m.timers, s.ID)
+	m.Unlock()
+
+	for t := range ts {
+		t.Stop()
+	}
+}
+
+// wrap the timer callback, which will be executed on logic goroutine
+func timerFunc(s *session.Session, fn func()) func() {
+	return func() {
+		if err := s.Invoke(fn); err != nil {
+			log.Debugf("Timer callback discarded, Id=%d, Error=%s", s.ID, err.Error())
+		}
+	}
+}
+
+// NewTimer returns a new Timer which calls fn every interval, fn will be
+// executed on the logic goroutine of the session, the same goroutine that
+// handler methods run on, so the states owned by the session can be accessed
+// without lock. Timer will be stopped when the session closed
+func NewTimer(s *session.Session, interval time.Duration, fn func()) *timer.Timer {
+	t := timer.Register(interval, timerFunc(s, fn))
+	timers.add(s, t)
+	return t
+}
+
+// NewAfterTimer returns a new Timer which calls fn once after the duration
+// elapsed, fn will be executed on the logic goroutine of the session
+func NewAfterTimer(s *session.Session, d time.Duration, fn func()) *timer.Timer {
+	t := timer.RegisterAfter(d, timerFunc(s, fn))
+	timers.add(s, t)
+	return t
+}
+
+// NewCountTimer returns a new Timer which calls fn every interval, and stops
+// after fn was called count times, fn will be executed on the logic goroutine
+// of the session
+func NewCountTimer(s *session.Session, interval time.Duration, count int, fn func()) *timer.Timer {
+	t := timer.RegisterCount(interval, timerFunc(s, fn), count)
+	timers.add(s, t)
+	return t
+}
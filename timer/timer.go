@@ -1,26 +1,40 @@
 package timer
 
 import (
+	"sync"
 	"time"
 )
 
 type Timer struct {
 	ticker     *time.Ticker
 	end        chan bool
+	done       chan struct{}
+	stopOnce   sync.Once
 	limitCount int
 	counter    int
 }
 
+// Stop turns off the timer, it's safe to call Stop more than once
 func (t *Timer) Stop() {
-	t.end <- true
+	t.stopOnce.Do(func() {
+		t.end <- true
+	})
+}
+
+// Done returns a channel that's closed when the timer stopped or fired the
+// limited times
+func (t *Timer) Done() <-chan struct{} {
+	return t.done
 }
 
 func Register(d time.Duration, fn func()) *Timer {
 	t := &Timer{
 		ticker: time.NewTicker(d),
 		end:    make(chan bool, 1),
+		done:   make(chan struct{}),
 	}
 	go func() {
+		defer close(t.done)
 	loop:
 		for {
 			select {
@@ -39,20 +53,22 @@ func RegisterCount(d time.Duration, fn func(), count int) *Timer {
 	t := &Timer{
 		ticker:     time.NewTicker(d),
 		end:        make(chan bool, 1),
+		done:       make(chan struct{}),
 		limitCount: count,
 		counter:    0,
 	}
 	go func() {
+		defer close(t.done)
 	loop:
 		for {
 			select {
 			case <-t.ticker.C:
 				t.counter++
-				if t.counter > t.limitCount {
+				fn()
+				if t.counter >= t.limitCount {
 					t.ticker.Stop()
 					break loop
 				}
-				fn()
 			case <-t.end:
 				t.ticker.Stop()
 				break loop
@@ -61,3 +77,8 @@ func RegisterCount(d time.Duration, fn func(), count int) *Timer {
 	}()
 	return t
 }
+
+// RegisterAfter calls fn once after the duration elapsed
+func RegisterAfter(d time.Duration, fn func()) *Timer {
+	return RegisterCount(d, fn, 1)
+}
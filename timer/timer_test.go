@@ -1,15 +1,16 @@
 package timer
 
 import (
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestRegister(t *testing.T) {
 	wait := make(chan bool, 1)
-	counter := 0
+	var counter int32
 	timer := Register(10*time.Millisecond, func() {
-		counter++
+		atomic.AddInt32(&counter, 1)
 	})
 
 	time.AfterFunc(55*time.Millisecond, func() {
@@ -18,16 +19,16 @@ func TestRegister(t *testing.T) {
 
 	<-wait
 	timer.Stop()
-	if counter != 5 {
+	if atomic.LoadInt32(&counter) != 5 {
 		t.Fail()
 	}
 }
 
 func TestRegisterCount(t *testing.T) {
 	wait := make(chan bool, 1)
-	counter := 0
+	var counter int32
 	timer := RegisterCount(10*time.Millisecond, func() {
-		counter++
+		atomic.AddInt32(&counter, 1)
 	}, 5)
 
 	time.AfterFunc(80*time.Millisecond, func() {
@@ -36,7 +37,43 @@ func TestRegisterCount(t *testing.T) {
 
 	<-wait
 	timer.Stop()
-	if counter != 5 {
+	if atomic.LoadInt32(&counter) != 5 {
 		t.Fail()
 	}
 }
+
+func TestRegisterAfter(t *testing.T) {
+	wait := make(chan bool, 1)
+	var counter int32
+	timer := RegisterAfter(10*time.Millisecond, func() {
+		atomic.AddInt32(&counter, 1)
+	})
+
+	time.AfterFunc(50*time.Millisecond, func() {
+		wait <- true
+	})
+
+	<-wait
+	timer.Stop()
+	timer.Stop() // stop more than once
+	if atomic.LoadInt32(&counter) != 1 {
+		t.Fail()
+	}
+}
+
+func TestDone(t *testing.T) {
+	timer := RegisterAfter(time.Millisecond, func() {})
+	select {
+	case <-timer.Done():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timer should be done after fired")
+	}
+
+	timer = Register(time.Millisecond, func() {})
+	timer.Stop()
+	select {
+	case <-timer.Done():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timer should be done after stopped")
+	}
+}
@@ -0,0 +1,95 @@
+package starx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/session"
+)
+
+func TestNewAfterTimer(t *testing.T) {
+	c, _ := net.Pipe()
+	a := newAgent(c)
+
+	called := false
+	NewAfterTimer(a.session, 10*time.Millisecond, func() {
+		called = true
+	})
+
+	select {
+	case fn := <-a.tasks:
+		fn()
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timer callback should be pushed to logic goroutine")
+	}
+
+	if !called {
+		t.Fatal("timer callback should be called")
+	}
+}
+
+func TestTimerStoppedWhenSessionClosed(t *testing.T) {
+	c, _ := net.Pipe()
+	a := newAgent(c)
+
+	tm := NewTimer(a.session, time.Millisecond, func() {})
+	timers.stopSessionTimers(a.session)
+
+	timers.Lock()
+	n := len(timers.timers[a.session.ID])
+	timers.Unlock()
+	if n != 0 {
+		t.Fatalf("session timers should be removed, remains: %d", n)
+	}
+
+	// stop a stopped timer should not block
+	tm.Stop()
+}
+
+func TestFinishedTimerRemoved(t *testing.T) {
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	defer timers.stopSessionTimers(a.session)
+
+	count := func() int {
+		timers.Lock()
+		defer timers.Unlock()
+		return len(timers.timers[a.session.ID])
+	}
+
+	tm := NewTimer(a.session, time.Hour, func() {})
+	NewAfterTimer(a.session, time.Millisecond, func() {})
+	if n := count(); n != 2 {
+		t.Fatalf("expect 2 timers, got: %d", n)
+	}
+
+	tm.Stop()
+	deadline := time.Now().Add(time.Second)
+	for count() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("finished timers should be removed, remains: %d", count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTimerOfClosedSession(t *testing.T) {
+	c, _ := net.Pipe()
+	a := transporter.createAgent(c)
+	transporter.closeSession(a.session, session.CloseClient)
+
+	tm := NewTimer(a.session, time.Millisecond, func() {})
+	select {
+	case <-tm.Done():
+	case <-time.After(time.Second):
+		t.Fatal("timer of closed session should be stopped")
+	}
+
+	timers.Lock()
+	_, ok := timers.timers[a.session.ID]
+	timers.Unlock()
+	if ok {
+		t.Fatal("timer of closed session should not be added")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/log"
+)
+
+const clusterHeartbeatRoute = "__Cluster.Heartbeat"
+
+// default interval of heartbeats sent to peers
+const defaultTopologyInterval = 10 * time.Second
+
+// Cluster returns the live view of all servers in cluster ordered by server
+// type, including the status, rpc latency and connection count of peers
+// reported by heartbeats over the rpc mesh. Frontend peers without rpc port
+// can't be probed, so their status is always unknown. The peers are copies, it's safe to modify.
+func Cluster() []*cluster.Peer {
+	peers := cluster.Topology()
+	for _, p := range peers {
+		if app.config != nil && p.ID == app.config.Id {
+			p.Status = cluster.PeerUp
+			p.Connections = transporter.count()
+			p.LastSeen = time.Now()
+		}
+	}
+	return peers
+}
+
+// watchTopology send heartbeats to peers every interval until shutdown, and
+// emit PeerStatusChanged when the status of a peer changed
+func watchTopology() {
+	if env.topologyInterval <= 0 || env.single {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(env.topologyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				probePeers()
+			case <-env.die:
+				return
+			}
+		}
+	}()
+}
+
+func probePeers() {
+	for _, p := range cluster.Probe() {
+		log.Infof("peer %s status changed to %s", p.ID, p.Status)
+		svr, err := cluster.Server(p.ID)
+		if err != nil {
+			continue
+		}
+		events.emit(&EventArgs{Event: PeerStatusChanged, Server: svr, Peer: p})
+	}
+}
+
+// heartbeatReport returns the state of current server to the heartbeat
+func heartbeatReport([]byte) ([]byte, error) {
+	return json.Marshal(&cluster.Report{Connections: transporter.count()})
+}
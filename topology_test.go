@@ -0,0 +1,84 @@
+package starx
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/lonnng/starx/cluster"
+)
+
+func TestCluster(t *testing.T) {
+	cluster.SetAppConfig(app.config)
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go remote.handle(conn)
+		}
+	}()
+
+	// a port refusing connections
+	down, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+
+	cluster.Register(&cluster.ServerConfig{Type: "topology", Id: "topology-1", Host: "127.0.0.1", Port: l.Addr().(*net.TCPAddr).Port})
+	cluster.Register(&cluster.ServerConfig{Type: "topology", Id: "topology-2", Host: "127.0.0.1", Port: down.Addr().(*net.TCPAddr).Port})
+	cluster.Register(&cluster.ServerConfig{Type: "topology-gate", Id: "topology-gate-1", Host: "127.0.0.1", Port: 1, IsFrontend: true})
+	defer func() {
+		for _, id := range []string{"topology-1", "topology-2", "topology-gate-1"} {
+			cluster.RemoveServer(id)
+		}
+	}()
+
+	var (
+		mu      sync.Mutex
+		changed = make(map[string]cluster.PeerStatus)
+	)
+	defer On(PeerStatusChanged, func(args *EventArgs) {
+		mu.Lock()
+		defer mu.Unlock()
+		changed[args.Server.Id] = args.Peer.Status
+	})()
+
+	probePeers()
+
+	peers := make(map[string]*cluster.Peer)
+	for _, p := range Cluster() {
+		peers[p.ID] = p
+	}
+	if p := peers["topology-1"]; p == nil || p.Status != cluster.PeerUp || p.Latency <= 0 || p.LastSeen.IsZero() || p.Type != "topology" {
+		t.Fatalf("peer responded heartbeat should be up, got %+v", p)
+	}
+	if p := peers["topology-2"]; p == nil || p.Status != cluster.PeerDown {
+		t.Fatalf("peer failed heartbeat should be down, got %+v", p)
+	}
+	if p := peers["topology-gate-1"]; p == nil || p.Status != cluster.PeerUnknown {
+		t.Fatalf("frontend peer should be unknown, got %+v", p)
+	}
+
+	mu.Lock()
+	if len(changed) != 2 || changed["topology-1"] != cluster.PeerUp || changed["topology-2"] != cluster.PeerDown {
+		t.Fatalf("unexpected status changed events: %v", changed)
+	}
+	mu.Unlock()
+
+	// no event if status not changed
+	probePeers()
+	mu.Lock()
+	if len(changed) != 2 {
+		t.Fatalf("unexpected status changed events: %v", changed)
+	}
+	mu.Unlock()
+}
@@ -0,0 +1,124 @@
+// Package trace generate trace ids for client messages, and record the spans
+// of handler calls across servers, e.g. gate -> game -> chat. Spans can be
+// exported to tracing systems like OpenTelemetry by an Exporter.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"time"
+)
+
+// Span represents a handler call in a server, ids are hex encoded with the
+// same length as W3C trace context, so spans can be converted to
+// OpenTelemetry spans directly
+type Span struct {
+	TraceID  string    // 16 bytes trace id of client message
+	SpanID   string    // 8 bytes span id
+	ParentID string    // span id of caller, empty for root span
+	Name     string    // route of the handler
+	Server   string    // id of server which the handler called in
+	Start    time.Time // start time of handler call
+	End      time.Time // end time of handler call
+	Error    string    // error returned by handler, if any
+}
+
+// Exporter export finished spans, Export is called in the goroutine which
+// finish the span, slow exporters should buffer spans
+type Exporter interface {
+	Export(s *Span)
+}
+
+// ExporterFunc is an adapter to allow the use of ordinary functions as
+// exporter
+type ExporterFunc func(s *Span)
+
+func (fn ExporterFunc) Export(s *Span) {
+	fn(s)
+}
+
+var exporter Exporter
+
+// SetExporter set the exporter of spans, spans are recorded only if exporter
+// has been set
+func SetExporter(e Exporter) {
+	exporter = e
+}
+
+// Enabled reports whether spans are recorded, trace ids are useless to be
+// generated otherwise
+func Enabled() bool {
+	return exporter != nil
+}
+
+// NewTraceID returns a random 16 bytes trace id
+func NewTraceID() string {
+	return newID(16)
+}
+
+// NewSpanID returns a random 8 bytes span id
+func NewSpanID() string {
+	return newID(8)
+}
+
+// newID generate the id from math/rand, which is unique enough for tracing
+// and much cheaper than crypto/rand on the message path
+func newID(n int) string {
+	b := make([]byte, n)
+	for i := 0; i < n; i += 8 {
+		binary.LittleEndian.PutUint64(b[i:], rand.Uint64())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Start returns a new span, nil will be returned if exporter not set or trace
+// id is empty, it's safe to call Finish on nil span
+func Start(traceID, parentID, name, server string) *Span {
+	if exporter == nil || traceID == "" {
+		return nil
+	}
+	return &Span{
+		TraceID:  traceID,
+		SpanID:   NewSpanID(),
+		ParentID: parentID,
+		Name:     name,
+		Server:   server,
+		Start:    time.Now(),
+	}
+}
+
+// Finish end the span with the error returned by handler, and export it
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if e := exporter; e != nil {
+		e.Export(s)
+	}
+}
+
+type contextKey struct{}
+
+// ids represents the trace id and span id carried by context
+type ids struct {
+	traceID string
+	spanID  string
+}
+
+// NewContext returns a copy of ctx which carries the trace id and span id
+func NewContext(ctx context.Context, traceID, spanID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ids{traceID: traceID, spanID: spanID})
+}
+
+// FromContext returns the trace id and span id carried by ctx, empty strings
+// returned if ctx carries nothing
+func FromContext(ctx context.Context) (traceID, spanID string) {
+	v, _ := ctx.Value(contextKey{}).(ids)
+	return v.traceID, v.spanID
+}
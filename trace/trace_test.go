@@ -0,0 +1,60 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSpan(t *testing.T) {
+	if s := Start(NewTraceID(), "", "Room.Join", "gate-1"); s != nil {
+		t.Fatal("span should not be recorded without exporter")
+	}
+	if Enabled() {
+		t.Fatal("trace should be disabled without exporter")
+	}
+
+	var spans []*Span
+	SetExporter(ExporterFunc(func(s *Span) { spans = append(spans, s) }))
+	defer SetExporter(nil)
+	if !Enabled() {
+		t.Fatal("trace should be enabled with exporter")
+	}
+
+	traceID := NewTraceID()
+	if len(traceID) != 32 {
+		t.Fatalf("trace id should be 16 bytes hex, got %q", traceID)
+	}
+	if Start("", "", "Room.Join", "gate-1") != nil {
+		t.Fatal("span should not be recorded without trace id")
+	}
+
+	root := Start(traceID, "", "Room.Join", "gate-1")
+	child := Start(traceID, root.SpanID, "Room.Join", "game-1")
+	child.Finish(errors.New("room is full"))
+	root.Finish(nil)
+
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	if s := spans[0]; s.ParentID != root.SpanID || s.Error != "room is full" || len(s.SpanID) != 16 || s.End.Before(s.Start) {
+		t.Fatalf("unexpected child span: %+v", s)
+	}
+	if s := spans[1]; s.ParentID != "" || s.TraceID != traceID || s.Error != "" {
+		t.Fatalf("unexpected root span: %+v", s)
+	}
+
+	var nilSpan *Span
+	nilSpan.Finish(nil)
+}
+
+func TestContext(t *testing.T) {
+	if traceID, spanID := FromContext(context.Background()); traceID != "" || spanID != "" {
+		t.Fatalf("empty context should carry nothing, got %q, %q", traceID, spanID)
+	}
+
+	ctx := NewContext(context.Background(), "trace", "span")
+	if traceID, spanID := FromContext(ctx); traceID != "trace" || spanID != "span" {
+		t.Fatalf("unexpected ids: %q, %q", traceID, spanID)
+	}
+}
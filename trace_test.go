@@ -0,0 +1,105 @@
+package starx
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/trace"
+)
+
+type TraceComp struct {
+	component.Base
+	traces []string
+	spans  []string
+}
+
+func (c *TraceComp) Handle(s *session.Session, data []byte) error {
+	c.traces = append(c.traces, s.TraceID)
+	c.spans = append(c.spans, s.SpanID)
+	return errors.New("trace error")
+}
+
+func TestTraceHandler(t *testing.T) {
+	var spans []*trace.Span
+	SetTraceExporter(trace.ExporterFunc(func(s *trace.Span) { spans = append(spans, s) }))
+	defer SetTraceExporter(nil)
+
+	c := &TraceComp{}
+	if err := handler.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.unregister("TraceComp")
+
+	s := session.New(nil)
+	for i := 0; i < 2; i++ {
+		msg := message.New()
+		msg.Route = "TraceComp.Handle"
+		msg.Type = message.Notify
+		handler.processMessage(s, msg)
+	}
+
+	if len(c.traces) != 2 || c.traces[0] == "" || c.traces[0] == c.traces[1] {
+		t.Fatalf("every message should have a new trace id, got %v", c.traces)
+	}
+	if len(spans) != 2 || spans[0].TraceID != c.traces[0] || spans[0].Name != "TraceComp.Handle" || spans[0].Error != "trace error" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+}
+
+func TestTraceDisabled(t *testing.T) {
+	c := &TraceComp{}
+	if err := handler.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer handler.unregister("TraceComp")
+
+	s := session.New(nil)
+	s.TraceID = "stale"
+	msg := message.New()
+	msg.Route = "TraceComp.Handle"
+	msg.Type = message.Notify
+	handler.processMessage(s, msg)
+
+	if len(c.traces) != 1 || c.traces[0] != "" {
+		t.Fatalf("trace id should not be generated without exporter, got %v", c.traces)
+	}
+}
+
+func TestTraceRemote(t *testing.T) {
+	var spans []*trace.Span
+	SetTraceExporter(trace.ExporterFunc(func(s *trace.Span) { spans = append(spans, s) }))
+	defer SetTraceExporter(nil)
+
+	c := &TraceComp{}
+	if err := remote.register(c); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.unregister("TraceComp")
+
+	conn, peer := net.Pipe()
+	go io.Copy(ioutil.Discard, peer)
+	ac := newAcceptor(1, conn)
+	defer ac.Close()
+
+	remote.processRequest(ac, &rpc.Request{
+		ServiceMethod: "TraceComp.Handle",
+		Sid:           100,
+		Kind:          rpc.Sys,
+		TraceID:       "trace",
+		SpanID:        "parent",
+	})
+
+	if len(c.traces) != 1 || c.traces[0] != "trace" {
+		t.Fatalf("trace id should be forwarded, got %v", c.traces)
+	}
+	if len(spans) != 1 || spans[0].ParentID != "parent" || spans[0].SpanID != c.spans[0] {
+		t.Fatalf("span of remote handler should be child of caller, got %+v", spans)
+	}
+}
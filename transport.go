@@ -0,0 +1,86 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/lonnng/starx/kcp"
+)
+
+var ErrUnknownTransport = errors.New("unknown transport")
+
+// ListenFunc announces on the local address and returns the listener of
+// client connections, connections accepted by listener share the same
+// packet and session layers regardless of the transport underneath
+type ListenFunc func(addr string) (net.Listener, error)
+
+var transports = struct {
+	sync.RWMutex
+	listeners map[string]ListenFunc
+}{
+	listeners: map[string]ListenFunc{
+		"tcp": func(addr string) (net.Listener, error) {
+			return upgrader.listenTCP(addr)
+		},
+		"kcp": func(addr string) (net.Listener, error) {
+			conn, err := upgrader.listenUDP(addr)
+			if err != nil {
+				return nil, err
+			}
+			return kcp.ServeConn(conn), nil
+		},
+	},
+}
+
+func registerTransport(name string, fn ListenFunc) {
+	transports.Lock()
+	defer transports.Unlock()
+
+	transports.listeners[name] = fn
+}
+
+// listen announces on the address with the transport in server config,
+// transport only available for frontend server, backend servers always
+// use tcp since rpc clients dial with tcp
+func listen(addr string) (net.Listener, error) {
+	name := app.config.Transport
+	if !app.config.IsFrontend {
+		name = "tcp"
+	}
+	return listenTransport(name, addr)
+}
+
+func listenTransport(name, addr string) (net.Listener, error) {
+	if name == "" {
+		name = "tcp"
+	}
+
+	transports.RLock()
+	fn, ok := transports.listeners[name]
+	transports.RUnlock()
+	if !ok {
+		return nil, ErrUnknownTransport
+	}
+	return fn(addr)
+}
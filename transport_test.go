@@ -0,0 +1,84 @@
+package starx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/client"
+	"github.com/lonnng/starx/kcp"
+)
+
+func TestListenTransport(t *testing.T) {
+	var listened string
+	RegisterTransport("fake", func(addr string) (net.Listener, error) {
+		listened = addr
+		return net.Listen("tcp", addr)
+	})
+
+	app.config.IsFrontend = true
+	app.config.Transport = "fake"
+	defer func() {
+		app.config.IsFrontend = false
+		app.config.Transport = ""
+	}()
+
+	l, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if listened != "127.0.0.1:0" {
+		t.Fatal("listener of transport should be used")
+	}
+
+	// backend server always use tcp
+	listened = ""
+	app.config.IsFrontend = false
+	if l, err = listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if listened != "" {
+		t.Fatal("backend server should listen with tcp")
+	}
+
+	app.config.IsFrontend = true
+	app.config.Transport = "unknown"
+	if _, err := listen("127.0.0.1:0"); err != ErrUnknownTransport {
+		t.Fatalf("expect ErrUnknownTransport, got: %v", err)
+	}
+}
+
+func TestKCPTransport(t *testing.T) {
+	app.config.IsFrontend = true
+	app.config.Transport = "kcp"
+	l, err := listen("127.0.0.1:0")
+	app.config.Transport = ""
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(l, handler.handle, acceptConn)
+
+	n := transporter.count()
+	conn, err := kcp.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := client.NewClient(conn)
+	if err := c.Handshake(nil); err != nil {
+		t.Fatalf("handshake over kcp failed: %v", err)
+	}
+
+	// sessions are closed asynchronously with the listener
+	conn.Close()
+	l.Close()
+	for deadline := time.Now().Add(time.Second); transporter.count() > n; {
+		if time.Now().After(deadline) {
+			t.Fatal("session should be closed with listener")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	app.config.IsFrontend = false
+}
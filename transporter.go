@@ -22,6 +22,7 @@ package starx
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -30,6 +31,7 @@ import (
 	"github.com/lonnng/starx/cluster"
 	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/metrics"
 	"github.com/lonnng/starx/packet"
 	"github.com/lonnng/starx/session"
 )
@@ -51,10 +53,10 @@ var (
 )
 
 type transportService struct {
-	sync.RWMutex
-	agents      map[int64]*agent    // agents map
-	acceptorUid int64               // acceptor unique id
-	acceptors   map[int64]*acceptor // acceptor map
+	sync.RWMutex                     // protect acceptors
+	sessions     session.Manager     // sessions of agents
+	acceptorUid  int64               // acceptor unique id
+	acceptors    map[int64]*acceptor // acceptor map
 
 	sessionCloseCbLock sync.RWMutex             // protect sessionCloseCb
 	sessionCloseCb     []func(*session.Session) // callback on session closed
@@ -63,7 +65,7 @@ type transportService struct {
 // Create new t service
 func newTransporter() *transportService {
 	return &transportService{
-		agents:      make(map[int64]*agent),
+		sessions:    session.NewShardedManager(session.DefaultShards),
 		acceptorUid: 0,
 		acceptors:   make(map[int64]*acceptor),
 	}
@@ -72,27 +74,44 @@ func newTransporter() *transportService {
 // Create agent via transportService
 func (t *transportService) createAgent(conn net.Conn) *agent {
 	a := newAgent(conn)
-	// add to maps
-	t.Lock()
-	defer t.Unlock()
+	t.sessions.Store(a.session)
 
-	t.agents[a.id] = a
+	metrics.Sessions.Inc()
+	events.emit(&EventArgs{Event: SessionCreated, Session: a.session})
 	return a
 }
 
 // get agent by session id
 func (t *transportService) agent(id int64) (*agent, error) {
-	t.RLock()
-	defer t.RUnlock()
-
-	a, ok := t.agents[id]
+	s, ok := t.sessions.Load(id)
 	if !ok {
-		return nil, errors.New("agent id: " + string(id) + " not exists!")
+		return nil, fmt.Errorf("agent id: %d not exists!", id)
+	}
+	a, ok := s.Entity.(*agent)
+	if !ok {
+		return nil, fmt.Errorf("agent id: %d not exists!", id)
 	}
 
 	return a, nil
 }
 
+// count return the number of agents
+func (t *transportService) count() int {
+	return t.sessions.Len()
+}
+
+// rangeAgents calls fn for each agent until fn returns false, sessions which
+// are being suspended are skipped
+func (t *transportService) rangeAgents(fn func(*agent) bool) {
+	t.sessions.Range(func(s *session.Session) bool {
+		a, ok := s.Entity.(*agent)
+		if !ok {
+			return true
+		}
+		return fn(a)
+	})
+}
+
 // Create acceptor via transportService
 func (t *transportService) createAcceptor(conn net.Conn) *acceptor {
 	id := atomic.AddInt64(&t.acceptorUid, 1)
@@ -112,7 +131,7 @@ func (t *transportService) acceptor(id int64) (*acceptor, error) {
 
 	rs, ok := t.acceptors[id]
 	if !ok || rs == nil {
-		return nil, errors.New("acceptor id: " + string(id) + " not exists!")
+		return nil, fmt.Errorf("acceptor id: %d not exists!", id)
 	}
 
 	return rs, nil
@@ -128,30 +147,11 @@ func (t *transportService) send(session *session.Session, data []byte) {
 // Push message to client
 // call by all package, the last argument was packaged message
 func (t *transportService) push(session *session.Session, route string, data []byte) error {
-	m, err := message.Encode(&message.Message{
+	return t.sendMessage(session, &message.Message{
 		Type:  message.MessageType(message.Push),
 		Route: route,
 		Data:  data,
 	})
-
-	if err != nil {
-		log.Errorf(err.Error())
-		return err
-	}
-
-	p := packet.Packet{
-		Type:   packet.Data,
-		Length: len(m),
-		Data:   m,
-	}
-	ep, err := p.Pack()
-	if err != nil {
-		log.Errorf(err.Error())
-		return err
-	}
-
-	t.send(session, ep)
-	return nil
 }
 
 // Response message to client
@@ -161,32 +161,108 @@ func (t *transportService) response(session *session.Session, data []byte) error
 	if session.LastID <= 0 {
 		return ErrSessionOnNotify
 	}
-	m, err := message.Encode(&message.Message{
+	return t.sendMessage(session, &message.Message{
 		Type: message.MessageType(message.Response),
 		ID:   session.LastID,
 		Data: data,
 	})
-	if err != nil {
-		log.Errorf(err.Error())
-		return err
+}
+
+// sendMessage pack the message and send it, message sent to a suspended
+// session will be buffered, and replayed after the session resumed
+func (t *transportService) sendMessage(session *session.Session, m *message.Message) error {
+	if e, ok := session.Entity.(*suspendedEntity); ok {
+		e.buffer(m)
+		return nil
 	}
 
-	p := packet.Packet{
-		Type:   packet.Data,
-		Length: len(m),
-		Data:   m,
+	if a, ok := session.Entity.(*agent); ok && a.batch != nil {
+		if m.Type == message.Push && env.pushPriorities[m.Route] == PriorityNormal {
+			em, err := t.encodeMessage(session, m)
+			if err != nil {
+				log.Error(err.Error())
+				return err
+			}
+			return a.batch.add(em)
+		}
+		// messages batched before should be sent first
+		if err := a.batch.flush(); err != nil {
+			log.Error(err.Error())
+		}
 	}
-	ep, err := p.Pack()
+
+	ep, err := t.packMessage(session, m)
 	if err != nil {
-		log.Errorf(err.Error())
+		log.Error(err.Error())
 		return err
 	}
 
+	if a, ok := session.Entity.(*agent); ok && m.Type == message.Push {
+		return a.sendPriority(ep, env.pushPriorities[m.Route])
+	}
 	t.send(session, ep)
 	return nil
 }
 
-// TODO: implement backend server broadcast
+// Encode message and pack it to a data packet, message data will be compressed
+// when the session has negotiated compression in handshake, and packet data
+// will be encrypted when encryption enabled
+func (t *transportService) packMessage(session *session.Session, m *message.Message) ([]byte, error) {
+	em, err := t.encodeMessage(session, m)
+	if err != nil {
+		return nil, err
+	}
+	return t.packData(session, em)
+}
+
+// encodeMessage transform message data by the outbound hook of client type,
+// compress it if negotiated, and encode the message
+func (t *transportService) encodeMessage(session *session.Session, m *message.Message) ([]byte, error) {
+	if hook := env.outboundHooks[session.ClientType]; hook != nil {
+		data, err := hook(session, m)
+		if err != nil {
+			return nil, err
+		}
+		m.Data = data
+	}
+
+	if a, ok := session.Entity.(*agent); ok && a.compress && len(m.Data) > env.compressThreshold {
+		data, err := env.compressor.Compress(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		m.Data = data
+		m.DataCompressed = true
+	}
+
+	em, err := message.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.outbound.process(session, em)
+}
+
+// packData encrypt the data if encryption enabled, and pack it to a data packet
+func (t *transportService) packData(session *session.Session, em []byte) ([]byte, error) {
+	var err error
+	if a, ok := session.Entity.(*agent); ok && a.cipher != nil {
+		if em, err = a.cipher.Encrypt(em); err != nil {
+			return nil, err
+		}
+	}
+
+	codec := env.packetCodec
+	if a, ok := session.Entity.(*agent); ok {
+		codec = a.packetCodec()
+	}
+	return codec.Encode(&packet.Packet{
+		Type:   packet.Data,
+		Length: len(em),
+		Data:   em,
+	})
+}
+
 // broadcast message to all sessions
 // Message level method
 // call by all package, the last argument was packaged message
@@ -195,36 +271,44 @@ func (t *transportService) broadcast(route string, data []byte) {
 		return
 	}
 
-	for _, s := range t.agents {
-		t.push(s.session, route, data)
-	}
+	t.sessions.Range(func(s *session.Session) bool {
+		t.push(s, route, data)
+		return true
+	})
 }
 
 // Multicast message to special agent ids
 func (t *transportService) multicast(aids []int64, route string, data []byte) {
-	t.RLock()
-	defer t.RUnlock()
-
 	for _, aid := range aids {
-		if agent, ok := t.agents[aid]; ok && agent != nil {
-			t.push(agent.session, route, data)
+		if s, ok := t.sessions.Load(aid); ok {
+			t.push(s, route, data)
 		}
 	}
 }
 
-func (t *transportService) Session(sid int64) (*session.Session, error) {
-	t.RLock()
-	defer t.RUnlock()
+// Broadcast message to all sessions, which implements cluster.SessionManager
+func (t *transportService) Broadcast(route string, data []byte) {
+	t.broadcast(route, data)
+}
 
-	a, ok := t.agents[sid]
+func (t *transportService) Session(sid int64) (*session.Session, error) {
+	s, ok := t.sessions.Load(sid)
 	if !ok {
+		// session may be suspended and waiting for resuming
+		if e, ok := resumes.entity(sid); ok {
+			return e.session, nil
+		}
 		return nil, ErrSessionNotFound
 	}
-	return a.session, nil
+	return s, nil
 }
 
-// Close session
-func (t *transportService) closeSession(session *session.Session) {
+// Close session, the reason is set and the context of session is canceled
+// before callbacks called
+func (t *transportService) closeSession(session *session.Session, reason session.CloseReason) {
+	session.CloseReason = reason
+	session.Cancel()
+
 	t.sessionCloseCbLock.RLock()
 	for _, cb := range t.sessionCloseCb {
 		if cb != nil {
@@ -233,16 +317,16 @@ func (t *transportService) closeSession(session *session.Session) {
 	}
 	t.sessionCloseCbLock.RUnlock()
 
-	t.Lock()
-	defer t.Unlock()
-
 	if app.config.IsFrontend {
-		if agent, ok := t.agents[session.Entity.ID()]; ok && (agent != nil) {
-			delete(t.agents, session.Entity.ID())
+		if t.sessions.Delete(session) {
+			metrics.Sessions.Dec()
 		}
 		// notify all backend server, current session has been closed.
 		cluster.SessionClosed(session)
 	} else {
+		t.Lock()
+		defer t.Unlock()
+
 		if acceptor, ok := t.acceptors[session.Entity.ID()]; ok && (acceptor != nil) {
 			delete(acceptor.sessionMap, session.ID)
 			if fid, ok := acceptor.b2fMap[session.ID]; ok {
@@ -262,40 +346,38 @@ func (t *transportService) removeAcceptor(a *acceptor) {
 
 // Send heartbeat packet
 func (t *transportService) heartbeat() {
-	if !app.config.IsFrontend || t.agents == nil {
+	if !app.config.IsFrontend {
 		return
 	}
-	dt := time.Now().Add(-2 * env.heartbeatInternal)
+	dt := time.Now().Add(-2 * heartbeatInterval())
 	dtu := dt.Unix()
 
-	for _, agent := range t.agents {
+	t.rangeAgents(func(agent *agent) bool {
 		if agent.status != statusWorking {
-			continue
+			return true
 		}
 
 		if agent.lastTime < dtu {
-			log.Debugf("Session heartbeat timeout, LastTime=%d, Deadline=%d", agent.lastTime, dtu)
-			agent.Close()
-			continue
+			sessionLogger(agent.session).Debugf("session heartbeat timeout, last time=%d, deadline=%d", agent.lastTime, dtu)
+			agent.disconnect(session.CloseHeartbeatTimeout)
+			return true
 		}
 
-		if err := agent.Send(heartbeatPacket); err != nil {
-			log.Error(err)
-			agent.Close()
-			continue
+		if err := agent.Send(agent.controlPacket(packet.Heartbeat, heartbeatPacket)); err != nil {
+			sessionLogger(agent.session).Errorf("send heartbeat error: %s", err.Error())
+			agent.disconnect(session.CloseServer)
 		}
-	}
+		return true
+	})
 }
 
 // Dump all agents
 func (t *transportService) dumpAgents() {
-	t.RLock()
-	defer t.RUnlock()
-
-	log.Infof("current agent count: %d", len(t.agents))
-	for _, ses := range t.agents {
-		log.Infof("session: " + ses.String())
-	}
+	log.Infof("current agent count: %d", t.count())
+	t.rangeAgents(func(a *agent) bool {
+		log.Info("session: " + a.String())
+		return true
+	})
 }
 
 // Dump all acceptor
@@ -305,7 +387,7 @@ func (t *transportService) dumpAcceptor() {
 
 	log.Infof("current acceptor count: %d", len(t.acceptors))
 	for _, ses := range t.acceptors {
-		log.Infof("session: " + ses.String())
+		log.Info("session: " + ses.String())
 	}
 }
 
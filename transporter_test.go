@@ -1,10 +1,15 @@
 package starx
 
 import (
+	"bytes"
+	"net"
 	"reflect"
 	"testing"
 
+	"github.com/lonnng/starx/compress/gzip"
+	"github.com/lonnng/starx/message"
 	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
 )
 
 func Test1(t *testing.T) {
@@ -12,3 +17,85 @@ func Test1(t *testing.T) {
 		t.Error("wrong heartbeat packet")
 	}
 }
+
+func TestTransportService_PackMessageCompressed(t *testing.T) {
+	SetCompressor(gzip.NewCompressor(), 64)
+	defer SetCompressor(nil, 0)
+
+	c, _ := net.Pipe()
+	a := newAgent(c)
+	a.compress = true
+
+	data := bytes.Repeat([]byte("hello world"), 100)
+	ep, err := transporter.packMessage(a.session, &message.Message{
+		Type:  message.Push,
+		Route: "onCompress",
+		Data:  data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _, err := packet.Unpack(ep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.DataCompressed {
+		t.Fatal("message data should be compressed")
+	}
+
+	raw, err := env.compressor.Decompress(m.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, data) {
+		t.Fatal("wrong decompressed data")
+	}
+}
+
+func TestTransportService_OutboundHook(t *testing.T) {
+	SetOutboundHook(ClientNative, func(s *session.Session, m *message.Message) ([]byte, error) {
+		return bytes.ToUpper(m.Data), nil
+	})
+	defer func() { env.outboundHooks = nil }()
+
+	c, _ := net.Pipe()
+	native, web := newAgent(c), newAgent(c)
+	native.session.ClientType = ClientNative
+	web.session.ClientType = ClientWeb
+
+	data := []byte("hello")
+	for _, tc := range []struct {
+		a      *agent
+		expect string
+	}{{native, "HELLO"}, {web, "hello"}} {
+		ep, err := transporter.packMessage(tc.a.session, &message.Message{Type: message.Push, Route: "onHook", Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _, _ := packet.Unpack(ep)
+		m, err := message.Decode(p.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m.Data) != tc.expect {
+			t.Fatalf("client type %s: expect %s, got %s", tc.a.session.ClientType, tc.expect, m.Data)
+		}
+	}
+	if string(data) != "hello" {
+		t.Fatal("shared data should not be modified")
+	}
+}
+
+func TestTransportService_NotExists(t *testing.T) {
+	if _, err := transporter.agent(12345); err == nil || err.Error() != "agent id: 12345 not exists!" {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, err := transporter.acceptor(12345); err == nil || err.Error() != "acceptor id: 12345 not exists!" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
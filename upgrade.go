@@ -0,0 +1,274 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// envInheritFDs is the environment variable which tells the listening
+// addresses of sockets inherited from parent process, the socket of i-th
+// address is the file descriptor 3+i, addresses of udp sockets are prefixed
+// with udpPrefix
+const envInheritFDs = envPrefix + "INHERIT_FDS"
+
+const udpPrefix = "udp:"
+
+var ErrUpgrading = errors.New("server is upgrading")
+
+// upgrader hand over the listening sockets to a new process, and drain the
+// sessions of current process
+var upgrader = newUpgradeService(os.Getenv(envInheritFDs))
+
+type upgradeService struct {
+	sync.Mutex
+	inherited    map[string]net.Listener   // address -> listener inherited from parent process
+	inheritedUDP map[string]net.PacketConn // address -> udp socket inherited from parent process
+	active       []*net.TCPListener        // listening sockets of current process
+	activeUDP    []*net.UDPConn            // udp sockets of current process, e.g. kcp
+	upgrading    bool
+}
+
+func newUpgradeService(addrs string) *upgradeService {
+	u := &upgradeService{
+		inherited:    make(map[string]net.Listener),
+		inheritedUDP: make(map[string]net.PacketConn),
+	}
+	if addrs == "" {
+		return u
+	}
+	for i, addr := range strings.Split(addrs, ",") {
+		f := os.NewFile(uintptr(3+i), addr)
+		if strings.HasPrefix(addr, udpPrefix) {
+			addr = strings.TrimPrefix(addr, udpPrefix)
+			conn, err := net.FilePacketConn(f)
+			f.Close()
+			if err != nil {
+				log.Errorf("inherit udp socket %s error: %s", addr, err.Error())
+				continue
+			}
+			u.inheritedUDP[addr] = conn
+			continue
+		}
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Errorf("inherit listener %s error: %s", addr, err.Error())
+			continue
+		}
+		u.inherited[addr] = l
+	}
+	return u
+}
+
+// listenTCP returns the listener inherited from parent process if there is
+// one on the address, or announces on the address
+func (u *upgradeService) listenTCP(addr string) (net.Listener, error) {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.upgrading {
+		return nil, ErrUpgrading
+	}
+
+	l, ok := u.inherited[addr]
+	if ok {
+		delete(u.inherited, addr)
+		log.Infof("listener %s inherited from parent process", addr)
+	} else {
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	if tl, ok := l.(*net.TCPListener); ok {
+		u.active = append(u.active, tl)
+	}
+	return l, nil
+}
+
+// listenUDP returns the udp socket inherited from parent process if there is
+// one on the address, or announces on the address
+func (u *upgradeService) listenUDP(addr string) (net.PacketConn, error) {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.upgrading {
+		return nil, ErrUpgrading
+	}
+
+	conn, ok := u.inheritedUDP[addr]
+	if ok {
+		delete(u.inheritedUDP, addr)
+		log.Infof("udp socket %s inherited from parent process", addr)
+	} else {
+		var err error
+		if conn, err = net.ListenPacket("udp", addr); err != nil {
+			return nil, err
+		}
+	}
+	if uc, ok := conn.(*net.UDPConn); ok {
+		u.activeUDP = append(u.activeUDP, uc)
+	}
+	return conn, nil
+}
+
+func (u *upgradeService) isUpgrading() bool {
+	u.Lock()
+	defer u.Unlock()
+	return u.upgrading
+}
+
+// upgrade start a new process of current executable with the same arguments,
+// which inherits the listening sockets, current process stops accepting once
+// the new process started
+func (u *upgradeService) upgrade() error {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.upgrading {
+		return ErrUpgrading
+	}
+
+	var (
+		addrs []string
+		files []*os.File
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range u.active {
+		f, err := l.File()
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, l.Addr().String())
+		files = append(files, f)
+	}
+	for _, conn := range u.activeUDP {
+		f, err := conn.File()
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, udpPrefix+conn.LocalAddr().String())
+		files = append(files, f)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(inheritEnv(), envInheritFDs+"="+strings.Join(addrs, ","))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Infof("new process %d started, inherited listeners: %v", cmd.Process.Pid, addrs)
+
+	u.upgrading = true
+	for _, l := range u.active {
+		l.Close()
+	}
+	for _, conn := range u.activeUDP {
+		conn.Close()
+	}
+	u.active, u.activeUDP = nil, nil
+	return nil
+}
+
+// inheritEnv returns the environment of current process without inherited
+// file descriptors
+func inheritEnv() []string {
+	var vars []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envInheritFDs+"=") {
+			vars = append(vars, kv)
+		}
+	}
+	return vars
+}
+
+// drain close all sessions evenly in duration, clients reconnect to the new
+// process, sessions are restored if session store enabled
+func drain(d time.Duration) {
+	agents := make([]*agent, 0, transporter.count())
+	transporter.rangeAgents(func(a *agent) bool {
+		agents = append(agents, a)
+		return true
+	})
+
+	log.Infof("draining %d sessions in %v", len(agents), d)
+	if len(agents) == 0 {
+		return
+	}
+
+	interval := d / time.Duration(len(agents))
+	for _, a := range agents {
+		a := a
+		a.Invoke(func() { a.disconnect(session.CloseShutdown) })
+		if interval > 0 {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// watchUpgrade restart gracefully on SIGUSR2
+func watchUpgrade() {
+	if env.drainTimeout <= 0 {
+		return
+	}
+
+	sg := make(chan os.Signal, 1)
+	signal.Notify(sg, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(sg)
+		for {
+			select {
+			case <-sg:
+				log.Info("got SIGUSR2, upgrading")
+				if err := upgrader.upgrade(); err != nil {
+					log.Errorf("upgrade error: %s", err.Error())
+					continue
+				}
+				drain(env.drainTimeout)
+				Shutdown()
+				return
+			case <-env.die:
+				return
+			}
+		}
+	}()
+}
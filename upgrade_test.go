@@ -0,0 +1,146 @@
+package starx
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpgradeListenTCP(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+
+	addr := parent.Addr().String()
+	u := &upgradeService{inherited: map[string]net.Listener{addr: parent}}
+
+	l, err := u.listenTCP(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != parent {
+		t.Fatal("listener should be inherited")
+	}
+	if len(u.inherited) != 0 || len(u.active) != 1 {
+		t.Fatalf("inherited listener should be active, inherited: %d, active: %d", len(u.inherited), len(u.active))
+	}
+
+	l, err = u.listenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if len(u.active) != 2 {
+		t.Fatalf("new listener should be active, active: %d", len(u.active))
+	}
+
+	u.upgrading = true
+	if err := u.upgrade(); err != ErrUpgrading {
+		t.Fatalf("expect ErrUpgrading, got %v", err)
+	}
+	if _, err := u.listenTCP("127.0.0.1:0"); err != ErrUpgrading {
+		t.Fatalf("expect ErrUpgrading, got %v", err)
+	}
+}
+
+func TestUpgradeListenUDP(t *testing.T) {
+	parent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+
+	addr := parent.LocalAddr().String()
+	u := newUpgradeService("")
+	u.inheritedUDP[addr] = parent
+
+	conn, err := u.listenUDP(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != parent {
+		t.Fatal("udp socket should be inherited")
+	}
+
+	conn, err = u.listenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if len(u.inheritedUDP) != 0 || len(u.activeUDP) != 2 {
+		t.Fatalf("udp sockets should be active, inherited: %d, active: %d", len(u.inheritedUDP), len(u.activeUDP))
+	}
+
+	u.upgrading = true
+	if _, err := u.listenUDP("127.0.0.1:0"); err != ErrUpgrading {
+		t.Fatalf("expect ErrUpgrading, got %v", err)
+	}
+}
+
+func TestNewUpgradeService(t *testing.T) {
+	if u := newUpgradeService(""); len(u.inherited) != 0 || len(u.inheritedUDP) != 0 {
+		t.Fatalf("unexpected inherited sockets: %v, %v", u.inherited, u.inheritedUDP)
+	}
+}
+
+func TestUpgradeKeepConsoleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "console.sock")
+	l, err := listenConsole(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgrader.Lock()
+	upgrader.upgrading = true
+	upgrader.Unlock()
+	defer func() {
+		upgrader.Lock()
+		upgrader.upgrading = false
+		upgrader.Unlock()
+	}()
+
+	closeConsole(l)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("socket file should be kept for the new process: %v", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	c1, _ := net.Pipe()
+	c2, _ := net.Pipe()
+	a1 := transporter.createAgent(c1)
+	a2 := transporter.createAgent(c2)
+	for _, a := range []*agent{a1, a2} {
+		go func(a *agent) {
+			for {
+				select {
+				case fn := <-a.tasks:
+					fn()
+				case <-a.die:
+					return
+				}
+			}
+		}(a)
+	}
+
+	drain(10 * time.Millisecond)
+
+	for _, a := range []*agent{a1, a2} {
+		select {
+		case <-a.die:
+		case <-time.After(time.Second):
+			t.Fatal("session should be closed")
+		}
+	}
+}
@@ -23,9 +23,14 @@ package starx
 import (
 	"bytes"
 	"encoding/gob"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
 
 	"github.com/lonnng/starx/log"
-	"os"
+	"github.com/lonnng/starx/metrics"
+	"github.com/lonnng/starx/session"
 )
 
 func serializeOrRaw(v interface{}) ([]byte, error) {
@@ -34,7 +39,7 @@ func serializeOrRaw(v interface{}) ([]byte, error) {
 	}
 	data, err := serializer.Serialize(v)
 	if err != nil {
-		log.Errorf(err.Error())
+		log.Error(err.Error())
 		return nil, err
 	}
 	return data, nil
@@ -56,3 +61,41 @@ func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	return err == nil || os.IsExist(err)
 }
+
+// sessionLogger returns a log entry with the contextual fields of the session
+func sessionLogger(s *session.Session) *log.Entry {
+	fields := log.Fields{"sid": s.ID, "uid": s.Uid}
+	if app.config != nil {
+		fields["server"] = app.config.Id
+	}
+	if s.TraceID != "" {
+		fields["trace"] = s.TraceID
+	}
+	return log.WithFields(fields)
+}
+
+// safeCall calls fn and recovers from panic, used to execute user-define
+// function on logic goroutine
+func safeCall(fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("Invoke function error: %+v", err)
+			os.Stderr.Write(debug.Stack())
+		}
+	}()
+
+	fn()
+}
+
+// countReader counts bytes read from the underlying reader
+type countReader struct {
+	io.Reader
+	n *int64 // bytes read of the connection
+}
+
+func (r countReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	metrics.BytesReceived.Add(int64(n))
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
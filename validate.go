@@ -0,0 +1,90 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+
+	"github.com/lonnng/starx/session"
+)
+
+// Validator checks the message of route after deserialized and before the
+// handler called, the message will be refused and a bad request error will be
+// responded if any error returned. Return a *ValidationError to respond the
+// invalid fields to client, e.g. anti-cheat sanity checks of moves:
+//
+//	starx.Validate("Player.Move", func(s *session.Session, v interface{}) error {
+//		m := v.(*MoveRequest)
+//		if m.Speed > maxSpeed {
+//			return starx.InvalidField("speed", "too fast")
+//		}
+//		return nil
+//	})
+//
+// v is the deserialized message, []byte for handlers of raw data
+type Validator func(s *session.Session, v interface{}) error
+
+// FieldError represents an invalid field of message
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError represents the invalid fields of message, which are
+// responded to client in the error envelope and never hidden
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// InvalidField returns a validation error of the field
+func InvalidField(field, reason string) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Reason: reason}}}
+}
+
+// Add append an invalid field to the error, returns the error itself
+func (e *ValidationError) Add(field, reason string) *ValidationError {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: reason})
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString("invalid message")
+	for i, f := range e.Fields {
+		if i == 0 {
+			buf.WriteString(": ")
+		} else {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(f.Field + " " + f.Reason)
+	}
+	return buf.String()
+}
+
+// validate run the validators of route, the first error returned
+func validate(route string, s *session.Session, v interface{}) error {
+	for _, fn := range env.validators[route] {
+		if err := fn(s, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
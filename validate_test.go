@@ -0,0 +1,103 @@
+package starx
+
+import (
+	encjson "encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/serialize/json"
+	"github.com/lonnng/starx/session"
+)
+
+type MoveRequest struct {
+	X, Y  int
+	Speed int
+}
+
+type ValidateComp struct {
+	component.Base
+	moves chan *MoveRequest
+}
+
+func (c *ValidateComp) Move(s *session.Session, m *MoveRequest) error {
+	c.moves <- m
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	SetSerializer(json.NewSerializer())
+	c := &ValidateComp{moves: make(chan *MoveRequest, 1)}
+	handler.register(c)
+	defer handler.unregister("ValidateComp")
+
+	Validate("ValidateComp.Move", func(s *session.Session, v interface{}) error {
+		m := v.(*MoveRequest)
+		if m.Speed > 10 {
+			return InvalidField("speed", "too fast")
+		}
+		return nil
+	})
+	Validate("ValidateComp.Move", func(s *session.Session, v interface{}) error {
+		m := v.(*MoveRequest)
+		var e *ValidationError
+		if m.X < 0 {
+			e = InvalidField("x", "out of map")
+		}
+		if m.Y < 0 {
+			if e == nil {
+				e = &ValidationError{}
+			}
+			e.Add("y", "out of map")
+		}
+		if e != nil {
+			return e
+		}
+		return nil
+	})
+	defer func() { env.validators = nil }()
+
+	conn, _ := net.Pipe()
+	a := newAgent(conn)
+	defer a.Close()
+
+	move := func(data string) *Error {
+		handler.processMessage(a.session, &message.Message{Type: message.Request, ID: 6, Route: "ValidateComp.Move", Data: []byte(data)})
+		select {
+		case <-c.moves:
+			return nil
+		default:
+		}
+		p, _, _ := packet.Unpack(<-a.sendBuffer)
+		m, err := message.Decode(p.Data)
+		if err != nil || !m.Error {
+			t.Fatalf("expect error response, got %v, %v", m, err)
+		}
+		e := &Error{}
+		if err := encjson.Unmarshal(m.Data, e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	if e := move(`{"X":1,"Y":1,"Speed":5}`); e != nil {
+		t.Fatalf("valid message should be handled, got %+v", e)
+	}
+
+	e := move(`{"X":1,"Y":1,"Speed":50}`)
+	if e == nil || e.Code != CodeBadRequest || !reflect.DeepEqual(e.Fields, []FieldError{{"speed", "too fast"}}) {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	// invalid fields are responded even if error details hidden
+	env.hideErrorDetails = true
+	defer func() { env.hideErrorDetails = false }()
+	e = move(`{"X":-1,"Y":-1,"Speed":5}`)
+	expect := []FieldError{{"x", "out of map"}, {"y", "out of map"}}
+	if e == nil || !reflect.DeepEqual(e.Fields, expect) || e.Msg != "invalid message: x out of map, y out of map" {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+}
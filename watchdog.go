@@ -0,0 +1,100 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/metrics"
+)
+
+func slowThreshold() time.Duration {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+
+	return env.slowThreshold
+}
+
+// watchHandler start watching the handler call of the route in current
+// goroutine, a warning with the stack of the goroutine will be logged if the
+// handler runs longer than slow threshold, the returned function should be
+// called after the handler returned
+func watchHandler(route string, size int) func() {
+	threshold := slowThreshold()
+	if threshold <= 0 {
+		return func() {}
+	}
+
+	start := time.Now()
+	gid := goroutineID()
+	logger := log.WithFields(log.Fields{"route": route, "size": size})
+	timer := time.AfterFunc(threshold, func() {
+		metrics.SlowHandlers.Inc()
+		logger.Warnf("handler running longer than %v, stack:\n%s", threshold, goroutineStack(gid))
+	})
+	return func() {
+		if !timer.Stop() {
+			logger.Warnf("slow handler returned after %v", time.Since(start))
+		}
+	}
+}
+
+// goroutineID returns the id of current goroutine, parsed from the header of
+// stack trace, e.g. "goroutine 18 [running]:"
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+// goroutineStack returns the stack trace of the goroutine, empty if the
+// goroutine not found
+func goroutineStack(id uint64) []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	header := []byte("goroutine " + strconv.FormatUint(id, 10) + " [")
+	i := bytes.Index(buf, header)
+	if i < 0 {
+		return nil
+	}
+	stack := buf[i:]
+	if j := bytes.Index(stack, []byte("\n\n")); j > 0 {
+		stack = stack[:j]
+	}
+	return stack
+}
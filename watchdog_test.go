@@ -0,0 +1,39 @@
+package starx
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/metrics"
+)
+
+func TestGoroutineStack(t *testing.T) {
+	id := goroutineID()
+	if id == 0 {
+		t.Fatal("goroutine id should be parsed")
+	}
+	stack := goroutineStack(id)
+	if !bytes.Contains(stack, []byte("TestGoroutineStack")) {
+		t.Fatalf("stack of current goroutine expected, got:\n%s", stack)
+	}
+	if bytes.Contains(stack, []byte("\n\n")) {
+		t.Fatal("stack should only contain one goroutine")
+	}
+}
+
+func TestWatchHandler(t *testing.T) {
+	SetSlowHandlerThreshold(10 * time.Millisecond)
+	defer SetSlowHandlerThreshold(0)
+
+	n := metrics.SlowHandlers.Value()
+	done := watchHandler("Test.Fast", 0)
+	done()
+
+	done = watchHandler("Test.Slow", 16)
+	time.Sleep(50 * time.Millisecond)
+	done()
+	if d := metrics.SlowHandlers.Value() - n; d != 1 {
+		t.Fatalf("expect 1 slow handler, got %d", d)
+	}
+}
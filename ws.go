@@ -23,10 +23,12 @@ package starx
 import (
 	"io"
 	"net"
+	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/packet"
 )
 
 // wsConn is an adapter to t.Conn, which implements all t.Conn
@@ -138,10 +140,40 @@ func (c *wsConn) SetWriteDeadline(t time.Time) error {
 }
 
 func (hs *handlerService) HandleWS(conn *websocket.Conn) {
+	hs.handleWS(conn, nil)
+}
+
+func (hs *handlerService) handleWS(conn *websocket.Conn, codec packet.Codec) {
 	c, err := newWSConn(conn)
 	if err != nil {
 		log.Error(err)
 		return
 	}
-	hs.handle(c)
+	hs.handleCodec(c, codec)
+}
+
+// wsHandler upgrade the http connections to websocket, and handle them with
+// the packet codec, nil means the default codec
+func wsHandler(codec packet.Codec) http.HandlerFunc {
+	var upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     env.checkOrigin,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !acceptRequest(r) {
+			log.Debugf("connection from %s refused by filter", r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		handler.handleWS(conn, codec)
+	}
 }